@@ -0,0 +1,780 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// Alert Types
+// ============================================================================
+
+// Supported alert metrics
+const (
+	AlertMetricCPU         = "cpu"
+	AlertMetricMemory      = "memory"
+	AlertMetricSwap        = "swap"
+	AlertMetricDisk        = "disk"
+	AlertMetricLoad1       = "load_1"
+	AlertMetricLoad5       = "load_5"
+	AlertMetricLoad15      = "load_15"
+	AlertMetricNetRx       = "net_rx"
+	AlertMetricNetTx       = "net_tx"
+	AlertMetricPingLatency = "ping_latency"
+	AlertMetricPingLoss    = "ping_loss"
+)
+
+// Alert states
+const (
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+)
+
+// alertOfflineResolveAfter resolves alerts of servers that stay offline this long
+const alertOfflineResolveAfter = 30 * time.Minute
+
+var alertMetrics = map[string]bool{
+	AlertMetricCPU:         true,
+	AlertMetricMemory:      true,
+	AlertMetricSwap:        true,
+	AlertMetricDisk:        true,
+	AlertMetricLoad1:       true,
+	AlertMetricLoad5:       true,
+	AlertMetricLoad15:      true,
+	AlertMetricNetRx:       true,
+	AlertMetricNetTx:       true,
+	AlertMetricPingLatency: true,
+	AlertMetricPingLoss:    true,
+}
+
+var alertOperators = map[string]bool{
+	"gt":  true,
+	"gte": true,
+	"lt":  true,
+	"lte": true,
+	"eq":  true,
+	"ne":  true,
+}
+
+// AlertRule defines a threshold condition evaluated against live agent metrics
+type AlertRule struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Metric       string   `json:"metric"`                 // cpu, memory, disk, load_1, ping_latency, ...
+	Operator     string   `json:"operator"`               // gt, gte, lt, lte, eq, ne
+	Threshold    float64  `json:"threshold"`              // Value compared against the metric
+	DurationSecs int      `json:"duration_secs"`          // Condition must hold this long before firing
+	CooldownSecs int      `json:"cooldown_secs"`          // Minimum time between two firings for the same server
+	ServerIDs    []string `json:"server_ids,omitempty"`   // Explicit server scope (empty = all servers)
+	DimensionID  string   `json:"dimension_id,omitempty"` // Group dimension scope
+	OptionID     string   `json:"option_id,omitempty"`    // Group option scope (requires dimension_id)
+	Channels     []string `json:"channels,omitempty"`     // Notification channel IDs (empty = all enabled channels)
+	Enabled      bool     `json:"enabled"`
+	CreatedAt    string   `json:"created_at"`
+	UpdatedAt    string   `json:"updated_at"`
+}
+
+// AlertEvent is a row of the alert history table
+type AlertEvent struct {
+	ID            string   `json:"id"`
+	RuleID        string   `json:"rule_id"`
+	RuleName      string   `json:"rule_name"`
+	ServerID      string   `json:"server_id"`
+	ServerName    string   `json:"server_name"`
+	Metric        string   `json:"metric"`
+	Operator      string   `json:"operator"`
+	Threshold     float64  `json:"threshold"`
+	Value         float64  `json:"value"`
+	Status        string   `json:"status"`
+	FiredAt       string   `json:"fired_at"`
+	ResolvedAt    *string  `json:"resolved_at,omitempty"`
+	ResolvedValue *float64 `json:"resolved_value,omitempty"`
+}
+
+// alertStateKey identifies the evaluation state of one rule on one server
+type alertStateKey struct {
+	RuleID   string
+	ServerID string
+}
+
+// alertState tracks pending/firing status between evaluation cycles
+type alertState struct {
+	PendingSince time.Time
+	OfflineSince time.Time
+	Firing       bool
+	Event        *AlertEvent
+	LastFiredAt  time.Time
+	LastValue    float64
+}
+
+// alertTarget is a server snapshot handed to the engine on every cycle
+type alertTarget struct {
+	ServerID    string
+	ServerName  string
+	GroupValues map[string]string
+	Online      bool
+	Metrics     *SystemMetrics
+	Maintenance bool // In a maintenance window, so new alerts don't fire
+	PingOnly    bool // Only its ping targets are in a maintenance window
+}
+
+// ============================================================================
+// Alert Engine
+// ============================================================================
+
+// AlertEngine evaluates alert rules and persists firing/resolved transitions
+type AlertEngine struct {
+	db       *sql.DB
+	notifier *NotificationDispatcher
+	mu       sync.Mutex
+	rules    []AlertRule
+	states   map[alertStateKey]*alertState
+}
+
+// NewAlertEngine creates the engine and restores rules and firing alerts from the database
+func NewAlertEngine(db *sql.DB, notifier *NotificationDispatcher) *AlertEngine {
+	e := &AlertEngine{
+		db:       db,
+		notifier: notifier,
+		states:   make(map[alertStateKey]*alertState),
+	}
+
+	if err := e.ReloadRules(); err != nil {
+		fmt.Printf("⚠️  Failed to load alert rules: %v\n", err)
+	}
+
+	// Restore firing alerts so a restart doesn't produce duplicate events
+	firing, err := queryAlertHistory(db, AlertHistoryFilter{Status: AlertStatusFiring, Limit: 10000})
+	if err != nil {
+		fmt.Printf("⚠️  Failed to restore firing alerts: %v\n", err)
+	}
+	for i := range firing {
+		ev := firing[i]
+		firedAt, _ := time.Parse(time.RFC3339, ev.FiredAt)
+		e.states[alertStateKey{RuleID: ev.RuleID, ServerID: ev.ServerID}] = &alertState{
+			Firing:      true,
+			Event:       &ev,
+			LastFiredAt: firedAt,
+			LastValue:   ev.Value,
+		}
+	}
+
+	if len(e.rules) > 0 {
+		fmt.Printf("🚨 Alert engine loaded: %d rules, %d firing\n", len(e.rules), len(firing))
+	}
+
+	return e
+}
+
+// ReloadRules reloads the rule set from the database
+func (e *AlertEngine) ReloadRules() error {
+	rules, err := listAlertRules(e.db)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Drop state for rules that no longer exist or were disabled, resolving their alerts
+	active := make(map[string]bool)
+	for _, r := range rules {
+		if r.Enabled {
+			active[r.ID] = true
+		}
+	}
+	for key, st := range e.states {
+		if active[key.RuleID] {
+			continue
+		}
+		if st.Firing {
+			e.resolve(st, e.ruleByID(key.RuleID), st.LastValue, now)
+		}
+		delete(e.states, key)
+	}
+	e.rules = rules
+	return nil
+}
+
+// Rules returns a copy of the current rule set
+func (e *AlertEngine) Rules() []AlertRule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rules := make([]AlertRule, len(e.rules))
+	copy(rules, e.rules)
+	return rules
+}
+
+// ActiveAlerts returns all currently firing alerts
+func (e *AlertEngine) ActiveAlerts() []AlertEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	active := []AlertEvent{}
+	for _, st := range e.states {
+		if st.Firing && st.Event != nil {
+			ev := *st.Event
+			ev.Value = st.LastValue
+			active = append(active, ev)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].FiredAt > active[j].FiredAt
+	})
+	return active
+}
+
+// ResolveRule resolves every firing alert of a rule (used when the rule is deleted or disabled)
+func (e *AlertEngine) ResolveRule(ruleID string) {
+	now := time.Now().UTC()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for key, st := range e.states {
+		if key.RuleID != ruleID {
+			continue
+		}
+		if st.Firing && st.Event != nil {
+			e.resolve(st, e.ruleByID(ruleID), st.LastValue, now)
+		}
+		delete(e.states, key)
+	}
+}
+
+// Evaluate checks all enabled rules against the given server snapshots.
+// Alerts of servers that were removed or left the scope of their rule are resolved.
+func (e *AlertEngine) Evaluate(targets []alertTarget, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	matched := make(map[alertStateKey]bool)
+	for _, rule := range e.rules {
+		if !rule.Enabled {
+			continue
+		}
+
+		for _, target := range targets {
+			if !rule.appliesTo(target) {
+				continue
+			}
+
+			key := alertStateKey{RuleID: rule.ID, ServerID: target.ServerID}
+			matched[key] = true
+			st := e.states[key]
+
+			// Stale metrics can't confirm or clear a condition, so only reset pending state
+			// until the server has been gone long enough to give up on it
+			if !target.Online || target.Metrics == nil {
+				if st == nil {
+					continue
+				}
+				st.PendingSince = time.Time{}
+				if st.OfflineSince.IsZero() {
+					st.OfflineSince = now
+				}
+				if st.Firing && now.Sub(st.OfflineSince) >= alertOfflineResolveAfter {
+					e.resolve(st, &rule, st.LastValue, now)
+				}
+				continue
+			}
+
+			value, ok := alertMetricValue(rule.Metric, target.Metrics)
+			if !ok {
+				continue
+			}
+
+			if st == nil {
+				st = &alertState{}
+				e.states[key] = st
+			}
+			st.LastValue = value
+			st.OfflineSince = time.Time{}
+
+			if compareAlertValue(value, rule.Operator, rule.Threshold) {
+				if st.Firing {
+					continue
+				}
+				if target.Maintenance && (!target.PingOnly || isPingAlertMetric(rule.Metric)) {
+					st.PendingSince = time.Time{}
+					continue
+				}
+				if st.PendingSince.IsZero() {
+					st.PendingSince = now
+				}
+				if now.Sub(st.PendingSince) < time.Duration(rule.DurationSecs)*time.Second {
+					continue
+				}
+				if !st.LastFiredAt.IsZero() && now.Sub(st.LastFiredAt) < time.Duration(rule.CooldownSecs)*time.Second {
+					continue
+				}
+				e.fire(st, &rule, &target, value, now)
+			} else {
+				st.PendingSince = time.Time{}
+				if st.Firing {
+					e.resolve(st, &rule, value, now)
+				}
+			}
+		}
+	}
+
+	for key, st := range e.states {
+		if matched[key] {
+			continue
+		}
+		if st.Firing {
+			e.resolve(st, e.ruleByID(key.RuleID), st.LastValue, now)
+		}
+		delete(e.states, key)
+	}
+}
+
+// fire records a firing transition (must hold e.mu)
+func (e *AlertEngine) fire(st *alertState, rule *AlertRule, target *alertTarget, value float64, now time.Time) {
+	ev := &AlertEvent{
+		ID:         uuid.New().String(),
+		RuleID:     rule.ID,
+		RuleName:   rule.Name,
+		ServerID:   target.ServerID,
+		ServerName: target.ServerName,
+		Metric:     rule.Metric,
+		Operator:   rule.Operator,
+		Threshold:  rule.Threshold,
+		Value:      value,
+		Status:     AlertStatusFiring,
+		FiredAt:    now.Format(time.RFC3339),
+	}
+
+	st.Firing = true
+	st.Event = ev
+	st.LastFiredAt = now
+	st.PendingSince = time.Time{}
+
+	fmt.Printf("🚨 Alert firing: %s on %s (%s = %.2f)\n", rule.Name, target.ServerName, rule.Metric, value)
+
+	copied := *ev
+	if dbWriter != nil {
+		dbWriter.WriteAsync(func(db *sql.DB) error {
+			return insertAlertEvent(db, &copied)
+		})
+	}
+
+	e.notifier.Dispatch(&Notification{
+		Event:      NotifyEventAlertFiring,
+		Severity:   SeverityWarning,
+		Title:      fmt.Sprintf("%s firing on %s", rule.Name, target.ServerName),
+		Message:    fmt.Sprintf("%s is %.2f (%s %s)", rule.Metric, value, alertOperatorSymbol(rule.Operator), formatAlertValue(rule.Threshold)),
+		ServerID:   target.ServerID,
+		ServerName: target.ServerName,
+		Fields:     alertNotificationFields(ev),
+		Time:       ev.FiredAt,
+	}, rule.Channels)
+}
+
+// resolve records a resolved transition (must hold e.mu); rule may be nil if it was already removed
+func (e *AlertEngine) resolve(st *alertState, rule *AlertRule, value float64, now time.Time) {
+	ev := st.Event
+	st.Firing = false
+	st.Event = nil
+
+	if ev == nil {
+		return
+	}
+
+	resolvedAt := now.Format(time.RFC3339)
+	ev.Status = AlertStatusResolved
+	ev.ResolvedAt = &resolvedAt
+	ev.ResolvedValue = &value
+
+	fmt.Printf("✅ Alert resolved: %s on %s\n", ev.RuleName, ev.ServerName)
+
+	id := ev.ID
+	if dbWriter != nil {
+		dbWriter.WriteAsync(func(db *sql.DB) error {
+			_, err := db.Exec(`UPDATE alert_history SET status = ?, resolved_at = ?, resolved_value = ? WHERE id = ?`,
+				AlertStatusResolved, resolvedAt, value, id)
+			return err
+		})
+	}
+
+	var channels []string
+	if rule != nil {
+		channels = rule.Channels
+	}
+	e.notifier.Dispatch(&Notification{
+		Event:      NotifyEventAlertResolved,
+		Severity:   SeverityResolved,
+		Title:      fmt.Sprintf("%s resolved on %s", ev.RuleName, ev.ServerName),
+		Message:    fmt.Sprintf("%s is back to %.2f", ev.Metric, value),
+		ServerID:   ev.ServerID,
+		ServerName: ev.ServerName,
+		Fields:     alertNotificationFields(ev),
+		Time:       resolvedAt,
+	}, channels)
+}
+
+// ruleByID looks up a loaded rule (must hold e.mu)
+func (e *AlertEngine) ruleByID(id string) *AlertRule {
+	for i := range e.rules {
+		if e.rules[i].ID == id {
+			return &e.rules[i]
+		}
+	}
+	return nil
+}
+
+// alertNotificationFields exposes the alert event to notification templates
+func alertNotificationFields(ev *AlertEvent) map[string]string {
+	return map[string]string{
+		"alert_id":  ev.ID,
+		"rule_id":   ev.RuleID,
+		"rule_name": ev.RuleName,
+		"metric":    ev.Metric,
+		"operator":  ev.Operator,
+		"threshold": formatAlertValue(ev.Threshold),
+		"value":     formatAlertValue(ev.Value),
+		"fired_at":  ev.FiredAt,
+	}
+}
+
+func alertOperatorSymbol(operator string) string {
+	switch operator {
+	case "gt":
+		return ">"
+	case "gte":
+		return ">="
+	case "lt":
+		return "<"
+	case "lte":
+		return "<="
+	case "eq":
+		return "=="
+	case "ne":
+		return "!="
+	}
+	return operator
+}
+
+func formatAlertValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// appliesTo checks the rule scope against a server
+func (r *AlertRule) appliesTo(target alertTarget) bool {
+	if len(r.ServerIDs) > 0 {
+		found := false
+		for _, id := range r.ServerIDs {
+			if id == target.ServerID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.DimensionID != "" {
+		optionID, ok := target.GroupValues[r.DimensionID]
+		if !ok {
+			return false
+		}
+		if r.OptionID != "" && optionID != r.OptionID {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Validate checks that a rule is well-formed
+func (r *AlertRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !alertMetrics[r.Metric] {
+		return fmt.Errorf("unsupported metric: %s", r.Metric)
+	}
+	if !alertOperators[r.Operator] {
+		return fmt.Errorf("unsupported operator: %s", r.Operator)
+	}
+	if r.DurationSecs < 0 || r.CooldownSecs < 0 {
+		return fmt.Errorf("duration and cooldown must not be negative")
+	}
+	if r.OptionID != "" && r.DimensionID == "" {
+		return fmt.Errorf("option_id requires dimension_id")
+	}
+	return nil
+}
+
+// alertMetricValue extracts the value of an alert metric from a metrics snapshot
+func alertMetricValue(metric string, m *SystemMetrics) (float64, bool) {
+	switch metric {
+	case AlertMetricCPU:
+		return float64(m.CPU.Usage), true
+	case AlertMetricMemory:
+		return float64(m.Memory.UsagePercent), true
+	case AlertMetricSwap:
+		if m.Memory.SwapTotal == 0 {
+			return 0, false
+		}
+		return float64(m.Memory.SwapUsed) * 100 / float64(m.Memory.SwapTotal), true
+	case AlertMetricDisk:
+		// Use the fullest disk so any filling volume triggers the rule
+		if len(m.Disks) == 0 {
+			return 0, false
+		}
+		var max float32
+		for _, d := range m.Disks {
+			if d.UsagePercent > max {
+				max = d.UsagePercent
+			}
+		}
+		return float64(max), true
+	case AlertMetricLoad1:
+		return m.LoadAverage.One, true
+	case AlertMetricLoad5:
+		return m.LoadAverage.Five, true
+	case AlertMetricLoad15:
+		return m.LoadAverage.Fifteen, true
+	case AlertMetricNetRx:
+		return float64(m.Network.RxSpeed), true
+	case AlertMetricNetTx:
+		return float64(m.Network.TxSpeed), true
+	case AlertMetricPingLatency:
+		if m.Ping == nil {
+			return 0, false
+		}
+		var sum float64
+		var count int
+		for _, t := range m.Ping.Targets {
+			if t.LatencyMs != nil {
+				sum += *t.LatencyMs
+				count++
+			}
+		}
+		if count == 0 {
+			return 0, false
+		}
+		return sum / float64(count), true
+	case AlertMetricPingLoss:
+		// Worst packet loss across all targets
+		if m.Ping == nil || len(m.Ping.Targets) == 0 {
+			return 0, false
+		}
+		var max float64
+		for _, t := range m.Ping.Targets {
+			if t.PacketLoss > max {
+				max = t.PacketLoss
+			}
+		}
+		return max, true
+	}
+	return 0, false
+}
+
+func isPingAlertMetric(metric string) bool {
+	return metric == AlertMetricPingLatency || metric == AlertMetricPingLoss
+}
+
+func compareAlertValue(value float64, operator string, threshold float64) bool {
+	switch operator {
+	case "gt":
+		return value > threshold
+	case "gte":
+		return value >= threshold
+	case "lt":
+		return value < threshold
+	case "lte":
+		return value <= threshold
+	case "eq":
+		return value == threshold
+	case "ne":
+		return value != threshold
+	}
+	return false
+}
+
+// buildAlertTargets assembles the server snapshots evaluated on each broadcast cycle
+func buildAlertTargets(config *AppConfig, agentMetrics map[string]*AgentMetricsData, localMetrics *SystemMetrics, now time.Time) []alertTarget {
+	localName := "Dashboard Server"
+	if config.LocalNode.Name != "" {
+		localName = config.LocalNode.Name
+	}
+
+	targets := make([]alertTarget, 0, len(config.Servers)+1)
+	targets = append(targets, alertTarget{
+		ServerID:    "local",
+		ServerName:  localName,
+		GroupValues: config.LocalNode.GroupValues,
+		Online:      true,
+		Metrics:     localMetrics,
+	})
+
+	for _, server := range config.Servers {
+		target := alertTarget{
+			ServerID:    server.ID,
+			ServerName:  server.Name,
+			GroupValues: server.GroupValues,
+		}
+		if metricsData := agentMetrics[server.ID]; metricsData != nil {
+			target.Online = isAgentOnline(&server, metricsData, now)
+			target.Metrics = &metricsData.Metrics
+		}
+		targets = append(targets, target)
+	}
+
+	for i := range targets {
+		server, ping := maintenanceAt(targets[i].ServerID, now)
+		targets[i].Maintenance = server || ping
+		targets[i].PingOnly = !server && ping
+	}
+	return targets
+}
+
+// ============================================================================
+// Alert Persistence
+// ============================================================================
+
+func listAlertRules(db *sql.DB) ([]AlertRule, error) {
+	rows, err := db.Query(`
+		SELECT id, name, metric, operator, threshold, duration_secs, cooldown_secs, server_ids, dimension_id, option_id, channels, enabled, created_at, updated_at
+		FROM alert_rules
+		ORDER BY created_at ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []AlertRule{}
+	for rows.Next() {
+		var r AlertRule
+		var serverIDs, channels string
+		var enabled int
+		if err := rows.Scan(&r.ID, &r.Name, &r.Metric, &r.Operator, &r.Threshold, &r.DurationSecs, &r.CooldownSecs,
+			&serverIDs, &r.DimensionID, &r.OptionID, &channels, &enabled, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if serverIDs != "" {
+			json.Unmarshal([]byte(serverIDs), &r.ServerIDs)
+		}
+		if channels != "" {
+			json.Unmarshal([]byte(channels), &r.Channels)
+		}
+		r.Enabled = enabled == 1
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func saveAlertRule(db *sql.DB, r *AlertRule) error {
+	serverIDs, _ := json.Marshal(r.ServerIDs)
+	if len(r.ServerIDs) == 0 {
+		serverIDs = []byte("")
+	}
+	channels, _ := json.Marshal(r.Channels)
+	if len(r.Channels) == 0 {
+		channels = []byte("")
+	}
+	enabled := 0
+	if r.Enabled {
+		enabled = 1
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO alert_rules (id, name, metric, operator, threshold, duration_secs, cooldown_secs, server_ids, dimension_id, option_id, channels, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name,
+			metric = excluded.metric,
+			operator = excluded.operator,
+			threshold = excluded.threshold,
+			duration_secs = excluded.duration_secs,
+			cooldown_secs = excluded.cooldown_secs,
+			server_ids = excluded.server_ids,
+			dimension_id = excluded.dimension_id,
+			option_id = excluded.option_id,
+			channels = excluded.channels,
+			enabled = excluded.enabled,
+			updated_at = excluded.updated_at`,
+		r.ID, r.Name, r.Metric, r.Operator, r.Threshold, r.DurationSecs, r.CooldownSecs,
+		string(serverIDs), r.DimensionID, r.OptionID, string(channels), enabled, r.CreatedAt, r.UpdatedAt)
+	return err
+}
+
+func deleteAlertRule(db *sql.DB, id string) (bool, error) {
+	res, err := db.Exec(`DELETE FROM alert_rules WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func insertAlertEvent(db *sql.DB, ev *AlertEvent) error {
+	_, err := db.Exec(`
+		INSERT INTO alert_history (id, rule_id, rule_name, server_id, server_name, metric, operator, threshold, value, status, fired_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ev.ID, ev.RuleID, ev.RuleName, ev.ServerID, ev.ServerName, ev.Metric, ev.Operator,
+		ev.Threshold, ev.Value, ev.Status, ev.FiredAt)
+	return err
+}
+
+// AlertHistoryFilter narrows down alert history queries
+type AlertHistoryFilter struct {
+	ServerID string
+	RuleID   string
+	Status   string
+	Limit    int
+	Offset   int
+}
+
+func queryAlertHistory(db *sql.DB, f AlertHistoryFilter) ([]AlertEvent, error) {
+	query := `
+		SELECT id, rule_id, rule_name, server_id, server_name, metric, operator, threshold, value, status, fired_at, resolved_at, resolved_value
+		FROM alert_history WHERE 1=1`
+	var args []interface{}
+	if f.ServerID != "" {
+		query += " AND server_id = ?"
+		args = append(args, f.ServerID)
+	}
+	if f.RuleID != "" {
+		query += " AND rule_id = ?"
+		args = append(args, f.RuleID)
+	}
+	if f.Status != "" {
+		query += " AND status = ?"
+		args = append(args, f.Status)
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	query += " ORDER BY fired_at DESC LIMIT ? OFFSET ?"
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AlertEvent{}
+	for rows.Next() {
+		var ev AlertEvent
+		if err := rows.Scan(&ev.ID, &ev.RuleID, &ev.RuleName, &ev.ServerID, &ev.ServerName, &ev.Metric, &ev.Operator,
+			&ev.Threshold, &ev.Value, &ev.Status, &ev.FiredAt, &ev.ResolvedAt, &ev.ResolvedValue); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+// newTestAlertEngine returns an engine without database or notifier holding rules
+func newTestAlertEngine(rules ...AlertRule) *AlertEngine {
+	return &AlertEngine{rules: rules, states: make(map[alertStateKey]*alertState)}
+}
+
+func cpuTarget(id string, usage float32) alertTarget {
+	m := &SystemMetrics{}
+	m.CPU.Usage = usage
+	return alertTarget{ServerID: id, ServerName: id, Online: true, Metrics: m}
+}
+
+func alertFiring(e *AlertEngine, ruleID, serverID string) bool {
+	st := e.states[alertStateKey{RuleID: ruleID, ServerID: serverID}]
+	return st != nil && st.Firing
+}
+
+func TestAlertEngineLifecycle(t *testing.T) {
+	s := newTestState(t)
+	e := newTestAlertEngine(AlertRule{ID: "r", Name: "cpu", Metric: AlertMetricCPU, Operator: "gt", Threshold: 90,
+		DurationSecs: 60, CooldownSecs: 600, Enabled: true})
+	e.db = s.DB
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	step := func(offset time.Duration, usage float32, want bool) {
+		t.Helper()
+		e.Evaluate([]alertTarget{cpuTarget("a", usage)}, start.Add(offset))
+		if got := alertFiring(e, "r", "a"); got != want {
+			t.Fatalf("at %v with cpu %.0f: firing = %v, want %v", offset, usage, got, want)
+		}
+	}
+
+	step(0, 95, false)              // Pending
+	step(30*time.Second, 50, false) // Back to normal resets the pending time
+	step(40*time.Second, 95, false)
+	step(90*time.Second, 95, false)
+	step(100*time.Second, 95, true) // Held for the whole duration
+	step(5*time.Minute, 50, false)  // Resolved
+	step(6*time.Minute, 95, false)
+	step(8*time.Minute, 95, false) // Within the cooldown of the first firing
+	step(100*time.Second+10*time.Minute, 95, true)
+
+	// History is written asynchronously; a synchronous write waits for it
+	if err := dbWriter.WriteSync(func(*sql.DB) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	events, err := queryAlertHistory(s.DB, AlertHistoryFilter{RuleID: "r"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Status != AlertStatusFiring || events[1].Status != AlertStatusResolved {
+		t.Fatalf("unexpected history: %+v", events)
+	}
+	if events[1].ResolvedValue == nil || *events[1].ResolvedValue != 50 {
+		t.Fatalf("resolved value: %+v", events[1])
+	}
+}
+
+func TestAlertEngineMaintenance(t *testing.T) {
+	e := newTestAlertEngine(
+		AlertRule{ID: "cpu", Name: "cpu", Metric: AlertMetricCPU, Operator: "gt", Threshold: 90, Enabled: true},
+		AlertRule{ID: "ping", Name: "ping", Metric: AlertMetricPingLoss, Operator: "gt", Threshold: 10, Enabled: true},
+	)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	target := cpuTarget("a", 95)
+	target.Metrics.Ping = &PingMetrics{Targets: []PingTarget{{Name: "gw", PacketLoss: 50}}}
+
+	// Only the ping targets are in maintenance
+	target.Maintenance, target.PingOnly = true, true
+	e.Evaluate([]alertTarget{target}, now)
+	if !alertFiring(e, "cpu", "a") || alertFiring(e, "ping", "a") {
+		t.Fatalf("ping-only maintenance: %+v", e.states)
+	}
+
+	// The whole server is in maintenance: firing alerts still resolve, new ones don't fire
+	e = newTestAlertEngine(e.rules...)
+	target.PingOnly = false
+	e.Evaluate([]alertTarget{target}, now)
+	if len(e.states) != 2 || alertFiring(e, "cpu", "a") || alertFiring(e, "ping", "a") {
+		t.Fatalf("server maintenance: %+v", e.states)
+	}
+}
+
+func TestAlertEngineResolvesStaleStates(t *testing.T) {
+	rule := AlertRule{ID: "r", Name: "cpu", Metric: AlertMetricCPU, Operator: "gt", Threshold: 90, Enabled: true}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fire := func(e *AlertEngine, targets ...alertTarget) {
+		t.Helper()
+		e.Evaluate(targets, now)
+		for _, target := range targets {
+			if !alertFiring(e, "r", target.ServerID) {
+				t.Fatalf("%s is not firing", target.ServerID)
+			}
+		}
+	}
+
+	t.Run("server removed", func(t *testing.T) {
+		e := newTestAlertEngine(rule)
+		fire(e, cpuTarget("a", 95), cpuTarget("b", 95))
+		e.Evaluate([]alertTarget{cpuTarget("b", 95)}, now.Add(time.Minute))
+		if _, ok := e.states[alertStateKey{RuleID: "r", ServerID: "a"}]; ok {
+			t.Fatal("state of the removed server was kept")
+		}
+		if !alertFiring(e, "r", "b") {
+			t.Fatal("alert of the remaining server was resolved")
+		}
+	})
+
+	t.Run("server left scope", func(t *testing.T) {
+		scoped := rule
+		scoped.DimensionID, scoped.OptionID = "region", "eu"
+		e := newTestAlertEngine(scoped)
+		target := cpuTarget("a", 95)
+		target.GroupValues = map[string]string{"region": "eu"}
+		fire(e, target)
+		target.GroupValues = map[string]string{"region": "us"}
+		e.Evaluate([]alertTarget{target}, now.Add(time.Minute))
+		if len(e.states) != 0 {
+			t.Fatalf("state kept after the server left the scope: %+v", e.states)
+		}
+	})
+
+	t.Run("server offline", func(t *testing.T) {
+		e := newTestAlertEngine(rule)
+		fire(e, cpuTarget("a", 95))
+		offline := alertTarget{ServerID: "a", ServerName: "a"}
+		e.Evaluate([]alertTarget{offline}, now.Add(time.Minute))
+		if !alertFiring(e, "r", "a") {
+			t.Fatal("alert resolved on a short disconnect")
+		}
+		e.Evaluate([]alertTarget{offline}, now.Add(time.Minute+alertOfflineResolveAfter))
+		if alertFiring(e, "r", "a") {
+			t.Fatal("alert of a server offline for good is still firing")
+		}
+	})
+
+	t.Run("rule removed", func(t *testing.T) {
+		e := newTestAlertEngine(rule)
+		fire(e, cpuTarget("a", 95))
+		e.rules = nil
+		e.Evaluate([]alertTarget{cpuTarget("a", 95)}, now.Add(time.Minute))
+		if len(e.states) != 0 {
+			t.Fatalf("state kept after the rule was removed: %+v", e.states)
+		}
+	})
+}
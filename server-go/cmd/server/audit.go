@@ -0,0 +1,214 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Audit Log
+// ============================================================================
+//
+// Mutating admin handlers record who changed what, with the changed fields before and after.
+// The audit_log table refuses updates and deletes (see migration 0011). Values of fields named
+// like a token, secret or password are replaced with auditRedacted, so rotating a secret shows
+// up as a change without storing it.
+
+const auditRedacted = "[redacted]"
+
+// AuditChange is the value of a field before and after an action; Before is absent for
+// created fields and After for removed ones
+type AuditChange struct {
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	Timestamp  string                 `json:"timestamp"`
+	ActorID    string                 `json:"actor_id"`
+	Actor      string                 `json:"actor"`
+	APITokenID string                 `json:"api_token_id,omitempty"`
+	ClientIP   string                 `json:"client_ip"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id,omitempty"`
+	Changes    map[string]AuditChange `json:"changes"`
+}
+
+// auditSnapshot copies a value as its flattened JSON fields, e.g. github.client_id, so later
+// changes to the value do not affect it. Values that are not JSON objects are kept under "value".
+func auditSnapshot(v interface{}) map[string]interface{} {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil()) {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	if obj, ok := decoded.(map[string]interface{}); ok {
+		flattenAuditFields(fields, "", obj)
+	} else {
+		fields["value"] = decoded
+	}
+	return fields
+}
+
+func flattenAuditFields(fields map[string]interface{}, prefix string, obj map[string]interface{}) {
+	for k, v := range obj {
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenAuditFields(fields, prefix+k+".", nested)
+			continue
+		}
+		fields[prefix+k] = v
+	}
+}
+
+// auditDiff returns the fields that differ between two snapshots; either may be nil
+func auditDiff(before, after map[string]interface{}) map[string]AuditChange {
+	changes := make(map[string]AuditChange)
+	for k, b := range before {
+		a, ok := after[k]
+		if !ok {
+			changes[k] = AuditChange{Before: redactAuditValue(k, b)}
+		} else if !reflect.DeepEqual(a, b) {
+			changes[k] = AuditChange{Before: redactAuditValue(k, b), After: redactAuditValue(k, a)}
+		}
+	}
+	for k, a := range after {
+		if _, ok := before[k]; !ok {
+			changes[k] = AuditChange{After: redactAuditValue(k, a)}
+		}
+	}
+	return changes
+}
+
+func redactAuditValue(field string, v interface{}) interface{} {
+	if s, ok := v.(string); ok && s != "" {
+		name := strings.ToLower(field[strings.LastIndex(field, ".")+1:])
+		if strings.Contains(name, "token") || strings.Contains(name, "secret") || strings.Contains(name, "password") {
+			return auditRedacted
+		}
+	}
+	return v
+}
+
+// recordAudit appends an entry for an action of the authenticated user. before and after are
+// auditSnapshot results; pass nil before for creations and nil after for deletions.
+func (s *AppState) recordAudit(c *gin.Context, action, targetType, targetID string, before, after map[string]interface{}) {
+	entry := AuditEntry{
+		Timestamp:  time.Now().UTC().Format(time.RFC3339),
+		APITokenID: currentAPITokenID(c),
+		ClientIP:   c.ClientIP(),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Changes:    auditDiff(before, after),
+	}
+	if user := currentUser(c); user != nil {
+		entry.ActorID, entry.Actor = user.ID, user.Username
+	}
+	if err := insertAuditEntry(s.DB, &entry); err != nil {
+		fmt.Printf("⚠️  Failed to record audit entry %s %s: %v\n", action, targetID, err)
+	}
+}
+
+func insertAuditEntry(db *sql.DB, e *AuditEntry) error {
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return err
+	}
+	return writeInventory(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO audit_log (timestamp, actor_id, actor, api_token_id, client_ip, action, target_type, target_id, changes)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			e.Timestamp, e.ActorID, e.Actor, e.APITokenID, e.ClientIP, e.Action, e.TargetType, e.TargetID, string(changes))
+		return err
+	})
+}
+
+// AuditFilter narrows down audit log queries
+type AuditFilter struct {
+	Actor      string // username or user ID
+	Action     string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time
+	Limit      int
+	Offset     int
+}
+
+func queryAuditLog(db *sql.DB, f AuditFilter) ([]AuditEntry, error) {
+	query := `SELECT id, timestamp, actor_id, actor, api_token_id, client_ip, action, target_type, target_id, changes
+		FROM audit_log WHERE 1 = 1`
+	args := []interface{}{}
+	if f.Actor != "" {
+		query += " AND (actor = ? COLLATE NOCASE OR actor_id = ?)"
+		args = append(args, f.Actor, f.Actor)
+	}
+	if f.Action != "" {
+		// A prefix such as "server." matches all actions on servers
+		if strings.HasSuffix(f.Action, ".") {
+			query += " AND action LIKE ?"
+			args = append(args, f.Action+"%")
+		} else {
+			query += " AND action = ?"
+			args = append(args, f.Action)
+		}
+	}
+	if f.TargetType != "" {
+		query += " AND target_type = ?"
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		query += " AND target_id = ?"
+		args = append(args, f.TargetID)
+	}
+	if !f.From.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, f.From.UTC().Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		query += " AND timestamp <= ?"
+		args = append(args, f.To.UTC().Format(time.RFC3339))
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var changes string
+		if err := rows.Scan(&e.ID, &e.Timestamp, &e.ActorID, &e.Actor, &e.APITokenID, &e.ClientIP,
+			&e.Action, &e.TargetType, &e.TargetID, &changes); err != nil {
+			return nil, err
+		}
+		e.Changes = map[string]AuditChange{}
+		if changes != "" {
+			json.Unmarshal([]byte(changes), &e.Changes)
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
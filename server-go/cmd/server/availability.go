@@ -0,0 +1,255 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"vstats/internal/common"
+)
+
+// ============================================================================
+// Availability Types
+// ============================================================================
+
+// AvailabilityReport summarizes how available a server was over a time window.
+//
+// Uptime is derived from recorded online/offline events and only covers the part of
+// the window after the server's first recorded transition (MonitoredSecs). Downtime within
+// maintenance windows is reported as PlannedDowntimeSecs and does not count against it.
+// Coverage is the share of expected sample buckets that actually contain metrics; it is
+// used as the availability figure when no connectivity events exist for the window.
+type AvailabilityReport struct {
+	ServerID            string             `json:"server_id"`
+	ServerName          string             `json:"server_name"`
+	From                string             `json:"from"`
+	To                  string             `json:"to"`
+	MonitoredSecs       int64              `json:"monitored_secs"`
+	DowntimeSecs        int64              `json:"downtime_secs"`
+	PlannedDowntimeSecs int64              `json:"planned_downtime_secs"`
+	Incidents           int                `json:"incidents"`
+	UptimePercent       *float64           `json:"uptime_percent"`
+	CoveragePercent     *float64           `json:"coverage_percent"`
+	AvailabilityPercent *float64           `json:"availability_percent"`
+	SLATarget           float64            `json:"sla_target,omitempty"`
+	SLAMet              *bool              `json:"sla_met,omitempty"`
+	PingTargets         []PingAvailability `json:"ping_targets,omitempty"`
+}
+
+// PingAvailability is the reachability of one ping target from a server
+type PingAvailability struct {
+	Name                string   `json:"name"`
+	Host                string   `json:"host"`
+	OkCount             int64    `json:"ok_count"`
+	FailCount           int64    `json:"fail_count"`
+	AvailabilityPercent *float64 `json:"availability_percent"`
+}
+
+// availabilityGranularity maps a window start to the finest table that still holds it
+type availabilityGranularity struct {
+	Name       string
+	BucketSecs int64
+}
+
+// pickAvailabilityGranularity skips the 5-second table, which agents sending only aggregates leave empty
+func pickAvailabilityGranularity(from, now time.Time) availabilityGranularity {
+	age := now.Sub(from)
+	list := historyGranularities()
+	gran := list[len(list)-1]
+	for _, g := range list[1:] {
+		if age <= g.Retention {
+			gran = g
+			break
+		}
+	}
+	return availabilityGranularity{gran.Name, gran.BucketSecs}
+}
+
+// ============================================================================
+// Availability Calculation
+// ============================================================================
+
+// computeAvailability builds the availability report of a server for [from, to].
+// Events are read from db, sample coverage from the metrics storage.
+func computeAvailability(db *sql.DB, st Storage, server *RemoteServer, from, to time.Time, withPing bool) (*AvailabilityReport, error) {
+	now := time.Now().UTC()
+	from = from.UTC()
+	to = to.UTC()
+	if to.After(now) {
+		to = now
+	}
+
+	report := &AvailabilityReport{
+		ServerID:   server.ID,
+		ServerName: server.Name,
+		From:       from.Format(time.RFC3339),
+		To:         to.Format(time.RFC3339),
+		SLATarget:  server.SLATarget,
+	}
+	if !from.Before(to) {
+		return report, nil
+	}
+
+	// Connectivity events only describe the time after the first recorded transition
+	var firstEvent sql.NullString
+	if err := db.QueryRow(`SELECT MIN(timestamp) FROM server_events WHERE server_id = ? AND type IN (?, ?)`,
+		server.ID, ServerEventOnline, ServerEventOffline).Scan(&firstEvent); err != nil {
+		return nil, err
+	}
+
+	if firstEvent.Valid {
+		monitoredFrom := from
+		if first, err := time.Parse(time.RFC3339, firstEvent.String); err == nil && first.After(from) {
+			monitoredFrom = first
+		}
+
+		if monitoredFrom.Before(to) {
+			intervals, err := queryDowntime(db, server.ID, monitoredFrom, to)
+			if err != nil {
+				return nil, err
+			}
+			report.MonitoredSecs = int64(to.Sub(monitoredFrom).Seconds())
+			for _, iv := range intervals {
+				report.DowntimeSecs += iv.DurationSecs - iv.PlannedSecs
+				report.PlannedDowntimeSecs += iv.PlannedSecs
+				if !iv.Planned {
+					report.Incidents++
+				}
+			}
+			if report.DowntimeSecs > report.MonitoredSecs {
+				report.DowntimeSecs = report.MonitoredSecs
+			}
+			if report.MonitoredSecs > 0 {
+				report.UptimePercent = percentOf(report.MonitoredSecs-report.DowntimeSecs, report.MonitoredSecs)
+			}
+		}
+	}
+
+	gran := pickAvailabilityGranularity(from, now)
+	coverage, err := sampleCoverage(st, gran, server.ID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	report.CoveragePercent = coverage
+
+	// Without events, coverage stands in for uptime; no samples at all means unknown, not 0%
+	report.AvailabilityPercent = report.UptimePercent
+	if report.AvailabilityPercent == nil && report.CoveragePercent != nil && *report.CoveragePercent > 0 {
+		report.AvailabilityPercent = report.CoveragePercent
+	}
+
+	if report.SLATarget > 0 && report.AvailabilityPercent != nil {
+		met := *report.AvailabilityPercent >= report.SLATarget
+		report.SLAMet = &met
+	}
+
+	if withPing {
+		targets, err := pingAvailability(st, gran, server.ID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		report.PingTargets = targets
+	}
+
+	return report, nil
+}
+
+// sampleCoverage returns the share of expected buckets in [from, to) that contain samples
+func sampleCoverage(st Storage, gran availabilityGranularity, serverID string, from, to time.Time) (*float64, error) {
+	startBucket := from.Unix() / gran.BucketSecs
+	endBucket := (to.Unix() + gran.BucketSecs - 1) / gran.BucketSecs
+	expected := endBucket - startBucket
+	if expected <= 0 {
+		return nil, nil
+	}
+
+	var present int64
+	err := st.ScanMetricBuckets(serverID, gran.Name, startBucket, endBucket-1, func(b *common.BucketData) error {
+		if b.SampleCount > 0 {
+			present++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return percentOf(present, expected), nil
+}
+
+// pingAvailability returns the success ratio of every ping target in [from, to)
+func pingAvailability(st Storage, gran availabilityGranularity, serverID string, from, to time.Time) ([]PingAvailability, error) {
+	targets := []PingAvailability{}
+	// Buckets arrive ordered by target, so consecutive buckets share a target
+	err := st.ScanPingBuckets(serverID, gran.Name, from.Unix()/gran.BucketSecs, (to.Unix()+gran.BucketSecs-1)/gran.BucketSecs-1, func(p *common.PingBucketData) error {
+		if len(targets) == 0 || targets[len(targets)-1].Name != p.TargetName {
+			targets = append(targets, PingAvailability{Name: p.TargetName})
+		}
+		t := &targets[len(targets)-1]
+		t.Host = max(t.Host, p.TargetHost)
+		t.OkCount += int64(p.OkCount)
+		t.FailCount += int64(p.FailCount)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range targets {
+		t := &targets[i]
+		t.AvailabilityPercent = percentOf(t.OkCount, t.OkCount+t.FailCount)
+	}
+	return targets, nil
+}
+
+func percentOf(part, total int64) *float64 {
+	if total <= 0 {
+		return nil
+	}
+	p := float64(part) * 100 / float64(total)
+	return &p
+}
+
+// ============================================================================
+// Daily Uptime Rollup
+// ============================================================================
+
+// FillDailyUptime writes the availability of each server for the given UTC day into
+// metrics_daily.uptime_percent. The other columns belong to the daily aggregation; days it has
+// not reached yet get a row with empty metrics, which it replaces later.
+func FillDailyUptime(db *sql.DB, st Storage, servers []RemoteServer, day time.Time) error {
+	dayStart := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+	dayEnd := dayStart.Add(24 * time.Hour)
+	date := dayStart.Format("2006-01-02")
+
+	uptimes := make(map[string]float64)
+	for i := range servers {
+		server := &servers[i]
+		report, err := computeAvailability(db, st, server, dayStart, dayEnd, false)
+		if err != nil {
+			return err
+		}
+		if report.AvailabilityPercent != nil {
+			uptimes[server.ID] = *report.AvailabilityPercent
+		}
+	}
+
+	if len(uptimes) == 0 {
+		return nil
+	}
+
+	write := func(db *sql.DB) error {
+		for serverID, uptime := range uptimes {
+			if _, err := db.Exec(`
+				INSERT INTO metrics_daily (server_id, date, cpu_avg, cpu_max, memory_avg, memory_max, disk_avg, net_rx_total, net_tx_total, uptime_percent, sample_count)
+				VALUES (?, ?, 0, 0, 0, 0, 0, 0, 0, ?, 0)
+				ON CONFLICT(server_id, date) DO UPDATE SET uptime_percent = excluded.uptime_percent`,
+				serverID, date, uptime); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if dbWriter != nil {
+		return dbWriter.WriteSync(write)
+	}
+	return write(db)
+}
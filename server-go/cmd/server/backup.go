@@ -0,0 +1,438 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Backup & Restore
+// ============================================================================
+//
+// A backup is a .tar.gz archive with an online snapshot of the SQLite database
+// (VACUUM INTO, safe while the server is writing), the config file and a manifest.
+// Metrics kept in PostgreSQL are not included; back them up with pg_dump.
+
+const (
+	backupDBName       = "vstats.db"
+	backupConfigName   = "vstats-config.json"
+	backupManifestName = "manifest.json"
+	backupFilePrefix   = "vstats-backup-"
+	backupFileSuffix   = ".tar.gz"
+)
+
+// BackupManifest describes the contents of a backup archive
+type BackupManifest struct {
+	ServerVersion string `json:"server_version"`
+	SchemaVersion int    `json:"schema_version"`
+	StorageDriver string `json:"storage_driver"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// backupFileName names an archive after its creation time, so names sort chronologically
+func backupFileName(t time.Time) string {
+	return backupFilePrefix + t.UTC().Format("20060102-150405") + backupFileSuffix
+}
+
+// WriteBackup snapshots db and writes the archive to w. Nothing is written to w
+// when the snapshot fails, so callers can still report the error.
+func WriteBackup(db *sql.DB, config []byte, storageDriver string, w io.Writer) error {
+	snapshot, err := snapshotDatabase(db)
+	if err != nil {
+		return fmt.Errorf("database snapshot failed: %w", err)
+	}
+	defer os.Remove(snapshot)
+
+	schemaVersion := 0
+	if applied, err := appliedMigrations(db); err == nil {
+		for version := range applied {
+			schemaVersion = max(schemaVersion, version)
+		}
+	}
+	manifest, _ := json.MarshalIndent(BackupManifest{
+		ServerVersion: ServerVersion,
+		SchemaVersion: schemaVersion,
+		StorageDriver: storageDriver,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+	}, "", "  ")
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeTarBytes(tw, backupManifestName, manifest); err != nil {
+		return err
+	}
+	if err := writeTarBytes(tw, backupConfigName, config); err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, backupDBName, snapshot); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// snapshotDatabase copies the live database into a temporary file next to it
+func snapshotDatabase(db *sql.DB) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(GetDBPath()), ".vstats-snapshot-*.db")
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+	f.Close()
+	os.Remove(path) // VACUUM INTO requires a path that does not exist yet
+
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+func writeTarBytes(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func writeTarFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0600, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// WriteBackupFile writes an archive to path atomically
+func WriteBackupFile(db *sql.DB, config []byte, storageDriver, path string) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := WriteBackup(db, config, storageDriver, f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// RestoreBackup replaces the database and config with the contents of an archive.
+// The replaced files are kept with a ".before-restore" suffix. The server must be stopped.
+func RestoreBackup(archive string) (*BackupManifest, error) {
+	dbPath, configPath := GetDBPath(), GetConfigPath()
+	tmpDB, tmpConfig := dbPath+".restore", configPath+".restore"
+	defer os.Remove(tmpDB)
+	defer os.Remove(tmpConfig)
+
+	manifest, err := extractBackup(archive, map[string]string{backupDBName: tmpDB, backupConfigName: tmpConfig})
+	if err != nil {
+		return nil, err
+	}
+	if manifest.SchemaVersion > LatestSchemaVersion() {
+		return nil, fmt.Errorf("backup has schema version %d, newer than this server supports (%d)", manifest.SchemaVersion, LatestSchemaVersion())
+	}
+	if err := checkDatabaseFile(tmpDB); err != nil {
+		return nil, fmt.Errorf("backup database is damaged: %w", err)
+	}
+	var config AppConfig
+	data, err := os.ReadFile(tmpConfig)
+	if err == nil {
+		err = json.Unmarshal(data, &config)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("backup config is invalid: %w", err)
+	}
+
+	// Move the current files aside; WAL files of the old database must not be applied to the new one
+	for _, path := range []string{dbPath, dbPath + "-wal", dbPath + "-shm", configPath} {
+		if fileExists(path) {
+			if err := os.Rename(path, path+".before-restore"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := os.Rename(tmpDB, dbPath); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmpConfig, configPath); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// extractBackup writes the archive members named in targets to their paths and returns the manifest
+func extractBackup(archive string, targets map[string]string) (*BackupManifest, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+
+	var manifest *BackupManifest
+	found := make(map[string]bool)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a backup archive: %w", err)
+		}
+
+		if hdr.Name == backupManifestName {
+			manifest = &BackupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+		path, ok := targets[hdr.Name]
+		if !ok {
+			continue
+		}
+		out, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(out, tr)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, err
+		}
+		found[hdr.Name] = true
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("not a backup archive: %s missing", backupManifestName)
+	}
+	for name := range targets {
+		if !found[name] {
+			return nil, fmt.Errorf("backup archive is missing %s", name)
+		}
+	}
+	return manifest, nil
+}
+
+func checkDatabaseFile(path string) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("%s", result)
+	}
+	return nil
+}
+
+// ============================================================================
+// Scheduled Backups
+// ============================================================================
+
+// Effective returns the settings with defaults applied
+func (b BackupSettings) Effective() BackupSettings {
+	if b.Dir == "" {
+		b.Dir = filepath.Join(filepath.Dir(GetDBPath()), "backups")
+	}
+	if b.IntervalHours <= 0 {
+		b.IntervalHours = 24
+	}
+	if b.Keep <= 0 {
+		b.Keep = 7
+	}
+	return b
+}
+
+// listBackups returns the archives in dir, oldest first
+func listBackups(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	names := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), backupFilePrefix) && strings.HasSuffix(e.Name(), backupFileSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// backupLoop writes scheduled backups and removes archives beyond the configured count.
+// The newest archive's name tells when the last backup ran, so restarts do not reset the schedule.
+func backupLoop(state *AppState) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		state.ConfigMu.RLock()
+		settings := state.Config.Backup.Effective()
+		state.ConfigMu.RUnlock()
+
+		if settings.Enabled {
+			if err := runScheduledBackup(state, settings, time.Now().UTC()); err != nil {
+				fmt.Printf("Failed to write scheduled backup: %v\n", err)
+			}
+		}
+
+		<-ticker.C
+	}
+}
+
+func runScheduledBackup(state *AppState, settings BackupSettings, now time.Time) error {
+	existing := listBackups(settings.Dir)
+	if n := len(existing); n > 0 {
+		last, err := time.Parse("20060102-150405", strings.TrimSuffix(strings.TrimPrefix(existing[n-1], backupFilePrefix), backupFileSuffix))
+		if err == nil && now.Sub(last) < time.Duration(settings.IntervalHours)*time.Hour {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(settings.Dir, 0700); err != nil {
+		return err
+	}
+	config, err := state.configSnapshot(true)
+	if err != nil {
+		return err
+	}
+	name := backupFileName(now)
+	if err := WriteBackupFile(state.DB, config, metricsStore.Driver(), filepath.Join(settings.Dir, name)); err != nil {
+		return err
+	}
+	fmt.Printf("💾 Backup written: %s\n", filepath.Join(settings.Dir, name))
+
+	// Rotate
+	existing = listBackups(settings.Dir)
+	for i := 0; i < len(existing)-settings.Keep; i++ {
+		os.Remove(filepath.Join(settings.Dir, existing[i]))
+	}
+	return nil
+}
+
+// configSnapshot serializes the current config file the way SaveBootstrapConfig writes it;
+// everything else is part of the database snapshot. Without the JWT secret, a server restored
+// from the snapshot generates a new one, which ends all sessions.
+func (s *AppState) configSnapshot(withJWTSecret bool) ([]byte, error) {
+	s.ConfigMu.RLock()
+	bootstrap := s.Config.Bootstrap()
+	s.ConfigMu.RUnlock()
+	if !withJWTSecret {
+		bootstrap.JWTSecret = ""
+	}
+	return json.MarshalIndent(bootstrap, "", "  ")
+}
+
+// ============================================================================
+// Backup & Restore Commands
+// ============================================================================
+
+// runBackupCommand implements `vstats-server backup <file>`
+func runBackupCommand(args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: vstats-server backup <file.tar.gz>")
+	}
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if !fileExists(GetDBPath()) {
+		fmt.Fprintf(os.Stderr, "❌ Database not found: %s\n", GetDBPath())
+		return 1
+	}
+	config, err := os.ReadFile(GetConfigPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to read config %s: %v\n", GetConfigPath(), err)
+		return 1
+	}
+	var parsed AppConfig
+	if err := json.Unmarshal(config, &parsed); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to read config %s: %v\n", GetConfigPath(), err)
+		return 1
+	}
+
+	db, err := sql.Open("sqlite", GetDBPath()+"?_busy_timeout=5000")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	driver := parsed.Storage.Resolve().Driver
+	if err := WriteBackupFile(db, config, driver, fs.Arg(0)); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ Backup written to %s\n", fs.Arg(0))
+	if driver != StorageDriverSQLite {
+		fmt.Println("⚠️  Metrics history is stored in PostgreSQL and is not part of this backup")
+	}
+	return 0
+}
+
+// runRestoreCommand implements `vstats-server restore <file>`
+func runRestoreCommand(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: vstats-server restore <file.tar.gz>  (stop the server first)")
+	}
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	manifest, err := RestoreBackup(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ Restored backup from %s (server %s, schema version %d)\n", manifest.CreatedAt, manifest.ServerVersion, manifest.SchemaVersion)
+	fmt.Printf("   Database: %s\n", GetDBPath())
+	fmt.Printf("   Config: %s\n", GetConfigPath())
+	fmt.Println("   Previous files were kept with the .before-restore suffix")
+	return 0
+}
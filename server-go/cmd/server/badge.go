@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ============================================================================
+// SVG Badges
+// ============================================================================
+//
+// Badges follow the flat style of shields.io so they sit next to other README badges: a grey
+// label on the left and a colored value on the right, in 11px Verdana.
+
+const (
+	BadgeBrightGreen = "#4c1"
+	BadgeGreen       = "#97ca00"
+	BadgeYellow      = "#dfb317"
+	BadgeOrange      = "#fe7d37"
+	BadgeRed         = "#e05d44"
+	BadgeBlue        = "#007ec6"
+	BadgeGrey        = "#9f9f9f"
+
+	badgeLabelColor = "#555"
+	badgeMaxText    = 64 // Runes of a custom label
+)
+
+// badgeCharWidths are the advances of 11px Verdana for the characters badges mostly show;
+// other characters count as badgeDefaultWidth
+var badgeCharWidths = map[rune]float64{
+	' ': 3.9, '!': 4.3, '%': 12.3, '(': 5.0, ')': 5.0, ',': 3.9, '-': 4.9, '.': 3.9, '/': 5.4,
+	':': 4.6, '_': 7.0, '|': 4.9,
+	'0': 7.0, '1': 7.0, '2': 7.0, '3': 7.0, '4': 7.0, '5': 7.0, '6': 7.0, '7': 7.0, '8': 7.0, '9': 7.0,
+	'a': 6.7, 'b': 6.9, 'c': 5.8, 'd': 6.9, 'e': 6.6, 'f': 3.9, 'g': 6.9, 'h': 7.0, 'i': 3.0,
+	'j': 3.8, 'k': 6.5, 'l': 3.0, 'm': 10.7, 'n': 7.0, 'o': 6.7, 'p': 6.9, 'q': 6.9, 'r': 4.7,
+	's': 5.7, 't': 4.3, 'u': 7.0, 'v': 6.5, 'w': 9.0, 'x': 6.5, 'y': 6.5, 'z': 5.8,
+	'I': 4.6, 'M': 9.5, 'W': 10.9,
+}
+
+const (
+	badgeDefaultWidth = 7.5 // Upper case letters and anything not in the table
+	badgePadding      = 10  // Horizontal space around each text
+)
+
+func badgeTextWidth(text string) float64 {
+	width := 0.0
+	for _, r := range text {
+		if w, ok := badgeCharWidths[r]; ok {
+			width += w
+		} else {
+			width += badgeDefaultWidth
+		}
+	}
+	return math.Ceil(width)
+}
+
+// badgeLabel shortens a label taken from the request
+func badgeLabel(label string) string {
+	label = strings.TrimSpace(label)
+	if utf8.RuneCountInString(label) > badgeMaxText {
+		label = string([]rune(label)[:badgeMaxText])
+	}
+	return label
+}
+
+// renderBadge returns a badge showing value in color next to label
+func renderBadge(label, value, color string) []byte {
+	labelWidth := badgeTextWidth(label) + badgePadding
+	valueWidth := badgeTextWidth(value) + badgePadding
+	if label == "" {
+		labelWidth = 0
+	}
+	total := labelWidth + valueWidth
+	title := html.EscapeString(value)
+	if label != "" {
+		title = html.EscapeString(label) + ": " + title
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="20" role="img" aria-label="%s">`, total, title)
+	fmt.Fprintf(&b, `<title>%s</title>`, title)
+	b.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%g" height="20" rx="3" fill="#fff"/></clipPath>`, total)
+	fmt.Fprintf(&b, `<g clip-path="url(#r)"><rect width="%g" height="20" fill="%s"/>`, labelWidth, badgeLabelColor)
+	fmt.Fprintf(&b, `<rect x="%g" width="%g" height="20" fill="%s"/>`, labelWidth, valueWidth, color)
+	fmt.Fprintf(&b, `<rect width="%g" height="20" fill="url(#s)"/></g>`, total)
+	b.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" text-rendering="geometricPrecision" font-size="11">`)
+	if label != "" {
+		writeBadgeText(&b, labelWidth/2, label)
+	}
+	writeBadgeText(&b, labelWidth+valueWidth/2, value)
+	b.WriteString(`</g></svg>`)
+	return []byte(b.String())
+}
+
+// writeBadgeText writes text centered at x with the shadow of the flat style
+func writeBadgeText(b *strings.Builder, x float64, text string) {
+	text = html.EscapeString(text)
+	fmt.Fprintf(b, `<text x="%g" y="15" fill="#010101" fill-opacity=".3">%s</text>`, x, text)
+	fmt.Fprintf(b, `<text x="%g" y="14">%s</text>`, x, text)
+}
+
+// formatBadgePercent shows a percentage with at most two decimals, rounded down so that
+// 99.999% does not read as 100%
+func formatBadgePercent(p float64) string {
+	return strconv.FormatFloat(math.Floor(p*100)/100, 'f', -1, 64) + "%"
+}
+
+// uptimeBadgeColor grades availability the way uptime badges usually do
+func uptimeBadgeColor(p float64) string {
+	switch {
+	case p >= 99.9:
+		return BadgeBrightGreen
+	case p >= 99:
+		return BadgeGreen
+	case p >= 97:
+		return BadgeYellow
+	case p >= 95:
+		return BadgeOrange
+	default:
+		return BadgeRed
+	}
+}
+
+func cpuBadgeColor(usage float64) string {
+	switch {
+	case usage < 50:
+		return BadgeBrightGreen
+	case usage < 80:
+		return BadgeYellow
+	default:
+		return BadgeRed
+	}
+}
+
+func latencyBadgeColor(ms float64) string {
+	switch {
+	case ms < 50:
+		return BadgeBrightGreen
+	case ms < 100:
+		return BadgeGreen
+	case ms < 200:
+		return BadgeYellow
+	case ms < 400:
+		return BadgeOrange
+	default:
+		return BadgeRed
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBadgeVisibility(t *testing.T) {
+	s := newTestState(t)
+	s.Config.Servers = []RemoteServer{{ID: "a", Name: "web-1"}, {ID: "b", Name: "db-1", Hidden: true}}
+	admin, _ := getUserByUsername(s.DB, "admin")
+	route := func(r *gin.Engine) { r.GET("/badge/:server_id/:badge", s.GetBadge) }
+	notFound := serveTest(route, http.MethodGet, "/badge/unknown/status.svg", "")
+
+	cases := []struct {
+		name         string
+		target       string
+		bearer       string
+		code         int
+		cacheControl string
+		value        string
+	}{
+		{"visible server", "/badge/a/status.svg", "", http.StatusOK, "public, max-age=30", "offline"},
+		{"cpu of offline server", "/badge/a/cpu.svg", "", http.StatusOK, "public, max-age=30", "offline"},
+		{"unknown badge", "/badge/a/memory.svg", "", http.StatusNotFound, "no-cache", "not found"},
+		{"invalid range", "/badge/a/uptime.svg?range=1y", "", http.StatusBadRequest, "no-cache", "invalid range"},
+		{"hidden server", "/badge/b/status.svg", "", http.StatusNotFound, "no-cache", "not found"},
+		{"hidden server with token", "/badge/b/status.svg?token=" + newTestToken(t, s, admin, ScopeMetricsRead), "", http.StatusOK, "private, max-age=30", "offline"},
+		{"hidden server with other scope", "/badge/b/status.svg?token=" + newTestToken(t, s, admin, ScopeAlertsRead), "", http.StatusNotFound, "no-cache", "not found"},
+		{"hidden server with session", "/badge/b/status.svg", newTestSession(t, s, admin), http.StatusOK, "private, max-age=30", "offline"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serveTest(route, http.MethodGet, tc.target, tc.bearer)
+			if w.Code != tc.code || w.Header().Get("Cache-Control") != tc.cacheControl {
+				t.Fatalf("%d %q, want %d %q", w.Code, w.Header().Get("Cache-Control"), tc.code, tc.cacheControl)
+			}
+			if !strings.Contains(w.Body.String(), ">"+tc.value+"<") {
+				t.Fatalf("badge does not show %q: %s", tc.value, w.Body)
+			}
+		})
+	}
+
+	// A hidden server cannot be told apart from an unknown one
+	hidden := serveTest(route, http.MethodGet, "/badge/b/status.svg", "")
+	if hidden.Body.String() != notFound.Body.String() || hidden.Header().Get("ETag") != notFound.Header().Get("ETag") {
+		t.Fatal("hidden server badge differs from the unknown server badge")
+	}
+}
+
+func TestBadgeRevalidation(t *testing.T) {
+	s := newTestState(t)
+	s.Config.Servers = []RemoteServer{{ID: "a", Name: "web-1"}}
+	r := gin.New()
+	r.GET("/badge/:server_id/:badge", s.GetBadge)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/badge/a/status.svg?label=<b>", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || strings.Contains(w.Body.String(), "<b>") {
+		t.Fatalf("%d %q: %s", w.Code, etag, w.Body)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/badge/a/status.svg?label=<b>", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("revalidation: %d %s", w.Code, w.Body)
+	}
+}
@@ -2,12 +2,14 @@ package main
 
 import (
 	"crypto/rand"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"math/big"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"vstats/internal/common"
 	"golang.org/x/crypto/bcrypt"
@@ -34,6 +36,34 @@ type LocalNodeConfig struct {
 	PricePeriod  string            `json:"price_period,omitempty"`
 	PurchaseDate string            `json:"purchase_date,omitempty"`
 	TipBadge     string            `json:"tip_badge,omitempty"`
+	Hidden       bool              `json:"hidden,omitempty"` // Not shown to visitors who are not logged in
+}
+
+// VisibilitySettings controls what visitors who are not logged in see of the servers on the
+// public dashboard endpoints; logged-in users always see everything
+type VisibilitySettings struct {
+	MaskIP            bool `json:"mask_ip"`             // Show only the network part of IP addresses
+	HideHostname      bool `json:"hide_hostname"`       // Hostname reported by the agent
+	HideSystemDetails bool `json:"hide_system_details"` // Kernel version, disk models and serials, MAC addresses
+	HidePrices        bool `json:"hide_prices"`         // Price and purchase date
+}
+
+// StatusPageSettings configures the public status page (see status.go)
+type StatusPageSettings struct {
+	Enabled     bool              `json:"enabled"`
+	Title       string            `json:"title,omitempty"` // Default: the site name
+	Description string            `json:"description,omitempty"`
+	PageURL     string            `json:"page_url,omitempty"` // Where subscribers are sent from feed items (default: /api/status)
+	Components  []StatusComponent `json:"components"`
+}
+
+// StatusComponent is an entry of the status page, backed by a server or one of its ping targets
+type StatusComponent struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	ServerID    string `json:"server_id"`             // "local" for the dashboard server
+	PingTarget  string `json:"ping_target,omitempty"` // Name of a ping target of the server; empty for the server itself
 }
 
 // BackgroundConfig represents background settings for the site theme
@@ -88,6 +118,124 @@ type OAuthConfig struct {
 	// Self-hosted OAuth configuration (optional, for advanced users)
 	GitHub *OAuthProvider `json:"github,omitempty"`
 	Google *OAuthProvider `json:"google,omitempty"`
+
+	// Generic OpenID Connect provider (Keycloak, Authentik, ...), available with either mode
+	OIDC *OIDCProvider `json:"oidc,omitempty"`
+}
+
+// OIDCProvider configures login through any OpenID Connect issuer. Accounts are matched by
+// email: an account linked to a user logs in as that user, and accounts passing the allow-lists
+// get a new user with DefaultRole on their first login.
+type OIDCProvider struct {
+	Enabled        bool     `json:"enabled"`
+	DisplayName    string   `json:"display_name,omitempty"` // Login button label (default "SSO")
+	Issuer         string   `json:"issuer"`                 // Endpoints are discovered from <issuer>/.well-known/openid-configuration
+	ClientID       string   `json:"client_id"`
+	ClientSecret   string   `json:"client_secret"`             // Empty for public clients, which rely on PKCE alone
+	Scopes         []string `json:"scopes,omitempty"`          // Default: openid email profile
+	AllowedUsers   []string `json:"allowed_users,omitempty"`   // Emails
+	AllowedDomains []string `json:"allowed_domains,omitempty"` // Email domains, e.g. example.com
+	AllowedGroups  []string `json:"allowed_groups,omitempty"`  // Values of the groups claim
+	GroupsClaim    string   `json:"groups_claim,omitempty"`    // ID token claim listing the groups (default "groups")
+	DefaultRole    Role     `json:"default_role,omitempty"`    // Role of users created on first login (default viewer)
+}
+
+// Notification channel types
+const (
+	ChannelTypeWebhook  = "webhook"
+	ChannelTypeEmail    = "email"
+	ChannelTypeTelegram = "telegram"
+	ChannelTypeSlack    = "slack"
+	ChannelTypeDiscord  = "discord"
+)
+
+// NotificationSettings configures outgoing notification channels
+type NotificationSettings struct {
+	Channels      []NotificationChannel `json:"channels"`
+	MaxRetries    int                   `json:"max_retries,omitempty"`     // Retries after the first attempt (default 3)
+	RetryBaseSecs int                   `json:"retry_base_secs,omitempty"` // Initial backoff, doubled on every retry (default 2)
+}
+
+// NotificationChannel is a single delivery target; only the block matching Type is used
+type NotificationChannel struct {
+	ID       string                    `json:"id"`
+	Name     string                    `json:"name"`
+	Type     string                    `json:"type"` // webhook, email, telegram, slack, discord
+	Enabled  bool                      `json:"enabled"`
+	Webhook  *WebhookChannelConfig     `json:"webhook,omitempty"`
+	Email    *EmailChannelConfig       `json:"email,omitempty"`
+	Telegram *TelegramChannelConfig    `json:"telegram,omitempty"`
+	Chat     *ChatWebhookChannelConfig `json:"chat,omitempty"` // Slack and Discord incoming webhooks
+}
+
+// WebhookChannelConfig posts a rendered body to an arbitrary URL
+type WebhookChannelConfig struct {
+	URL          string            `json:"url"`
+	Method       string            `json:"method,omitempty"`        // Default POST
+	Headers      map[string]string `json:"headers,omitempty"`       // Extra request headers (e.g. Authorization)
+	ContentType  string            `json:"content_type,omitempty"`  // Default application/json
+	BodyTemplate string            `json:"body_template,omitempty"` // Go text/template, default is the notification as JSON
+}
+
+// EmailChannelConfig delivers notifications over SMTP
+type EmailChannelConfig struct {
+	Host     string   `json:"host"`
+	Port     int      `json:"port"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+	TLSMode  string   `json:"tls_mode,omitempty"` // starttls (default), tls, none
+}
+
+// TelegramChannelConfig delivers notifications through a Telegram bot
+type TelegramChannelConfig struct {
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+	APIBase  string `json:"api_base,omitempty"` // Default https://api.telegram.org
+}
+
+// ChatWebhookChannelConfig is a Slack or Discord compatible incoming webhook
+type ChatWebhookChannelConfig struct {
+	URL      string `json:"url"`
+	Username string `json:"username,omitempty"`
+}
+
+// PrometheusSettings controls the /metrics exporter
+type PrometheusSettings struct {
+	Enabled     bool   `json:"enabled"`
+	BearerToken string `json:"bearer_token,omitempty"` // Required as "Authorization: Bearer <token>" when set
+}
+
+// BackupSettings schedules automatic backup archives
+type BackupSettings struct {
+	Enabled       bool   `json:"enabled"`
+	Dir           string `json:"dir,omitempty"`            // Default: "backups" next to the database
+	IntervalHours int    `json:"interval_hours,omitempty"` // Default: 24
+	Keep          int    `json:"keep,omitempty"`           // Archives to keep, default 7
+}
+
+// StorageSettings selects the metrics storage backend; VSTATS_DB_DRIVER and VSTATS_DATABASE_URL override it
+type StorageSettings struct {
+	Driver      string `json:"driver,omitempty"`       // "sqlite" (default) or "postgres"
+	DatabaseURL string `json:"database_url,omitempty"` // PostgreSQL connection URL
+}
+
+// RetentionPolicy sets how long each history granularity is kept; 0 inherits the parent value
+type RetentionPolicy struct {
+	RawHours   int `json:"raw_hours,omitempty"`   // metrics_raw, ping_raw
+	Sec5Hours  int `json:"5sec_hours,omitempty"`  // metrics_5sec, ping_5sec
+	Min2Hours  int `json:"2min_hours,omitempty"`  // metrics_2min, ping_2min
+	Min15Days  int `json:"15min_days,omitempty"`  // metrics_15min_agg, ping_15min_agg (and legacy 15min tables)
+	HourlyDays int `json:"hourly_days,omitempty"` // metrics_hourly_agg, ping_hourly_agg (and legacy hourly tables)
+	DailyDays  int `json:"daily_days,omitempty"`  // metrics_daily_agg, ping_daily_agg, server_events
+}
+
+// RetentionSettings holds the default policy and its overrides
+type RetentionSettings struct {
+	Default RetentionPolicy            `json:"default"`
+	Groups  map[string]RetentionPolicy `json:"groups,omitempty"`  // Group option ID -> policy
+	Servers map[string]RetentionPolicy `json:"servers,omitempty"` // Server ID -> policy
 }
 
 // GroupDimension represents a grouping dimension (e.g., Region, Purpose)
@@ -130,19 +278,47 @@ type RemoteServer struct {
 	PricePeriod  string            `json:"price_period,omitempty"`
 	PurchaseDate string            `json:"purchase_date,omitempty"`
 	TipBadge     string            `json:"tip_badge,omitempty"`
+	// Seconds without metrics before the server is considered offline (0 = DefaultOfflineGraceSecs)
+	OfflineGraceSecs int `json:"offline_grace_secs,omitempty"`
+	// Availability promised by the provider in percent (e.g. 99.9), used for SLA reports
+	SLATarget float64 `json:"sla_target,omitempty"`
+	// Not shown to visitors who are not logged in
+	Hidden bool `json:"hidden,omitempty"`
 }
 
+// DefaultOfflineGraceSecs is how long a server may stay silent before it is reported offline
+const DefaultOfflineGraceSecs = 30
+
+// OfflineGrace returns the heartbeat-loss grace period of the server
+func (s *RemoteServer) OfflineGrace() time.Duration {
+	if s.OfflineGraceSecs > 0 {
+		return time.Duration(s.OfflineGraceSecs) * time.Second
+	}
+	return DefaultOfflineGraceSecs * time.Second
+}
+
+// AppConfig is the complete configuration. Only the bootstrap part lives in the config file
+// (see BootstrapConfig); the rest is stored in the database. The JSON tags describe the
+// config file format of older versions, which is imported once (see LoadConfig).
 type AppConfig struct {
-	AdminPasswordHash string           `json:"admin_password_hash"`
-	JWTSecret         string           `json:"jwt_secret"`
-	Port              string           `json:"port,omitempty"`
-	Servers           []RemoteServer   `json:"servers"`
-	Groups            []ServerGroup    `json:"groups,omitempty"` // Deprecated, for backward compatibility
-	GroupDimensions   []GroupDimension `json:"group_dimensions,omitempty"`
-	SiteSettings      SiteSettings     `json:"site_settings"`
-	LocalNode         LocalNodeConfig  `json:"local_node"`
-	ProbeSettings     ProbeSettings    `json:"probe_settings"`
-	OAuth             *OAuthConfig     `json:"oauth,omitempty"`
+	AdminPasswordHash string               `json:"admin_password_hash"`
+	JWTSecret         string               `json:"jwt_secret"`
+	Port              string               `json:"port,omitempty"`
+	DBPath            string               `json:"db_path,omitempty"`
+	Servers           []RemoteServer       `json:"servers"`
+	Groups            []ServerGroup        `json:"groups,omitempty"` // Deprecated, for backward compatibility
+	GroupDimensions   []GroupDimension     `json:"group_dimensions,omitempty"`
+	SiteSettings      SiteSettings         `json:"site_settings"`
+	LocalNode         LocalNodeConfig      `json:"local_node"`
+	ProbeSettings     ProbeSettings        `json:"probe_settings"`
+	OAuth             *OAuthConfig         `json:"oauth,omitempty"`
+	Notifications     NotificationSettings `json:"notifications"`
+	Prometheus        PrometheusSettings   `json:"prometheus"`
+	Retention         RetentionSettings    `json:"retention"`
+	Storage           StorageSettings      `json:"storage"`
+	Backup            BackupSettings       `json:"backup"`
+	Visibility        VisibilitySettings   `json:"visibility"`
+	StatusPage        StatusPageSettings   `json:"status_page"`
 }
 
 func getExeDir() string {
@@ -166,9 +342,45 @@ func GetDBPath() string {
 	if dbPath := os.Getenv("VSTATS_DB_PATH"); dbPath != "" {
 		return dbPath
 	}
+	if config, err := readConfigFile(); err == nil && config != nil && config.DBPath != "" {
+		return config.DBPath
+	}
 	return filepath.Join(getExeDir(), DBFilename)
 }
 
+// BootstrapConfig is what the config file holds: the settings needed before the database is open
+type BootstrapConfig struct {
+	JWTSecret string          `json:"jwt_secret"`
+	Port      string          `json:"port,omitempty"`
+	DBPath    string          `json:"db_path,omitempty"`
+	Storage   StorageSettings `json:"storage"`
+}
+
+func (c *AppConfig) Bootstrap() BootstrapConfig {
+	return BootstrapConfig{
+		JWTSecret: c.JWTSecret,
+		Port:      c.Port,
+		DBPath:    c.DBPath,
+		Storage:   c.Storage,
+	}
+}
+
+// readConfigFile parses the config file; it returns nil without an error when there is none
+func readConfigFile() (*AppConfig, error) {
+	data, err := os.ReadFile(GetConfigPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config AppConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
 func GetJWTSecret() string {
 	jwtSecretMu.RLock()
 	defer jwtSecretMu.RUnlock()
@@ -261,101 +473,195 @@ func (c *AppConfig) ResetPassword() string {
 	return password
 }
 
-func LoadConfig() (*AppConfig, *string) {
+// LoadConfig reads the bootstrap settings from the config file and everything else from the
+// database. Config files of older versions still hold servers and settings; these are imported
+// into the database once and the file is rewritten with the bootstrap settings only.
+func LoadConfig(db *sql.DB) (*AppConfig, *string, error) {
 	path := GetConfigPath()
 	fmt.Printf("📂 Loading config from: %s\n", path)
 
-	if _, err := os.Stat(path); err == nil {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			fmt.Printf("⚠️  Failed to read config: %v, using defaults\n", err)
-			config, password := NewAppConfigWithRandomPassword()
-			SaveConfig(config)
-			InitJWTSecret(config.JWTSecret)
-			return config, &password
-		}
+	fileConfig, err := readConfigFile()
+	if err != nil {
+		fmt.Printf("⚠️  Failed to read config: %v, using defaults\n", err)
+		fileConfig = nil
+	}
+	config := &AppConfig{}
+	if fileConfig != nil {
+		config = fileConfig
+	}
 
-		var config AppConfig
-		if err := json.Unmarshal(data, &config); err != nil {
-			fmt.Printf("⚠️  Failed to parse config: %v, using defaults\n", err)
-			newConfig, password := NewAppConfigWithRandomPassword()
-			SaveConfig(newConfig)
-			InitJWTSecret(newConfig.JWTSecret)
-			return newConfig, &password
+	var initialPassword *string
+	found, err := LoadInventory(db, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load settings from database: %w", err)
+	}
+	switch {
+	case found:
+	case config.AdminPasswordHash != "" || len(config.Servers) > 0:
+		fmt.Printf("📦 Importing %d server(s) and settings from %s into the database\n", len(config.Servers), path)
+		if err := SaveInventory(db, config); err != nil {
+			return nil, nil, fmt.Errorf("failed to import config: %w", err)
 		}
+		// Keep the original file next to the rewritten one
+		if data, err := os.ReadFile(path); err == nil {
+			os.WriteFile(path+".imported", data, 0600)
+		}
+	default:
+		// First run - generate random password
+		newConfig, password := NewAppConfigWithRandomPassword()
+		newConfig.Port, newConfig.DBPath, newConfig.Storage = config.Port, config.DBPath, config.Storage
+		if config.JWTSecret != "" {
+			newConfig.JWTSecret = config.JWTSecret
+		}
+		config, initialPassword = newConfig, &password
+		if err := SaveInventory(db, config); err != nil {
+			return nil, nil, fmt.Errorf("failed to save initial settings: %w", err)
+		}
+	}
 
+	// The admin password only seeds the admin user (see EnsureAdminUser). Once users exist, logins
+	// check the users table and --reset-password is the way to recover an account.
+	users, err := countUsers(db)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	if users == 0 {
 		// Verify password hash looks valid
 		if len(config.AdminPasswordHash) < 4 || config.AdminPasswordHash[:3] != "$2a" && config.AdminPasswordHash[:3] != "$2b" {
 			fmt.Println("⚠️  Invalid password hash format, regenerating...")
-			password := GenerateRandomString(16)
-			hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-			config.AdminPasswordHash = string(hash)
-			SaveConfig(&config)
+			password := config.ResetPassword()
+			if err := SaveSettings(db, config, SettingAdminPasswordHash); err != nil {
+				return nil, nil, err
+			}
 			fmt.Printf("🔑 New password: %s\n", password)
-		} else {
+		} else if initialPassword == nil {
 			fmt.Printf("✅ Password hash loaded (%d chars)\n", len(config.AdminPasswordHash))
 		}
+	}
 
-		// Ensure jwt_secret exists
-		if config.JWTSecret == "" {
-			config.JWTSecret = GenerateRandomString(64)
-			SaveConfig(&config)
-		}
+	// Ensure jwt_secret exists
+	if config.JWTSecret == "" {
+		config.JWTSecret = GenerateRandomString(64)
+	}
 
-		// Initialize default group dimensions if not present
-		if len(config.GroupDimensions) == 0 {
-			config.GroupDimensions = GetDefaultGroupDimensions()
-			SaveConfig(&config)
-			fmt.Println("✅ Initialized default group dimensions")
+	// Initialize default group dimensions if not present
+	if len(config.GroupDimensions) == 0 {
+		config.GroupDimensions = GetDefaultGroupDimensions()
+		if err := SaveGrouping(db, config); err != nil {
+			return nil, nil, err
 		}
+		fmt.Println("✅ Initialized default group dimensions")
+	}
 
-		InitJWTSecret(config.JWTSecret)
-		return &config, nil
+	// Single-user versions only had the admin password
+	if err := EnsureAdminUser(db, config); err != nil {
+		return nil, nil, fmt.Errorf("failed to create admin user: %w", err)
 	}
 
-	// First run - generate random password
-	config, password := NewAppConfigWithRandomPassword()
-	SaveConfig(config)
+	if fileConfig == nil || fileConfig.Bootstrap() != config.Bootstrap() || !isBootstrapOnly(path) {
+		SaveBootstrapConfig(config)
+	}
 	InitJWTSecret(config.JWTSecret)
-	return config, &password
+	if err := PruneSessions(db, config.JWTSecret); err != nil {
+		return nil, nil, fmt.Errorf("failed to prune sessions: %w", err)
+	}
+	return config, initialPassword, nil
 }
 
-func ResetAdminPassword() string {
-	path := GetConfigPath()
-	var config *AppConfig
-
-	if _, err := os.Stat(path); err == nil {
-		data, err := os.ReadFile(path)
-		if err == nil {
-			var c AppConfig
-			if json.Unmarshal(data, &c) == nil {
-				config = &c
-			}
+// isBootstrapOnly reports whether the config file holds nothing but bootstrap settings
+func isBootstrapOnly(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return false
+	}
+	for key := range fields {
+		switch key {
+		case "jwt_secret", "port", "db_path", "storage":
+		default:
+			return false
 		}
 	}
+	return true
+}
 
-	if config == nil {
-		config, _ = NewAppConfigWithRandomPassword()
+// ResetAdminPassword sets a new random password for the named user, or the first admin when
+// username is empty, in the database of this installation
+func ResetAdminPassword(username string) (*User, string, error) {
+	db, err := InitDatabase()
+	if err != nil {
+		return nil, "", err
 	}
+	defer db.Close()
 
-	password := config.ResetPassword()
+	user, err := findUserForReset(db, username)
+	if err != nil {
+		return nil, "", err
+	}
 
-	// Ensure JWT secret exists before saving
-	if config.JWTSecret == "" {
-		config.JWTSecret = GenerateRandomString(64)
+	password := GenerateRandomString(16)
+	if err := user.SetPassword(password); err != nil {
+		return nil, "", err
+	}
+	user.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := SaveUser(db, user); err != nil {
+		return nil, "", err
+	}
+	if _, err := RevokeUserSessions(db, user.ID); err != nil {
+		return nil, "", err
 	}
+	return user, password, nil
+}
 
-	SaveConfig(config)
+// ResetUserTOTP turns off two-factor authentication for the named user, or the first admin when
+// username is empty, for users who lost their authenticator device and recovery codes
+func ResetUserTOTP(username string) (*User, bool, error) {
+	db, err := InitDatabase()
+	if err != nil {
+		return nil, false, err
+	}
+	defer db.Close()
 
-	// Re-initialize JWT secret in case server is running
-	InitJWTSecret(config.JWTSecret)
+	user, err := findUserForReset(db, username)
+	if err != nil {
+		return nil, false, err
+	}
+	found, err := DisableUserTOTP(db, user.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	return user, found, nil
+}
 
-	return password
+// findUserForReset loads the config (creating the admin user on a fresh install) and returns
+// the named user, or the first admin when username is empty
+func findUserForReset(db *sql.DB, username string) (*User, error) {
+	if _, _, err := LoadConfig(db); err != nil {
+		return nil, err
+	}
+	var user *User
+	var err error
+	if username == "" {
+		user, err = firstAdmin(db)
+	} else {
+		user, err = getUserByUsername(db, username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %q not found", username)
+	}
+	return user, nil
 }
 
-func SaveConfig(config *AppConfig) {
+// SaveBootstrapConfig writes the bootstrap settings to the config file
+func SaveBootstrapConfig(config *AppConfig) {
 	path := GetConfigPath()
-	data, err := json.MarshalIndent(config, "", "  ")
+	data, err := json.MarshalIndent(config.Bootstrap(), "", "  ")
 	if err != nil {
 		fmt.Printf("Failed to serialize config: %v\n", err)
 		return
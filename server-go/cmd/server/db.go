@@ -146,13 +146,13 @@ func (mb *MetricsBuffer) Flush() {
 
 // flushItems writes items to database
 func (mb *MetricsBuffer) flushItems(items []MetricsBufferItem) {
-	if len(items) == 0 || dbWriter == nil {
+	if len(items) == 0 || metricsStore == nil {
 		return
 	}
 	
-	dbWriter.WriteAsync(func(db *sql.DB) error {
-		return batchStoreMetrics(db, items)
-	})
+	if err := metricsStore.StoreSamples(items); err != nil {
+		fmt.Printf("Database write error: %v\n", err)
+	}
 }
 
 // Close stops the buffer
@@ -163,12 +163,21 @@ func (mb *MetricsBuffer) Close() {
 
 // GetLastMetricsTime returns the last metrics timestamp for a server
 func GetLastMetricsTime(serverID string) *time.Time {
-	if dbWriter == nil {
+	if metricsStore == nil {
 		return nil
 	}
-	
-	db := dbWriter.GetDB()
-	
+	return metricsStore.LastMetricsTime(serverID)
+}
+
+// GetLastAggregationBuckets returns the last bucket for each granularity for a server
+func GetLastAggregationBuckets(serverID string) map[string]int64 {
+	if metricsStore == nil {
+		return nil
+	}
+	return metricsStore.LastBuckets(serverID)
+}
+
+func lastMetricsTimeSQLite(db *sql.DB, serverID string) *time.Time {
 	// Check multiple tables to find the latest timestamp
 	var lastTime *time.Time
 	
@@ -208,13 +217,7 @@ func GetLastMetricsTime(serverID string) *time.Time {
 	return lastTime
 }
 
-// GetLastAggregationBuckets returns the last bucket for each granularity for a server
-func GetLastAggregationBuckets(serverID string) map[string]int64 {
-	if dbWriter == nil {
-		return nil
-	}
-	
-	db := dbWriter.GetDB()
+func lastAggregationBucketsSQLite(db *sql.DB, serverID string) map[string]int64 {
 	buckets := make(map[string]int64)
 	
 	tables := map[string]string{
@@ -295,6 +298,45 @@ func batchStoreMetrics(db *sql.DB, items []MetricsBufferItem) error {
 	}
 	defer stmt2min.Close()
 	
+	// Per-target ping statements, matching storeMetricsInternal
+	pingRawStmt, err := tx.Prepare(`
+		INSERT INTO ping_raw (server_id, timestamp, target_name, target_host, latency_ms, packet_loss, status, bucket_5min, bucket_5sec)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer pingRawStmt.Close()
+	
+	ping5secStmt, err := tx.Prepare(`
+		INSERT INTO ping_5sec (server_id, bucket, target_name, target_host, latency_sum, latency_max, latency_count, ok_count, fail_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(server_id, target_name, bucket) DO UPDATE SET
+			target_host = excluded.target_host,
+			latency_sum = latency_sum + excluded.latency_sum,
+			latency_max = MAX(latency_max, excluded.latency_max),
+			latency_count = latency_count + excluded.latency_count,
+			ok_count = ok_count + excluded.ok_count,
+			fail_count = fail_count + excluded.fail_count`)
+	if err != nil {
+		return err
+	}
+	defer ping5secStmt.Close()
+	
+	ping2minStmt, err := tx.Prepare(`
+		INSERT INTO ping_2min (server_id, bucket, target_name, target_host, latency_sum, latency_max, latency_count, ok_count, fail_count)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(server_id, target_name, bucket) DO UPDATE SET
+			target_host = excluded.target_host,
+			latency_sum = latency_sum + excluded.latency_sum,
+			latency_max = MAX(latency_max, excluded.latency_max),
+			latency_count = latency_count + excluded.latency_count,
+			ok_count = ok_count + excluded.ok_count,
+			fail_count = fail_count + excluded.fail_count`)
+	if err != nil {
+		return err
+	}
+	defer ping2minStmt.Close()
+	
 	for _, item := range items {
 		metrics := item.Metrics
 		serverID := item.ServerID
@@ -357,6 +399,33 @@ func batchStoreMetrics(db *sql.DB, items []MetricsBufferItem) error {
 			metrics.Network.TotalRx, metrics.Network.TotalTx,
 			pingVal, pingCnt,
 		)
+		
+		// Store individual ping targets
+		if metrics.Ping != nil {
+			for _, target := range metrics.Ping.Targets {
+				pingRawStmt.Exec(
+					serverID, timestamp, target.Name, target.Host,
+					target.LatencyMs, target.PacketLoss, target.Status,
+					bucket5min, bucket5sec,
+				)
+
+				latencyVal := float64(0)
+				latencyCnt := 0
+				if target.LatencyMs != nil {
+					latencyVal = *target.LatencyMs
+					latencyCnt = 1
+				}
+				okCnt, failCnt := 0, 1
+				if target.Status == "ok" {
+					okCnt, failCnt = 1, 0
+				}
+
+				ping5secStmt.Exec(serverID, bucket5sec, target.Name, target.Host,
+					latencyVal, latencyVal, latencyCnt, okCnt, failCnt)
+				ping2minStmt.Exec(serverID, bucket5min, target.Name, target.Host,
+					latencyVal, latencyVal, latencyCnt, okCnt, failCnt)
+			}
+		}
 	}
 	
 	return tx.Commit()
@@ -473,15 +542,11 @@ func (ab *AggBuffer) Flush() {
 	ab.ping = make(map[PingBufferKey]*common.PingBucketData)
 	ab.mu.Unlock()
 
-	// Write to database
-	if dbWriter != nil {
-		dbWriter.WriteAsync(func(db *sql.DB) error {
-			err := flushAggBufferToDB(db, metrics, ping)
-			if err != nil {
-				fmt.Printf("⚠️ Aggregation buffer flush error: %v\n", err)
-			}
-			return err
-		})
+	// Write to storage
+	if metricsStore != nil {
+		if err := metricsStore.StoreAggregates(metrics, ping); err != nil {
+			fmt.Printf("⚠️ Aggregation buffer flush error: %v\n", err)
+		}
 	}
 }
 
@@ -800,386 +865,12 @@ func InitDatabase() (*sql.DB, error) {
 		fmt.Printf("Warning: Failed to set synchronous mode: %v\n", err)
 	}
 
-	// Create tables
-	_, err = db.Exec(`
-		-- Raw metrics (keep for 24 hours)
-		-- Note: bucket_5min column added via migration for existing databases
-		CREATE TABLE IF NOT EXISTS metrics_raw (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			timestamp TEXT NOT NULL,
-			cpu_usage REAL NOT NULL,
-			memory_usage REAL NOT NULL,
-			disk_usage REAL NOT NULL,
-			net_rx INTEGER NOT NULL,
-			net_tx INTEGER NOT NULL,
-			load_1 REAL NOT NULL,
-			load_5 REAL NOT NULL,
-			load_15 REAL NOT NULL,
-			ping_ms REAL,
-			created_at TEXT DEFAULT CURRENT_TIMESTAMP
-		);
-		
-		-- 15-minute aggregated metrics (keep for 7 days, for 7d range with 720 points)
-		CREATE TABLE IF NOT EXISTS metrics_15min (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			bucket_start TEXT NOT NULL,
-			cpu_avg REAL NOT NULL,
-			cpu_max REAL NOT NULL,
-			memory_avg REAL NOT NULL,
-			memory_max REAL NOT NULL,
-			disk_avg REAL NOT NULL,
-			net_rx_total INTEGER NOT NULL,
-			net_tx_total INTEGER NOT NULL,
-			ping_avg REAL,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, bucket_start)
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_metrics_15min_server_time ON metrics_15min(server_id, bucket_start);
-		
-		-- Hourly aggregated metrics (keep for 30 days)
-		CREATE TABLE IF NOT EXISTS metrics_hourly (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			hour_start TEXT NOT NULL,
-			cpu_avg REAL NOT NULL,
-			cpu_max REAL NOT NULL,
-			memory_avg REAL NOT NULL,
-			memory_max REAL NOT NULL,
-			disk_avg REAL NOT NULL,
-			net_rx_total INTEGER NOT NULL,
-			net_tx_total INTEGER NOT NULL,
-			ping_avg REAL,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, hour_start)
-		);
-		
-		-- Daily aggregated metrics (keep forever)
-		CREATE TABLE IF NOT EXISTS metrics_daily (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			date TEXT NOT NULL,
-			cpu_avg REAL NOT NULL,
-			cpu_max REAL NOT NULL,
-			memory_avg REAL NOT NULL,
-			memory_max REAL NOT NULL,
-			disk_avg REAL NOT NULL,
-			net_rx_total INTEGER NOT NULL,
-			net_tx_total INTEGER NOT NULL,
-			uptime_percent REAL NOT NULL,
-			ping_avg REAL,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, date)
-		);
-		
-		-- Create indexes (bucket_5min index created after migration)
-		CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_time ON metrics_raw(server_id, timestamp);
-		CREATE INDEX IF NOT EXISTS idx_metrics_hourly_server_time ON metrics_hourly(server_id, hour_start);
-		CREATE INDEX IF NOT EXISTS idx_metrics_daily_server_time ON metrics_daily(server_id, date);
-		
-		-- Ping metrics per target (keep for 24 hours)
-		-- Note: bucket_5min column added via migration for existing databases
-		CREATE TABLE IF NOT EXISTS ping_raw (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			timestamp TEXT NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_ms REAL,
-			packet_loss REAL NOT NULL DEFAULT 0,
-			status TEXT NOT NULL DEFAULT 'ok'
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_ping_raw_server_time ON ping_raw(server_id, timestamp);
-		CREATE INDEX IF NOT EXISTS idx_ping_raw_target ON ping_raw(server_id, target_name, timestamp);
-		
-		-- 15-minute aggregated ping metrics (keep for 7 days)
-		CREATE TABLE IF NOT EXISTS ping_15min (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			bucket_start TEXT NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_avg REAL,
-			latency_max REAL,
-			packet_loss_avg REAL NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, target_name, bucket_start)
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_ping_15min_server_time ON ping_15min(server_id, bucket_start);
-		CREATE INDEX IF NOT EXISTS idx_ping_15min_target ON ping_15min(server_id, target_name, bucket_start);
-		
-		-- Hourly aggregated ping metrics (keep for 30 days)
-		CREATE TABLE IF NOT EXISTS ping_hourly (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			hour_start TEXT NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_avg REAL,
-			latency_max REAL,
-			packet_loss_avg REAL NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, target_name, hour_start)
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_ping_hourly_server_time ON ping_hourly(server_id, hour_start);
-		CREATE INDEX IF NOT EXISTS idx_ping_hourly_target ON ping_hourly(server_id, target_name, hour_start);
-		
-		-- Daily aggregated ping metrics (keep forever)
-		CREATE TABLE IF NOT EXISTS ping_daily (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			server_id TEXT NOT NULL,
-			date TEXT NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_avg REAL,
-			latency_max REAL,
-			packet_loss_avg REAL NOT NULL DEFAULT 0,
-			uptime_percent REAL NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL,
-			UNIQUE(server_id, target_name, date)
-		);
-		
-		CREATE INDEX IF NOT EXISTS idx_ping_daily_server_time ON ping_daily(server_id, date);
-		CREATE INDEX IF NOT EXISTS idx_ping_daily_target ON ping_daily(server_id, target_name, date);
-	`)
-	if err != nil {
+	// Bring the schema up to date
+	if _, err := Migrate(db); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	// Migration: Add ping_ms column if it doesn't exist
-	db.Exec("ALTER TABLE metrics_raw ADD COLUMN ping_ms REAL")
-	db.Exec("ALTER TABLE metrics_hourly ADD COLUMN ping_avg REAL")
-	db.Exec("ALTER TABLE metrics_daily ADD COLUMN ping_avg REAL")
-
-	// Migration: Add bucket_5min column for efficient 24h sampling (actually stores 2-min buckets for 720 points)
-	db.Exec("ALTER TABLE metrics_raw ADD COLUMN bucket_5min INTEGER")
-	db.Exec("ALTER TABLE ping_raw ADD COLUMN bucket_5min INTEGER")
-
-	// Create indexes for bucket_5min (ignore error if already exists)
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket ON metrics_raw(server_id, bucket_5min)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_ping_raw_server_bucket ON ping_raw(server_id, bucket_5min)")
-
-	// Backfill bucket for existing data - only if there are NULL values (check first for fast startup)
-	var needsBackfill5min int
-	db.QueryRow("SELECT 1 FROM metrics_raw WHERE bucket_5min IS NULL OR bucket_5min > 100000000 LIMIT 1").Scan(&needsBackfill5min)
-	if needsBackfill5min == 1 {
-		fmt.Println("⏳ Backfilling bucket_5min for metrics_raw (one-time migration)...")
-		db.Exec("UPDATE metrics_raw SET bucket_5min = CAST(strftime('%s', timestamp) AS INTEGER) / 120 WHERE bucket_5min IS NULL OR bucket_5min > 100000000")
-	}
-	db.QueryRow("SELECT 1 FROM ping_raw WHERE bucket_5min IS NULL OR bucket_5min > 100000000 LIMIT 1").Scan(&needsBackfill5min)
-	if needsBackfill5min == 1 {
-		fmt.Println("⏳ Backfilling bucket_5min for ping_raw (one-time migration)...")
-		db.Exec("UPDATE ping_raw SET bucket_5min = CAST(strftime('%s', timestamp) AS INTEGER) / 120 WHERE bucket_5min IS NULL OR bucket_5min > 100000000")
-	}
-
-	// Migration: Add bucket_5sec column for efficient 1h sampling (5-sec buckets for 720 points over 1h)
-	db.Exec("ALTER TABLE metrics_raw ADD COLUMN bucket_5sec INTEGER")
-	db.Exec("ALTER TABLE ping_raw ADD COLUMN bucket_5sec INTEGER")
-
-	// Create indexes for bucket_5sec (ignore error if already exists)
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket_5sec ON metrics_raw(server_id, bucket_5sec)")
-	db.Exec("CREATE INDEX IF NOT EXISTS idx_ping_raw_server_bucket_5sec ON ping_raw(server_id, bucket_5sec)")
-
-	// Backfill bucket_5sec for existing data - only if there are NULL values (check first for fast startup)
-	var needsBackfill5sec int
-	db.QueryRow("SELECT 1 FROM metrics_raw WHERE bucket_5sec IS NULL LIMIT 1").Scan(&needsBackfill5sec)
-	if needsBackfill5sec == 1 {
-		fmt.Println("⏳ Backfilling bucket_5sec for metrics_raw (one-time migration)...")
-		db.Exec("UPDATE metrics_raw SET bucket_5sec = CAST(strftime('%s', timestamp) AS INTEGER) / 5 WHERE bucket_5sec IS NULL")
-	}
-	db.QueryRow("SELECT 1 FROM ping_raw WHERE bucket_5sec IS NULL LIMIT 1").Scan(&needsBackfill5sec)
-	if needsBackfill5sec == 1 {
-		fmt.Println("⏳ Backfilling bucket_5sec for ping_raw (one-time migration)...")
-		db.Exec("UPDATE ping_raw SET bucket_5sec = CAST(strftime('%s', timestamp) AS INTEGER) / 5 WHERE bucket_5sec IS NULL")
-	}
-
-	// Create real-time aggregation tables for fast queries
-	db.Exec(`
-		-- 5-second aggregated metrics (for 1h queries, ~720 points per server)
-		CREATE TABLE IF NOT EXISTS metrics_5sec (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			cpu_sum REAL NOT NULL DEFAULT 0,
-			cpu_max REAL NOT NULL DEFAULT 0,
-			memory_sum REAL NOT NULL DEFAULT 0,
-			memory_max REAL NOT NULL DEFAULT 0,
-			disk_sum REAL NOT NULL DEFAULT 0,
-			net_rx INTEGER NOT NULL DEFAULT 0,
-			net_tx INTEGER NOT NULL DEFAULT 0,
-			ping_sum REAL NOT NULL DEFAULT 0,
-			ping_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- 2-minute aggregated metrics (for 24h queries, ~720 points per server)
-		CREATE TABLE IF NOT EXISTS metrics_2min (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			cpu_sum REAL NOT NULL DEFAULT 0,
-			cpu_max REAL NOT NULL DEFAULT 0,
-			memory_sum REAL NOT NULL DEFAULT 0,
-			memory_max REAL NOT NULL DEFAULT 0,
-			disk_sum REAL NOT NULL DEFAULT 0,
-			net_rx INTEGER NOT NULL DEFAULT 0,
-			net_tx INTEGER NOT NULL DEFAULT 0,
-			ping_sum REAL NOT NULL DEFAULT 0,
-			ping_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, bucket)
-		) WITHOUT ROWID
-	`)
-
-	// New aggregation tables for agent-side aggregation (15min, hourly, daily)
-	db.Exec(`
-		-- 15-minute aggregated metrics (for 7d queries, from agent)
-		CREATE TABLE IF NOT EXISTS metrics_15min_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			cpu_sum REAL NOT NULL DEFAULT 0,
-			cpu_max REAL NOT NULL DEFAULT 0,
-			memory_sum REAL NOT NULL DEFAULT 0,
-			memory_max REAL NOT NULL DEFAULT 0,
-			disk_sum REAL NOT NULL DEFAULT 0,
-			net_rx INTEGER NOT NULL DEFAULT 0,
-			net_tx INTEGER NOT NULL DEFAULT 0,
-			ping_sum REAL NOT NULL DEFAULT 0,
-			ping_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- Hourly aggregated metrics (for 30d queries, from agent)
-		CREATE TABLE IF NOT EXISTS metrics_hourly_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			cpu_sum REAL NOT NULL DEFAULT 0,
-			cpu_max REAL NOT NULL DEFAULT 0,
-			memory_sum REAL NOT NULL DEFAULT 0,
-			memory_max REAL NOT NULL DEFAULT 0,
-			disk_sum REAL NOT NULL DEFAULT 0,
-			net_rx INTEGER NOT NULL DEFAULT 0,
-			net_tx INTEGER NOT NULL DEFAULT 0,
-			ping_sum REAL NOT NULL DEFAULT 0,
-			ping_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- Daily aggregated metrics (for 1y queries, from agent)
-		CREATE TABLE IF NOT EXISTS metrics_daily_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			cpu_sum REAL NOT NULL DEFAULT 0,
-			cpu_max REAL NOT NULL DEFAULT 0,
-			memory_sum REAL NOT NULL DEFAULT 0,
-			memory_max REAL NOT NULL DEFAULT 0,
-			disk_sum REAL NOT NULL DEFAULT 0,
-			net_rx INTEGER NOT NULL DEFAULT 0,
-			net_tx INTEGER NOT NULL DEFAULT 0,
-			ping_sum REAL NOT NULL DEFAULT 0,
-			ping_count INTEGER NOT NULL DEFAULT 0,
-			sample_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- 5-second aggregated ping metrics (for 1h queries)
-		CREATE TABLE IF NOT EXISTS ping_5sec (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_sum REAL NOT NULL DEFAULT 0,
-			latency_max REAL NOT NULL DEFAULT 0,
-			latency_count INTEGER NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, target_name, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- 2-minute aggregated ping metrics (for 24h queries)
-		CREATE TABLE IF NOT EXISTS ping_2min (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_sum REAL NOT NULL DEFAULT 0,
-			latency_max REAL NOT NULL DEFAULT 0,
-			latency_count INTEGER NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, target_name, bucket)
-		) WITHOUT ROWID
-	`)
-
-	// New ping aggregation tables for agent-side aggregation
-	db.Exec(`
-		-- 15-minute aggregated ping metrics (for 7d queries, from agent)
-		CREATE TABLE IF NOT EXISTS ping_15min_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_sum REAL NOT NULL DEFAULT 0,
-			latency_max REAL NOT NULL DEFAULT 0,
-			latency_count INTEGER NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, target_name, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- Hourly aggregated ping metrics (for 30d queries, from agent)
-		CREATE TABLE IF NOT EXISTS ping_hourly_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_sum REAL NOT NULL DEFAULT 0,
-			latency_max REAL NOT NULL DEFAULT 0,
-			latency_count INTEGER NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, target_name, bucket)
-		) WITHOUT ROWID
-	`)
-
-	db.Exec(`
-		-- Daily aggregated ping metrics (for 1y queries, from agent)
-		CREATE TABLE IF NOT EXISTS ping_daily_agg (
-			server_id TEXT NOT NULL,
-			bucket INTEGER NOT NULL,
-			target_name TEXT NOT NULL,
-			target_host TEXT NOT NULL,
-			latency_sum REAL NOT NULL DEFAULT 0,
-			latency_max REAL NOT NULL DEFAULT 0,
-			latency_count INTEGER NOT NULL DEFAULT 0,
-			ok_count INTEGER NOT NULL DEFAULT 0,
-			fail_count INTEGER NOT NULL DEFAULT 0,
-			PRIMARY KEY (server_id, target_name, bucket)
-		) WITHOUT ROWID
-	`)
-
 	// Run ANALYZE in background to avoid slow startup
 	go func() {
 		time.Sleep(10 * time.Second) // Wait for server to fully start
@@ -1191,15 +882,14 @@ func InitDatabase() (*sql.DB, error) {
 
 // StoreMetricsAsync queues metrics storage (fire-and-forget)
 func StoreMetricsAsync(serverID string, metrics *SystemMetrics) {
-	if dbWriter == nil {
+	if metricsStore == nil {
 		return
 	}
 	// Copy data to avoid race conditions
 	m := *metrics
-	sid := serverID
-	dbWriter.WriteAsync(func(db *sql.DB) error {
-		return storeMetricsInternal(db, sid, &m)
-	})
+	if err := metricsStore.StoreSamples([]MetricsBufferItem{{ServerID: serverID, Metrics: &m}}); err != nil {
+		fmt.Printf("Database write error: %v\n", err)
+	}
 }
 
 // StoreMetricsWithDedup stores metrics with deduplication check
@@ -1212,48 +902,34 @@ func StoreMetricsWithDedup(serverID string, metrics *SystemMetrics) {
 	}
 	
 	// Fallback to direct write
-	if dbWriter == nil {
+	if metricsStore == nil {
 		return
 	}
-	m := *metrics
-	sid := serverID
-	dbWriter.WriteAsync(func(db *sql.DB) error {
-		return storeMetricsWithDedupInternal(db, sid, &m)
-	})
+	if err := metricsStore.StoreSample(serverID, metrics); err != nil {
+		fmt.Printf("Database write error: %v\n", err)
+	}
 }
 
 // StoreBatchMetrics stores a single metric from a batch, returns true if stored (not duplicate)
 func StoreBatchMetrics(serverID string, metrics *SystemMetrics) bool {
-	if dbWriter == nil {
+	if metricsStore == nil {
 		return false
 	}
-	m := *metrics
-	sid := serverID
 	
-	result := make(chan bool, 1)
-	dbWriter.WriteAsync(func(db *sql.DB) error {
-		stored := storeMetricsWithDedupInternal(db, sid, &m) == nil
-		select {
-		case result <- stored:
-		default:
-		}
-		return nil
-	})
-	
-	// Non-blocking - assume success
-	return true
+	// Writes may be queued, so a duplicate is only detected later - assume success
+	return metricsStore.StoreSample(serverID, metrics) == nil
 }
 
 // StoreAggregatedMetrics stores pre-aggregated metrics from agent
 func StoreAggregatedMetrics(serverID string, agg *common.AggregatedMetrics) bool {
-	if dbWriter == nil || agg == nil {
+	if metricsStore == nil || agg == nil {
 		return false
 	}
 	
-	dbWriter.WriteAsync(func(db *sql.DB) error {
-		return storeAggregatedMetricsInternal(db, serverID, agg)
-	})
-	
+	if err := storeAggregatedMetrics(metricsStore, serverID, agg); err != nil {
+		fmt.Printf("Database write error: %v\n", err)
+		return false
+	}
 	return true
 }
 
@@ -1271,87 +947,26 @@ func StoreMultiGranularityMetrics(serverID string, granularities []common.Granul
 	}
 	
 	// Fallback to direct write if buffer not initialized
-	if dbWriter == nil {
+	if metricsStore == nil {
 		return false
 	}
 	
-	dbWriter.WriteAsync(func(db *sql.DB) error {
-		return storeMultiGranularityMetricsInternal(db, serverID, granularities)
-	})
-	
-	return true
-}
-
-// storeMultiGranularityMetricsInternal stores multi-granularity aggregated data
-func storeMultiGranularityMetricsInternal(db *sql.DB, serverID string, granularities []common.GranularityData) error {
+	metrics := make(map[AggBufferKey]*common.BucketData)
+	ping := make(map[PingBufferKey]*common.PingBucketData)
 	for _, g := range granularities {
-		// Determine which table to use based on granularity
-		var metricsTable, pingTable string
-		switch g.Granularity {
-		case "5sec":
-			metricsTable = "metrics_5sec"
-			pingTable = "ping_5sec"
-		case "2min":
-			metricsTable = "metrics_2min"
-			pingTable = "ping_2min"
-		case "15min":
-			metricsTable = "metrics_15min_agg"
-			pingTable = "ping_15min_agg"
-		case "hourly":
-			metricsTable = "metrics_hourly_agg"
-			pingTable = "ping_hourly_agg"
-		case "daily":
-			metricsTable = "metrics_daily_agg"
-			pingTable = "ping_daily_agg"
-		default:
-			continue
+		for i := range g.Metrics {
+			metrics[AggBufferKey{serverID, g.Granularity, g.Metrics[i].Bucket}] = &g.Metrics[i]
 		}
-
-		// Store metrics buckets
-		for _, m := range g.Metrics {
-			db.Exec(`
-				INSERT INTO `+metricsTable+` (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-				ON CONFLICT(server_id, bucket) DO UPDATE SET
-					cpu_sum = excluded.cpu_sum,
-					cpu_max = MAX(cpu_max, excluded.cpu_max),
-					memory_sum = excluded.memory_sum,
-					memory_max = MAX(memory_max, excluded.memory_max),
-					disk_sum = excluded.disk_sum,
-					net_rx = MAX(net_rx, excluded.net_rx),
-					net_tx = MAX(net_tx, excluded.net_tx),
-					ping_sum = excluded.ping_sum,
-					ping_count = excluded.ping_count,
-					sample_count = excluded.sample_count`,
-				serverID, m.Bucket,
-				m.CPUSum, m.CPUMax,
-				m.MemorySum, m.MemoryMax,
-				m.DiskSum,
-				m.NetRx, m.NetTx,
-				m.PingSum, m.PingCount,
-				m.SampleCount,
-			)
-		}
-
-		// Store ping buckets
-		for _, p := range g.Ping {
-			db.Exec(`
-				INSERT INTO `+pingTable+` (server_id, bucket, target_name, target_host, latency_sum, latency_max, latency_count, ok_count, fail_count)
-				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-				ON CONFLICT(server_id, target_name, bucket) DO UPDATE SET
-					target_host = excluded.target_host,
-					latency_sum = excluded.latency_sum,
-					latency_max = MAX(latency_max, excluded.latency_max),
-					latency_count = excluded.latency_count,
-					ok_count = excluded.ok_count,
-					fail_count = excluded.fail_count`,
-				serverID, p.Bucket, p.TargetName, p.TargetHost,
-				p.LatencySum, p.LatencyMax, p.LatencyCount, p.OkCount, p.FailCount,
-			)
+		for i := range g.Ping {
+			p := &g.Ping[i]
+			ping[PingBufferKey{serverID, g.Granularity, p.Bucket, p.TargetName}] = p
 		}
 	}
-
-	return nil
+	if err := metricsStore.StoreAggregates(metrics, ping); err != nil {
+		fmt.Printf("Database write error: %v\n", err)
+	}
+	
+	return true
 }
 
 // storeMetricsWithDedupInternal stores metrics with timestamp-based deduplication
@@ -1386,8 +1001,8 @@ func storeMetricsWithDedupInternal(db *sql.DB, serverID string, metrics *SystemM
 	return storeMetricsInternal(db, serverID, metrics)
 }
 
-// storeAggregatedMetricsInternal stores pre-aggregated metrics
-func storeAggregatedMetricsInternal(db *sql.DB, serverID string, agg *common.AggregatedMetrics) error {
+// storeAggregatedMetrics stores pre-aggregated metrics of the legacy batch protocol
+func storeAggregatedMetrics(st Storage, serverID string, agg *common.AggregatedMetrics) error {
 	// Parse timestamps
 	startTime, err := time.Parse(time.RFC3339Nano, agg.StartTime)
 	if err != nil {
@@ -1409,49 +1024,39 @@ func storeAggregatedMetricsInternal(db *sql.DB, serverID string, agg *common.Agg
 	bucket2min := startTime.Unix() / 120
 	
 	// Check for existing data in this bucket
-	var exists int
-	err = db.QueryRow(`
-		SELECT 1 FROM metrics_2min 
-		WHERE server_id = ? AND bucket = ?
-		LIMIT 1`, serverID, bucket2min).Scan(&exists)
-	
-	if err == nil && exists == 1 {
-		// Already have aggregated data for this bucket - merge or skip
-		// For now, skip to avoid duplicates
+	exists := false
+	err = st.ScanMetricBuckets(serverID, "2min", bucket2min, bucket2min, func(*common.BucketData) error {
+		exists = true
 		return nil
-	}
-	
-	// Store in 2-minute aggregation table
-	_, err = db.Exec(`
-		INSERT INTO metrics_2min (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(server_id, bucket) DO UPDATE SET
-			cpu_sum = cpu_sum + excluded.cpu_sum,
-			cpu_max = MAX(cpu_max, excluded.cpu_max),
-			memory_sum = memory_sum + excluded.memory_sum,
-			memory_max = MAX(memory_max, excluded.memory_max),
-			disk_sum = disk_sum + excluded.disk_sum,
-			net_rx = MAX(net_rx, excluded.net_rx),
-			net_tx = MAX(net_tx, excluded.net_tx),
-			ping_sum = ping_sum + excluded.ping_sum,
-			ping_count = ping_count + excluded.ping_count,
-			sample_count = sample_count + excluded.sample_count`,
-		serverID, bucket2min,
-		float64(agg.CPUAvg)*float64(agg.SampleCount), float64(agg.CPUMax),
-		float64(agg.MemoryAvg)*float64(agg.SampleCount), float64(agg.MemoryMax),
-		float64(agg.DiskAvg)*float64(agg.SampleCount),
-		agg.NetRxMax, agg.NetTxMax,
-		0.0, 0, // ping values (if available)
-		agg.SampleCount,
-	)
+	})
 	if err != nil {
 		return err
 	}
 	
+	if !exists {
+		// Store in 2-minute aggregation table; the bucket is new, so replacing equals adding
+		bucket := &common.BucketData{
+			Bucket:      bucket2min,
+			CPUSum:      float64(agg.CPUAvg) * float64(agg.SampleCount),
+			CPUMax:      float64(agg.CPUMax),
+			MemorySum:   float64(agg.MemoryAvg) * float64(agg.SampleCount),
+			MemoryMax:   float64(agg.MemoryMax),
+			DiskSum:     float64(agg.DiskAvg) * float64(agg.SampleCount),
+			NetRx:       agg.NetRxMax,
+			NetTx:       agg.NetTxMax,
+			SampleCount: agg.SampleCount,
+		}
+		metrics := map[AggBufferKey]*common.BucketData{{serverID, "2min", bucket2min}: bucket}
+		if err := st.StoreAggregates(metrics, nil); err != nil {
+			return err
+		}
+	}
+	
 	// Also store last metrics snapshot as a raw entry for recent data queries
 	if agg.LastMetrics != nil {
-		agg.LastMetrics.Timestamp = endTime
-		storeMetricsWithDedupInternal(db, serverID, agg.LastMetrics)
+		m := *agg.LastMetrics
+		m.Timestamp = endTime
+		return st.StoreSample(serverID, &m)
 	}
 	
 	return nil
@@ -1801,64 +1406,30 @@ func aggregateDailyInternal(db *sql.DB) error {
 	return err
 }
 
-func CleanupOldData(db *sql.DB) error {
-	if dbWriter != nil {
-		return dbWriter.WriteSync(cleanupOldDataInternal)
-	}
-	return cleanupOldDataInternal(db)
-}
-
-func cleanupOldDataInternal(db *sql.DB) error {
-	// Delete raw data older than 24 hours
-	cutoffRaw := time.Now().UTC().Add(-24 * time.Hour).Format(time.RFC3339)
-	if _, err := db.Exec("DELETE FROM metrics_raw WHERE timestamp < ?", cutoffRaw); err != nil {
+// CleanupOldData removes history older than the retention policy of each server
+func CleanupOldData(db *sql.DB, st Storage, settings RetentionSettings, servers []RemoteServer) error {
+	scopes, err := ApplyRetention(db, st, settings, servers, time.Now().UTC(), false)
+	if err != nil {
 		return err
 	}
 
-	// Delete ping raw data older than 24 hours
-	if _, err := db.Exec("DELETE FROM ping_raw WHERE timestamp < ?", cutoffRaw); err != nil {
-		return err
+	var total int64
+	for _, scope := range scopes {
+		total += scope.Total
+	}
+	if total > 0 {
+		fmt.Printf("🧹 Retention cleanup removed %d rows\n", total)
 	}
-
-	// Delete 5-second aggregation data older than 2 hours
-	cutoff5sec := time.Now().UTC().Add(-2*time.Hour).Unix() / 5
-	db.Exec("DELETE FROM metrics_5sec WHERE bucket < ?", cutoff5sec)
-	db.Exec("DELETE FROM ping_5sec WHERE bucket < ?", cutoff5sec)
-
-	// Delete 2-minute aggregation data older than 26 hours
-	cutoff2min := time.Now().UTC().Add(-26*time.Hour).Unix() / 120
-	db.Exec("DELETE FROM metrics_2min WHERE bucket < ?", cutoff2min)
-	db.Exec("DELETE FROM ping_2min WHERE bucket < ?", cutoff2min)
-
-	// Delete 15-min aggregation data (agent-provided) older than 8 days
-	cutoff15minAgg := time.Now().UTC().Add(-8*24*time.Hour).Unix() / 900
-	db.Exec("DELETE FROM metrics_15min_agg WHERE bucket < ?", cutoff15minAgg)
-	db.Exec("DELETE FROM ping_15min_agg WHERE bucket < ?", cutoff15minAgg)
-
-	// Delete hourly aggregation data (agent-provided) older than 32 days
-	cutoffHourlyAgg := time.Now().UTC().Add(-32*24*time.Hour).Unix() / 3600
-	db.Exec("DELETE FROM metrics_hourly_agg WHERE bucket < ?", cutoffHourlyAgg)
-	db.Exec("DELETE FROM ping_hourly_agg WHERE bucket < ?", cutoffHourlyAgg)
-
-	// Delete daily aggregation data (agent-provided) older than 400 days
-	cutoffDailyAgg := time.Now().UTC().Add(-400*24*time.Hour).Unix() / 86400
-	db.Exec("DELETE FROM metrics_daily_agg WHERE bucket < ?", cutoffDailyAgg)
-	db.Exec("DELETE FROM ping_daily_agg WHERE bucket < ?", cutoffDailyAgg)
-
-	// Delete old pre-aggregated 15-min data older than 7 days (legacy)
-	cutoff15min := time.Now().UTC().Add(-7 * 24 * time.Hour).Format(time.RFC3339)
-	db.Exec("DELETE FROM metrics_15min WHERE bucket_start < ?", cutoff15min)
-	db.Exec("DELETE FROM ping_15min WHERE bucket_start < ?", cutoff15min)
-
-	// Delete old pre-aggregated hourly data older than 30 days (legacy)
-	cutoffHourly := time.Now().UTC().AddDate(0, 0, -30).Format(time.RFC3339)
-	db.Exec("DELETE FROM metrics_hourly WHERE hour_start < ?", cutoffHourly)
-	db.Exec("DELETE FROM ping_hourly WHERE hour_start < ?", cutoffHourly)
 
 	// Update query planner statistics after cleanup
-	db.Exec("ANALYZE")
-
-	return nil
+	analyze := func(db *sql.DB) error {
+		db.Exec("ANALYZE")
+		return nil
+	}
+	if dbWriter != nil {
+		return dbWriter.WriteSync(analyze)
+	}
+	return analyze(db)
 }
 
 func GetHistory(db *sql.DB, serverID, rangeStr string) ([]HistoryPoint, error) {
@@ -2430,3 +2001,66 @@ func GetPingHistorySince(db *sql.DB, serverID, rangeStr string, sinceBucket int6
 	return targets, nil
 }
 
+
+// ============================================================================
+// Time-Range History Queries
+// ============================================================================
+
+// HistoryGranularity describes one bucketed metrics/ping table pair and how long it is kept
+type HistoryGranularity struct {
+	Name       string // 5sec, 2min, 15min, hourly, daily (see getMetricsTable)
+	BucketSecs int64
+	Retention  time.Duration
+}
+
+// historyGranularityNames is ordered from finest to coarsest
+var historyGranularityNames = []string{"5sec", "2min", "15min", "hourly", "daily"}
+
+var historyBucketSecs = map[string]int64{"5sec": 5, "2min": 120, "15min": 900, "hourly": 3600, "daily": 86400}
+
+// historyGranularities returns all granularities with the retention of the active default policy
+func historyGranularities() []HistoryGranularity {
+	policy := ActiveRetention()
+	list := make([]HistoryGranularity, len(historyGranularityNames))
+	for i, name := range historyGranularityNames {
+		list[i] = HistoryGranularity{Name: name, BucketSecs: historyBucketSecs[name], Retention: policy.Duration(name)}
+	}
+	return list
+}
+
+// PickHistoryGranularity returns the coarsest granularity whose buckets are not wider than step
+// and whose retention still reaches back to from. Without such a table the finest one that
+// still holds from is used. A zero step selects the finest table that holds from.
+func PickHistoryGranularity(from time.Time, step time.Duration, now time.Time) HistoryGranularity {
+	age := now.Sub(from)
+	list := historyGranularities()
+	var choice *HistoryGranularity
+	for i := range list {
+		g := &list[i]
+		if age > g.Retention {
+			continue
+		}
+		if choice == nil || time.Duration(g.BucketSecs)*time.Second <= step {
+			choice = g
+		}
+	}
+	if choice == nil {
+		return list[len(list)-1]
+	}
+	return *choice
+}
+
+// GetHistoryRange returns the metrics buckets of one granularity that start within [from, to]
+func GetHistoryRange(st Storage, serverID string, gran HistoryGranularity, from, to time.Time) ([]HistoryPoint, error) {
+	data := []HistoryPoint{}
+	err := st.ScanMetricBuckets(serverID, gran.Name, from.Unix()/gran.BucketSecs, to.Unix()/gran.BucketSecs, func(b *common.BucketData) error {
+		data = append(data, historyPointFromBucket(b, gran.BucketSecs))
+		return nil
+	})
+	return data, err
+}
+
+// GetPingHistoryRange returns the ping buckets of one granularity within [from, to], grouped by target
+func GetPingHistoryRange(st Storage, serverID string, gran HistoryGranularity, from, to time.Time) ([]PingHistoryTarget, error) {
+	return scanPingHistory(st, serverID, gran.Name, from.Unix()/gran.BucketSecs, to.Unix()/gran.BucketSecs)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Server Event Types
+// ============================================================================
+
+// Server event types. connect/disconnect track the agent WebSocket, online/offline
+// track heartbeat loss (no metrics within the server's grace period).
+const (
+	ServerEventConnect    = "connect"
+	ServerEventDisconnect = "disconnect"
+	ServerEventOnline     = "online"
+	ServerEventOffline    = "offline"
+)
+
+// ServerEvent is a row of the server_events table
+type ServerEvent struct {
+	ID        int64  `json:"id"`
+	ServerID  string `json:"server_id"`
+	Type      string `json:"type"`
+	Timestamp string `json:"timestamp"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// DowntimeInterval is a period during which a server was offline
+type DowntimeInterval struct {
+	Start        string `json:"start"`
+	End          string `json:"end,omitempty"` // Empty while the server is still offline
+	DurationSecs int64  `json:"duration_secs"`
+	PlannedSecs  int64  `json:"planned_secs"` // Part within maintenance windows of the server
+	Planned      bool   `json:"planned"`      // Entirely within maintenance windows
+	Ongoing      bool   `json:"ongoing"`
+}
+
+// newDowntimeInterval builds the interval from start to end; ongoing intervals have no end yet
+func newDowntimeInterval(serverID string, start, end time.Time, ongoing bool) DowntimeInterval {
+	iv := DowntimeInterval{
+		Start:        start.Format(time.RFC3339),
+		DurationSecs: int64(end.Sub(start).Seconds()),
+		PlannedSecs:  int64(plannedDowntime(serverID, start, end).Seconds()),
+		Ongoing:      ongoing,
+	}
+	if !ongoing {
+		iv.End = end.Format(time.RFC3339)
+	}
+	iv.Planned = iv.DurationSecs > 0 && iv.PlannedSecs >= iv.DurationSecs
+	return iv
+}
+
+// isAgentOnline reports whether the server's last metrics arrived within its grace period
+func isAgentOnline(server *RemoteServer, data *AgentMetricsData, now time.Time) bool {
+	if data == nil {
+		return false
+	}
+	return now.Sub(data.LastUpdated) < server.OfflineGrace()
+}
+
+// ============================================================================
+// Connectivity Tracker
+// ============================================================================
+
+// ConnectivityTracker turns agent connections and heartbeat loss into persisted events
+type ConnectivityTracker struct {
+	mu        sync.Mutex
+	online    map[string]bool // Last recorded online/offline state per server
+	startedAt time.Time
+}
+
+// NewConnectivityTracker restores the last known online/offline state of every server
+func NewConnectivityTracker(db *sql.DB) *ConnectivityTracker {
+	t := &ConnectivityTracker{
+		online:    make(map[string]bool),
+		startedAt: time.Now(),
+	}
+
+	rows, err := db.Query(`
+		SELECT server_id, type FROM server_events
+		WHERE id IN (
+			SELECT MAX(id) FROM server_events
+			WHERE type IN (?, ?)
+			GROUP BY server_id
+		)`, ServerEventOnline, ServerEventOffline)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to restore server states: %v\n", err)
+		return t
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var serverID, eventType string
+		if rows.Scan(&serverID, &eventType) == nil {
+			t.online[serverID] = eventType == ServerEventOnline
+		}
+	}
+	return t
+}
+
+// AgentConnected records an authenticated agent WebSocket connection
+func (t *ConnectivityTracker) AgentConnected(serverID, clientIP string) {
+	recordServerEvent(serverID, ServerEventConnect, time.Now().UTC(), clientIP)
+}
+
+// AgentDisconnected records the agent WebSocket going away
+func (t *ConnectivityTracker) AgentDisconnected(serverID string) {
+	recordServerEvent(serverID, ServerEventDisconnect, time.Now().UTC(), "")
+}
+
+// Check applies the staleness rule to every server and records online/offline transitions
+func (t *ConnectivityTracker) Check(servers []RemoteServer, agentMetrics map[string]*AgentMetricsData, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	known := make(map[string]bool, len(servers))
+	for i := range servers {
+		server := &servers[i]
+		known[server.ID] = true
+
+		metricsData := agentMetrics[server.ID]
+		online := isAgentOnline(server, metricsData, now)
+
+		prev, seen := t.online[server.ID]
+		if seen && prev == online {
+			continue
+		}
+
+		if online {
+			t.online[server.ID] = true
+			recordServerEvent(server.ID, ServerEventOnline, metricsData.LastUpdated.UTC(), "")
+			continue
+		}
+
+		// A server that was never online has nothing to transition from
+		if !seen {
+			continue
+		}
+
+		// Give agents a chance to reconnect after a dashboard restart
+		grace := server.OfflineGrace()
+		if now.Sub(t.startedAt) < grace {
+			continue
+		}
+
+		// Downtime starts when the last heartbeat arrived, not when it was noticed
+		lastSeen := now.Add(-grace)
+		if metricsData != nil {
+			lastSeen = metricsData.LastUpdated
+		} else if last := GetLastMetricsTime(server.ID); last != nil {
+			lastSeen = *last
+		}
+
+		t.online[server.ID] = false
+		recordServerEvent(server.ID, ServerEventOffline, lastSeen.UTC(),
+			fmt.Sprintf("no metrics for %ds", int(now.Sub(lastSeen).Seconds())))
+	}
+
+	// Forget deleted servers
+	for id := range t.online {
+		if !known[id] {
+			delete(t.online, id)
+		}
+	}
+}
+
+// ============================================================================
+// Server Event Persistence
+// ============================================================================
+
+func recordServerEvent(serverID, eventType string, ts time.Time, detail string) {
+	if eventType == ServerEventOnline || eventType == ServerEventOffline {
+		fmt.Printf("📶 Server %s is %s\n", serverID, eventType)
+	}
+	if dbWriter == nil {
+		return
+	}
+	timestamp := ts.Format(time.RFC3339)
+	dbWriter.WriteAsync(func(db *sql.DB) error {
+		_, err := db.Exec(`INSERT INTO server_events (server_id, type, timestamp, detail) VALUES (?, ?, ?, ?)`,
+			serverID, eventType, timestamp, detail)
+		return err
+	})
+}
+
+// ServerEventFilter narrows down server event queries
+type ServerEventFilter struct {
+	ServerID string
+	Type     string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+func queryServerEvents(db *sql.DB, f ServerEventFilter) ([]ServerEvent, error) {
+	query := `SELECT id, server_id, type, timestamp, detail FROM server_events WHERE server_id = ?`
+	args := []interface{}{f.ServerID}
+	if f.Type != "" {
+		query += " AND type = ?"
+		args = append(args, f.Type)
+	}
+	if !f.From.IsZero() {
+		query += " AND timestamp >= ?"
+		args = append(args, f.From.UTC().Format(time.RFC3339))
+	}
+	if !f.To.IsZero() {
+		query += " AND timestamp <= ?"
+		args = append(args, f.To.UTC().Format(time.RFC3339))
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	query += " ORDER BY timestamp DESC, id DESC LIMIT ? OFFSET ?"
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ServerEvent{}
+	for rows.Next() {
+		var ev ServerEvent
+		if err := rows.Scan(&ev.ID, &ev.ServerID, &ev.Type, &ev.Timestamp, &ev.Detail); err != nil {
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// queryDowntime pairs offline/online events into downtime intervals clipped to [from, to]. Times
+// within maintenance windows are counted as planned (see SetActiveMaintenance).
+func queryDowntime(db *sql.DB, serverID string, from, to time.Time) ([]DowntimeInterval, error) {
+	fromStr := from.UTC().Format(time.RFC3339)
+	toStr := to.UTC().Format(time.RFC3339)
+
+	// State at the start of the window comes from the last transition before it
+	var startType string
+	err := db.QueryRow(`
+		SELECT type FROM server_events
+		WHERE server_id = ? AND type IN (?, ?) AND timestamp < ?
+		ORDER BY timestamp DESC, id DESC LIMIT 1`,
+		serverID, ServerEventOnline, ServerEventOffline, fromStr).Scan(&startType)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT type, timestamp FROM server_events
+		WHERE server_id = ? AND type IN (?, ?) AND timestamp >= ? AND timestamp <= ?
+		ORDER BY timestamp ASC, id ASC`,
+		serverID, ServerEventOnline, ServerEventOffline, fromStr, toStr)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	intervals := []DowntimeInterval{}
+	var downSince *time.Time
+	if startType == ServerEventOffline {
+		start := from.UTC()
+		downSince = &start
+	}
+
+	for rows.Next() {
+		var eventType, timestamp string
+		if err := rows.Scan(&eventType, &timestamp); err != nil {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			continue
+		}
+
+		switch eventType {
+		case ServerEventOffline:
+			if downSince == nil {
+				downSince = &ts
+			}
+		case ServerEventOnline:
+			if downSince != nil {
+				intervals = append(intervals, newDowntimeInterval(serverID, *downSince, ts, false))
+				downSince = nil
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Still offline at the end of the window
+	if downSince != nil {
+		end := to.UTC()
+		now := time.Now().UTC()
+		ongoing := !end.Before(now)
+		if ongoing {
+			end = now
+		}
+		intervals = append(intervals, newDowntimeInterval(serverID, *downSince, end, ongoing))
+	}
+
+	return intervals, nil
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"vstats/internal/common"
+)
+
+// ============================================================================
+// History Export
+// ============================================================================
+
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatJSONL = "jsonl"
+
+	ExportTypeMetrics = "metrics"
+	ExportTypePing    = "ping"
+)
+
+// exportFlushRows is how many rows are written between flushes of the underlying writer
+const exportFlushRows = 1000
+
+// HistoryExportOptions selects what ExportHistory writes
+type HistoryExportOptions struct {
+	Servers     []RemoteServer
+	Type        string // metrics or ping
+	Format      string // csv or jsonl
+	From        time.Time
+	To          time.Time
+	Granularity HistoryGranularity
+	Flush       func() // Optional, called periodically so HTTP clients receive data early
+}
+
+// Validate checks format and type
+func (o *HistoryExportOptions) Validate() error {
+	if o.Format != ExportFormatCSV && o.Format != ExportFormatJSONL {
+		return fmt.Errorf("unsupported format %q: use csv or jsonl", o.Format)
+	}
+	if o.Type != ExportTypeMetrics && o.Type != ExportTypePing {
+		return fmt.Errorf("unsupported type %q: use metrics or ping", o.Type)
+	}
+	if !o.From.Before(o.To) {
+		return fmt.Errorf("from must be before to")
+	}
+	return nil
+}
+
+var (
+	metricsExportColumns = []string{"server_id", "server_name", "timestamp", "cpu_avg", "cpu_max", "memory_avg", "memory_max", "disk_avg", "net_rx", "net_tx", "ping_avg", "samples"}
+	pingExportColumns    = []string{"server_id", "server_name", "timestamp", "target", "host", "latency_avg", "latency_max", "ok_count", "fail_count", "loss_percent"}
+)
+
+// ExportHistory streams history rows of every selected server to w, one row at a time.
+// Rows are streamed straight from the granularity table, so memory use does not grow with the window.
+func ExportHistory(st Storage, w io.Writer, opts HistoryExportOptions) (int64, error) {
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+
+	columns := metricsExportColumns
+	if opts.Type == ExportTypePing {
+		columns = pingExportColumns
+	}
+	out := newExportWriter(w, opts.Format, columns)
+	if err := out.Header(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for i := range opts.Servers {
+		n, err := exportServerHistory(st, out, &opts.Servers[i], opts, total)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, out.Close()
+}
+
+func exportServerHistory(st Storage, out *exportWriter, server *RemoteServer, opts HistoryExportOptions, written int64) (int64, error) {
+	gran := opts.Granularity
+	fromBucket, toBucket := opts.From.Unix()/gran.BucketSecs, opts.To.Unix()/gran.BucketSecs
+
+	var n int64
+	emit := func(bucket int64, values []interface{}) error {
+		timestamp := time.Unix(bucket*gran.BucketSecs, 0).UTC().Format(time.RFC3339)
+		values = append([]interface{}{server.ID, server.Name, timestamp}, values...)
+		if err := out.Row(values); err != nil {
+			return err
+		}
+		n++
+
+		if (written+n)%exportFlushRows == 0 {
+			if err := out.Flush(); err != nil {
+				return err
+			}
+			if opts.Flush != nil {
+				opts.Flush()
+			}
+		}
+		return nil
+	}
+
+	if opts.Type == ExportTypeMetrics {
+		err := st.ScanMetricBuckets(server.ID, gran.Name, fromBucket, toBucket, func(b *common.BucketData) error {
+			var cpuAvg, memAvg, diskAvg float64
+			if b.SampleCount > 0 {
+				cpuAvg = b.CPUSum / float64(b.SampleCount)
+				memAvg = b.MemorySum / float64(b.SampleCount)
+				diskAvg = b.DiskSum / float64(b.SampleCount)
+			}
+			var pingAvg sql.NullFloat64
+			if b.PingCount > 0 {
+				pingAvg = sql.NullFloat64{Float64: b.PingSum / float64(b.PingCount), Valid: true}
+			}
+			return emit(b.Bucket, []interface{}{cpuAvg, b.CPUMax, memAvg, b.MemoryMax, diskAvg,
+				int64(b.NetRx), int64(b.NetTx), pingAvg, int64(b.SampleCount)})
+		})
+		return n, err
+	}
+
+	err := st.ScanPingBuckets(server.ID, gran.Name, fromBucket, toBucket, func(p *common.PingBucketData) error {
+		var latencyAvg, latencyMax sql.NullFloat64
+		if p.LatencyCount > 0 {
+			latencyAvg = sql.NullFloat64{Float64: p.LatencySum / float64(p.LatencyCount), Valid: true}
+			latencyMax = sql.NullFloat64{Float64: p.LatencyMax, Valid: true}
+		}
+		okCount, failCount := int64(p.OkCount), int64(p.FailCount)
+		var loss sql.NullFloat64
+		if pct := percentOf(failCount, okCount+failCount); pct != nil {
+			loss = sql.NullFloat64{Float64: *pct, Valid: true}
+		}
+		return emit(p.Bucket, []interface{}{p.TargetName, p.TargetHost, latencyAvg, latencyMax, okCount, failCount, loss})
+	})
+	return n, err
+}
+
+// exportWriter renders rows as CSV or JSON Lines
+type exportWriter struct {
+	format  string
+	columns []string
+	buf     *bufio.Writer
+	csv     *csv.Writer
+}
+
+func newExportWriter(w io.Writer, format string, columns []string) *exportWriter {
+	ew := &exportWriter{format: format, columns: columns, buf: bufio.NewWriter(w)}
+	if format == ExportFormatCSV {
+		ew.csv = csv.NewWriter(ew.buf)
+	}
+	return ew
+}
+
+func (w *exportWriter) Header() error {
+	if w.csv != nil {
+		return w.csv.Write(w.columns)
+	}
+	return nil
+}
+
+func (w *exportWriter) Row(values []interface{}) error {
+	if w.csv != nil {
+		record := make([]string, len(values))
+		for i, v := range values {
+			record[i] = formatExportValue(v)
+		}
+		return w.csv.Write(record)
+	}
+
+	// Hand-built object keeps the column order of the CSV export
+	w.buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			w.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(w.columns[i])
+		w.buf.Write(key)
+		w.buf.WriteByte(':')
+		if nf, ok := v.(sql.NullFloat64); ok {
+			if !nf.Valid {
+				w.buf.WriteString("null")
+				continue
+			}
+			v = nf.Float64
+		}
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		w.buf.Write(value)
+	}
+	_, err := w.buf.WriteString("}\n")
+	return err
+}
+
+func (w *exportWriter) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return w.buf.Flush()
+}
+
+func (w *exportWriter) Close() error {
+	return w.Flush()
+}
+
+func formatExportValue(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case sql.NullFloat64:
+		if !x.Valid {
+			return ""
+		}
+		return strconv.FormatFloat(x.Float64, 'f', -1, 64)
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// ============================================================================
+// Export Command
+// ============================================================================
+
+// runExportCommand implements `vstats-server export`, reading the database and config of this installation
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	serverList := fs.String("server", "", "Comma-separated server IDs or names (default: all servers)")
+	fromStr := fs.String("from", "", "Start time, RFC3339 or unix seconds (default: 24 hours before -to)")
+	toStr := fs.String("to", "", "End time, RFC3339 or unix seconds (default: now)")
+	step := fs.String("step", "", "Duration or granularity (5sec, 2min, 15min, hourly, daily); default: finest table holding -from")
+	format := fs.String("format", ExportFormatCSV, "Output format: csv or jsonl")
+	dataType := fs.String("type", ExportTypeMetrics, "Data to export: metrics or ping")
+	output := fs.String("o", "", "Output file (default: stdout)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	now := time.Now().UTC()
+	to, err := parseTimeParam(*toStr, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	from, err := parseTimeParam(*fromStr, to.Add(-24*time.Hour))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	gran, err := exportGranularity(*step, from, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	// Read the config without LoadConfig, which would create or rewrite it
+	config, err := readConfigFile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to read config %s: %v\n", GetConfigPath(), err)
+		return 1
+	}
+	if config == nil {
+		config = &AppConfig{}
+	}
+
+	// The server inventory lives in SQLite, whichever backend holds the metrics
+	if !fileExists(GetDBPath()) {
+		fmt.Fprintf(os.Stderr, "❌ Database not found: %s\n", GetDBPath())
+		return 1
+	}
+	sqliteDB, err := sql.Open("sqlite", GetDBPath()+"?_busy_timeout=5000")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to open database: %v\n", err)
+		return 1
+	}
+	defer sqliteDB.Close()
+	// Databases not yet migrated still have their servers in the config file
+	if tableExists(sqliteDB, "settings") {
+		if _, err := LoadInventory(sqliteDB, config); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to read servers: %v\n", err)
+			return 1
+		}
+	}
+
+	servers, err := selectExportServers(append([]RemoteServer{config.localServer()}, config.Servers...), *serverList)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	var db *sql.DB
+	storage := config.Storage.Resolve()
+	if storage.Driver == StorageDriverSQLite {
+		db = sqliteDB
+	}
+	st, err := OpenStorage(storage, db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to open %s storage: %v\n", storage.Driver, err)
+		return 1
+	}
+	defer st.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	rows, err := ExportHistory(st, w, HistoryExportOptions{
+		Servers:     servers,
+		Type:        *dataType,
+		Format:      *format,
+		From:        from,
+		To:          to,
+		Granularity: gran,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Export failed after %d rows: %v\n", rows, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "✅ Exported %d %s rows (%s, %s granularity) for %d server(s)\n", rows, *dataType, *format, gran.Name, len(servers))
+	return 0
+}
+
+// exportGranularity resolves the step of an export; without one the finest table holding from is used
+func exportGranularity(step string, from, now time.Time) (HistoryGranularity, error) {
+	if step == "" {
+		return PickHistoryGranularity(from, 0, now), nil
+	}
+	return historyGranularityParam(step, from, now, now)
+}
+
+// localServer describes the dashboard server, which records its own history as "local"
+func (c *AppConfig) localServer() RemoteServer {
+	name := c.LocalNode.Name
+	if name == "" {
+		name = "Dashboard Server"
+	}
+	return RemoteServer{ID: "local", Name: name}
+}
+
+// selectExportServers picks servers by ID or name from a comma-separated list; an empty list selects all
+func selectExportServers(servers []RemoteServer, list string) ([]RemoteServer, error) {
+	if strings.TrimSpace(list) == "" || list == "all" {
+		return servers, nil
+	}
+	var selected []RemoteServer
+	for _, want := range strings.Split(list, ",") {
+		want = strings.TrimSpace(want)
+		found := false
+		for _, server := range servers {
+			if server.ID == want || server.Name == want {
+				selected = append(selected, server)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("server not found: %s", want)
+		}
+	}
+	return selected, nil
+}
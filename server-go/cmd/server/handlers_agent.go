@@ -33,10 +33,15 @@ func (s *AppState) RegisterAgent(c *gin.Context) {
 	}
 
 	s.ConfigMu.Lock()
+	if err := SaveServer(s.DB, server); err != nil {
+		s.ConfigMu.Unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register server"})
+		return
+	}
 	s.Config.Servers = append(s.Config.Servers, server)
-	SaveConfig(s.Config)
 	s.ConfigMu.Unlock()
 
+	s.recordAudit(c, "server.register", "server", serverID, nil, auditSnapshot(server))
 	c.JSON(http.StatusOK, AgentRegisterResponse{
 		ID:    serverID,
 		Token: agentToken,
@@ -189,6 +194,7 @@ func (s *AppState) UpdateAgent(c *gin.Context) {
 	data, _ := json.Marshal(cmd)
 	select {
 	case conn.SendChan <- data:
+		s.recordAudit(c, "agent.update", "server", serverID, nil, auditSnapshot(req))
 		c.JSON(http.StatusOK, UpdateAgentResponse{
 			Success: true,
 			Message: "Update command sent to agent",
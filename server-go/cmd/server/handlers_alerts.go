@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// Alert Rule Handlers
+// ============================================================================
+
+type AlertRuleRequest struct {
+	Name         string   `json:"name"`
+	Metric       string   `json:"metric"`
+	Operator     string   `json:"operator"`
+	Threshold    float64  `json:"threshold"`
+	DurationSecs int      `json:"duration_secs"`
+	CooldownSecs int      `json:"cooldown_secs"`
+	ServerIDs    []string `json:"server_ids,omitempty"`
+	DimensionID  string   `json:"dimension_id,omitempty"`
+	OptionID     string   `json:"option_id,omitempty"`
+	Channels     []string `json:"channels,omitempty"`
+	Enabled      *bool    `json:"enabled,omitempty"`
+}
+
+func (s *AppState) ListAlertRules(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Alerts.Rules())
+}
+
+func (s *AppState) GetAlertRule(c *gin.Context) {
+	id := c.Param("id")
+	for _, r := range s.Alerts.Rules() {
+		if r.ID == id {
+			c.JSON(http.StatusOK, r)
+			return
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+}
+
+func (s *AppState) AddAlertRule(c *gin.Context) {
+	var req AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	rule := AlertRule{
+		ID:        uuid.New().String(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Enabled:   true,
+	}
+	req.applyTo(&rule)
+
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		return saveAlertRule(db, &rule)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save alert rule"})
+		return
+	}
+
+	s.Alerts.ReloadRules()
+	c.JSON(http.StatusOK, rule)
+}
+
+func (s *AppState) UpdateAlertRule(c *gin.Context) {
+	id := c.Param("id")
+
+	var req AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var rule *AlertRule
+	for _, r := range s.Alerts.Rules() {
+		if r.ID == id {
+			copied := r
+			rule = &copied
+			break
+		}
+	}
+	if rule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+
+	req.applyTo(rule)
+	rule.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		return saveAlertRule(db, rule)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save alert rule"})
+		return
+	}
+
+	if !rule.Enabled {
+		s.Alerts.ResolveRule(rule.ID)
+	}
+	s.Alerts.ReloadRules()
+	c.JSON(http.StatusOK, rule)
+}
+
+func (s *AppState) DeleteAlertRule(c *gin.Context) {
+	id := c.Param("id")
+
+	var found bool
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		var err error
+		found, err = deleteAlertRule(db, id)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete alert rule"})
+		return
+	}
+
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Alert rule not found"})
+		return
+	}
+
+	s.Alerts.ResolveRule(id)
+	s.Alerts.ReloadRules()
+	c.Status(http.StatusOK)
+}
+
+// applyTo copies request fields onto a rule
+func (req *AlertRuleRequest) applyTo(rule *AlertRule) {
+	rule.Name = req.Name
+	rule.Metric = req.Metric
+	rule.Operator = req.Operator
+	rule.Threshold = req.Threshold
+	rule.DurationSecs = req.DurationSecs
+	rule.CooldownSecs = req.CooldownSecs
+	rule.ServerIDs = req.ServerIDs
+	rule.DimensionID = req.DimensionID
+	rule.OptionID = req.OptionID
+	rule.Channels = req.Channels
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+}
+
+// ============================================================================
+// Alert Status Handlers
+// ============================================================================
+
+func (s *AppState) GetActiveAlerts(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Alerts.ActiveAlerts())
+}
+
+func (s *AppState) GetAlertHistory(c *gin.Context, db *sql.DB) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	events, err := queryAlertHistory(db, AlertHistoryFilter{
+		ServerID: c.Query("server_id"),
+		RuleID:   c.Query("rule_id"),
+		Status:   c.Query("status"),
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch alert history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // ============================================================================
@@ -14,48 +14,47 @@ import (
 // ============================================================================
 
 func (s *AppState) Login(c *gin.Context) {
+	ip := c.ClientIP()
+	if wait := s.LoginGuard.Wait(ip, time.Now()); wait > 0 {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many failed login attempts, try again later",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	// Clients of the single-user versions only send the password
+	if req.Username == "" {
+		req.Username = DefaultAdminUsername
+	}
 
-	s.ConfigMu.RLock()
-	passwordHash := s.Config.AdminPasswordHash
-	s.ConfigMu.RUnlock()
-
-	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
-		// If password verification fails, try reloading config from disk
-		// This handles the case where password was reset while server is running
-		if newConfig, _ := LoadConfig(); newConfig != nil {
-			s.ConfigMu.Lock()
-			oldHash := s.Config.AdminPasswordHash
-			s.Config.AdminPasswordHash = newConfig.AdminPasswordHash
-			s.ConfigMu.Unlock()
-
-			// Try again with reloaded password hash
-			if err := bcrypt.CompareHashAndPassword([]byte(newConfig.AdminPasswordHash), []byte(req.Password)); err != nil {
-				// Still failed, restore old hash and return error
-				s.ConfigMu.Lock()
-				s.Config.AdminPasswordHash = oldHash
-				s.ConfigMu.Unlock()
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
-				return
-			}
-			// Success after reload, continue with login
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
-			return
+	user, err := getUserByUsername(s.DB, req.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+	if !checkLoginPassword(user, req.Password) {
+		s.LoginGuard.Failed(ip, req.Username, time.Now())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+		return
+	}
+	if user.TOTPEnabled && !s.checkSecondFactor(c, user.ID, req.TOTPCode, req.RecoveryCode) {
+		// Asking for the code is part of a normal login; only a wrong code counts as a failure
+		if req.TOTPCode != "" || req.RecoveryCode != "" {
+			s.LoginGuard.Failed(ip, req.Username, time.Now())
 		}
+		return
 	}
+	s.LoginGuard.Succeeded(ip)
 
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": "admin",
-		"exp": expiresAt.Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(GetJWTSecret()))
+	tokenString, expiresAt, err := s.issueSession(c, user, "")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -64,35 +63,80 @@ func (s *AppState) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, LoginResponse{
 		Token:     tokenString,
 		ExpiresAt: expiresAt,
+		User:      user,
 	})
 }
 
 func (s *AppState) VerifyToken(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "valid"})
+	c.JSON(http.StatusOK, gin.H{"status": "valid", "user": currentUser(c)})
 }
 
 func (s *AppState) ChangePassword(c *gin.Context) {
 	var req ChangePasswordRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || req.NewPassword == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	s.ConfigMu.Lock()
-	defer s.ConfigMu.Unlock()
-
-	if err := bcrypt.CompareHashAndPassword([]byte(s.Config.AdminPasswordHash), []byte(req.CurrentPassword)); err != nil {
+	user := currentUser(c)
+	// Accounts created for OAuth login only have no current password
+	if user.HasPassword && !user.CheckPassword(req.CurrentPassword) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid current password"})
 		return
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-	if err != nil {
+	if err := user.SetPassword(req.NewPassword); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
+	user.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := SaveUser(s.DB, user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save password"})
+		return
+	}
 
-	s.Config.AdminPasswordHash = string(hash)
-	SaveConfig(s.Config)
+	// Log out everywhere, then hand this client a fresh session
+	if _, err := RevokeUserSessions(s.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	tokenString, expiresAt, err := s.issueSession(c, user, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, LoginResponse{
+		Token:     tokenString,
+		ExpiresAt: expiresAt,
+		User:      user,
+	})
+}
+
+// ============================================================================
+// Login Protection Handlers
+// ============================================================================
+
+type LoginBlocksResponse struct {
+	GlobalPausedUntil string       `json:"global_paused_until,omitempty"` // Set while password logins are paused for everyone
+	Blocks            []LoginBlock `json:"blocks"`
+}
+
+// ListLoginBlocks lists the IPs with recent failed logins
+func (s *AppState) ListLoginBlocks(c *gin.Context) {
+	blocks, globalUntil := s.LoginGuard.Blocks(time.Now())
+	resp := LoginBlocksResponse{Blocks: blocks}
+	if !globalUntil.IsZero() {
+		resp.GlobalPausedUntil = globalUntil.UTC().Format(time.RFC3339)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// UnblockLogin clears the failed logins of an IP, lifting its backoff or lockout
+func (s *AppState) UnblockLogin(c *gin.Context) {
+	if !s.LoginGuard.Unblock(c.Param("ip")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No failed logins recorded for this IP"})
+		return
+	}
+	s.recordAudit(c, "login_block.delete", "ip", c.Param("ip"), nil, nil)
 	c.Status(http.StatusOK)
 }
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Availability Handlers
+// ============================================================================
+
+// findServer returns a copy of a configured server
+func (s *AppState) findServer(id string) (RemoteServer, bool) {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+	for _, server := range s.Config.Servers {
+		if server.ID == id {
+			return server, true
+		}
+	}
+	return RemoteServer{}, false
+}
+
+// parseWindow reads from/to query parameters, defaulting to the last 30 days
+func parseWindow(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now().UTC()
+	from, err := parseTimeParam(c.Query("from"), now.AddDate(0, 0, -30))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return time.Time{}, time.Time{}, false
+	}
+	to, err := parseTimeParam(c.Query("to"), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return time.Time{}, time.Time{}, false
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// GetServerAvailability returns the availability of a server, including per ping target
+func (s *AppState) GetServerAvailability(c *gin.Context, db *sql.DB) {
+	server, ok := s.findServer(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		return
+	}
+	if s.hiddenFromRequest(c, server.ID) {
+		return
+	}
+
+	from, to, ok := parseWindow(c)
+	if !ok {
+		return
+	}
+
+	report, err := computeAvailability(db, metricsStore, &server, from, to, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute availability"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetServerMonthlyAvailability returns one availability report per calendar month (UTC), newest first
+func (s *AppState) GetServerMonthlyAvailability(c *gin.Context, db *sql.DB) {
+	server, ok := s.findServer(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		return
+	}
+	if s.hiddenFromRequest(c, server.ID) {
+		return
+	}
+
+	months, _ := strconv.Atoi(c.DefaultQuery("months", "12"))
+	if months <= 0 || months > 36 {
+		months = 12
+	}
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	type monthlyReport struct {
+		Month string `json:"month"`
+		*AvailabilityReport
+	}
+
+	reports := make([]monthlyReport, 0, months)
+	for i := 0; i < months; i++ {
+		start := monthStart.AddDate(0, -i, 0)
+		end := start.AddDate(0, 1, 0)
+
+		report, err := computeAvailability(db, metricsStore, &server, start, end, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute availability"})
+			return
+		}
+		reports = append(reports, monthlyReport{Month: start.Format("2006-01"), AvailabilityReport: report})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":  server.ID,
+		"sla_target": server.SLATarget,
+		"months":     reports,
+	})
+}
+
+// GetDimensionAvailability aggregates server availability per option of a group dimension
+func (s *AppState) GetDimensionAvailability(c *gin.Context, db *sql.DB) {
+	dimensionID := c.Param("id")
+
+	s.ConfigMu.RLock()
+	var dimension *GroupDimension
+	for i := range s.Config.GroupDimensions {
+		if s.Config.GroupDimensions[i].ID == dimensionID {
+			d := s.Config.GroupDimensions[i]
+			dimension = &d
+			break
+		}
+	}
+	servers := append([]RemoteServer(nil), s.Config.Servers...)
+	s.ConfigMu.RUnlock()
+
+	if dimension == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dimension not found"})
+		return
+	}
+
+	from, to, ok := parseWindow(c)
+	if !ok {
+		return
+	}
+	_, public := s.publicView(c)
+
+	type optionAvailability struct {
+		OptionID            string                `json:"option_id"`
+		Name                string                `json:"name"`
+		MonitoredSecs       int64                 `json:"monitored_secs"`
+		DowntimeSecs        int64                 `json:"downtime_secs"`
+		PlannedDowntimeSecs int64                 `json:"planned_downtime_secs"`
+		Incidents           int                   `json:"incidents"`
+		AvailabilityPercent *float64              `json:"availability_percent"`
+		Servers             []*AvailabilityReport `json:"servers"`
+	}
+
+	options := make([]optionAvailability, 0, len(dimension.Options))
+	for _, opt := range dimension.Options {
+		result := optionAvailability{OptionID: opt.ID, Name: opt.Name, Servers: []*AvailabilityReport{}}
+
+		// Servers without connectivity events contribute their sample coverage instead
+		var coverageSum float64
+		var coverageCount int
+		for i := range servers {
+			if servers[i].GroupValues[dimensionID] != opt.ID || (public && servers[i].Hidden) {
+				continue
+			}
+			report, err := computeAvailability(db, metricsStore, &servers[i], from, to, false)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute availability"})
+				return
+			}
+			result.Servers = append(result.Servers, report)
+			result.MonitoredSecs += report.MonitoredSecs
+			result.DowntimeSecs += report.DowntimeSecs
+			result.PlannedDowntimeSecs += report.PlannedDowntimeSecs
+			result.Incidents += report.Incidents
+			if report.UptimePercent == nil && report.AvailabilityPercent != nil {
+				coverageSum += *report.AvailabilityPercent
+				coverageCount++
+			}
+		}
+
+		if result.MonitoredSecs > 0 {
+			result.AvailabilityPercent = percentOf(result.MonitoredSecs-result.DowntimeSecs, result.MonitoredSecs)
+		} else if coverageCount > 0 {
+			avg := coverageSum / float64(coverageCount)
+			result.AvailabilityPercent = &avg
+		}
+		options = append(options, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dimension_id": dimension.ID,
+		"from":         from.Format(time.RFC3339),
+		"to":           to.Format(time.RFC3339),
+		"options":      options,
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Backup Handlers
+// ============================================================================
+
+// DownloadBackup streams a backup archive of the database and config. The JWT secret stays on
+// the server, so the archive cannot be used to forge sessions.
+func (s *AppState) DownloadBackup(c *gin.Context) {
+	config, err := s.configSnapshot(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to serialize config"})
+		return
+	}
+
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, backupFileName(time.Now())))
+	if err := WriteBackup(s.DB, config, metricsStore.Driver(), c.Writer); err != nil {
+		// The snapshot is taken before anything is written, so most errors can still be reported
+		if !c.Writer.Written() {
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		fmt.Printf("Backup download failed: %v\n", err)
+	}
+}
+
+func (s *AppState) GetBackupSettings(c *gin.Context) {
+	s.ConfigMu.RLock()
+	settings := s.Config.Backup
+	s.ConfigMu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings":  settings,
+		"effective": settings.Effective(),
+		"backups":   listBackups(settings.Effective().Dir),
+	})
+}
+
+func (s *AppState) UpdateBackupSettings(c *gin.Context) {
+	var settings BackupSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if settings.IntervalHours < 0 || settings.Keep < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval_hours and keep must not be negative"})
+		return
+	}
+
+	s.ConfigMu.Lock()
+	s.Config.Backup = settings
+	err := SaveSettings(s.DB, s.Config, SettingBackup)
+	s.ConfigMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save backup settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"settings":  settings,
+		"effective": settings.Effective(),
+		"backups":   listBackups(settings.Effective().Dir),
+	})
+}
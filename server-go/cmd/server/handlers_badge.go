@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Badge Handlers
+// ============================================================================
+
+const (
+	badgeLiveMaxAge   = 30  // Seconds clients may cache the status, cpu and latency badges
+	badgeUptimeMaxAge = 300 // Seconds clients may cache the uptime badge
+)
+
+// badgeRanges are the windows the uptime badge can cover
+var badgeRanges = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
+
+// GetBadge serves /badge/:server_id/{status,uptime,cpu,latency}.svg. Hidden servers answer like
+// unknown ones unless the request is logged in; as <img> tags cannot send headers, an API token
+// can be passed as ?token=. ?label= replaces the label, an empty one drops it.
+func (s *AppState) GetBadge(c *gin.Context) {
+	kind, ok := strings.CutSuffix(c.Param("badge"), ".svg")
+	server, known, hidden := s.badgeServer(c.Param("server_id"))
+	if known && hidden && s.optionalUser(c, ScopeMetricsRead) == nil {
+		known = false
+	}
+	if !ok || !known {
+		writeBadge(c, http.StatusNotFound, "no-cache", "badge", "not found", BadgeGrey)
+		return
+	}
+
+	cacheControl := "public"
+	if hidden {
+		cacheControl = "private"
+	}
+	maxAge := badgeLiveMaxAge
+	now := time.Now()
+
+	var label, value, color string
+	switch kind {
+	case "status":
+		label = server.Name
+		value, color = s.statusBadge(&server, now)
+	case "uptime":
+		rangeStr := c.DefaultQuery("range", "30d")
+		window, ok := badgeRanges[rangeStr]
+		if !ok {
+			writeBadge(c, http.StatusBadRequest, "no-cache", "uptime", "invalid range", BadgeGrey)
+			return
+		}
+		report, err := computeAvailability(s.DB, metricsStore, &server, now.Add(-window), now, false)
+		if err != nil {
+			writeBadge(c, http.StatusInternalServerError, "no-cache", "uptime", "error", BadgeGrey)
+			return
+		}
+		label, value, color = "uptime "+rangeStr, "n/a", BadgeGrey
+		if report.AvailabilityPercent != nil {
+			value, color = formatBadgePercent(*report.AvailabilityPercent), uptimeBadgeColor(*report.AvailabilityPercent)
+		}
+		maxAge = badgeUptimeMaxAge
+	case "cpu":
+		label, value, color = "cpu", "offline", BadgeGrey
+		if metrics := s.badgeMetrics(&server, now); metrics != nil {
+			usage := float64(metrics.CPU.Usage)
+			value, color = fmt.Sprintf("%.1f%%", usage), cpuBadgeColor(usage)
+		}
+	case "latency":
+		label = "latency"
+		value, color = latencyBadge(s.badgeMetrics(&server, now), c.Query("target"))
+	default:
+		writeBadge(c, http.StatusNotFound, "no-cache", "badge", "not found", BadgeGrey)
+		return
+	}
+
+	if custom, ok := c.GetQuery("label"); ok {
+		label = badgeLabel(custom)
+	}
+	writeBadge(c, http.StatusOK, fmt.Sprintf("%s, max-age=%d", cacheControl, maxAge), label, value, color)
+}
+
+// badgeServer looks up a server, or "local" for the dashboard server, and whether it is hidden
+func (s *AppState) badgeServer(id string) (RemoteServer, bool, bool) {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+
+	hidden := s.Config.serverHidden(id)
+	if id == "local" {
+		return s.Config.localServer(), true, hidden
+	}
+	for _, server := range s.Config.Servers {
+		if server.ID == id {
+			return server, true, hidden
+		}
+	}
+	return RemoteServer{}, false, false
+}
+
+func (s *AppState) badgeOnline(server *RemoteServer, now time.Time) bool {
+	if server.ID == "local" {
+		return true
+	}
+	s.AgentMetricsMu.RLock()
+	data := s.AgentMetrics[server.ID]
+	s.AgentMetricsMu.RUnlock()
+	return isAgentOnline(server, data, now)
+}
+
+// badgeMetrics returns the current metrics of a server, or nil while it is offline
+func (s *AppState) badgeMetrics(server *RemoteServer, now time.Time) *SystemMetrics {
+	if server.ID == "local" {
+		metrics := CollectMetrics()
+		return &metrics
+	}
+	s.AgentMetricsMu.RLock()
+	defer s.AgentMetricsMu.RUnlock()
+	data := s.AgentMetrics[server.ID]
+	if !isAgentOnline(server, data, now) {
+		return nil
+	}
+	metrics := data.Metrics
+	return &metrics
+}
+
+func (s *AppState) statusBadge(server *RemoteServer, now time.Time) (string, string) {
+	if inMaintenance, _ := maintenanceAt(server.ID, now); inMaintenance {
+		return "maintenance", BadgeBlue
+	}
+	if s.badgeOnline(server, now) {
+		return "online", BadgeBrightGreen
+	}
+	return "offline", BadgeRed
+}
+
+// latencyBadge shows the latency to the ping target named or addressed by target, or the
+// average over all targets that answer
+func latencyBadge(metrics *SystemMetrics, target string) (string, string) {
+	if metrics == nil {
+		return "offline", BadgeGrey
+	}
+	if metrics.Ping == nil {
+		return "n/a", BadgeGrey
+	}
+	var sum float64
+	matched, answered := 0, 0
+	for _, t := range metrics.Ping.Targets {
+		if target != "" && t.Name != target && t.Host != target {
+			continue
+		}
+		matched++
+		if t.Status == "ok" && t.LatencyMs != nil {
+			sum += *t.LatencyMs
+			answered++
+		}
+	}
+	switch {
+	case matched == 0:
+		return "n/a", BadgeGrey
+	case answered == 0:
+		return "timeout", BadgeRed
+	}
+	avg := sum / float64(answered)
+	return fmt.Sprintf("%.0f ms", avg), latencyBadgeColor(avg)
+}
+
+// writeBadge answers with a badge and an ETag, so clients revalidating an unchanged badge get
+// 304 without the body
+func writeBadge(c *gin.Context, status int, cacheControl, label, value, color string) {
+	svg := renderBadge(label, value, color)
+	sum := sha256.Sum256(svg)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	c.Header("Cache-Control", cacheControl)
+	c.Header("ETag", etag)
+	if status == http.StatusOK && c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(status, "image/svg+xml; charset=utf-8", svg)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Server Event Handlers
+// ============================================================================
+
+// GetServerEvents returns connect/disconnect/online/offline events of a server, newest first
+func (s *AppState) GetServerEvents(c *gin.Context, db *sql.DB) {
+	serverID := c.Param("id")
+	if s.hiddenFromRequest(c, serverID) {
+		return
+	}
+
+	from, err := parseTimeParam(c.Query("from"), time.Time{})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c.Query("to"), time.Time{})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	events, err := queryServerEvents(db, ServerEventFilter{
+		ServerID: serverID,
+		Type:     c.Query("type"),
+		From:     from,
+		To:       to,
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch server events"})
+		return
+	}
+
+	// Details include the addresses agents connect from, which visitors must not see
+	if s.optionalUser(c, ScopeMetricsRead) == nil {
+		for i := range events {
+			events[i].Detail = ""
+		}
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// GetServerDowntime returns offline intervals of a server (default: last 7 days)
+func (s *AppState) GetServerDowntime(c *gin.Context, db *sql.DB) {
+	serverID := c.Param("id")
+	if s.hiddenFromRequest(c, serverID) {
+		return
+	}
+	now := time.Now().UTC()
+
+	from, err := parseTimeParam(c.Query("from"), now.Add(-7*24*time.Hour))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseTimeParam(c.Query("to"), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	intervals, err := queryDowntime(db, serverID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute downtime"})
+		return
+	}
+
+	var total, planned int64
+	for _, iv := range intervals {
+		total += iv.DurationSecs
+		planned += iv.PlannedSecs
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"server_id":    serverID,
+		"from":         from.UTC().Format(time.RFC3339),
+		"to":           to.UTC().Format(time.RFC3339),
+		"total_secs":   total,
+		"planned_secs": planned,
+		"intervals":    intervals,
+	})
+}
+
+// parseTimeParam parses an RFC3339 timestamp or unix seconds, returning def for an empty value
+func parseTimeParam(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: use RFC3339 or unix seconds", value)
+	}
+	return t.UTC(), nil
+}
+
+// parseDurationParam parses seconds (with optional fraction) or a duration such as 30s, 5m, 1h, 1d, 1w
+func parseDurationParam(value string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour} {
+		if n, err := strconv.Atoi(strings.TrimSuffix(value, suffix)); err == nil && strings.HasSuffix(value, suffix) {
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"net/http"
 	"sync"
@@ -20,12 +19,22 @@ type LocalMetricsResponse struct {
 }
 
 func (s *AppState) GetMetrics(c *gin.Context) {
+	if s.hiddenFromRequest(c, "local") {
+		return
+	}
+	visibility, public := s.publicView(c)
 	metrics := CollectMetrics()
 
 	s.ConfigMu.RLock()
 	localNode := s.Config.LocalNode
 	s.ConfigMu.RUnlock()
 
+	if public {
+		metrics = *visibility.redactMetrics(&metrics)
+		if visibility.HidePrices {
+			localNode.PriceAmount, localNode.PricePeriod, localNode.PurchaseDate = "", "", ""
+		}
+	}
 	c.JSON(http.StatusOK, LocalMetricsResponse{
 		SystemMetrics: metrics,
 		LocalNode:     localNode,
@@ -33,6 +42,8 @@ func (s *AppState) GetMetrics(c *gin.Context) {
 }
 
 func (s *AppState) GetAllMetrics(c *gin.Context) {
+	visibility, public := s.publicView(c)
+
 	s.ConfigMu.RLock()
 	servers := s.Config.Servers
 	s.ConfigMu.RUnlock()
@@ -42,11 +53,11 @@ func (s *AppState) GetAllMetrics(c *gin.Context) {
 
 	var updates []ServerMetricsUpdate
 	for _, server := range servers {
-		metricsData := s.AgentMetrics[server.ID]
-		online := false
-		if metricsData != nil {
-			online = time.Since(metricsData.LastUpdated).Seconds() < 30
+		if public && server.Hidden {
+			continue
 		}
+		metricsData := s.AgentMetrics[server.ID]
+		online := isAgentOnline(&server, metricsData, time.Now())
 
 		version := server.Version
 		if metricsData != nil && metricsData.Metrics.Version != "" {
@@ -58,7 +69,7 @@ func (s *AppState) GetAllMetrics(c *gin.Context) {
 			metrics = &metricsData.Metrics
 		}
 
-		updates = append(updates, ServerMetricsUpdate{
+		update := ServerMetricsUpdate{
 			ServerID:     server.ID,
 			ServerName:   server.Name,
 			Location:     server.Location,
@@ -73,7 +84,11 @@ func (s *AppState) GetAllMetrics(c *gin.Context) {
 			PricePeriod:  server.PricePeriod,
 			PurchaseDate: server.PurchaseDate,
 			TipBadge:     server.TipBadge,
-		})
+		}
+		if public {
+			visibility.redactUpdate(&update)
+		}
+		updates = append(updates, update)
 	}
 
 	c.JSON(http.StatusOK, updates)
@@ -83,8 +98,16 @@ func (s *AppState) GetAllMetrics(c *gin.Context) {
 // History Handler
 // ============================================================================
 
-func (s *AppState) GetHistory(c *gin.Context, db *sql.DB) {
+func (s *AppState) GetHistory(c *gin.Context) {
 	serverID := c.Param("server_id")
+	if s.hiddenFromRequest(c, serverID) {
+		return
+	}
+	s.serveHistory(c, serverID)
+}
+
+// serveHistory answers a history request for a server the caller may see
+func (s *AppState) serveHistory(c *gin.Context, serverID string) {
 	rangeStr := c.DefaultQuery("range", "24h")
 	dataType := c.DefaultQuery("type", "all") // "ping", "metrics", or "all"
 	sinceStr := c.Query("since")              // Bucket number for incremental updates
@@ -94,6 +117,12 @@ func (s *AppState) GetHistory(c *gin.Context, db *sql.DB) {
 		fmt.Sscanf(sinceStr, "%d", &sinceBucket)
 	}
 
+	// Explicit from/to windows bypass the rolling ranges and the cache
+	if c.Query("from") != "" || c.Query("to") != "" {
+		s.getHistoryWindow(c, serverID, dataType)
+		return
+	}
+
 	// Only use cache for 1h and 24h ranges with type=all
 	useCache := (rangeStr == "1h" || rangeStr == "24h" || rangeStr == "") && dataType == "all" && historyCache != nil
 
@@ -123,12 +152,12 @@ func (s *AppState) GetHistory(c *gin.Context, db *sql.DB) {
 
 		go func() {
 			defer wg.Done()
-			data, metricsErr = GetHistorySince(db, serverID, rangeStr, sinceBucket)
+			data, metricsErr = metricsStore.History(serverID, rangeStr, sinceBucket)
 		}()
 
 		go func() {
 			defer wg.Done()
-			pingTargets, pingErr = GetPingHistorySince(db, serverID, rangeStr, sinceBucket)
+			pingTargets, pingErr = metricsStore.PingHistory(serverID, rangeStr, sinceBucket)
 		}()
 
 		wg.Wait()
@@ -140,13 +169,13 @@ func (s *AppState) GetHistory(c *gin.Context, db *sql.DB) {
 		// Ignore ping errors, just return empty if failed
 		_ = pingErr
 	} else if dataType == "metrics" {
-		data, metricsErr = GetHistorySince(db, serverID, rangeStr, sinceBucket)
+		data, metricsErr = metricsStore.History(serverID, rangeStr, sinceBucket)
 		if metricsErr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
 			return
 		}
 	} else if dataType == "ping" {
-		pingTargets, _ = GetPingHistorySince(db, serverID, rangeStr, sinceBucket)
+		pingTargets, _ = metricsStore.PingHistory(serverID, rangeStr, sinceBucket)
 	}
 
 	// Calculate last bucket from the data
@@ -176,6 +205,163 @@ func (s *AppState) GetHistory(c *gin.Context, db *sql.DB) {
 	})
 }
 
+// getHistoryWindow serves GetHistory for from/to (RFC3339 or unix seconds). The granularity table is
+// chosen from step, which is either a duration ("30s", "5m", "1h") or a granularity name ("5sec",
+// "2min", "15min", "hourly", "daily"); without step the window is resolved into about 720 points.
+func (s *AppState) getHistoryWindow(c *gin.Context, serverID, dataType string) {
+	now := time.Now().UTC()
+	to, err := parseTimeParam(c.Query("to"), now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, err := parseTimeParam(c.Query("from"), to.Add(-24*time.Hour))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	gran, err := historyGranularityParam(c.Query("step"), from, to, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var data []HistoryPoint
+	var pingTargets []PingHistoryTarget
+
+	if dataType == "all" || dataType == "metrics" {
+		data, err = GetHistoryRange(metricsStore, serverID, gran, from, to)
+		// Agent-provided tables can be sparse; fall back to coarser ones that still resolve the window
+		for err == nil && len(data) == 0 && c.Query("step") == "" {
+			next, ok := coarserHistoryGranularity(gran, to.Sub(from))
+			if !ok {
+				break
+			}
+			gran = next
+			data, err = GetHistoryRange(metricsStore, serverID, gran, from, to)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch history"})
+			return
+		}
+	}
+	if dataType == "all" || dataType == "ping" {
+		// Ignore ping errors, just return empty if failed
+		pingTargets, _ = GetPingHistoryRange(metricsStore, serverID, gran, from, to)
+	}
+
+	c.JSON(http.StatusOK, HistoryResponse{
+		ServerID:    serverID,
+		Range:       "custom",
+		From:        from.Format(time.RFC3339),
+		To:          to.Format(time.RFC3339),
+		Granularity: gran.Name,
+		Data:        data,
+		PingTargets: pingTargets,
+	})
+}
+
+// coarserHistoryGranularity returns the next coarser granularity if its buckets are shorter than span
+func coarserHistoryGranularity(gran HistoryGranularity, span time.Duration) (HistoryGranularity, bool) {
+	list := historyGranularities()
+	for i, g := range list[:len(list)-1] {
+		if g.Name == gran.Name {
+			next := list[i+1]
+			return next, time.Duration(next.BucketSecs)*time.Second < span
+		}
+	}
+	return HistoryGranularity{}, false
+}
+
+// historyGranularityParam resolves the step parameter of a history window query
+func historyGranularityParam(step string, from, to, now time.Time) (HistoryGranularity, error) {
+	if step == "" {
+		return PickHistoryGranularity(from, to.Sub(from)/720, now), nil
+	}
+	for _, g := range historyGranularities() {
+		if g.Name == step {
+			return g, nil
+		}
+	}
+	d, err := parseDurationParam(step)
+	if err != nil || d <= 0 {
+		return HistoryGranularity{}, fmt.Errorf("invalid step %q: use a duration or one of 5sec, 2min, 15min, hourly, daily", step)
+	}
+	return PickHistoryGranularity(from, d, now), nil
+}
+
+// ============================================================================
+// History Export Handler
+// ============================================================================
+
+// ExportServerHistory streams metrics or ping history as CSV or JSON Lines.
+// Use "all" as server ID to export every server, "local" for the dashboard server.
+func (s *AppState) ExportServerHistory(c *gin.Context) {
+	serverID := c.Param("server_id")
+
+	var servers []RemoteServer
+	switch serverID {
+	case "all":
+		s.ConfigMu.RLock()
+		servers = append([]RemoteServer{s.Config.localServer()}, s.Config.Servers...)
+		s.ConfigMu.RUnlock()
+	case "local":
+		s.ConfigMu.RLock()
+		servers = []RemoteServer{s.Config.localServer()}
+		s.ConfigMu.RUnlock()
+	default:
+		server, ok := s.findServer(serverID)
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+			return
+		}
+		servers = []RemoteServer{server}
+	}
+
+	from, to, ok := parseWindow(c)
+	if !ok {
+		return
+	}
+	gran, err := exportGranularity(c.Query("step"), from, time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := HistoryExportOptions{
+		Servers:     servers,
+		Type:        c.DefaultQuery("type", ExportTypeMetrics),
+		Format:      c.DefaultQuery("format", ExportFormatCSV),
+		From:        from,
+		To:          to,
+		Granularity: gran,
+		Flush:       c.Writer.Flush,
+	}
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if opts.Format == ExportFormatJSONL {
+		contentType = "application/x-ndjson"
+	}
+	filename := fmt.Sprintf("vstats-%s-%s-%s.%s", serverID, opts.Type, from.Format("20060102T150405Z"), opts.Format)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	// Headers are already sent, so a failure can only cut the stream short
+	if _, err := ExportHistory(metricsStore, c.Writer, opts); err != nil {
+		fmt.Printf("⚠️  History export for %s failed: %v\n", serverID, err)
+	}
+}
+
 // ============================================================================
 // Health Check
 // ============================================================================
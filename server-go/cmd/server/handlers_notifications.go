@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// Notification Settings Handlers
+// ============================================================================
+
+func (s *AppState) GetNotificationSettings(c *gin.Context) {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+	c.JSON(http.StatusOK, maskNotificationSettings(s.Config.Notifications))
+}
+
+func (s *AppState) UpdateNotificationSettings(c *gin.Context) {
+	var settings NotificationSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if settings.MaxRetries < 0 || settings.RetryBaseSecs < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_retries and retry_base_secs must not be negative"})
+		return
+	}
+	if settings.Channels == nil {
+		settings.Channels = []NotificationChannel{}
+	}
+
+	s.ConfigMu.Lock()
+	defer s.ConfigMu.Unlock()
+
+	seen := make(map[string]bool)
+	for i := range settings.Channels {
+		ch := &settings.Channels[i]
+		if ch.ID == "" {
+			ch.ID = uuid.New().String()
+		}
+		if seen[ch.ID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Duplicate channel id: " + ch.ID})
+			return
+		}
+		seen[ch.ID] = true
+
+		restoreChannelSecrets(ch, s.Config.Notifications.Channels)
+		if err := ch.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	s.Config.Notifications = settings
+	if err := SaveSettings(s.DB, s.Config, SettingNotifications); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, maskNotificationSettings(settings))
+}
+
+// notificationSettings returns a snapshot of the notification settings for the dispatcher
+func (s *AppState) notificationSettings() NotificationSettings {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+	settings := s.Config.Notifications
+	settings.Channels = append([]NotificationChannel(nil), s.Config.Notifications.Channels...)
+	return settings
+}
+
+// ============================================================================
+// Test Notification Handler
+// ============================================================================
+
+type TestNotificationRequest struct {
+	ChannelID string               `json:"channel_id,omitempty"` // Test a saved channel
+	Channel   *NotificationChannel `json:"channel,omitempty"`    // Or test an unsaved configuration (admins only)
+}
+
+func (s *AppState) TestNotification(c *gin.Context) {
+	var req TestNotificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	s.ConfigMu.RLock()
+	existing := append([]NotificationChannel(nil), s.Config.Notifications.Channels...)
+	s.ConfigMu.RUnlock()
+
+	var channel *NotificationChannel
+	if req.Channel != nil {
+		// Unsaved channels can send stored credentials to a destination of the caller's choice,
+		// so they need the same rights as editing the settings
+		if user := currentUser(c); user == nil || !user.Role.Allows(RoleAdmin) || currentAPITokenID(c) != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Testing unsaved channels requires an admin login"})
+			return
+		}
+		channel = req.Channel
+		restoreChannelSecrets(channel, existing)
+	} else {
+		for i := range existing {
+			if existing[i].ID == req.ChannelID {
+				channel = &existing[i]
+				break
+			}
+		}
+		if channel == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Channel not found"})
+			return
+		}
+	}
+
+	if err := SendTestNotification(channel); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -51,10 +50,19 @@ func (s *AppState) GetOAuthProviders(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	response := gin.H{
 		"providers":   providers,
 		"centralized": centralized,
-	})
+	}
+	// OIDC is always self-hosted, so it is offered in both modes
+	if oidc := s.Config.OAuth.oidcProvider(); oidc != nil {
+		providers["oidc"] = true
+		response["oidc_name"] = oidc.DisplayName
+		if oidc.DisplayName == "" {
+			response["oidc_name"] = "SSO"
+		}
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // GetOAuthSettings returns OAuth configuration (admin only)
@@ -88,6 +96,22 @@ func (s *AppState) GetOAuthSettings(c *gin.Context) {
 				"allowed_users": s.Config.OAuth.Google.AllowedUsers,
 			}
 		}
+		if oidc := s.Config.OAuth.OIDC; oidc != nil {
+			response["oidc"] = gin.H{
+				"enabled":         oidc.Enabled,
+				"display_name":    oidc.DisplayName,
+				"issuer":          oidc.Issuer,
+				"client_id":       oidc.ClientID,
+				"has_secret":      oidc.ClientSecret != "",
+				"scopes":          oidc.Scopes,
+				"allowed_users":   oidc.AllowedUsers,
+				"allowed_domains": oidc.AllowedDomains,
+				"allowed_groups":  oidc.AllowedGroups,
+				"groups_claim":    oidc.GroupsClaim,
+				"default_role":    oidc.DefaultRole,
+				"callback_url":    getCallbackURL(c, "oidc"),
+			}
+		}
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -110,16 +134,24 @@ func (s *AppState) UpdateOAuthSettings(c *gin.Context) {
 			ClientSecret string   `json:"client_secret,omitempty"`
 			AllowedUsers []string `json:"allowed_users"`
 		} `json:"google,omitempty"`
+		OIDC *OIDCProvider `json:"oidc,omitempty"` // An empty client_secret keeps the current one
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	if req.OIDC != nil {
+		if err := validateOIDCProvider(req.OIDC); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
 
+	before := auditSnapshot(s.Config.OAuth)
 	if s.Config.OAuth == nil {
 		s.Config.OAuth = &OAuthConfig{}
 	}
@@ -157,7 +189,18 @@ func (s *AppState) UpdateOAuthSettings(c *gin.Context) {
 		s.Config.OAuth.Google.AllowedUsers = req.Google.AllowedUsers
 	}
 
-	SaveConfig(s.Config)
+	if req.OIDC != nil {
+		if req.OIDC.ClientSecret == "" && s.Config.OAuth.OIDC != nil {
+			req.OIDC.ClientSecret = s.Config.OAuth.OIDC.ClientSecret
+		}
+		s.Config.OAuth.OIDC = req.OIDC
+	}
+
+	if err := SaveSettings(s.DB, s.Config, SettingOAuth); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save OAuth settings"})
+		return
+	}
+	s.recordAudit(c, "settings.update", "settings", SettingOAuth, before, auditSnapshot(s.Config.OAuth))
 	c.JSON(http.StatusOK, gin.H{"status": "updated"})
 }
 
@@ -258,14 +301,15 @@ func (s *AppState) GitHubOAuthCallback(c *gin.Context) {
 		return
 	}
 
-	// Check if user is allowed
-	if !isUserAllowed(oauth.GitHub.AllowedUsers, user.Login) {
-		redirectWithError(c, "User not authorized: "+user.Login)
+	// Find the user this account is linked to
+	account, err := s.oauthUser("github", user.Login, oauth.GitHub.AllowedUsers)
+	if err != nil {
+		redirectWithError(c, err.Error())
 		return
 	}
 
 	// Generate JWT token
-	token, expiresAt, err := generateJWTToken(user.Login, "github")
+	token, expiresAt, err := s.issueSession(c, account, "github")
 	if err != nil {
 		redirectWithError(c, "Failed to generate token")
 		return
@@ -371,14 +415,15 @@ func (s *AppState) GoogleOAuthCallback(c *gin.Context) {
 		return
 	}
 
-	// Check if user is allowed
-	if !isUserAllowed(oauth.Google.AllowedUsers, user.Email) {
-		redirectWithError(c, "User not authorized: "+user.Email)
+	// Find the user this account is linked to
+	account, err := s.oauthUser("google", user.Email, oauth.Google.AllowedUsers)
+	if err != nil {
+		redirectWithError(c, err.Error())
 		return
 	}
 
 	// Generate JWT token
-	token, expiresAt, err := generateJWTToken(user.Email, "google")
+	token, expiresAt, err := s.issueSession(c, account, "google")
 	if err != nil {
 		redirectWithError(c, "Failed to generate token")
 		return
@@ -388,6 +433,114 @@ func (s *AppState) GoogleOAuthCallback(c *gin.Context) {
 	redirectWithToken(c, token, expiresAt, "google", user.Email)
 }
 
+// OpenID Connect handlers
+func (s *AppState) OIDCOAuthStart(c *gin.Context) {
+	s.ConfigMu.RLock()
+	oidc := s.Config.OAuth.oidcProvider()
+	s.ConfigMu.RUnlock()
+
+	if oidc == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "OIDC not configured"})
+		return
+	}
+
+	discovery, err := discoverOIDC(oidc.Issuer)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "OIDC " + err.Error()})
+		return
+	}
+
+	state := uuid.New().String()
+	stateData := &OAuthStateData{
+		Provider:     "oidc",
+		State:        state,
+		CreatedAt:    time.Now().Unix(),
+		CodeVerifier: oidcRandom(),
+		Nonce:        oidcRandom(),
+	}
+
+	oauthStatesMu.Lock()
+	oauthStates[state] = stateData
+	oauthStatesMu.Unlock()
+
+	go cleanupOAuthStates()
+
+	authURL := oidcAuthURL(discovery, oidc, getCallbackURL(c, "oidc"), state, stateData.Nonce, stateData.CodeVerifier)
+	c.JSON(http.StatusOK, gin.H{"url": authURL})
+}
+
+func (s *AppState) OIDCOAuthCallback(c *gin.Context) {
+	if errorMsg := c.Query("error"); errorMsg != "" {
+		redirectWithError(c, strings.TrimSpace(errorMsg+" "+c.Query("error_description")))
+		return
+	}
+
+	code := c.Query("code")
+	state := c.Query("state")
+
+	if code == "" || state == "" {
+		redirectWithError(c, "Missing code or state parameter")
+		return
+	}
+
+	// Verify state
+	oauthStatesMu.Lock()
+	stateData, exists := oauthStates[state]
+	if exists {
+		delete(oauthStates, state)
+	}
+	oauthStatesMu.Unlock()
+
+	if !exists || stateData.Provider != "oidc" {
+		redirectWithError(c, "Invalid state parameter")
+		return
+	}
+
+	s.ConfigMu.RLock()
+	oidc := s.Config.OAuth.oidcProvider()
+	s.ConfigMu.RUnlock()
+
+	if oidc == nil {
+		redirectWithError(c, "OIDC not configured")
+		return
+	}
+
+	discovery, err := discoverOIDC(oidc.Issuer)
+	if err != nil {
+		redirectWithError(c, "OIDC "+err.Error())
+		return
+	}
+
+	// Exchange code for the ID token and verify it
+	idToken, err := exchangeOIDCCode(discovery, oidc, code, getCallbackURL(c, "oidc"), stateData.CodeVerifier)
+	if err != nil {
+		redirectWithError(c, "Failed to exchange code: "+err.Error())
+		return
+	}
+	claims, err := verifyOIDCToken(discovery, oidc, idToken, stateData.Nonce)
+	if err != nil {
+		redirectWithError(c, err.Error())
+		return
+	}
+
+	// Find or create the user this account logs in as
+	account, err := s.oidcUser(oidc, claims)
+	if err != nil {
+		redirectWithError(c, err.Error())
+		return
+	}
+
+	// Generate JWT token
+	token, expiresAt, err := s.issueSession(c, account, "oidc")
+	if err != nil {
+		redirectWithError(c, "Failed to generate token")
+		return
+	}
+
+	// Redirect to frontend with token
+	redirectWithToken(c, token, expiresAt, "oidc", claims.Email)
+}
+
 // ProxyOAuthCallback handles OAuth callback from centralized OAuth proxy (vstats.zsoft.cc)
 func (s *AppState) ProxyOAuthCallback(c *gin.Context) {
 	state := c.Query("state")
@@ -436,14 +589,15 @@ func (s *AppState) ProxyOAuthCallback(c *gin.Context) {
 		return
 	}
 
-	// Check allowed users (from centralized config)
-	if !isUserAllowed(oauth.AllowedUsers, user) {
-		redirectWithError(c, "User not authorized: "+user)
+	// Find the user this account is linked to (allowed users come from the centralized config)
+	account, err := s.oauthUser(provider, user, oauth.AllowedUsers)
+	if err != nil {
+		redirectWithError(c, err.Error())
 		return
 	}
 
 	// Generate JWT token
-	token, expiresAt, err := generateJWTToken(user, provider)
+	token, expiresAt, err := s.issueSession(c, account, provider)
 	if err != nil {
 		redirectWithError(c, "Failed to generate token")
 		return
@@ -458,6 +612,11 @@ func (s *AppState) ProxyOAuthCallback(c *gin.Context) {
 // ============================================================================
 
 func getCallbackURL(c *gin.Context, provider string) string {
+	return fmt.Sprintf("%s/api/auth/oauth/%s/callback", requestBaseURL(c), provider)
+}
+
+// requestBaseURL returns the scheme and host the client reached this server at
+func requestBaseURL(c *gin.Context) string {
 	protocol := "https"
 
 	// Priority: X-Forwarded-Proto header > TLS detection > localhost fallback
@@ -472,7 +631,7 @@ func getCallbackURL(c *gin.Context, provider string) string {
 		protocol = "http"
 	}
 
-	return fmt.Sprintf("%s://%s/api/auth/oauth/%s/callback", protocol, c.Request.Host, provider)
+	return fmt.Sprintf("%s://%s", protocol, c.Request.Host)
 }
 
 func exchangeGitHubCode(code, clientID, clientSecret, redirectURI string) (*GitHubTokenResponse, error) {
@@ -588,20 +747,20 @@ func isUserAllowed(allowedUsers []string, identifier string) bool {
 	return false
 }
 
-func generateJWTToken(sub, provider string) (string, time.Time, error) {
-	expiresAt := time.Now().Add(7 * 24 * time.Hour)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub":      sub,
-		"provider": provider,
-		"exp":      expiresAt.Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(GetJWTSecret()))
+// oauthUser returns the user an OAuth account logs in as: the user it is linked to, or for
+// accounts on the provider's allow-list (the single-user way of granting access) the first admin
+func (s *AppState) oauthUser(provider, subject string, allowedUsers []string) (*User, error) {
+	user, err := getUserByIdentity(s.DB, provider, subject)
+	if err == nil && user == nil && isUserAllowed(allowedUsers, subject) {
+		user, err = firstAdmin(s.DB)
+	}
 	if err != nil {
-		return "", time.Time{}, err
+		return nil, fmt.Errorf("Failed to load user")
 	}
-
-	return tokenString, expiresAt, nil
+	if user == nil {
+		return nil, fmt.Errorf("User not authorized: %s", subject)
+	}
+	return user, nil
 }
 
 func redirectWithToken(c *gin.Context, token string, expiresAt time.Time, provider, username string) {
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Prometheus Query API Handlers
+// ============================================================================
+//
+// A read-only subset of the Prometheus HTTP API over stored history, so Grafana
+// can use vstats as a Prometheus data source. Queries must be plain series
+// selectors; the history table is chosen from the requested step.
+
+// promMaxPoints mirrors the per-series resolution limit of Prometheus
+const promMaxPoints = 11000
+
+func promSuccess(c *gin.Context, data interface{}) {
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": data})
+}
+
+func promError(c *gin.Context, status int, errorType, message string) {
+	c.JSON(status, gin.H{"status": "error", "errorType": errorType, "error": message})
+}
+
+// promAPISnapshot checks access and returns the configured servers and dimensions.
+// It answers the request itself and returns false when the request must stop.
+func (s *AppState) promAPISnapshot(c *gin.Context) ([]RemoteServer, []GroupDimension, bool) {
+	s.ConfigMu.RLock()
+	settings := s.Config.Prometheus
+	servers := prometheusServers(settings, s.Config.Servers)
+	dimensions := append([]GroupDimension(nil), s.Config.GroupDimensions...)
+	s.ConfigMu.RUnlock()
+
+	switch checkPrometheusAccess(c, settings) {
+	case http.StatusNotFound:
+		promError(c, http.StatusNotFound, "unavailable", "Prometheus API is disabled")
+		return nil, nil, false
+	case http.StatusUnauthorized:
+		promError(c, http.StatusUnauthorized, "unauthorized", "Unauthorized")
+		return nil, nil, false
+	}
+
+	// Grafana sends form-encoded POST bodies by default
+	if err := c.Request.ParseForm(); err != nil {
+		promError(c, http.StatusBadRequest, "bad_data", err.Error())
+		return nil, nil, false
+	}
+	return servers, dimensions, true
+}
+
+// PromQueryRange implements /api/v1/query_range
+func (s *AppState) PromQueryRange(c *gin.Context) {
+	servers, dimensions, ok := s.promAPISnapshot(c)
+	if !ok {
+		return
+	}
+	form := c.Request.Form
+
+	now := time.Now().UTC()
+	start, err := parsePromTime(form.Get("start"), time.Time{})
+	if err != nil || start.IsZero() {
+		promError(c, http.StatusBadRequest, "bad_data", "invalid parameter \"start\"")
+		return
+	}
+	end, err := parsePromTime(form.Get("end"), time.Time{})
+	if err != nil || end.IsZero() {
+		promError(c, http.StatusBadRequest, "bad_data", "invalid parameter \"end\"")
+		return
+	}
+	if end.Before(start) {
+		promError(c, http.StatusBadRequest, "bad_data", "end timestamp must not be before start time")
+		return
+	}
+	step, err := parseDurationParam(form.Get("step"))
+	if err != nil || step <= 0 {
+		promError(c, http.StatusBadRequest, "bad_data", "invalid parameter \"step\": zero or negative query resolution step widths are not accepted")
+		return
+	}
+	if end.Sub(start)/step > promMaxPoints {
+		promError(c, http.StatusBadRequest, "bad_data", "exceeded maximum resolution of 11,000 points per timeseries. Try decreasing the query resolution (?step=XX)")
+		return
+	}
+
+	query := form.Get("query")
+	if v, ok := evalPromScalar(query); ok {
+		values := [][]interface{}{}
+		for t := start; !t.After(end); t = t.Add(step) {
+			values = append(values, promValue(t, v))
+		}
+		promSuccess(c, gin.H{"resultType": "matrix", "result": []gin.H{{"metric": gin.H{}, "values": values}}})
+		return
+	}
+	matchers, err := parsePromSelector(query)
+	if err != nil {
+		promError(c, http.StatusBadRequest, "bad_data", err.Error())
+		return
+	}
+
+	gran := PickHistoryGranularity(start, step, now)
+	lookback := promLookback(gran)
+	series, err := selectPromSeries(metricsStore, servers, dimensions, matchers, gran, start.Add(-lookback), end)
+	if err != nil {
+		promError(c, http.StatusInternalServerError, "internal", "Failed to query history")
+		return
+	}
+
+	result := []gin.H{}
+	for i := range series {
+		values := stepPromPoints(series[i].Points, start, end, step, lookback)
+		if len(values) == 0 {
+			continue
+		}
+		result = append(result, gin.H{"metric": series[i].LabelMap(), "values": values})
+	}
+	promSuccess(c, gin.H{"resultType": "matrix", "result": result})
+}
+
+// PromQuery implements /api/v1/query for selectors and scalar literals
+func (s *AppState) PromQuery(c *gin.Context) {
+	servers, dimensions, ok := s.promAPISnapshot(c)
+	if !ok {
+		return
+	}
+	form := c.Request.Form
+
+	now := time.Now().UTC()
+	at, err := parsePromTime(form.Get("time"), now)
+	if err != nil {
+		promError(c, http.StatusBadRequest, "bad_data", "invalid parameter \"time\"")
+		return
+	}
+
+	query := form.Get("query")
+	if v, ok := evalPromScalar(query); ok {
+		promSuccess(c, gin.H{"resultType": "scalar", "result": promValue(at, v)})
+		return
+	}
+	matchers, err := parsePromSelector(query)
+	if err != nil {
+		promError(c, http.StatusBadRequest, "bad_data", err.Error())
+		return
+	}
+
+	gran := PickHistoryGranularity(at.Add(-5*time.Minute), 5*time.Minute, now)
+	lookback := promLookback(gran)
+	series, err := selectPromSeries(metricsStore, servers, dimensions, matchers, gran, at.Add(-lookback), at)
+	if err != nil {
+		promError(c, http.StatusInternalServerError, "internal", "Failed to query history")
+		return
+	}
+
+	result := []gin.H{}
+	for i := range series {
+		values := stepPromPoints(series[i].Points, at, at, time.Second, lookback)
+		if len(values) == 0 {
+			continue
+		}
+		result = append(result, gin.H{"metric": series[i].LabelMap(), "value": values[0]})
+	}
+	promSuccess(c, gin.H{"resultType": "vector", "result": result})
+}
+
+// PromSeries implements /api/v1/series (default window: the last 24 hours)
+func (s *AppState) PromSeries(c *gin.Context) {
+	servers, dimensions, ok := s.promAPISnapshot(c)
+	if !ok {
+		return
+	}
+	form := c.Request.Form
+
+	start, end, ok := parsePromWindow(c)
+	if !ok {
+		return
+	}
+	selectors := form["match[]"]
+	if len(selectors) == 0 {
+		promError(c, http.StatusBadRequest, "bad_data", "no match[] parameter provided")
+		return
+	}
+
+	// Existence only matters here, so read about as many buckets as a dashboard graph would
+	gran := PickHistoryGranularity(start, end.Sub(start)/720, time.Now().UTC())
+
+	seen := make(map[string]bool)
+	result := []map[string]string{}
+	for _, selector := range selectors {
+		matchers, err := parsePromSelector(selector)
+		if err != nil {
+			promError(c, http.StatusBadRequest, "bad_data", err.Error())
+			return
+		}
+		series, err := selectPromSeries(metricsStore, servers, dimensions, matchers, gran, start, end)
+		if err != nil {
+			promError(c, http.StatusInternalServerError, "internal", "Failed to query history")
+			return
+		}
+		for i := range series {
+			key := promSeriesKey(series[i].Labels)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			result = append(result, series[i].LabelMap())
+		}
+	}
+	promSuccess(c, result)
+}
+
+// PromLabels implements /api/v1/labels
+func (s *AppState) PromLabels(c *gin.Context) {
+	_, dimensions, ok := s.promAPISnapshot(c)
+	if !ok {
+		return
+	}
+	promSuccess(c, promLabelNames(dimensions))
+}
+
+// PromLabelValues implements /api/v1/label/:name/values
+func (s *AppState) PromLabelValues(c *gin.Context) {
+	servers, dimensions, ok := s.promAPISnapshot(c)
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+
+	set := make(map[string]bool)
+	switch name {
+	case "__name__":
+		for _, metric := range promHistoryMetrics {
+			set[metric.Name] = true
+		}
+	case "target", "host":
+		targets, err := metricsStore.PingTargets()
+		if err != nil {
+			promError(c, http.StatusInternalServerError, "internal", "Failed to query label values")
+			return
+		}
+		for _, t := range targets {
+			if name == "host" {
+				set[t.Host] = true
+			} else {
+				set[t.Name] = true
+			}
+		}
+	default:
+		for i := range servers {
+			for _, l := range serverPromLabels(&servers[i], dimensions) {
+				if l.Name == name {
+					set[l.Value] = true
+				}
+			}
+		}
+	}
+
+	values := make([]string, 0, len(set))
+	for v := range set {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	promSuccess(c, values)
+}
+
+// ============================================================================
+// Parameter Parsing
+// ============================================================================
+
+// parsePromTime accepts unix seconds (with optional fraction) or RFC3339, returning def for an empty value
+func parsePromTime(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		whole, frac := math.Modf(secs)
+		return time.Unix(int64(whole), int64(frac*1e9)).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", value)
+	}
+	return t.UTC(), nil
+}
+
+// parsePromWindow reads optional start/end parameters, defaulting to the last 24 hours
+func parsePromWindow(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now().UTC()
+	end, err := parsePromTime(c.Request.Form.Get("end"), now)
+	if err != nil {
+		promError(c, http.StatusBadRequest, "bad_data", "invalid parameter \"end\"")
+		return time.Time{}, time.Time{}, false
+	}
+	start, err := parsePromTime(c.Request.Form.Get("start"), end.Add(-24*time.Hour))
+	if err != nil {
+		promError(c, http.StatusBadRequest, "bad_data", "invalid parameter \"start\"")
+		return time.Time{}, time.Time{}, false
+	}
+	if end.Before(start) {
+		promError(c, http.StatusBadRequest, "bad_data", "end timestamp must not be before start time")
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
+func promSeriesKey(labels []promLabel) string {
+	var b strings.Builder
+	for _, l := range labels {
+		b.WriteString(l.Name)
+		b.WriteByte(0)
+		b.WriteString(l.Value)
+		b.WriteByte(0)
+	}
+	return b.String()
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Prometheus Exporter Handler
+// ============================================================================
+
+// PrometheusMetrics serves the latest metrics of every agent in Prometheus text format
+func (s *AppState) PrometheusMetrics(c *gin.Context) {
+	s.ConfigMu.RLock()
+	settings := s.Config.Prometheus
+	servers := prometheusServers(settings, s.Config.Servers)
+	dimensions := append([]GroupDimension(nil), s.Config.GroupDimensions...)
+	s.ConfigMu.RUnlock()
+
+	switch checkPrometheusAccess(c, settings) {
+	case http.StatusNotFound:
+		c.String(http.StatusNotFound, "Prometheus exporter is disabled\n")
+		return
+	case http.StatusUnauthorized:
+		c.String(http.StatusUnauthorized, "Unauthorized\n")
+		return
+	}
+
+	s.AgentMetricsMu.RLock()
+	agentMetrics := make(map[string]*AgentMetricsData, len(s.AgentMetrics))
+	for k, v := range s.AgentMetrics {
+		agentMetrics[k] = v
+	}
+	s.AgentMetricsMu.RUnlock()
+
+	now := time.Now()
+	r := newPromRegistry()
+	for i := range servers {
+		server := &servers[i]
+		data := agentMetrics[server.ID]
+		writeServerMetrics(r, serverPromLabels(server, dimensions), isAgentOnline(server, data, now), data)
+	}
+	r.gauge("vstats_servers", "Number of configured servers.", nil, float64(len(servers)))
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	c.Data(http.StatusOK, prometheusContentType, buf.Bytes())
+}
+
+// checkPrometheusAccess returns http.StatusOK when the Prometheus endpoints are enabled and the
+// request carries the configured bearer token, otherwise the status to answer with
+func checkPrometheusAccess(c *gin.Context, settings PrometheusSettings) int {
+	if !settings.Enabled {
+		return http.StatusNotFound
+	}
+	if settings.BearerToken != "" {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(settings.BearerToken)) != 1 {
+			c.Header("WWW-Authenticate", `Bearer realm="vstats"`)
+			return http.StatusUnauthorized
+		}
+	}
+	return http.StatusOK
+}
+
+// prometheusServers copies the servers the Prometheus endpoints expose. Without a bearer token
+// anyone can scrape them, so hidden servers are left out as for visitors of the dashboard.
+func prometheusServers(settings PrometheusSettings, servers []RemoteServer) []RemoteServer {
+	result := make([]RemoteServer, 0, len(servers))
+	for _, server := range servers {
+		if server.Hidden && settings.BearerToken == "" {
+			continue
+		}
+		result = append(result, server)
+	}
+	return result
+}
+
+// ============================================================================
+// Prometheus Settings Handlers
+// ============================================================================
+
+func (s *AppState) GetPrometheusSettings(c *gin.Context) {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   s.Config.Prometheus.Enabled,
+		"has_token": s.Config.Prometheus.BearerToken != "",
+	})
+}
+
+func (s *AppState) UpdatePrometheusSettings(c *gin.Context) {
+	var req struct {
+		Enabled     bool    `json:"enabled"`
+		BearerToken *string `json:"bearer_token,omitempty"` // Omit to keep the current token, "" to remove it
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	s.ConfigMu.Lock()
+	defer s.ConfigMu.Unlock()
+
+	s.Config.Prometheus.Enabled = req.Enabled
+	if req.BearerToken != nil {
+		s.Config.Prometheus.BearerToken = *req.BearerToken
+	}
+	if err := SaveSettings(s.DB, s.Config, SettingPrometheus); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save Prometheus settings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":   s.Config.Prometheus.Enabled,
+		"has_token": s.Config.Prometheus.BearerToken != "",
+	})
+}
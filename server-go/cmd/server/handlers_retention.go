@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Retention Settings Handlers
+// ============================================================================
+
+// retentionResponse returns the stored settings together with the effective default policy
+func retentionResponse(settings RetentionSettings) gin.H {
+	return gin.H{
+		"default":   settings.Default,
+		"groups":    settings.Groups,
+		"servers":   settings.Servers,
+		"effective": settings.Base(),
+		"builtin":   DefaultRetentionPolicy,
+		"minimum":   minRetentionPolicy,
+	}
+}
+
+func (s *AppState) GetRetentionSettings(c *gin.Context) {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+	c.JSON(http.StatusOK, retentionResponse(s.Config.Retention))
+}
+
+func (s *AppState) UpdateRetentionSettings(c *gin.Context) {
+	var settings RetentionSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if err := settings.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.ConfigMu.Lock()
+	s.Config.Retention = settings
+	err := SaveSettings(s.DB, s.Config, SettingRetention)
+	s.ConfigMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save retention settings"})
+		return
+	}
+
+	SetActiveRetention(settings)
+	c.JSON(http.StatusOK, retentionResponse(settings))
+}
+
+// RetentionDryRun reports how many rows each distinct policy would delete right now.
+// An optional body previews unsaved settings; without one the current settings are used.
+func (s *AppState) RetentionDryRun(c *gin.Context, db *sql.DB) {
+	s.ConfigMu.RLock()
+	settings := s.Config.Retention
+	servers := append([]RemoteServer(nil), s.Config.Servers...)
+	s.ConfigMu.RUnlock()
+
+	var proposed RetentionSettings
+	if err := c.ShouldBindJSON(&proposed); err == nil {
+		if err := proposed.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		settings = proposed
+	} else if err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	scopes, err := ApplyRetention(db, metricsStore, settings, servers, time.Now().UTC(), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate retention: " + err.Error()})
+		return
+	}
+
+	var total int64
+	for _, scope := range scopes {
+		total += scope.Total
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"scopes": scopes,
+		"total":  total,
+	})
+}
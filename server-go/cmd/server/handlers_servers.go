@@ -11,10 +11,31 @@ import (
 // Server Management Handlers
 // ============================================================================
 
+// GetServers lists the servers. API tokens need servers:read or servers:write. Agent tokens are
+// only included for operators logged in with a session, as API tokens may travel in URLs, and
+// visitors who are not logged in get the public view (see VisibilitySettings).
 func (s *AppState) GetServers(c *gin.Context) {
+	user, token := s.optionalCaller(c, ScopeServersRead, ScopeServersWrite)
+
 	s.ConfigMu.RLock()
 	defer s.ConfigMu.RUnlock()
-	c.JSON(http.StatusOK, s.Config.Servers)
+	if user != nil && user.Role.Allows(RoleOperator) && token == nil {
+		c.JSON(http.StatusOK, s.Config.Servers)
+		return
+	}
+
+	servers := []RemoteServer{}
+	for _, server := range s.Config.Servers {
+		server.Token = ""
+		if user == nil {
+			if server.Hidden {
+				continue
+			}
+			s.Config.Visibility.redactServer(&server)
+		}
+		servers = append(servers, server)
+	}
+	c.JSON(http.StatusOK, servers)
 }
 
 func (s *AppState) AddServer(c *gin.Context) {
@@ -25,26 +46,42 @@ func (s *AppState) AddServer(c *gin.Context) {
 	}
 
 	server := RemoteServer{
-		ID:           uuid.New().String(),
-		Name:         req.Name,
-		URL:          req.URL,
-		Location:     req.Location,
-		Provider:     req.Provider,
-		Tag:          req.Tag,
-		Token:        uuid.New().String(),
-		GroupID:      req.GroupID,
-		GroupValues:  req.GroupValues,
-		PriceAmount:  req.PriceAmount,
-		PricePeriod:  req.PricePeriod,
-		PurchaseDate: req.PurchaseDate,
-		TipBadge:     req.TipBadge,
+		ID:               uuid.New().String(),
+		Name:             req.Name,
+		URL:              req.URL,
+		Location:         req.Location,
+		Provider:         req.Provider,
+		Tag:              req.Tag,
+		Token:            uuid.New().String(),
+		GroupID:          req.GroupID,
+		GroupValues:      req.GroupValues,
+		PriceAmount:      req.PriceAmount,
+		PricePeriod:      req.PricePeriod,
+		PurchaseDate:     req.PurchaseDate,
+		TipBadge:         req.TipBadge,
+		OfflineGraceSecs: req.OfflineGraceSecs,
+		SLATarget:        req.SLATarget,
+		Hidden:           req.Hidden,
+	}
+	if server.OfflineGraceSecs < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offline_grace_secs must not be negative"})
+		return
+	}
+	if server.SLATarget < 0 || server.SLATarget > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sla_target must be between 0 and 100"})
+		return
 	}
 
 	s.ConfigMu.Lock()
+	if err := SaveServer(s.DB, server); err != nil {
+		s.ConfigMu.Unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save server"})
+		return
+	}
 	s.Config.Servers = append(s.Config.Servers, server)
-	SaveConfig(s.Config)
 	s.ConfigMu.Unlock()
 
+	s.recordAudit(c, "server.create", "server", server.ID, nil, auditSnapshot(server))
 	c.JSON(http.StatusOK, server)
 }
 
@@ -52,20 +89,28 @@ func (s *AppState) DeleteServer(c *gin.Context) {
 	id := c.Param("id")
 
 	s.ConfigMu.Lock()
+	if err := DeleteServerRecord(s.DB, id); err != nil {
+		s.ConfigMu.Unlock()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete server"})
+		return
+	}
 	servers := make([]RemoteServer, 0)
+	var before map[string]interface{}
 	for _, srv := range s.Config.Servers {
 		if srv.ID != id {
 			servers = append(servers, srv)
+		} else {
+			before = auditSnapshot(srv)
 		}
 	}
 	s.Config.Servers = servers
-	SaveConfig(s.Config)
 	s.ConfigMu.Unlock()
 
 	s.AgentMetricsMu.Lock()
 	delete(s.AgentMetrics, id)
 	s.AgentMetricsMu.Unlock()
 
+	s.recordAudit(c, "server.delete", "server", id, before, nil)
 	c.Status(http.StatusOK)
 }
 
@@ -77,54 +122,82 @@ func (s *AppState) UpdateServer(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	if req.OfflineGraceSecs != nil && *req.OfflineGraceSecs < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "offline_grace_secs must not be negative"})
+		return
+	}
+	if req.SLATarget != nil && (*req.SLATarget < 0 || *req.SLATarget > 100) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sla_target must be between 0 and 100"})
+		return
+	}
 
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
 
-	var updated *RemoteServer
+	index := -1
 	for i := range s.Config.Servers {
 		if s.Config.Servers[i].ID == id {
-			if req.Name != nil {
-				s.Config.Servers[i].Name = *req.Name
-			}
-			if req.Location != nil {
-				s.Config.Servers[i].Location = *req.Location
-			}
-			if req.Provider != nil {
-				s.Config.Servers[i].Provider = *req.Provider
-			}
-			if req.Tag != nil {
-				s.Config.Servers[i].Tag = *req.Tag
-			}
-			if req.GroupID != nil {
-				s.Config.Servers[i].GroupID = *req.GroupID
-			}
-			if req.GroupValues != nil {
-				s.Config.Servers[i].GroupValues = *req.GroupValues
-			}
-			if req.PriceAmount != nil {
-				s.Config.Servers[i].PriceAmount = *req.PriceAmount
-			}
-			if req.PricePeriod != nil {
-				s.Config.Servers[i].PricePeriod = *req.PricePeriod
-			}
-			if req.PurchaseDate != nil {
-				s.Config.Servers[i].PurchaseDate = *req.PurchaseDate
-			}
-			if req.TipBadge != nil {
-				s.Config.Servers[i].TipBadge = *req.TipBadge
-			}
-			updated = &s.Config.Servers[i]
+			index = i
 			break
 		}
 	}
-
-	if updated == nil {
+	if index < 0 {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
 		return
 	}
 
-	SaveConfig(s.Config)
+	// Changes apply to a copy, which replaces the server once it is saved
+	updated := s.Config.Servers[index]
+	before := auditSnapshot(updated)
+	if req.Name != nil {
+		updated.Name = *req.Name
+	}
+	if req.Location != nil {
+		updated.Location = *req.Location
+	}
+	if req.Provider != nil {
+		updated.Provider = *req.Provider
+	}
+	if req.Tag != nil {
+		updated.Tag = *req.Tag
+	}
+	if req.GroupID != nil {
+		updated.GroupID = *req.GroupID
+	}
+	if req.GroupValues != nil {
+		updated.GroupValues = *req.GroupValues
+	}
+	if req.PriceAmount != nil {
+		updated.PriceAmount = *req.PriceAmount
+	}
+	if req.PricePeriod != nil {
+		updated.PricePeriod = *req.PricePeriod
+	}
+	if req.PurchaseDate != nil {
+		updated.PurchaseDate = *req.PurchaseDate
+	}
+	if req.TipBadge != nil {
+		updated.TipBadge = *req.TipBadge
+	}
+	if req.OfflineGraceSecs != nil {
+		updated.OfflineGraceSecs = *req.OfflineGraceSecs
+	}
+	if req.SLATarget != nil {
+		updated.SLATarget = *req.SLATarget
+	}
+	if req.Hidden != nil {
+		updated.Hidden = *req.Hidden
+	}
+
+	if err := SaveServer(s.DB, updated); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save server"})
+		return
+	}
+	s.Config.Servers[index] = updated
+	s.recordAudit(c, "server.update", "server", id, before, auditSnapshot(updated))
+	if req.Hidden != nil {
+		s.dropPublicSnapshot()
+	}
 	c.JSON(http.StatusOK, updated)
 }
 
@@ -157,13 +230,22 @@ func (s *AppState) AddGroup(c *gin.Context) {
 	}
 
 	s.ConfigMu.Lock()
-	if s.Config.Groups == nil {
-		s.Config.Groups = []ServerGroup{}
+	next := s.Config.groupingCopy()
+	if next.Groups == nil {
+		next.Groups = []ServerGroup{}
+	}
+	next.Groups = append(next.Groups, group)
+	err := SaveGrouping(s.DB, next)
+	if err == nil {
+		s.Config.applyGrouping(next)
 	}
-	s.Config.Groups = append(s.Config.Groups, group)
-	SaveConfig(s.Config)
 	s.ConfigMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save group"})
+		return
+	}
 
+	s.recordAudit(c, "group.create", "group", group.ID, nil, auditSnapshot(group))
 	c.JSON(http.StatusOK, group)
 }
 
@@ -178,17 +260,20 @@ func (s *AppState) UpdateGroup(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
+	next := s.Config.groupingCopy()
 
 	var updated *ServerGroup
-	for i := range s.Config.Groups {
-		if s.Config.Groups[i].ID == id {
+	var before map[string]interface{}
+	for i := range next.Groups {
+		if next.Groups[i].ID == id {
+			before = auditSnapshot(next.Groups[i])
 			if req.Name != nil {
-				s.Config.Groups[i].Name = *req.Name
+				next.Groups[i].Name = *req.Name
 			}
 			if req.SortOrder != nil {
-				s.Config.Groups[i].SortOrder = *req.SortOrder
+				next.Groups[i].SortOrder = *req.SortOrder
 			}
-			updated = &s.Config.Groups[i]
+			updated = &next.Groups[i]
 			break
 		}
 	}
@@ -198,7 +283,12 @@ func (s *AppState) UpdateGroup(c *gin.Context) {
 		return
 	}
 
-	SaveConfig(s.Config)
+	if err := SaveGrouping(s.DB, next); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save groups"})
+		return
+	}
+	s.Config.applyGrouping(next)
+	s.recordAudit(c, "group.update", "group", id, before, auditSnapshot(*updated))
 	c.JSON(http.StatusOK, updated)
 }
 
@@ -206,31 +296,43 @@ func (s *AppState) DeleteGroup(c *gin.Context) {
 	id := c.Param("id")
 
 	s.ConfigMu.Lock()
+	next := s.Config.groupingCopy()
 
 	// Remove group
 	groups := make([]ServerGroup, 0)
-	for _, g := range s.Config.Groups {
+	var before map[string]interface{}
+	for _, g := range next.Groups {
 		if g.ID != id {
 			groups = append(groups, g)
+		} else {
+			before = auditSnapshot(g)
 		}
 	}
-	s.Config.Groups = groups
+	next.Groups = groups
 
 	// Clear group_id from servers that had this group
-	for i := range s.Config.Servers {
-		if s.Config.Servers[i].GroupID == id {
-			s.Config.Servers[i].GroupID = ""
+	for i := range next.Servers {
+		if next.Servers[i].GroupID == id {
+			next.Servers[i].GroupID = ""
 		}
 	}
 
 	// Clear group_id from local node if it had this group
-	if s.Config.LocalNode.GroupID == id {
-		s.Config.LocalNode.GroupID = ""
+	if next.LocalNode.GroupID == id {
+		next.LocalNode.GroupID = ""
 	}
 
-	SaveConfig(s.Config)
+	err := SaveGrouping(s.DB, next)
+	if err == nil {
+		s.Config.applyGrouping(next)
+	}
 	s.ConfigMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save groups"})
+		return
+	}
 
+	s.recordAudit(c, "group.delete", "group", id, before, nil)
 	c.Status(http.StatusOK)
 }
 
@@ -258,9 +360,10 @@ func (s *AppState) AddDimension(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
+	next := s.Config.groupingCopy()
 
 	// Check if key already exists
-	for _, d := range s.Config.GroupDimensions {
+	for _, d := range next.GroupDimensions {
 		if d.Key == req.Key {
 			c.JSON(http.StatusConflict, gin.H{"error": "Dimension key already exists"})
 			return
@@ -276,12 +379,17 @@ func (s *AppState) AddDimension(c *gin.Context) {
 		Options:   []GroupOption{},
 	}
 
-	if s.Config.GroupDimensions == nil {
-		s.Config.GroupDimensions = []GroupDimension{}
+	if next.GroupDimensions == nil {
+		next.GroupDimensions = []GroupDimension{}
+	}
+	next.GroupDimensions = append(next.GroupDimensions, dimension)
+	if err := SaveGrouping(s.DB, next); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save groups"})
+		return
 	}
-	s.Config.GroupDimensions = append(s.Config.GroupDimensions, dimension)
-	SaveConfig(s.Config)
+	s.Config.applyGrouping(next)
 
+	s.recordAudit(c, "dimension.create", "dimension", dimension.ID, nil, auditSnapshot(dimension))
 	c.JSON(http.StatusOK, dimension)
 }
 
@@ -296,20 +404,23 @@ func (s *AppState) UpdateDimension(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
+	next := s.Config.groupingCopy()
 
 	var updated *GroupDimension
-	for i := range s.Config.GroupDimensions {
-		if s.Config.GroupDimensions[i].ID == id {
+	var before map[string]interface{}
+	for i := range next.GroupDimensions {
+		if next.GroupDimensions[i].ID == id {
+			before = auditSnapshot(next.GroupDimensions[i])
 			if req.Name != nil {
-				s.Config.GroupDimensions[i].Name = *req.Name
+				next.GroupDimensions[i].Name = *req.Name
 			}
 			if req.Enabled != nil {
-				s.Config.GroupDimensions[i].Enabled = *req.Enabled
+				next.GroupDimensions[i].Enabled = *req.Enabled
 			}
 			if req.SortOrder != nil {
-				s.Config.GroupDimensions[i].SortOrder = *req.SortOrder
+				next.GroupDimensions[i].SortOrder = *req.SortOrder
 			}
-			updated = &s.Config.GroupDimensions[i]
+			updated = &next.GroupDimensions[i]
 			break
 		}
 	}
@@ -319,7 +430,12 @@ func (s *AppState) UpdateDimension(c *gin.Context) {
 		return
 	}
 
-	SaveConfig(s.Config)
+	if err := SaveGrouping(s.DB, next); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save groups"})
+		return
+	}
+	s.Config.applyGrouping(next)
+	s.recordAudit(c, "dimension.update", "dimension", id, before, auditSnapshot(*updated))
 	c.JSON(http.StatusOK, updated)
 }
 
@@ -328,29 +444,38 @@ func (s *AppState) DeleteDimension(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
+	next := s.Config.groupingCopy()
 
 	// Remove dimension
 	dimensions := make([]GroupDimension, 0)
-	for _, d := range s.Config.GroupDimensions {
+	var before map[string]interface{}
+	for _, d := range next.GroupDimensions {
 		if d.ID != id {
 			dimensions = append(dimensions, d)
+		} else {
+			before = auditSnapshot(d)
 		}
 	}
-	s.Config.GroupDimensions = dimensions
+	next.GroupDimensions = dimensions
 
 	// Clear group values from servers
-	for i := range s.Config.Servers {
-		if s.Config.Servers[i].GroupValues != nil {
-			delete(s.Config.Servers[i].GroupValues, id)
+	for i := range next.Servers {
+		if next.Servers[i].GroupValues != nil {
+			delete(next.Servers[i].GroupValues, id)
 		}
 	}
 
 	// Clear from local node
-	if s.Config.LocalNode.GroupValues != nil {
-		delete(s.Config.LocalNode.GroupValues, id)
+	if next.LocalNode.GroupValues != nil {
+		delete(next.LocalNode.GroupValues, id)
 	}
 
-	SaveConfig(s.Config)
+	if err := SaveGrouping(s.DB, next); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save groups"})
+		return
+	}
+	s.Config.applyGrouping(next)
+	s.recordAudit(c, "dimension.delete", "dimension", id, before, nil)
 	c.Status(http.StatusOK)
 }
 
@@ -369,11 +494,12 @@ func (s *AppState) AddOption(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
+	next := s.Config.groupingCopy()
 
 	var dimension *GroupDimension
-	for i := range s.Config.GroupDimensions {
-		if s.Config.GroupDimensions[i].ID == dimID {
-			dimension = &s.Config.GroupDimensions[i]
+	for i := range next.GroupDimensions {
+		if next.GroupDimensions[i].ID == dimID {
+			dimension = &next.GroupDimensions[i]
 			break
 		}
 	}
@@ -390,8 +516,13 @@ func (s *AppState) AddOption(c *gin.Context) {
 	}
 
 	dimension.Options = append(dimension.Options, option)
-	SaveConfig(s.Config)
+	if err := SaveGrouping(s.DB, next); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save groups"})
+		return
+	}
+	s.Config.applyGrouping(next)
 
+	s.recordAudit(c, "dimension_option.create", "dimension_option", option.ID, nil, auditSnapshot(option))
 	c.JSON(http.StatusOK, option)
 }
 
@@ -407,19 +538,22 @@ func (s *AppState) UpdateOption(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
+	next := s.Config.groupingCopy()
 
 	var updated *GroupOption
-	for i := range s.Config.GroupDimensions {
-		if s.Config.GroupDimensions[i].ID == dimID {
-			for j := range s.Config.GroupDimensions[i].Options {
-				if s.Config.GroupDimensions[i].Options[j].ID == optID {
+	var before map[string]interface{}
+	for i := range next.GroupDimensions {
+		if next.GroupDimensions[i].ID == dimID {
+			for j := range next.GroupDimensions[i].Options {
+				if next.GroupDimensions[i].Options[j].ID == optID {
+					before = auditSnapshot(next.GroupDimensions[i].Options[j])
 					if req.Name != nil {
-						s.Config.GroupDimensions[i].Options[j].Name = *req.Name
+						next.GroupDimensions[i].Options[j].Name = *req.Name
 					}
 					if req.SortOrder != nil {
-						s.Config.GroupDimensions[i].Options[j].SortOrder = *req.SortOrder
+						next.GroupDimensions[i].Options[j].SortOrder = *req.SortOrder
 					}
-					updated = &s.Config.GroupDimensions[i].Options[j]
+					updated = &next.GroupDimensions[i].Options[j]
 					break
 				}
 			}
@@ -432,7 +566,12 @@ func (s *AppState) UpdateOption(c *gin.Context) {
 		return
 	}
 
-	SaveConfig(s.Config)
+	if err := SaveGrouping(s.DB, next); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save groups"})
+		return
+	}
+	s.Config.applyGrouping(next)
+	s.recordAudit(c, "dimension_option.update", "dimension_option", optID, before, auditSnapshot(*updated))
 	c.JSON(http.StatusOK, updated)
 }
 
@@ -442,19 +581,22 @@ func (s *AppState) DeleteOption(c *gin.Context) {
 
 	s.ConfigMu.Lock()
 	defer s.ConfigMu.Unlock()
+	next := s.Config.groupingCopy()
 
 	found := false
-	for i := range s.Config.GroupDimensions {
-		if s.Config.GroupDimensions[i].ID == dimID {
+	var before map[string]interface{}
+	for i := range next.GroupDimensions {
+		if next.GroupDimensions[i].ID == dimID {
 			options := make([]GroupOption, 0)
-			for _, o := range s.Config.GroupDimensions[i].Options {
+			for _, o := range next.GroupDimensions[i].Options {
 				if o.ID != optID {
 					options = append(options, o)
 				} else {
 					found = true
+					before = auditSnapshot(o)
 				}
 			}
-			s.Config.GroupDimensions[i].Options = options
+			next.GroupDimensions[i].Options = options
 			break
 		}
 	}
@@ -465,25 +607,30 @@ func (s *AppState) DeleteOption(c *gin.Context) {
 	}
 
 	// Clear this option from servers
-	for i := range s.Config.Servers {
-		if s.Config.Servers[i].GroupValues != nil {
-			for k, v := range s.Config.Servers[i].GroupValues {
+	for i := range next.Servers {
+		if next.Servers[i].GroupValues != nil {
+			for k, v := range next.Servers[i].GroupValues {
 				if v == optID {
-					delete(s.Config.Servers[i].GroupValues, k)
+					delete(next.Servers[i].GroupValues, k)
 				}
 			}
 		}
 	}
 
 	// Clear from local node
-	if s.Config.LocalNode.GroupValues != nil {
-		for k, v := range s.Config.LocalNode.GroupValues {
+	if next.LocalNode.GroupValues != nil {
+		for k, v := range next.LocalNode.GroupValues {
 			if v == optID {
-				delete(s.Config.LocalNode.GroupValues, k)
+				delete(next.LocalNode.GroupValues, k)
 			}
 		}
 	}
 
-	SaveConfig(s.Config)
+	if err := SaveGrouping(s.DB, next); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save groups"})
+		return
+	}
+	s.Config.applyGrouping(next)
+	s.recordAudit(c, "dimension_option.delete", "dimension_option", optID, before, nil)
 	c.Status(http.StatusOK)
 }
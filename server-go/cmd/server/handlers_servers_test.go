@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetServersAgentTokens(t *testing.T) {
+	s := newTestState(t)
+	s.Config.Servers = []RemoteServer{
+		{ID: "a", Name: "web-1", Token: "agent-secret-a", IP: "203.0.113.7"},
+		{ID: "b", Name: "db-1", Token: "agent-secret-b", Hidden: true},
+	}
+	s.Config.Visibility.MaskIP = true
+	admin, err := getUserByUsername(s.DB, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewer := newTestUser(t, s, "viewer", RoleViewer)
+
+	route := func(r *gin.Engine) { r.GET("/api/servers", s.GetServers) }
+	list := func(target, bearer string) []RemoteServer {
+		t.Helper()
+		w := serveTest(route, http.MethodGet, target, bearer)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: %d %s", target, w.Code, w.Body)
+		}
+		var servers []RemoteServer
+		if err := json.Unmarshal(w.Body.Bytes(), &servers); err != nil {
+			t.Fatal(err)
+		}
+		return servers
+	}
+
+	cases := []struct {
+		name      string
+		target    string
+		bearer    string
+		servers   int  // Hidden servers are only listed for logged in callers
+		tokens    bool // Agent tokens
+		maskedIPs bool
+	}{
+		{"visitor", "/api/servers", "", 1, false, true},
+		{"admin session", "/api/servers", newTestSession(t, s, admin), 2, true, false},
+		{"viewer session", "/api/servers", newTestSession(t, s, viewer), 2, false, false},
+		{"metrics:read token", "/api/servers", newTestToken(t, s, admin, ScopeMetricsRead), 1, false, true},
+		{"metrics:read token in URL", "/api/servers?token=" + newTestToken(t, s, admin, ScopeMetricsRead), "", 1, false, true},
+		{"servers:read token", "/api/servers", newTestToken(t, s, admin, ScopeServersRead), 2, false, false},
+		{"servers:read token in URL", "/api/servers?token=" + newTestToken(t, s, admin, ScopeServersRead), "", 2, false, false},
+		{"servers:write token", "/api/servers", newTestToken(t, s, admin, ScopeServersWrite), 2, false, false},
+		{"invalid session", "/api/servers", "not-a-jwt", 1, false, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			servers := list(tc.target, tc.bearer)
+			if len(servers) != tc.servers {
+				t.Fatalf("%d servers, want %d", len(servers), tc.servers)
+			}
+			for _, server := range servers {
+				if (server.Token != "") != tc.tokens {
+					t.Errorf("server %s: token %q", server.ID, server.Token)
+				}
+				if server.ID == "a" && (server.IP != "203.0.113.7") != tc.maskedIPs {
+					t.Errorf("server a: ip %q", server.IP)
+				}
+			}
+		})
+	}
+}
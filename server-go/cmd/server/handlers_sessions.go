@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Session Handlers
+// ============================================================================
+
+// ListSessions lists the current user's login sessions
+func (s *AppState) ListSessions(c *gin.Context) {
+	sessions, err := listSessions(s.DB, currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sessions"})
+		return
+	}
+	current := currentSessionID(c)
+	for _, ss := range sessions {
+		ss.Current = ss.ID == current
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession ends one of the current user's sessions
+func (s *AppState) RevokeSession(c *gin.Context) {
+	found, err := deleteSession(s.DB, currentUser(c).ID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// RevokeAllSessions ends all sessions of the current user, including this one
+func (s *AppState) RevokeAllSessions(c *gin.Context) {
+	n, err := RevokeUserSessions(s.DB, currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"revoked": n})
+}
+
+// CreateWSTicket exchanges the current login session for a one-time ticket for /ws
+func (s *AppState) CreateWSTicket(c *gin.Context) {
+	ticket := s.WSTickets.Issue(currentUser(c).ID, currentSessionID(c), time.Now())
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_in": int(wsTicketLifetime.Seconds())})
+}
@@ -28,9 +28,15 @@ func (s *AppState) UpdateSiteSettings(c *gin.Context) {
 	}
 
 	s.ConfigMu.Lock()
+	before := auditSnapshot(s.Config.SiteSettings)
 	s.Config.SiteSettings = settings
-	SaveConfig(s.Config)
+	err := SaveSettings(s.DB, s.Config, SettingSite)
 	s.ConfigMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save site settings"})
+		return
+	}
+	s.recordAudit(c, "settings.update", "settings", SettingSite, before, auditSnapshot(settings))
 
 	// Broadcast the updated settings to all connected dashboard clients
 	s.BroadcastSiteSettings(&settings)
@@ -78,13 +84,52 @@ func (s *AppState) UpdateLocalNodeConfig(c *gin.Context) {
 	}
 
 	s.ConfigMu.Lock()
+	before := auditSnapshot(s.Config.LocalNode)
 	s.Config.LocalNode = config
-	SaveConfig(s.Config)
+	err := SaveSettings(s.DB, s.Config, SettingLocalNode)
 	s.ConfigMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save local node config"})
+		return
+	}
+	s.recordAudit(c, "settings.update", "settings", SettingLocalNode, before, auditSnapshot(config))
+	s.dropPublicSnapshot()
 
 	c.JSON(http.StatusOK, config)
 }
 
+// ============================================================================
+// Visibility Settings Handlers
+// ============================================================================
+
+func (s *AppState) GetVisibilitySettings(c *gin.Context) {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+	c.JSON(http.StatusOK, s.Config.Visibility)
+}
+
+func (s *AppState) UpdateVisibilitySettings(c *gin.Context) {
+	var settings VisibilitySettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	s.ConfigMu.Lock()
+	before := auditSnapshot(s.Config.Visibility)
+	s.Config.Visibility = settings
+	err := SaveSettings(s.DB, s.Config, SettingVisibility)
+	s.ConfigMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save visibility settings"})
+		return
+	}
+	s.recordAudit(c, "settings.update", "settings", SettingVisibility, before, auditSnapshot(settings))
+
+	s.dropPublicSnapshot()
+	c.JSON(http.StatusOK, settings)
+}
+
 // ============================================================================
 // Probe Settings Handlers
 // ============================================================================
@@ -103,9 +148,15 @@ func (s *AppState) UpdateProbeSettings(c *gin.Context) {
 	}
 
 	s.ConfigMu.Lock()
+	before := auditSnapshot(s.Config.ProbeSettings)
 	s.Config.ProbeSettings = settings
-	SaveConfig(s.Config)
+	err := SaveSettings(s.DB, s.Config, SettingProbe)
 	s.ConfigMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save probe settings"})
+		return
+	}
+	s.recordAudit(c, "settings.update", "settings", SettingProbe, before, auditSnapshot(settings))
 
 	// Update local collector's ping targets
 	localCollector := GetLocalCollector()
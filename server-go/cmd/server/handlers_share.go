@@ -0,0 +1,346 @@
+package main
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// Share Link Handlers
+// ============================================================================
+
+type CreateShareLinkRequest struct {
+	Name        string   `json:"name"`
+	ServerIDs   []string `json:"server_ids,omitempty"`   // "local" for the dashboard server
+	DimensionID string   `json:"dimension_id,omitempty"` // Instead of server_ids: the servers of a group option
+	OptionID    string   `json:"option_id,omitempty"`
+	Password    string   `json:"password,omitempty"`
+	ExpiresAt   string   `json:"expires_at,omitempty"` // RFC3339, empty for no expiry
+}
+
+type ShareUnlockRequest struct {
+	Password string `json:"password"`
+}
+
+type ShareResponse struct {
+	Name      string                `json:"name"`
+	ExpiresAt string                `json:"expires_at,omitempty"`
+	Servers   []ServerMetricsUpdate `json:"servers"`
+}
+
+func (s *AppState) ListShareLinks(c *gin.Context) {
+	links, err := listShareLinks(s.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load share links"})
+		return
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+func (s *AppState) CreateShareLink(c *gin.Context) {
+	var req CreateShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	link := &ShareLink{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		CreatedBy: currentUser(c).Username,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := s.validateShareScope(&req, link); err != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		return
+	}
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil || !t.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be a future RFC3339 time"})
+			return
+		}
+		link.ExpiresAt = t.UTC().Format(time.RFC3339)
+	}
+	if err := link.SetPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+	link.Token = shareToken(link.ID)
+
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		return saveShareLink(db, link)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save share link"})
+		return
+	}
+
+	s.recordAudit(c, "share.create", "share", link.ID, nil, auditSnapshot(link))
+	c.JSON(http.StatusOK, link)
+}
+
+// validateShareScope copies the servers or group option of a request to the link and returns
+// what is wrong with them, if anything
+func (s *AppState) validateShareScope(req *CreateShareLinkRequest, link *ShareLink) string {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+
+	if (len(req.ServerIDs) > 0) == (req.DimensionID != "") {
+		return "Either server_ids or dimension_id and option_id are required"
+	}
+	if req.DimensionID != "" {
+		for _, d := range s.Config.GroupDimensions {
+			if d.ID != req.DimensionID {
+				continue
+			}
+			for _, o := range d.Options {
+				if o.ID == req.OptionID {
+					link.DimensionID, link.OptionID = req.DimensionID, req.OptionID
+					return ""
+				}
+			}
+		}
+		return "Group option not found"
+	}
+
+	known := map[string]bool{"local": true}
+	for _, server := range s.Config.Servers {
+		known[server.ID] = true
+	}
+	seen := make(map[string]bool)
+	for _, id := range req.ServerIDs {
+		if !known[id] {
+			return "Server not found: " + id
+		}
+		if !seen[id] {
+			seen[id] = true
+			link.ServerIDs = append(link.ServerIDs, id)
+		}
+	}
+	return ""
+}
+
+// DeleteShareLink revokes a link and disconnects the dashboards opened with it
+func (s *AppState) DeleteShareLink(c *gin.Context) {
+	id := c.Param("id")
+	var found bool
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		var err error
+		found, err = deleteShareLink(db, id)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete share link"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found"})
+		return
+	}
+
+	s.DashboardMu.RLock()
+	for conn, client := range s.DashboardClients {
+		if client.ShareID == id {
+			conn.Close()
+		}
+	}
+	s.DashboardMu.RUnlock()
+
+	s.recordAudit(c, "share.delete", "share", id, nil, nil)
+	c.Status(http.StatusOK)
+}
+
+// ============================================================================
+// Shared Views
+// ============================================================================
+
+// resolveShare checks the link token of the request and, for links with a password, the access
+// token from ShareUnlock, passed as bearer token or as ?access= for WebSockets. It returns the
+// link, the servers it shares and when the access ends (zero for never), or answers the
+// request and returns nil.
+func (s *AppState) resolveShare(c *gin.Context) (*ShareLink, map[string]bool, time.Time) {
+	link, ok := s.lookupShare(c)
+	if !ok {
+		return nil, nil, time.Time{}
+	}
+	var until time.Time
+	if link.ExpiresAt != "" {
+		until, _ = time.Parse(time.RFC3339, link.ExpiresAt)
+	}
+	if link.HasPassword {
+		access := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if access == "" {
+			access = c.Query("access")
+		}
+		if until, ok = shareAccessExpiry(link.ID, access); !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Password required", "password_required": true})
+			return nil, nil, time.Time{}
+		}
+	}
+
+	s.ConfigMu.RLock()
+	scope := link.scope(s.Config)
+	s.ConfigMu.RUnlock()
+	return link, scope, until
+}
+
+// lookupShare loads the link of a valid, unexpired link token, or answers the request with 404
+func (s *AppState) lookupShare(c *gin.Context) (*ShareLink, bool) {
+	var link *ShareLink
+	id, ok := parseShareToken(c.Param("token"))
+	if ok {
+		var err error
+		if link, err = getShareLink(s.DB, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load share link"})
+			return nil, false
+		}
+	}
+	if link == nil || link.Expired(time.Now()) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or expired"})
+		return nil, false
+	}
+	return link, true
+}
+
+// UnlockShare exchanges the password of a link for an access token. Wrong passwords count as
+// failed logins of the client IP.
+func (s *AppState) UnlockShare(c *gin.Context) {
+	ip := c.ClientIP()
+	if wait := s.LoginGuard.Wait(ip, time.Now()); wait > 0 {
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many failed attempts, try again later",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	link, ok := s.lookupShare(c)
+	if !ok {
+		return
+	}
+	var req ShareUnlockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if link.HasPassword && !link.CheckPassword(req.Password) {
+		s.LoginGuard.Failed(ip, "share:"+link.ID, time.Now())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password", "password_required": true})
+		return
+	}
+
+	token, expiresAt, err := newShareAccessToken(link, time.Now().UTC())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"access_token": token, "expires_at": expiresAt.Unix()})
+}
+
+// GetShare returns the shared servers with their current metrics
+func (s *AppState) GetShare(c *gin.Context) {
+	link, scope, _ := s.resolveShare(c)
+	if link == nil {
+		return
+	}
+
+	s.ConfigMu.RLock()
+	localNode := s.Config.LocalNode
+	servers := append([]RemoteServer(nil), s.Config.Servers...)
+	visibility := s.Config.Visibility
+	s.ConfigMu.RUnlock()
+
+	updates := []ServerMetricsUpdate{}
+	if scope["local"] {
+		metrics := CollectMetrics()
+		updates = append(updates, ServerMetricsUpdate{
+			ServerID:     "local",
+			ServerName:   localNode.Name,
+			Location:     localNode.Location,
+			Provider:     localNode.Provider,
+			Tag:          localNode.Tag,
+			GroupValues:  localNode.GroupValues,
+			Version:      ServerVersion,
+			Online:       true,
+			Metrics:      &metrics,
+			PriceAmount:  localNode.PriceAmount,
+			PricePeriod:  localNode.PricePeriod,
+			PurchaseDate: localNode.PurchaseDate,
+			TipBadge:     localNode.TipBadge,
+		})
+		if updates[0].ServerName == "" {
+			updates[0].ServerName = "Dashboard Server"
+		}
+	}
+
+	s.AgentMetricsMu.RLock()
+	for _, server := range servers {
+		if !scope[server.ID] {
+			continue
+		}
+		metricsData := s.AgentMetrics[server.ID]
+		version := server.Version
+		var metrics *SystemMetrics
+		if metricsData != nil {
+			m := metricsData.Metrics
+			metrics = &m
+			if m.Version != "" {
+				version = m.Version
+			}
+		}
+		updates = append(updates, ServerMetricsUpdate{
+			ServerID:     server.ID,
+			ServerName:   server.Name,
+			Location:     server.Location,
+			Provider:     server.Provider,
+			Tag:          server.Tag,
+			GroupValues:  server.GroupValues,
+			Version:      version,
+			IP:           server.IP,
+			Online:       isAgentOnline(&server, metricsData, time.Now()),
+			Metrics:      metrics,
+			PriceAmount:  server.PriceAmount,
+			PricePeriod:  server.PricePeriod,
+			PurchaseDate: server.PurchaseDate,
+			TipBadge:     server.TipBadge,
+		})
+	}
+	s.AgentMetricsMu.RUnlock()
+
+	for i := range updates {
+		visibility.redactUpdate(&updates[i])
+	}
+	c.JSON(http.StatusOK, ShareResponse{Name: link.Name, ExpiresAt: link.ExpiresAt, Servers: updates})
+}
+
+// GetShareHistory serves the history of a shared server, with the parameters of GetHistory
+func (s *AppState) GetShareHistory(c *gin.Context) {
+	link, scope, _ := s.resolveShare(c)
+	if link == nil {
+		return
+	}
+	serverID := c.Param("server_id")
+	if !scope[serverID] {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		return
+	}
+	s.serveHistory(c, serverID)
+}
+
+// HandleShareWS streams live updates of the shared servers; the connection is closed when the
+// access ends or the link is deleted
+func (s *AppState) HandleShareWS(c *gin.Context) {
+	link, scope, until := s.resolveShare(c)
+	if link == nil {
+		return
+	}
+	s.serveDashboardWS(c, &DashboardClient{Public: true, Scope: scope, ShareID: link.ID}, until)
+}
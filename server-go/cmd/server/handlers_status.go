@@ -0,0 +1,716 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// Status Page Settings Handlers
+// ============================================================================
+
+func (s *AppState) GetStatusPageSettings(c *gin.Context) {
+	s.ConfigMu.RLock()
+	settings := s.Config.StatusPage
+	s.ConfigMu.RUnlock()
+	if settings.Components == nil {
+		settings.Components = []StatusComponent{}
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (s *AppState) UpdateStatusPageSettings(c *gin.Context) {
+	var settings StatusPageSettings
+	if err := c.ShouldBindJSON(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	s.ConfigMu.Lock()
+	if err := settings.validate(s.Config); err != nil {
+		s.ConfigMu.Unlock()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	before := auditSnapshot(s.Config.StatusPage)
+	s.Config.StatusPage = settings
+	err := SaveSettings(s.DB, s.Config, SettingStatusPage)
+	s.ConfigMu.Unlock()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save status page settings"})
+		return
+	}
+	s.recordAudit(c, "settings.update", "settings", SettingStatusPage, before, auditSnapshot(settings))
+
+	// Maintenance windows refer to components, which may now be backed by other servers
+	if err := s.reloadMaintenance(); err != nil {
+		fmt.Printf("⚠️  Failed to reload maintenance windows: %v\n", err)
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// statusComponentIDs dedupes the component IDs of an incident or maintenance window and
+// returns what is wrong with them, if anything
+func (s *AppState) statusComponentIDs(ids []string) ([]string, string) {
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+
+	known := make(map[string]bool, len(s.Config.StatusPage.Components))
+	for _, comp := range s.Config.StatusPage.Components {
+		known[comp.ID] = true
+	}
+	result := []string{}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if !known[id] {
+			return nil, "Component not found: " + id
+		}
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result, ""
+}
+
+// ============================================================================
+// Incident Handlers
+// ============================================================================
+
+type IncidentRequest struct {
+	Title        string   `json:"title"`
+	Impact       string   `json:"impact"` // none, minor, major, critical (default minor)
+	ComponentIDs []string `json:"component_ids"`
+	Status       string   `json:"status,omitempty"`  // Status of the first update when creating (default investigating)
+	Message      string   `json:"message,omitempty"` // First update, required when creating
+}
+
+type IncidentUpdateRequest struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// applyTo copies the title, impact and components of a request onto an incident and returns
+// what is wrong with them, if anything
+func (req *IncidentRequest) applyTo(s *AppState, inc *Incident) string {
+	if strings.TrimSpace(req.Title) == "" {
+		return "title is required"
+	}
+	if req.Impact == "" {
+		req.Impact = IncidentImpactMinor
+	}
+	if _, ok := incidentImpactStatus[req.Impact]; !ok {
+		return "unsupported impact: " + req.Impact
+	}
+	componentIDs, msg := s.statusComponentIDs(req.ComponentIDs)
+	if msg != "" {
+		return msg
+	}
+	inc.Title, inc.Impact, inc.ComponentIDs = req.Title, req.Impact, componentIDs
+	return ""
+}
+
+// applyTo sets the status of an incident from a timeline update
+func (u *IncidentUpdate) applyTo(inc *Incident) {
+	inc.Status = u.Status
+	inc.UpdatedAt = u.CreatedAt
+	inc.ResolvedAt = ""
+	if u.Status == IncidentResolved {
+		inc.ResolvedAt = u.CreatedAt
+	}
+}
+
+// ListIncidents returns all incidents with their updates, newest first
+func (s *AppState) ListIncidents(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	incidents, err := queryIncidents(s.DB, IncidentFilter{Limit: limit, Offset: offset})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load incidents"})
+		return
+	}
+	c.JSON(http.StatusOK, incidents)
+}
+
+func (s *AppState) CreateIncident(c *gin.Context) {
+	var req IncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if req.Status == "" {
+		req.Status = IncidentInvestigating
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	username := currentUser(c).Username
+	inc := &Incident{
+		ID:        uuid.New().String(),
+		CreatedBy: username,
+		CreatedAt: now,
+	}
+	if msg := req.applyTo(s, inc); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	update := IncidentUpdate{Status: req.Status, Message: req.Message, CreatedBy: username, CreatedAt: now}
+	if msg := validateIncidentUpdate(&update); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	update.applyTo(inc)
+
+	if err := writeInventory(s.DB, func(tx *sql.Tx) error {
+		if err := saveIncident(tx, inc); err != nil {
+			return err
+		}
+		return insertIncidentUpdate(tx, inc.ID, &update)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save incident"})
+		return
+	}
+	inc.Updates = []IncidentUpdate{update}
+
+	s.recordAudit(c, "incident.create", "incident", inc.ID, nil, auditSnapshot(inc))
+	c.JSON(http.StatusOK, inc)
+}
+
+// UpdateIncident changes the title, impact or components of an incident; its status changes
+// with new updates (AddIncidentUpdate)
+func (s *AppState) UpdateIncident(c *gin.Context) {
+	var req IncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	inc, ok := s.loadIncident(c)
+	if !ok {
+		return
+	}
+	before := auditSnapshot(inc)
+	if msg := req.applyTo(s, inc); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := writeInventory(s.DB, func(tx *sql.Tx) error {
+		return saveIncident(tx, inc)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save incident"})
+		return
+	}
+
+	s.recordAudit(c, "incident.update", "incident", inc.ID, before, auditSnapshot(inc))
+	c.JSON(http.StatusOK, inc)
+}
+
+// AddIncidentUpdate adds an update to the timeline of an incident; an update with status
+// resolved closes it and any other status reopens it
+func (s *AppState) AddIncidentUpdate(c *gin.Context) {
+	var req IncidentUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	update := IncidentUpdate{
+		Status:    req.Status,
+		Message:   req.Message,
+		CreatedBy: currentUser(c).Username,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if msg := validateIncidentUpdate(&update); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	inc, ok := s.loadIncident(c)
+	if !ok {
+		return
+	}
+	before := auditSnapshot(map[string]string{"status": inc.Status})
+	update.applyTo(inc)
+
+	if err := writeInventory(s.DB, func(tx *sql.Tx) error {
+		if err := saveIncident(tx, inc); err != nil {
+			return err
+		}
+		return insertIncidentUpdate(tx, inc.ID, &update)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save incident"})
+		return
+	}
+	inc.Updates = append([]IncidentUpdate{update}, inc.Updates...)
+
+	s.recordAudit(c, "incident.status", "incident", inc.ID, before,
+		auditSnapshot(map[string]string{"status": inc.Status, "message": update.Message}))
+	c.JSON(http.StatusOK, inc)
+}
+
+func (s *AppState) DeleteIncident(c *gin.Context) {
+	id := c.Param("id")
+	var found bool
+	if err := writeInventory(s.DB, func(tx *sql.Tx) error {
+		var err error
+		found, err = deleteIncident(tx, id)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete incident"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
+		return
+	}
+
+	s.recordAudit(c, "incident.delete", "incident", id, nil, nil)
+	c.Status(http.StatusOK)
+}
+
+// loadIncident loads the incident of the :id parameter, or answers the request
+func (s *AppState) loadIncident(c *gin.Context) (*Incident, bool) {
+	inc, err := getIncident(s.DB, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load incident"})
+		return nil, false
+	}
+	if inc == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Incident not found"})
+		return nil, false
+	}
+	return inc, true
+}
+
+func validateIncidentUpdate(u *IncidentUpdate) string {
+	if !incidentStatuses[u.Status] {
+		return "unsupported status: " + u.Status
+	}
+	if strings.TrimSpace(u.Message) == "" {
+		return "message is required"
+	}
+	return ""
+}
+
+// ============================================================================
+// Maintenance Window Handlers
+// ============================================================================
+
+type MaintenanceWindowRequest struct {
+	Title        string   `json:"title"`
+	Description  string   `json:"description,omitempty"`
+	ComponentIDs []string `json:"component_ids"`
+	StartsAt     string   `json:"starts_at"` // RFC3339
+	EndsAt       string   `json:"ends_at"`
+}
+
+// applyTo copies request fields onto a window and returns what is wrong with them, if anything
+func (req *MaintenanceWindowRequest) applyTo(s *AppState, w *MaintenanceWindow) string {
+	if strings.TrimSpace(req.Title) == "" {
+		return "title is required"
+	}
+	if len(req.ComponentIDs) == 0 {
+		return "component_ids is required"
+	}
+	componentIDs, msg := s.statusComponentIDs(req.ComponentIDs)
+	if msg != "" {
+		return msg
+	}
+	start, err1 := time.Parse(time.RFC3339, req.StartsAt)
+	end, err2 := time.Parse(time.RFC3339, req.EndsAt)
+	if err1 != nil || err2 != nil {
+		return "starts_at and ends_at must be RFC3339 times"
+	}
+	if !start.Before(end) {
+		return "starts_at must be before ends_at"
+	}
+
+	w.Title, w.Description, w.ComponentIDs = req.Title, req.Description, componentIDs
+	w.StartsAt, w.EndsAt = start.UTC().Format(time.RFC3339), end.UTC().Format(time.RFC3339)
+	w.Status = w.State(time.Now())
+	return ""
+}
+
+// ListMaintenanceWindows returns all maintenance windows by start
+func (s *AppState) ListMaintenanceWindows(c *gin.Context) {
+	windows, err := listMaintenanceWindows(s.DB, time.Time{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load maintenance windows"})
+		return
+	}
+	c.JSON(http.StatusOK, windows)
+}
+
+func (s *AppState) CreateMaintenanceWindow(c *gin.Context) {
+	var req MaintenanceWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	w := &MaintenanceWindow{
+		ID:        uuid.New().String(),
+		CreatedBy: currentUser(c).Username,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if msg := req.applyTo(s, w); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if !s.saveMaintenanceWindow(c, w) {
+		return
+	}
+
+	s.recordAudit(c, "maintenance.create", "maintenance", w.ID, nil, auditSnapshot(w))
+	c.JSON(http.StatusOK, w)
+}
+
+func (s *AppState) UpdateMaintenanceWindow(c *gin.Context) {
+	var req MaintenanceWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	w, err := getMaintenanceWindow(s.DB, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load maintenance window"})
+		return
+	}
+	if w == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Maintenance window not found"})
+		return
+	}
+	before := auditSnapshot(w)
+	if msg := req.applyTo(s, w); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	w.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if !s.saveMaintenanceWindow(c, w) {
+		return
+	}
+
+	s.recordAudit(c, "maintenance.update", "maintenance", w.ID, before, auditSnapshot(w))
+	c.JSON(http.StatusOK, w)
+}
+
+func (s *AppState) DeleteMaintenanceWindow(c *gin.Context) {
+	id := c.Param("id")
+	var found bool
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		var err error
+		found, err = deleteMaintenanceWindow(db, id)
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete maintenance window"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Maintenance window not found"})
+		return
+	}
+	if err := s.reloadMaintenance(); err != nil {
+		fmt.Printf("⚠️  Failed to reload maintenance windows: %v\n", err)
+	}
+
+	s.recordAudit(c, "maintenance.delete", "maintenance", id, nil, nil)
+	c.Status(http.StatusOK)
+}
+
+// saveMaintenanceWindow stores a window and applies it to alerts and downtime, or answers the request
+func (s *AppState) saveMaintenanceWindow(c *gin.Context, w *MaintenanceWindow) bool {
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		return saveMaintenanceWindow(db, w)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save maintenance window"})
+		return false
+	}
+	if err := s.reloadMaintenance(); err != nil {
+		fmt.Printf("⚠️  Failed to reload maintenance windows: %v\n", err)
+	}
+	return true
+}
+
+// ============================================================================
+// Public Status Page
+// ============================================================================
+
+type StatusPageResponse struct {
+	Title       string                 `json:"title"`
+	Description string                 `json:"description,omitempty"`
+	Status      string                 `json:"status"` // Worst status of all components
+	UpdatedAt   string                 `json:"updated_at"`
+	Components  []StatusComponentState `json:"components"`
+	Incidents   []Incident             `json:"incidents"`   // Open and recently updated, newest first
+	Maintenance []MaintenanceWindow    `json:"maintenance"` // In progress and scheduled, by start
+}
+
+type StatusComponentState struct {
+	ID            string      `json:"id"`
+	Name          string      `json:"name"`
+	Description   string      `json:"description,omitempty"`
+	Status        string      `json:"status"`
+	UptimePercent *float64    `json:"uptime_percent"` // Over the days below; null without data
+	Days          []StatusDay `json:"days"`           // Oldest first
+}
+
+type StatusDay struct {
+	Date          string   `json:"date"`
+	UptimePercent *float64 `json:"uptime_percent"`
+}
+
+// statusPageConfig returns the status page settings with the defaults filled in, or answers
+// 404 when the page is disabled
+func (s *AppState) statusPageConfig(c *gin.Context) (StatusPageSettings, bool) {
+	s.ConfigMu.RLock()
+	settings := s.Config.StatusPage
+	siteName := s.Config.SiteSettings.SiteName
+	s.ConfigMu.RUnlock()
+
+	if !settings.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Status page is not enabled"})
+		return settings, false
+	}
+	if settings.Title == "" {
+		settings.Title = siteName
+	}
+	if settings.Title == "" {
+		settings.Title = "Status"
+	}
+	if settings.PageURL == "" {
+		settings.PageURL = requestBaseURL(c) + "/api/status"
+	}
+	return settings, true
+}
+
+// GetStatusPage returns the status and uptime of the components with open and recent incidents
+// and upcoming maintenance; ?days= sets the uptime history (default and at most 90)
+func (s *AppState) GetStatusPage(c *gin.Context) {
+	settings, ok := s.statusPageConfig(c)
+	if !ok {
+		return
+	}
+	days, _ := strconv.Atoi(c.DefaultQuery("days", strconv.Itoa(statusMaxDays)))
+	if days <= 0 || days > statusMaxDays {
+		days = statusMaxDays
+	}
+
+	now := time.Now().UTC()
+	incidents, err := queryIncidents(s.DB, IncidentFilter{Since: now.Add(-statusIncidentHistory)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load incidents"})
+		return
+	}
+	windows, err := listMaintenanceWindows(s.DB, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load maintenance windows"})
+		return
+	}
+	components, err := s.componentStates(settings.Components, windows, incidents, days, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute availability"})
+		return
+	}
+
+	page := StatusPageResponse{
+		Title:       settings.Title,
+		Description: settings.Description,
+		Status:      ComponentOperational,
+		UpdatedAt:   now.Format(time.RFC3339),
+		Components:  components,
+		Incidents:   incidents,
+		Maintenance: windows,
+	}
+	for _, comp := range components {
+		page.Status = worseStatus(page.Status, comp.Status)
+	}
+
+	// Visitors don't need to know who reported what
+	for i := range page.Incidents {
+		page.Incidents[i].CreatedBy = ""
+		for j := range page.Incidents[i].Updates {
+			page.Incidents[i].Updates[j].CreatedBy = ""
+		}
+	}
+	for i := range page.Maintenance {
+		page.Maintenance[i].CreatedBy = ""
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// componentStates derives the status and daily uptime of every component
+func (s *AppState) componentStates(components []StatusComponent, windows []MaintenanceWindow, incidents []Incident, days int, now time.Time) ([]StatusComponentState, error) {
+	s.ConfigMu.RLock()
+	servers := make(map[string]RemoteServer, len(s.Config.Servers)+1)
+	for _, server := range s.Config.Servers {
+		servers[server.ID] = server
+	}
+	servers["local"] = RemoteServer{ID: "local", Name: s.Config.LocalNode.Name}
+	s.ConfigMu.RUnlock()
+
+	s.AgentMetricsMu.RLock()
+	agentMetrics := make(map[string]*AgentMetricsData, len(components))
+	for _, comp := range components {
+		if data := s.AgentMetrics[comp.ServerID]; data != nil {
+			agentMetrics[comp.ServerID] = data
+		}
+	}
+	s.AgentMetricsMu.RUnlock()
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := today.AddDate(0, 0, -(days - 1))
+
+	var localMetrics *SystemMetrics
+	states := make([]StatusComponentState, 0, len(components))
+	for i := range components {
+		comp := &components[i]
+		server, known := servers[comp.ServerID]
+
+		// The dashboard server is up whenever it answers
+		online := comp.ServerID == "local"
+		var metrics *SystemMetrics
+		if comp.ServerID == "local" {
+			if comp.PingTarget != "" && localMetrics == nil {
+				m := CollectMetrics()
+				localMetrics = &m
+			}
+			metrics = localMetrics
+		} else if data := agentMetrics[comp.ServerID]; known && data != nil {
+			online = isAgentOnline(&server, data, now)
+			metrics = &data.Metrics
+		}
+
+		state := StatusComponentState{
+			ID:          comp.ID,
+			Name:        comp.Name,
+			Description: comp.Description,
+			Status:      comp.status(comp.connectivityStatus(online, metrics), windows, incidents, now),
+			Days:        make([]StatusDay, 0, days),
+		}
+
+		perDay := map[string]float64{}
+		if known {
+			var err error
+			if state.UptimePercent, perDay, err = componentUptime(s.DB, comp, &server, from, today, now); err != nil {
+				return nil, err
+			}
+		}
+		for d := from; !d.After(today); d = d.AddDate(0, 0, 1) {
+			day := StatusDay{Date: d.Format("2006-01-02")}
+			if p, ok := perDay[day.Date]; ok {
+				day.UptimePercent = &p
+			}
+			state.Days = append(state.Days, day)
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// componentUptime returns the availability of a component since from and per UTC day. Server
+// components use the daily uptime rollup and compute today, which it fills in only tomorrow.
+func componentUptime(db *sql.DB, comp *StatusComponent, server *RemoteServer, from, today, now time.Time) (*float64, map[string]float64, error) {
+	if comp.PingTarget != "" {
+		return pingDailyAvailability(metricsStore, server.ID, comp.PingTarget, from, now)
+	}
+
+	report, err := computeAvailability(db, metricsStore, server, from, now, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	perDay, err := dailyUptime(db, server.ID, from)
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := computeAvailability(db, metricsStore, server, today, now, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if current.AvailabilityPercent != nil {
+		perDay[today.Format("2006-01-02")] = *current.AvailabilityPercent
+	}
+	return report.AvailabilityPercent, perDay, nil
+}
+
+// ============================================================================
+// Status Feed Handlers
+// ============================================================================
+
+// statusFeed loads the feed items, or answers the request
+func (s *AppState) statusFeed(c *gin.Context) (StatusPageSettings, []statusFeedItem, bool) {
+	settings, ok := s.statusPageConfig(c)
+	if !ok {
+		return settings, nil, false
+	}
+	incidents, err := queryIncidents(s.DB, IncidentFilter{Limit: statusFeedItems})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load incidents"})
+		return settings, nil, false
+	}
+	windows, err := listMaintenanceWindows(s.DB, time.Time{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load maintenance windows"})
+		return settings, nil, false
+	}
+	return settings, statusFeedEntries(incidents, windows, settings.PageURL), true
+}
+
+func (s *AppState) GetStatusFeedJSON(c *gin.Context) {
+	settings, items, ok := s.statusFeed(c)
+	if !ok {
+		return
+	}
+	feedURL := requestBaseURL(c) + c.Request.URL.Path
+	data, err := json.Marshal(buildJSONFeed(settings.Title, settings.Description, settings.PageURL, feedURL, items))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build feed"})
+		return
+	}
+	c.Data(http.StatusOK, "application/feed+json; charset=utf-8", data)
+}
+
+func (s *AppState) GetStatusFeedRSS(c *gin.Context) {
+	settings, items, ok := s.statusFeed(c)
+	if !ok {
+		return
+	}
+	s.writeXMLFeed(c, "application/rss+xml; charset=utf-8",
+		buildRSSFeed(settings.Title, settings.Description, settings.PageURL, items, time.Now().UTC()))
+}
+
+func (s *AppState) GetStatusFeedAtom(c *gin.Context) {
+	settings, items, ok := s.statusFeed(c)
+	if !ok {
+		return
+	}
+	feedURL := requestBaseURL(c) + c.Request.URL.Path
+	s.writeXMLFeed(c, "application/atom+xml; charset=utf-8",
+		buildAtomFeed(settings.Title, settings.Description, settings.PageURL, feedURL, items, time.Now().UTC()))
+}
+
+func (s *AppState) writeXMLFeed(c *gin.Context, contentType string, feed interface{}) {
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build feed"})
+		return
+	}
+	c.Data(http.StatusOK, contentType, append([]byte(xml.Header), data...))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// API Token Handlers
+// ============================================================================
+
+type CreateAPITokenRequest struct {
+	Name            string  `json:"name"`
+	Scopes          []Scope `json:"scopes"`
+	ExpiresAt       string  `json:"expires_at,omitempty"`       // RFC3339, empty for no expiry
+	AdminEquivalent bool    `json:"admin_equivalent,omitempty"` // Required for scopes in adminEquivalentScopes
+}
+
+type CreateAPITokenResponse struct {
+	*APIToken
+	Token string `json:"token"` // Only returned once
+}
+
+// ListAPITokens lists the tokens of the current user
+func (s *AppState) ListAPITokens(c *gin.Context) {
+	tokens, err := listAPITokens(s.DB, currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (s *AppState) CreateAPIToken(c *gin.Context) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	scopes, err := validateScopes(req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, scope := range scopes {
+		if adminEquivalentScopes[scope] && !req.AdminEquivalent {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("scope %s is equivalent to admin access and requires admin_equivalent", scope)})
+			return
+		}
+	}
+	expiresAt := ""
+	if req.ExpiresAt != "" {
+		t, err := time.Parse(time.RFC3339, req.ExpiresAt)
+		if err != nil || !t.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be a future RFC3339 time"})
+			return
+		}
+		expiresAt = t.UTC().Format(time.RFC3339)
+	}
+
+	token, secret := newAPIToken(currentUser(c).ID, req.Name, scopes, expiresAt)
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		return saveAPIToken(db, token, secret)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save token"})
+		return
+	}
+
+	s.recordAudit(c, "api_token.create", "api_token", token.ID, nil, auditSnapshot(token))
+	c.JSON(http.StatusOK, CreateAPITokenResponse{APIToken: token, Token: secret})
+}
+
+// DeleteAPIToken revokes one of the current user's tokens
+func (s *AppState) DeleteAPIToken(c *gin.Context) {
+	var found bool
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		var err error
+		found, err = deleteAPIToken(db, currentUser(c).ID, c.Param("id"))
+		return err
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete token"})
+		return
+	}
+
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	s.recordAudit(c, "api_token.delete", "api_token", c.Param("id"), nil, nil)
+	c.Status(http.StatusOK)
+}
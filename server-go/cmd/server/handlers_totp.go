@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Two-Factor Authentication Handlers
+// ============================================================================
+
+type TOTPStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	Pending                bool `json:"pending"` // enrolled but not confirmed with a code yet
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"` // render as a QR code for authenticator apps
+}
+
+type TOTPCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code,omitempty"` // accepted instead of code when disabling
+}
+
+type TOTPRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// GetTOTPStatus reports whether the current user has two-factor authentication
+func (s *AppState) GetTOTPStatus(c *gin.Context) {
+	t, err := getUserTOTP(s.DB, currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor settings"})
+		return
+	}
+	var status TOTPStatusResponse
+	if t != nil {
+		status.Enabled = t.Enabled
+		status.Pending = !t.Enabled
+		status.RecoveryCodesRemaining = len(t.RecoveryCodes)
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// EnrollTOTP creates a new secret for the current user; it takes effect once confirmed with EnableTOTP
+func (s *AppState) EnrollTOTP(c *gin.Context) {
+	user := currentUser(c)
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	t, err := newUserTOTP(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	if err := saveUserTOTP(s.DB, t); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save two-factor settings"})
+		return
+	}
+	c.JSON(http.StatusOK, TOTPEnrollResponse{
+		Secret: t.Secret,
+		URI:    t.URI(user.Username),
+	})
+}
+
+// EnableTOTP confirms an enrollment with a code from the authenticator app and returns the
+// recovery codes, which are only shown this once
+func (s *AppState) EnableTOTP(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	t, err := getUserTOTP(s.DB, currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor settings"})
+		return
+	}
+	if t == nil || t.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending two-factor enrollment"})
+		return
+	}
+	step := t.matchStep(req.Code, time.Now())
+	if step == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	t.Enabled = true
+	t.RecoveryCodes = hashes
+	t.LastStep = step
+	t.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := saveUserTOTP(s.DB, t); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save two-factor settings"})
+		return
+	}
+	c.JSON(http.StatusOK, TOTPRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns two-factor authentication off; it needs a current code or a recovery code,
+// so a stolen session alone cannot remove it
+func (s *AppState) DisableTOTP(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user := currentUser(c)
+	if user.TOTPEnabled && !s.checkSecondFactor(c, user.ID, req.Code, req.RecoveryCode) {
+		return
+	}
+	if _, err := DisableUserTOTP(s.DB, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save two-factor settings"})
+		return
+	}
+	c.Status(http.StatusOK)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user
+func (s *AppState) RegenerateRecoveryCodes(c *gin.Context) {
+	var req TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user := currentUser(c)
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !s.checkSecondFactor(c, user.ID, req.Code, "") {
+		return
+	}
+
+	t, err := getUserTOTP(s.DB, user.ID)
+	if err != nil || t == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor settings"})
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	t.RecoveryCodes = hashes
+	t.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := saveUserTOTP(s.DB, t); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save two-factor settings"})
+		return
+	}
+	c.JSON(http.StatusOK, TOTPRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// ResetUserTOTP lets an admin turn off two-factor authentication of a user who lost their device
+func (s *AppState) ResetUserTOTP(c *gin.Context) {
+	found, err := DisableUserTOTP(s.DB, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save two-factor settings"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Two-factor authentication is not enabled for this user"})
+		return
+	}
+	s.recordAudit(c, "user.totp_reset", "user", c.Param("id"), nil, nil)
+	c.Status(http.StatusOK)
+}
+
+// checkSecondFactor verifies a TOTP code, or else a recovery code, of a user with two-factor
+// authentication enabled. It responds with 401 and totp_required if neither is valid.
+func (s *AppState) checkSecondFactor(c *gin.Context, userID, code, recoveryCode string) bool {
+	if code == "" && recoveryCode == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor code required", "totp_required": true})
+		return false
+	}
+
+	var ok bool
+	var err error
+	if code != "" {
+		var t *UserTOTP
+		if t, err = getUserTOTP(s.DB, userID); err == nil && t != nil && t.Enabled {
+			ok, err = useTOTPCode(s.DB, t, code)
+		}
+	} else {
+		ok, err = useRecoveryCode(s.DB, userID, recoveryCode)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify two-factor code"})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code", "totp_required": true})
+		return false
+	}
+	return true
+}
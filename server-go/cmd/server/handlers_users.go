@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// User Management Handlers
+// ============================================================================
+
+type UserRequest struct {
+	Username   *string         `json:"username,omitempty"`
+	Password   *string         `json:"password,omitempty"` // Empty string removes the password
+	Role       *Role           `json:"role,omitempty"`
+	Identities *[]UserIdentity `json:"identities,omitempty"` // Replaces the linked OAuth accounts
+}
+
+func (s *AppState) ListUsers(c *gin.Context) {
+	users, err := listUsers(s.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load users"})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+func (s *AppState) CreateUser(c *gin.Context) {
+	var req UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Username == nil || req.Role == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user := newUser(*req.Username, *req.Role)
+	if !applyUserRequest(c, &req, user) {
+		return
+	}
+
+	if err := SaveUser(s.DB, user); err != nil {
+		respondUserSaveError(c, err)
+		return
+	}
+	s.recordAudit(c, "user.create", "user", user.ID, nil, auditSnapshot(user))
+	c.JSON(http.StatusOK, user)
+}
+
+func (s *AppState) UpdateUser(c *gin.Context) {
+	var req UserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	user, err := getUserByID(s.DB, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	before := auditSnapshot(user)
+	if !applyUserRequest(c, &req, user) {
+		return
+	}
+	user.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := SaveUser(s.DB, user); err != nil {
+		respondUserSaveError(c, err)
+		return
+	}
+	after := auditSnapshot(user)
+	if req.Password != nil {
+		// The password hash is not part of the snapshot; record that it was set
+		after["password"] = auditRedacted
+		if _, err := RevokeUserSessions(s.DB, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+			return
+		}
+	}
+	s.recordAudit(c, "user.update", "user", user.ID, before, after)
+	c.JSON(http.StatusOK, user)
+}
+
+func (s *AppState) DeleteUser(c *gin.Context) {
+	id := c.Param("id")
+	if id == currentUser(c).ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete your own account"})
+		return
+	}
+
+	user, err := getUserByID(s.DB, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return
+	}
+	found, err := DeleteUser(s.DB, id)
+	if err != nil {
+		respondUserSaveError(c, err)
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	s.recordAudit(c, "user.delete", "user", id, auditSnapshot(user), nil)
+	c.Status(http.StatusOK)
+}
+
+// applyUserRequest validates the request and copies it onto user, responding with an error if it is invalid
+func applyUserRequest(c *gin.Context, req *UserRequest, user *User) bool {
+	if req.Username != nil {
+		if err := validateUsername(*req.Username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		user.Username = *req.Username
+	}
+	if req.Role != nil {
+		if !req.Role.Valid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be admin, operator or viewer"})
+			return false
+		}
+		user.Role = *req.Role
+	}
+	if req.Identities != nil {
+		for _, identity := range *req.Identities {
+			if err := validateIdentity(identity); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return false
+			}
+		}
+		user.Identities = *req.Identities
+	}
+	if req.Password != nil {
+		if *req.Password == "" {
+			user.PasswordHash, user.HasPassword = "", false
+		} else if err := user.SetPassword(*req.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+			return false
+		}
+	}
+	if !user.HasPassword && len(user.Identities) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A password or a linked OAuth account is required"})
+		return false
+	}
+	return true
+}
+
+func respondUserSaveError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUsernameTaken), errors.Is(err, errIdentityLinked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errLastAdmin):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user: " + err.Error()})
+	}
+}
@@ -51,7 +51,7 @@ type UpgradeServerResponse struct {
 	Output  string `json:"output,omitempty"`
 }
 
-func UpgradeServer(c *gin.Context) {
+func (s *AppState) UpgradeServer(c *gin.Context) {
 	var req UpgradeServerRequest
 	c.ShouldBindJSON(&req)
 
@@ -79,6 +79,7 @@ func UpgradeServer(c *gin.Context) {
 		return
 	}
 
+	s.recordAudit(c, "system.upgrade", "system", "", nil, auditSnapshot(gin.H{"from_version": ServerVersion, "force": req.Force}))
 	c.JSON(http.StatusOK, UpgradeServerResponse{
 		Success: true,
 		Message: "Upgrade started in background (force mode). The server will restart shortly. Check /tmp/vstats-upgrade.log for details.",
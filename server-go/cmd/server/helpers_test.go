@@ -0,0 +1,93 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// openTestDB opens an empty database in a temporary directory
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newTestState returns a state over a migrated database in a temporary directory, with one
+// admin user and an empty config. Writes go through dbWriter as in the server.
+func newTestState(t *testing.T) *AppState {
+	t.Helper()
+	db := openTestDB(t)
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	dbWriter = NewDBWriter(db, 64)
+	t.Cleanup(func() {
+		dbWriter.Close()
+		dbWriter = nil
+	})
+
+	s := &AppState{DB: db, Config: &AppConfig{}, WSTickets: NewWSTickets()}
+	newTestUser(t, s, "admin", RoleAdmin)
+	return s
+}
+
+func newTestUser(t *testing.T, s *AppState, username string, role Role) *User {
+	t.Helper()
+	user := newUser(username, role)
+	if err := user.SetPassword("password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveUser(s.DB, user); err != nil {
+		t.Fatalf("save user %s: %v", username, err)
+	}
+	return user
+}
+
+// newTestToken creates an API token of user and returns its secret
+func newTestToken(t *testing.T, s *AppState, user *User, scopes ...Scope) string {
+	t.Helper()
+	token, secret := newAPIToken(user.ID, "test", scopes, "")
+	if err := saveAPIToken(s.DB, token, secret); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// newTestSession logs user in and returns the session JWT
+func newTestSession(t *testing.T, s *AppState, user *User) string {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+	token, _, err := s.issueSession(c, user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// serveTest sends a request through a router with handlers registered by route, and an
+// Authorization header when bearer is set
+func serveTest(route func(r *gin.Engine), method, target, bearer string) *httptest.ResponseRecorder {
+	r := gin.New()
+	route(r)
+	req := httptest.NewRequest(method, target, nil)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// ============================================================================
+// Inventory & Settings Persistence
+// ============================================================================
+//
+// Servers, group dimensions and settings live in the database; the config file only
+// keeps the bootstrap settings needed before the database is open (see BootstrapConfig).
+// AppState.Config stays the in-memory view; handlers change it under ConfigMu and then
+// persist just the part they changed.
+
+// Keys of the settings table and the AppConfig field stored under each
+const (
+	SettingAdminPasswordHash = "admin_password_hash"
+	SettingSite              = "site"
+	SettingLocalNode         = "local_node"
+	SettingProbe             = "probe"
+	SettingOAuth             = "oauth"
+	SettingNotifications     = "notifications"
+	SettingPrometheus        = "prometheus"
+	SettingRetention         = "retention"
+	SettingBackup            = "backup"
+	SettingVisibility        = "visibility"
+	SettingStatusPage        = "status_page"
+	SettingGroups            = "groups" // Deprecated server groups
+)
+
+func (c *AppConfig) settingFields() map[string]interface{} {
+	return map[string]interface{}{
+		SettingAdminPasswordHash: &c.AdminPasswordHash,
+		SettingSite:              &c.SiteSettings,
+		SettingLocalNode:         &c.LocalNode,
+		SettingProbe:             &c.ProbeSettings,
+		SettingOAuth:             &c.OAuth,
+		SettingNotifications:     &c.Notifications,
+		SettingPrometheus:        &c.Prometheus,
+		SettingRetention:         &c.Retention,
+		SettingBackup:            &c.Backup,
+		SettingVisibility:        &c.Visibility,
+		SettingStatusPage:        &c.StatusPage,
+		SettingGroups:            &c.Groups,
+	}
+}
+
+// writeInventory runs fn in a transaction, through dbWriter when it is running
+func writeInventory(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	run := func(db *sql.DB) error {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	if dbWriter == nil {
+		return run(db)
+	}
+	return dbWriter.WriteSync(run)
+}
+
+// ============================================================================
+// Loading
+// ============================================================================
+
+// LoadInventory replaces the inventory and settings of config with the stored ones.
+// It reports false, leaving config untouched, when nothing has been stored yet.
+func LoadInventory(db *sql.DB, config *AppConfig) (bool, error) {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM settings WHERE key = ?`, SettingAdminPasswordHash).Scan(&n); err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	loaded := *config
+	for key, field := range loaded.settingFields() {
+		var value string
+		err := db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err == nil {
+			err = json.Unmarshal([]byte(value), field)
+		}
+		if err != nil {
+			return false, fmt.Errorf("setting %s: %w", key, err)
+		}
+	}
+
+	servers, err := loadServers(db)
+	if err != nil {
+		return false, err
+	}
+	dimensions, err := loadGroupDimensions(db)
+	if err != nil {
+		return false, err
+	}
+	loaded.Servers, loaded.GroupDimensions = servers, dimensions
+	*config = loaded
+	return true, nil
+}
+
+// LoadSetting reads a single settings section into dst
+func LoadSetting(db *sql.DB, key string, dst interface{}) error {
+	var value string
+	if err := db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&value); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(value), dst)
+}
+
+func loadServers(db *sql.DB) ([]RemoteServer, error) {
+	rows, err := db.Query(`
+		SELECT id, name, url, location, provider, tag, token, version, ip, group_id, group_values,
+			price_amount, price_period, purchase_date, tip_badge, offline_grace_secs, sla_target, hidden
+		FROM servers
+		ORDER BY position, rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	servers := []RemoteServer{}
+	for rows.Next() {
+		var s RemoteServer
+		var groupValues string
+		if err := rows.Scan(&s.ID, &s.Name, &s.URL, &s.Location, &s.Provider, &s.Tag, &s.Token, &s.Version, &s.IP,
+			&s.GroupID, &groupValues, &s.PriceAmount, &s.PricePeriod, &s.PurchaseDate, &s.TipBadge,
+			&s.OfflineGraceSecs, &s.SLATarget, &s.Hidden); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(groupValues), &s.GroupValues)
+		if len(s.GroupValues) == 0 {
+			s.GroupValues = nil
+		}
+		servers = append(servers, s)
+	}
+	return servers, rows.Err()
+}
+
+func loadGroupDimensions(db *sql.DB) ([]GroupDimension, error) {
+	rows, err := db.Query(`SELECT id, name, key, enabled, sort_order FROM group_dimensions ORDER BY sort_order, id`)
+	if err != nil {
+		return nil, err
+	}
+	dimensions := []GroupDimension{}
+	index := make(map[string]int)
+	for rows.Next() {
+		d := GroupDimension{Options: []GroupOption{}}
+		if err := rows.Scan(&d.ID, &d.Name, &d.Key, &d.Enabled, &d.SortOrder); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[d.ID] = len(dimensions)
+		dimensions = append(dimensions, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	optRows, err := db.Query(`SELECT dimension_id, id, name, sort_order FROM group_options ORDER BY sort_order, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer optRows.Close()
+	for optRows.Next() {
+		var dimID string
+		var o GroupOption
+		if err := optRows.Scan(&dimID, &o.ID, &o.Name, &o.SortOrder); err != nil {
+			return nil, err
+		}
+		if i, ok := index[dimID]; ok {
+			dimensions[i].Options = append(dimensions[i].Options, o)
+		}
+	}
+	return dimensions, optRows.Err()
+}
+
+// ============================================================================
+// Saving
+// ============================================================================
+
+// SaveSettings stores the named settings sections of config
+func SaveSettings(db *sql.DB, config *AppConfig, keys ...string) error {
+	fields := config.settingFields()
+	return writeInventory(db, func(tx *sql.Tx) error {
+		for _, key := range keys {
+			field, ok := fields[key]
+			if !ok {
+				return fmt.Errorf("unknown setting %q", key)
+			}
+			if err := saveSettingTx(tx, key, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func saveSettingTx(tx *sql.Tx, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		key, string(data), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// SaveServer inserts or updates one server; new servers are appended to the display order
+func SaveServer(db *sql.DB, server RemoteServer) error {
+	return writeInventory(db, func(tx *sql.Tx) error {
+		return saveServerTx(tx, server, -1)
+	})
+}
+
+// saveServerTx upserts a server at position, or at the end for new servers when position < 0
+func saveServerTx(tx *sql.Tx, s RemoteServer, position int) error {
+	groupValues, err := json.Marshal(s.GroupValues)
+	if err != nil {
+		return err
+	}
+	if s.GroupValues == nil {
+		groupValues = []byte("{}")
+	}
+
+	positionExpr, args := "(SELECT COALESCE(MAX(position), -1) + 1 FROM servers)", []interface{}{}
+	if position >= 0 {
+		positionExpr, args = "?", []interface{}{position}
+	}
+	args = append(args, s.ID, s.Name, s.URL, s.Location, s.Provider, s.Tag, s.Token, s.Version, s.IP,
+		s.GroupID, string(groupValues), s.PriceAmount, s.PricePeriod, s.PurchaseDate, s.TipBadge,
+		s.OfflineGraceSecs, s.SLATarget, s.Hidden)
+
+	update := ""
+	if position >= 0 {
+		update = "position = excluded.position,"
+	}
+	_, err = tx.Exec(`
+		INSERT INTO servers (position, id, name, url, location, provider, tag, token, version, ip, group_id, group_values,
+			price_amount, price_period, purchase_date, tip_badge, offline_grace_secs, sla_target, hidden)
+		VALUES (`+positionExpr+`, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET `+update+`
+			name = excluded.name,
+			url = excluded.url,
+			location = excluded.location,
+			provider = excluded.provider,
+			tag = excluded.tag,
+			token = excluded.token,
+			version = excluded.version,
+			ip = excluded.ip,
+			group_id = excluded.group_id,
+			group_values = excluded.group_values,
+			price_amount = excluded.price_amount,
+			price_period = excluded.price_period,
+			purchase_date = excluded.purchase_date,
+			tip_badge = excluded.tip_badge,
+			offline_grace_secs = excluded.offline_grace_secs,
+			sla_target = excluded.sla_target,
+			hidden = excluded.hidden`, args...)
+	return err
+}
+
+// DeleteServerRecord removes a server from the inventory
+func DeleteServerRecord(db *sql.DB, id string) error {
+	return writeInventory(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM servers WHERE id = ?`, id)
+		return err
+	})
+}
+
+// UpdateServerAgentInfo records the version and IP an agent reports. It is called for every
+// metrics message, so the write is queued and only touches the two columns.
+func UpdateServerAgentInfo(db *sql.DB, id, version, ip string) {
+	update := func(db *sql.DB) error {
+		_, err := db.Exec(`UPDATE servers SET version = ?, ip = ? WHERE id = ?`, version, ip, id)
+		return err
+	}
+	if dbWriter == nil {
+		update(db)
+		return
+	}
+	dbWriter.WriteAsync(update)
+}
+
+// SaveGrouping stores the group dimensions together with everything that references them (the
+// order and grouping of servers, local node and the deprecated groups), as removing a dimension
+// or option changes all of them
+func SaveGrouping(db *sql.DB, config *AppConfig) error {
+	return writeInventory(db, func(tx *sql.Tx) error {
+		return saveGroupingTx(tx, config)
+	})
+}
+
+// groupingCopy returns a copy of config whose servers, local node, groups and dimensions can be
+// changed without touching config, so that only saved changes are applied
+func (c *AppConfig) groupingCopy() *AppConfig {
+	next := *c
+	next.Servers = slices.Clone(c.Servers)
+	for i := range next.Servers {
+		next.Servers[i].GroupValues = maps.Clone(next.Servers[i].GroupValues)
+	}
+	next.LocalNode.GroupValues = maps.Clone(c.LocalNode.GroupValues)
+	next.Groups = slices.Clone(c.Groups)
+	next.GroupDimensions = slices.Clone(c.GroupDimensions)
+	for i := range next.GroupDimensions {
+		next.GroupDimensions[i].Options = slices.Clone(next.GroupDimensions[i].Options)
+	}
+	return &next
+}
+
+// applyGrouping takes over the grouping of a saved groupingCopy
+func (c *AppConfig) applyGrouping(next *AppConfig) {
+	c.Servers, c.LocalNode = next.Servers, next.LocalNode
+	c.Groups, c.GroupDimensions = next.Groups, next.GroupDimensions
+}
+
+func saveGroupingTx(tx *sql.Tx, config *AppConfig) error {
+	if _, err := tx.Exec(`DELETE FROM group_options`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM group_dimensions`); err != nil {
+		return err
+	}
+	for _, d := range config.GroupDimensions {
+		if _, err := tx.Exec(`INSERT INTO group_dimensions (id, name, key, enabled, sort_order) VALUES (?, ?, ?, ?, ?)`,
+			d.ID, d.Name, d.Key, d.Enabled, d.SortOrder); err != nil {
+			return err
+		}
+		for _, o := range d.Options {
+			if _, err := tx.Exec(`INSERT INTO group_options (dimension_id, id, name, sort_order) VALUES (?, ?, ?, ?)`,
+				d.ID, o.ID, o.Name, o.SortOrder); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Only the grouping columns: version and ip are written by agents in the meantime
+	for i, s := range config.Servers {
+		groupValues, err := json.Marshal(s.GroupValues)
+		if err != nil {
+			return err
+		}
+		if s.GroupValues == nil {
+			groupValues = []byte("{}")
+		}
+		if _, err := tx.Exec(`UPDATE servers SET position = ?, group_id = ?, group_values = ? WHERE id = ?`,
+			i, s.GroupID, string(groupValues), s.ID); err != nil {
+			return err
+		}
+	}
+	fields := config.settingFields()
+	for _, key := range []string{SettingLocalNode, SettingGroups} {
+		if err := saveSettingTx(tx, key, fields[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveInventory stores the complete inventory and all settings of config in one transaction
+func SaveInventory(db *sql.DB, config *AppConfig) error {
+	return writeInventory(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM servers`); err != nil {
+			return err
+		}
+		for i, s := range config.Servers {
+			if err := saveServerTx(tx, s, i); err != nil {
+				return err
+			}
+		}
+		if err := saveGroupingTx(tx, config); err != nil {
+			return err
+		}
+		for key, field := range config.settingFields() {
+			if err := saveSettingTx(tx, key, field); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSaveGroupingKeepsAgentInfo(t *testing.T) {
+	s := newTestState(t)
+	s.Config.Servers = []RemoteServer{{ID: "a", Name: "web-1", Token: "t", Version: "1.0.0", IP: "192.0.2.1"}}
+	if err := SaveInventory(s.DB, s.Config); err != nil {
+		t.Fatal(err)
+	}
+
+	// The agent reports a new version while the config still holds the old one
+	UpdateServerAgentInfo(s.DB, "a", "1.1.0", "192.0.2.2")
+	s.Config.Servers[0].GroupValues = map[string]string{"region": "eu"}
+	if err := SaveGrouping(s.DB, s.Config); err != nil {
+		t.Fatal(err)
+	}
+
+	servers, err := loadServers(s.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].Version != "1.1.0" || servers[0].IP != "192.0.2.2" {
+		t.Fatalf("agent info was overwritten: %+v", servers)
+	}
+	if servers[0].GroupValues["region"] != "eu" {
+		t.Fatalf("grouping was not saved: %+v", servers[0])
+	}
+
+	// Servers deleted in the meantime are not brought back
+	s.Config.Servers = append(s.Config.Servers, RemoteServer{ID: "gone", Name: "gone"})
+	if err := SaveGrouping(s.DB, s.Config); err != nil {
+		t.Fatal(err)
+	}
+	if servers, _ := loadServers(s.DB); len(servers) != 1 {
+		t.Fatalf("deleted server was saved again: %+v", servers)
+	}
+}
+
+func TestFailedSavesLeaveConfigUnchanged(t *testing.T) {
+	s := newTestState(t)
+	s.Config.Servers = []RemoteServer{{ID: "a", Name: "web-1", Token: "t"}}
+	s.Config.GroupDimensions = []GroupDimension{{ID: "d", Name: "Region", Key: "region", Options: []GroupOption{{ID: "o", Name: "EU"}}}}
+	s.Config.Servers[0].GroupValues = map[string]string{"d": "o"}
+	if err := SaveInventory(s.DB, s.Config); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"servers", "group_dimensions"} {
+		if err := dbWriter.WriteSync(func(db *sql.DB) error {
+			_, err := db.Exec(`ALTER TABLE ` + table + ` RENAME TO broken_` + table)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	admin, _ := getUserByUsername(s.DB, "admin")
+	session := newTestSession(t, s, admin)
+	r := gin.New()
+	r.Use(s.AuthMiddleware(RoleOperator))
+	r.PUT("/api/servers/:id", s.UpdateServer)
+	r.POST("/api/groups", s.AddGroup)
+	r.DELETE("/api/dimensions/:id/options/:option_id", s.DeleteOption)
+	send := func(method, target, body string) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("%s %s: %d %s", method, target, w.Code, w.Body)
+		}
+	}
+
+	send(http.MethodPut, "/api/servers/a", `{"name":"renamed"}`)
+	send(http.MethodPost, "/api/groups", `{"name":"new"}`)
+	send(http.MethodDelete, "/api/dimensions/d/options/o", "")
+
+	if s.Config.Servers[0].Name != "web-1" {
+		t.Errorf("server rename was applied: %+v", s.Config.Servers[0])
+	}
+	if len(s.Config.Groups) != 0 {
+		t.Errorf("group was added: %+v", s.Config.Groups)
+	}
+	if len(s.Config.GroupDimensions[0].Options) != 1 || s.Config.Servers[0].GroupValues["d"] != "o" {
+		t.Errorf("option was removed: %+v %+v", s.Config.GroupDimensions, s.Config.Servers[0])
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Login Brute-Force Protection
+// ============================================================================
+//
+// Failed password logins are counted per client IP (as resolved by gin, so only trusted
+// proxies can set it through X-Forwarded-For) and across all IPs. After a few failures an IP
+// has to wait before trying again, doubling with every failure, until it is locked out; many
+// failures from everywhere pause password logins for everyone. The counters live in memory
+// and start over when the server restarts.
+
+const (
+	loginFreeAttempts    = 3                // failures per IP before the backoff starts
+	loginBackoffBase     = time.Second      // wait after the first failure beyond the free ones, doubling after each
+	loginLockoutFailures = 10               // failures per IP that lock it out
+	loginLockoutDuration = 15 * time.Minute // how long a locked out IP is refused
+	loginFailureWindow   = time.Hour        // failures of an IP are forgotten after this long without one
+	loginGlobalFailures  = 100              // failures from all IPs within loginGlobalWindow ...
+	loginGlobalWindow    = 5 * time.Minute
+	loginGlobalPause     = time.Minute // ... that pause password logins for everyone
+)
+
+type loginAttempts struct {
+	failures     int
+	lastFailure  time.Time
+	lastUsername string
+	blockedUntil time.Time
+}
+
+// LoginBlock describes the failed logins of one IP for the admin view
+type LoginBlock struct {
+	IP           string `json:"ip"`
+	Failures     int    `json:"failures"`
+	LastUsername string `json:"last_username"`
+	LastFailure  string `json:"last_failure"`
+	BlockedUntil string `json:"blocked_until,omitempty"` // Empty when the IP may try again now
+	LockedOut    bool   `json:"locked_out"`
+}
+
+// LoginGuard tracks failed logins and decides when clients must back off
+type LoginGuard struct {
+	mu          sync.Mutex
+	ips         map[string]*loginAttempts
+	recent      []time.Time // failures from all IPs within loginGlobalWindow, oldest first
+	globalUntil time.Time
+	lastPrune   time.Time
+}
+
+func NewLoginGuard() *LoginGuard {
+	return &LoginGuard{ips: make(map[string]*loginAttempts)}
+}
+
+// Wait returns how long ip must wait before its next login attempt; zero means it may try now
+func (g *LoginGuard) Wait(ip string, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	wait := g.globalUntil.Sub(now)
+	if a, ok := g.ips[ip]; ok {
+		if d := a.blockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Failed records a failed login from ip
+func (g *LoginGuard) Failed(ip, username string, now time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prune(now)
+
+	a, ok := g.ips[ip]
+	if !ok || now.Sub(a.lastFailure) > loginFailureWindow {
+		a = &loginAttempts{}
+		g.ips[ip] = a
+	}
+	a.failures++
+	a.lastFailure = now
+	a.lastUsername = username
+	switch {
+	case a.failures >= loginLockoutFailures:
+		a.blockedUntil = now.Add(loginLockoutDuration)
+		fmt.Printf("🚫 Login locked out for %s until %s after %d failed attempts (last username %q)\n",
+			ip, a.blockedUntil.UTC().Format(time.RFC3339), a.failures, username)
+	case a.failures > loginFreeAttempts:
+		a.blockedUntil = now.Add(loginBackoffBase << (a.failures - loginFreeAttempts - 1))
+	}
+
+	g.recent = append(g.recent, now)
+	if len(g.recent) >= loginGlobalFailures && !now.Before(g.globalUntil) {
+		g.globalUntil = now.Add(loginGlobalPause)
+		fmt.Printf("🚫 %d failed logins from all addresses within %s, pausing password logins until %s\n",
+			len(g.recent), loginGlobalWindow, g.globalUntil.UTC().Format(time.RFC3339))
+	}
+}
+
+// Succeeded forgets the failures of ip after it logged in
+func (g *LoginGuard) Succeeded(ip string) {
+	g.mu.Lock()
+	delete(g.ips, ip)
+	g.mu.Unlock()
+}
+
+// Unblock forgets the failures of ip and reports whether there were any
+func (g *LoginGuard) Unblock(ip string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	_, ok := g.ips[ip]
+	delete(g.ips, ip)
+	if ok {
+		fmt.Printf("🔓 Login block for %s cleared by an admin\n", ip)
+	}
+	return ok
+}
+
+// Blocks lists the IPs with recent failed logins, most recent first, and when the global pause ends
+func (g *LoginGuard) Blocks(now time.Time) ([]LoginBlock, time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.prune(now)
+
+	blocks := []LoginBlock{}
+	for ip, a := range g.ips {
+		b := LoginBlock{
+			IP:           ip,
+			Failures:     a.failures,
+			LastUsername: a.lastUsername,
+			LastFailure:  a.lastFailure.UTC().Format(time.RFC3339),
+			LockedOut:    a.failures >= loginLockoutFailures && now.Before(a.blockedUntil),
+		}
+		if now.Before(a.blockedUntil) {
+			b.BlockedUntil = a.blockedUntil.UTC().Format(time.RFC3339)
+		}
+		blocks = append(blocks, b)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].LastFailure > blocks[j].LastFailure })
+
+	var globalUntil time.Time
+	if now.Before(g.globalUntil) {
+		globalUntil = g.globalUntil
+	}
+	return blocks, globalUntil
+}
+
+// prune drops failures that no longer count, at most once a minute; callers hold g.mu
+func (g *LoginGuard) prune(now time.Time) {
+	cutoff := now.Add(-loginGlobalWindow)
+	i := 0
+	for i < len(g.recent) && g.recent[i].Before(cutoff) {
+		i++
+	}
+	g.recent = g.recent[i:]
+
+	if now.Sub(g.lastPrune) < time.Minute {
+		return
+	}
+	g.lastPrune = now
+	for ip, a := range g.ips {
+		if now.Sub(a.lastFailure) > loginFailureWindow && now.After(a.blockedUntil) {
+			delete(g.ips, ip)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginGuardBackoff(t *testing.T) {
+	g := NewLoginGuard()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	const ip = "192.0.2.1"
+
+	for i := 1; i <= loginFreeAttempts; i++ {
+		g.Failed(ip, "admin", now)
+		if wait := g.Wait(ip, now); wait != 0 {
+			t.Fatalf("failure %d: wait %v within the free attempts", i, wait)
+		}
+	}
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		g.Failed(ip, "admin", now)
+		if wait := g.Wait(ip, now); wait != want {
+			t.Fatalf("failure %d: wait %v, want %v", loginFreeAttempts+i+1, wait, want)
+		}
+	}
+	if wait := g.Wait("192.0.2.2", now); wait != 0 {
+		t.Fatalf("other IP has to wait %v", wait)
+	}
+
+	for i := loginFreeAttempts + 5; i <= loginLockoutFailures; i++ {
+		g.Failed(ip, "admin", now)
+	}
+	if wait := g.Wait(ip, now); wait != loginLockoutDuration {
+		t.Fatalf("locked out for %v", wait)
+	}
+	blocks, _ := g.Blocks(now)
+	if len(blocks) != 1 || !blocks[0].LockedOut || blocks[0].Failures != loginLockoutFailures {
+		t.Fatalf("blocks: %+v", blocks)
+	}
+
+	if !g.Unblock(ip) || g.Wait(ip, now) != 0 {
+		t.Fatal("unblock did not clear the lockout")
+	}
+
+	// Failures are forgotten after a successful login and after the failure window
+	for i := 0; i < loginFreeAttempts+1; i++ {
+		g.Failed(ip, "admin", now)
+	}
+	g.Succeeded(ip)
+	g.Failed(ip, "admin", now)
+	if wait := g.Wait(ip, now); wait != 0 {
+		t.Fatalf("wait %v after a successful login", wait)
+	}
+	later := now.Add(loginFailureWindow + time.Second)
+	for i := 0; i < loginFreeAttempts; i++ {
+		g.Failed(ip, "admin", later)
+	}
+	if wait := g.Wait(ip, later); wait != 0 {
+		t.Fatalf("old failures still count: wait %v", wait)
+	}
+}
+
+func TestLoginGuardGlobalPause(t *testing.T) {
+	g := NewLoginGuard()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < loginGlobalFailures; i++ {
+		g.Failed(fmt.Sprintf("198.51.100.%d", i), "admin", now)
+	}
+	if wait := g.Wait("203.0.113.1", now); wait != loginGlobalPause {
+		t.Fatalf("new IP waits %v during the global pause", wait)
+	}
+	if _, until := g.Blocks(now); !until.Equal(now.Add(loginGlobalPause)) {
+		t.Fatalf("global pause until %v", until)
+	}
+	if wait := g.Wait("203.0.113.1", now.Add(loginGlobalPause)); wait != 0 {
+		t.Fatalf("wait %v after the global pause", wait)
+	}
+}
+
+func TestLoginBackoffResponse(t *testing.T) {
+	s := newTestState(t)
+	s.LoginGuard = NewLoginGuard()
+	r := gin.New()
+	r.POST("/api/auth/login", s.Login)
+	login := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(body)))
+		return w
+	}
+
+	// Unknown usernames count as failures like wrong passwords
+	for i := 0; i <= loginFreeAttempts; i++ {
+		if w := login(`{"username":"nobody","password":"password"}`); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: %d", i+1, w.Code)
+		}
+	}
+	w := login(`{"username":"admin","password":"password"}`)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("during backoff: %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestDummyPasswordHash(t *testing.T) {
+	// Unknown users are checked against the dummy hash, which must cost as much as real ones
+	cost, err := bcrypt.Cost(dummyPasswordHash)
+	if err != nil || cost != bcrypt.DefaultCost {
+		t.Fatalf("dummy hash cost %d: %v", cost, err)
+	}
+	if checkLoginPassword(nil, "password") {
+		t.Fatal("unknown user logged in")
+	}
+	if checkLoginPassword(&User{}, "") {
+		t.Fatal("user without password logged in")
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -28,13 +27,46 @@ func main() {
 		case "--check":
 			showDiagnostics()
 			return
+		case "export":
+			os.Exit(runExportCommand(args[1:]))
+		case "migrate":
+			os.Exit(runMigrateCommand(args[1:]))
+		case "backup":
+			os.Exit(runBackupCommand(args[1:]))
+		case "restore":
+			os.Exit(runRestoreCommand(args[1:]))
+		case "--reset-totp":
+			username := ""
+			if len(args) > 1 {
+				username = args[1]
+			}
+			user, found, err := ResetUserTOTP(username)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Failed to reset two-factor authentication: %v\n", err)
+				os.Exit(1)
+			}
+			if !found {
+				fmt.Printf("ℹ️  Two-factor authentication is not enabled for %s\n", user.Username)
+				return
+			}
+			fmt.Printf("✅ Two-factor authentication disabled for %s; log in with the password and enroll again\n", user.Username)
+			return
 		case "--reset-password":
-			password := ResetAdminPassword()
+			username := ""
+			if len(args) > 1 {
+				username = args[1]
+			}
+			user, password, err := ResetAdminPassword(username)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ Failed to reset password: %v\n", err)
+				os.Exit(1)
+			}
 			fmt.Println("\n╔════════════════════════════════════════════════════════════════╗")
 			fmt.Println("║                    🔑 PASSWORD RESET                           ║")
 			fmt.Println("╠════════════════════════════════════════════════════════════════╣")
-			fmt.Printf("║  New admin password: %-40s ║\n", password)
-			fmt.Printf("║  Config file: %-47s ║\n", GetConfigPath())
+			fmt.Printf("║  User: %-54s ║\n", user.Username)
+			fmt.Printf("║  New password: %-46s ║\n", password)
+			fmt.Printf("║  Database: %-50s ║\n", GetDBPath())
 			fmt.Println("╚════════════════════════════════════════════════════════════════╝")
 
 			// Try to signal running server to reload config
@@ -88,16 +120,6 @@ func main() {
 	dbWriter = NewDBWriter(db, 100)
 	defer dbWriter.Close()
 
-	// Initialize metrics buffer for batched real-time metrics writes
-	// Flush every 1 second or when buffer reaches 1000 items
-	metricsBuffer = NewMetricsBuffer(1*time.Second, 1000)
-	defer metricsBuffer.Close()
-
-	// Initialize aggregation buffer for batched writes (flush every 1 second)
-	aggBuffer = NewAggBuffer(1 * time.Second)
-	defer aggBuffer.Close()
-	fmt.Println("📊 Batch write buffers initialized (flush every 1s, supports 3000+ agents)")
-
 	// Initialize history cache with 10 second TTL
 	InitHistoryCache(10 * time.Second)
 
@@ -105,7 +127,11 @@ func main() {
 	fmt.Printf("⚙️  Config file: %s\n", GetConfigPath())
 
 	// Load config
-	config, initialPassword := LoadConfig()
+	config, initialPassword, err := LoadConfig(db)
+	if err != nil {
+		fmt.Printf("❌ Failed to load config: %v\n", err)
+		os.Exit(1)
+	}
 	if initialPassword != nil {
 		fmt.Println("\n╔════════════════════════════════════════════════════════════════╗")
 		fmt.Println("║              🎉 FIRST RUN - SAVE YOUR PASSWORD!               ║")
@@ -117,6 +143,25 @@ func main() {
 		fmt.Println("╚════════════════════════════════════════════════════════════════╝")
 	}
 
+	// Open metrics storage (SQLite shares the database above)
+	metricsStore, err = OpenStorage(config.Storage, db)
+	if err != nil {
+		fmt.Printf("Failed to open metrics storage: %v\n", err)
+		os.Exit(1)
+	}
+	defer metricsStore.Close()
+	fmt.Printf("🗄️  Metrics storage: %s\n", metricsStore.Driver())
+
+	// Initialize metrics buffer for batched real-time metrics writes
+	// Flush every 1 second or when buffer reaches 1000 items
+	metricsBuffer = NewMetricsBuffer(1*time.Second, 1000)
+	defer metricsBuffer.Close()
+
+	// Initialize aggregation buffer for batched writes (flush every 1 second)
+	aggBuffer = NewAggBuffer(1 * time.Second)
+	defer aggBuffer.Close()
+	fmt.Println("📊 Batch write buffers initialized (flush every 1s, supports 3000+ agents)")
+
 	// Create app state
 	state := &AppState{
 		Config:           config,
@@ -133,6 +178,22 @@ func main() {
 		DB:               db,
 	}
 
+	// Notifications are delivered by background workers; alert transitions are dispatched through them
+	state.Notifier = NewNotificationDispatcher(state.notificationSettings, 4)
+	state.Alerts = NewAlertEngine(db, state.Notifier)
+	state.Connectivity = NewConnectivityTracker(db)
+	state.Rollups = NewRollupTracker()
+	state.LoginGuard = NewLoginGuard()
+	state.WSTickets = NewWSTickets()
+
+	// History table selection follows the configured retention
+	SetActiveRetention(config.Retention)
+
+	// Maintenance windows suppress alerts and mark downtime as planned
+	if err := state.reloadMaintenance(); err != nil {
+		fmt.Printf("⚠️  Failed to load maintenance windows: %v\n", err)
+	}
+
 	// Initialize local metrics collector with ping targets
 	localCollector := GetLocalCollector()
 	if len(config.ProbeSettings.PingTargets) > 0 {
@@ -147,7 +208,10 @@ func main() {
 	go snapshotRefreshLoop(state)  // Refresh dashboard snapshot every 5 seconds
 	go metricsBroadcastLoop(state) // Broadcast delta updates to connected dashboards
 	// NOTE: aggregation15MinLoop and aggregationLoop removed - aggregation now done on agent side
-	go cleanupLoop(db)
+	go rollupLoop(state) // Builds aggregates for servers that only send raw metrics
+	go cleanupLoop(state)
+	go availabilityLoop(state)
+	go backupLoop(state)
 
 	// Setup routes
 	gin.SetMode(gin.ReleaseMode)
@@ -175,13 +239,37 @@ func main() {
 
 	// Public routes
 	r.GET("/health", HealthCheck)
+	r.GET("/metrics", state.PrometheusMetrics) // Prometheus exporter (disabled unless configured)
+	// Prometheus-compatible query API over stored history (same switch and token as the exporter)
+	r.GET("/api/v1/query", state.PromQuery)
+	r.POST("/api/v1/query", state.PromQuery)
+	r.GET("/api/v1/query_range", state.PromQueryRange)
+	r.POST("/api/v1/query_range", state.PromQueryRange)
+	r.GET("/api/v1/series", state.PromSeries)
+	r.POST("/api/v1/series", state.PromSeries)
+	r.GET("/api/v1/labels", state.PromLabels)
+	r.POST("/api/v1/labels", state.PromLabels)
+	r.GET("/api/v1/label/:name/values", state.PromLabelValues)
 	r.GET("/api/metrics", state.GetMetrics)
 	r.GET("/api/metrics/all", state.GetAllMetrics)
 	r.GET("/api/online-users", state.GetOnlineUsers)
-	r.GET("/api/history/:server_id", func(c *gin.Context) {
-		state.GetHistory(c, db)
-	})
+	r.GET("/api/history/:server_id", state.GetHistory)
 	r.GET("/api/servers", state.GetServers)
+	r.GET("/api/servers/:id/events", func(c *gin.Context) {
+		state.GetServerEvents(c, db)
+	})
+	r.GET("/api/servers/:id/downtime", func(c *gin.Context) {
+		state.GetServerDowntime(c, db)
+	})
+	r.GET("/api/servers/:id/availability", func(c *gin.Context) {
+		state.GetServerAvailability(c, db)
+	})
+	r.GET("/api/servers/:id/availability/monthly", func(c *gin.Context) {
+		state.GetServerMonthlyAvailability(c, db)
+	})
+	r.GET("/api/dimensions/:id/availability", func(c *gin.Context) {
+		state.GetDimensionAvailability(c, db)
+	})
 	r.GET("/api/groups", state.GetGroups)
 	r.GET("/api/dimensions", state.GetDimensions) // Public: get all dimensions for grouping
 	r.GET("/api/settings/site", state.GetSiteSettings)
@@ -190,7 +278,7 @@ func main() {
 	r.GET("/api/wallpaper/proxy", GetCustomWallpaper)
 	r.GET("/api/wallpaper/proxy/image", GetCustomWallpaperImage)
 	r.POST("/api/auth/login", state.Login)
-	r.GET("/api/auth/verify", AuthMiddleware(), state.VerifyToken)
+	r.GET("/api/auth/verify", state.AuthMiddleware(RoleViewer), state.VerifyToken)
 
 	// OAuth 2.0 routes (public)
 	r.GET("/api/auth/oauth/providers", state.GetOAuthProviders)
@@ -198,8 +286,10 @@ func main() {
 	r.GET("/api/auth/oauth/github/callback", state.GitHubOAuthCallback)
 	r.GET("/api/auth/oauth/google", state.GoogleOAuthStart)
 	r.GET("/api/auth/oauth/google/callback", state.GoogleOAuthCallback)
+	r.GET("/api/auth/oauth/oidc", state.OIDCOAuthStart)
+	r.GET("/api/auth/oauth/oidc/callback", state.OIDCOAuthCallback)
 	r.GET("/api/auth/oauth/proxy/callback", state.ProxyOAuthCallback) // Centralized OAuth callback
-	r.GET("/api/install-command", AuthMiddleware(), state.GetInstallCommand)
+	r.GET("/api/install-command", state.AuthMiddleware(RoleOperator), state.GetInstallCommand)
 	r.GET("/api/version", GetServerVersion)
 	r.GET("/version", GetServerVersion)
 	r.GET("/api/version/check", CheckLatestVersion)
@@ -208,39 +298,131 @@ func main() {
 	r.GET("/agent-upgrade.ps1", state.GetAgentUpgradePowerShellScript)
 	r.GET("/agent-uninstall.ps1", state.GetAgentUninstallPowerShellScript)
 	r.GET("/ws", state.HandleDashboardWS)
+	r.GET("/api/share/:token", state.GetShare)
+	r.POST("/api/share/:token/unlock", state.UnlockShare)
+	r.GET("/api/share/:token/history/:server_id", state.GetShareHistory)
+	r.GET("/api/share/:token/ws", state.HandleShareWS)
+	// Public status page and its feeds
+	r.GET("/api/status", state.GetStatusPage)
+	r.GET("/api/status/feed.json", state.GetStatusFeedJSON)
+	r.GET("/api/status/feed.rss", state.GetStatusFeedRSS)
+	r.GET("/api/status/feed.atom", state.GetStatusFeedAtom)
+	// Embeddable SVG badges: status, uptime, cpu and latency
+	r.GET("/badge/:server_id/:badge", state.GetBadge)
 	r.GET("/ws/agent", state.HandleAgentWS)
 
-	// Protected routes
+	// Protected routes, by the least role they require
 	protected := r.Group("/")
-	protected.Use(AuthMiddleware())
+	protected.Use(state.AuthMiddleware(RoleViewer))
 	{
-		protected.POST("/api/servers", state.AddServer)
-		protected.DELETE("/api/servers/:id", state.DeleteServer)
-		protected.PUT("/api/servers/:id", state.UpdateServer)
-		protected.POST("/api/servers/:id/update", state.UpdateAgent)
 		protected.POST("/api/auth/password", state.ChangePassword)
-		protected.POST("/api/agent/register", state.RegisterAgent)
-		protected.PUT("/api/settings/site", state.UpdateSiteSettings)
+		protected.GET("/api/auth/totp", state.GetTOTPStatus)
+		protected.POST("/api/auth/totp/enroll", state.EnrollTOTP)
+		protected.POST("/api/auth/totp/enable", state.EnableTOTP)
+		protected.POST("/api/auth/totp/disable", state.DisableTOTP)
+		protected.POST("/api/auth/totp/recovery-codes", state.RegenerateRecoveryCodes)
+		// API tokens of the current user (login sessions only, see apiTokenRoutes)
+		protected.GET("/api/tokens", state.ListAPITokens)
+		protected.POST("/api/tokens", state.CreateAPIToken)
+		protected.DELETE("/api/tokens/:id", state.DeleteAPIToken)
+		// Login sessions of the current user
+		protected.GET("/api/sessions", state.ListSessions)
+		protected.DELETE("/api/sessions", state.RevokeAllSessions)
+		protected.DELETE("/api/sessions/:id", state.RevokeSession)
+		protected.POST("/api/auth/ws-ticket", state.CreateWSTicket)
 		protected.GET("/api/settings/local-node", state.GetLocalNodeConfig)
-		protected.PUT("/api/settings/local-node", state.UpdateLocalNodeConfig)
 		protected.GET("/api/settings/probe", state.GetProbeSettings)
-		protected.PUT("/api/settings/probe", state.UpdateProbeSettings)
-		protected.POST("/api/server/upgrade", UpgradeServer)
-		// OAuth settings (admin only)
-		protected.GET("/api/settings/oauth", state.GetOAuthSettings)
-		protected.PUT("/api/settings/oauth", state.UpdateOAuthSettings)
+		// Alert status
+		protected.GET("/api/alerts/rules", state.ListAlertRules)
+		protected.GET("/api/alerts/rules/:id", state.GetAlertRule)
+		protected.GET("/api/alerts/active", state.GetActiveAlerts)
+		protected.GET("/api/alerts/history", func(c *gin.Context) {
+			state.GetAlertHistory(c, db)
+		})
+		protected.GET("/api/settings/retention", state.GetRetentionSettings)
+		// History export (CSV / JSON Lines)
+		protected.GET("/api/history/:server_id/export", state.ExportServerHistory)
+		// Status page incidents and maintenance
+		protected.GET("/api/status/incidents", state.ListIncidents)
+		protected.GET("/api/status/maintenance", state.ListMaintenanceWindows)
+	}
+
+	operator := r.Group("/")
+	operator.Use(state.AuthMiddleware(RoleOperator))
+	{
+		operator.POST("/api/servers", state.AddServer)
+		operator.DELETE("/api/servers/:id", state.DeleteServer)
+		operator.PUT("/api/servers/:id", state.UpdateServer)
+		operator.POST("/api/servers/:id/update", state.UpdateAgent)
+		operator.POST("/api/agent/register", state.RegisterAgent)
+		operator.PUT("/api/settings/local-node", state.UpdateLocalNodeConfig)
+		operator.PUT("/api/settings/probe", state.UpdateProbeSettings)
 		// Group management (GET is public, mutations are protected)
-		protected.POST("/api/groups", state.AddGroup)
-		protected.PUT("/api/groups/:id", state.UpdateGroup)
-		protected.DELETE("/api/groups/:id", state.DeleteGroup)
+		operator.POST("/api/groups", state.AddGroup)
+		operator.PUT("/api/groups/:id", state.UpdateGroup)
+		operator.DELETE("/api/groups/:id", state.DeleteGroup)
 		// Dimension management (GET is public, mutations are protected)
-		protected.POST("/api/dimensions", state.AddDimension)
-		protected.PUT("/api/dimensions/:id", state.UpdateDimension)
-		protected.DELETE("/api/dimensions/:id", state.DeleteDimension)
+		operator.POST("/api/dimensions", state.AddDimension)
+		operator.PUT("/api/dimensions/:id", state.UpdateDimension)
+		operator.DELETE("/api/dimensions/:id", state.DeleteDimension)
 		// Dimension options management
-		protected.POST("/api/dimensions/:id/options", state.AddOption)
-		protected.PUT("/api/dimensions/:id/options/:option_id", state.UpdateOption)
-		protected.DELETE("/api/dimensions/:id/options/:option_id", state.DeleteOption)
+		operator.POST("/api/dimensions/:id/options", state.AddOption)
+		operator.PUT("/api/dimensions/:id/options/:option_id", state.UpdateOption)
+		operator.DELETE("/api/dimensions/:id/options/:option_id", state.DeleteOption)
+		// Alert rules
+		operator.POST("/api/alerts/rules", state.AddAlertRule)
+		operator.PUT("/api/alerts/rules/:id", state.UpdateAlertRule)
+		operator.DELETE("/api/alerts/rules/:id", state.DeleteAlertRule)
+		operator.POST("/api/notifications/test", state.TestNotification)
+		// Status page incidents and maintenance
+		operator.POST("/api/status/incidents", state.CreateIncident)
+		operator.PUT("/api/status/incidents/:id", state.UpdateIncident)
+		operator.DELETE("/api/status/incidents/:id", state.DeleteIncident)
+		operator.POST("/api/status/incidents/:id/updates", state.AddIncidentUpdate)
+		operator.POST("/api/status/maintenance", state.CreateMaintenanceWindow)
+		operator.PUT("/api/status/maintenance/:id", state.UpdateMaintenanceWindow)
+		operator.DELETE("/api/status/maintenance/:id", state.DeleteMaintenanceWindow)
+	}
+
+	admin := r.Group("/")
+	admin.Use(state.AuthMiddleware(RoleAdmin))
+	{
+		// Users and roles
+		admin.GET("/api/users", state.ListUsers)
+		admin.POST("/api/users", state.CreateUser)
+		admin.PUT("/api/users/:id", state.UpdateUser)
+		admin.DELETE("/api/users/:id", state.DeleteUser)
+		admin.DELETE("/api/users/:id/totp", state.ResetUserTOTP)
+		admin.PUT("/api/settings/site", state.UpdateSiteSettings)
+		admin.GET("/api/settings/visibility", state.GetVisibilitySettings)
+		admin.PUT("/api/settings/visibility", state.UpdateVisibilitySettings)
+		admin.GET("/api/shares", state.ListShareLinks)
+		admin.POST("/api/shares", state.CreateShareLink)
+		admin.DELETE("/api/shares/:id", state.DeleteShareLink)
+		admin.GET("/api/settings/status-page", state.GetStatusPageSettings)
+		admin.PUT("/api/settings/status-page", state.UpdateStatusPageSettings)
+		admin.POST("/api/server/upgrade", state.UpgradeServer)
+		// OAuth settings
+		admin.GET("/api/settings/oauth", state.GetOAuthSettings)
+		admin.PUT("/api/settings/oauth", state.UpdateOAuthSettings)
+		// Notification channels
+		admin.GET("/api/settings/notifications", state.GetNotificationSettings)
+		admin.PUT("/api/settings/notifications", state.UpdateNotificationSettings)
+		// Prometheus exporter
+		admin.GET("/api/settings/prometheus", state.GetPrometheusSettings)
+		admin.PUT("/api/settings/prometheus", state.UpdatePrometheusSettings)
+		// Retention policies
+		admin.PUT("/api/settings/retention", state.UpdateRetentionSettings)
+		admin.POST("/api/settings/retention/dry-run", func(c *gin.Context) {
+			state.RetentionDryRun(c, db)
+		})
+		// Backups
+		admin.GET("/api/admin/backup", state.DownloadBackup)
+		admin.GET("/api/audit", state.GetAuditLog)
+		admin.GET("/api/admin/login-blocks", state.ListLoginBlocks)
+		admin.DELETE("/api/admin/login-blocks/:ip", state.UnblockLogin)
+		admin.GET("/api/settings/backup", state.GetBackupSettings)
+		admin.PUT("/api/settings/backup", state.UpdateBackupSettings)
 	}
 
 	// Static file serving
@@ -316,17 +498,17 @@ func showDiagnostics() {
 	fmt.Printf("║  Database: %-50s ║\n", dbPath)
 	fmt.Printf("║  Database exists: %-43s ║\n", boolToStr(fileExists(dbPath)))
 
-	if fileExists(configPath) {
-		data, err := os.ReadFile(configPath)
+	if fileExists(dbPath) {
+		db, err := sql.Open("sqlite", dbPath+"?_busy_timeout=5000")
 		if err == nil {
-			var config map[string]interface{}
-			if json.Unmarshal(data, &config) == nil {
-				hash, _ := config["admin_password_hash"].(string)
-				hasHash := hash != "" && (hash[:3] == "$2a" || hash[:3] == "$2b")
-				fmt.Printf("║  Password hash valid: %-39s ║\n", boolToStr(hasHash))
-
-				servers, _ := config["servers"].([]interface{})
-				fmt.Printf("║  Servers configured: %-40d ║\n", len(servers))
+			defer db.Close()
+			var users, admins int
+			if db.QueryRow(`SELECT COUNT(*), COUNT(CASE WHEN role = ? THEN 1 END) FROM users`, RoleAdmin).Scan(&users, &admins) == nil {
+				fmt.Printf("║  Users: %-53s ║\n", fmt.Sprintf("%d (%d admin)", users, admins))
+			}
+			var servers int
+			if db.QueryRow(`SELECT COUNT(*) FROM servers`).Scan(&servers) == nil {
+				fmt.Printf("║  Servers configured: %-40d ║\n", servers)
 			}
 		}
 	}
@@ -364,6 +546,14 @@ func metricsBroadcastLoop(state *AppState) {
 
 		// Collect local metrics
 		localMetrics := CollectMetrics()
+		StoreMetricsWithDedup("local", &localMetrics)
+
+		// Evaluate alert rules against the latest metrics
+		now := time.Now().UTC()
+		state.Alerts.Evaluate(buildAlertTargets(config, agentMetrics, &localMetrics, now), now)
+
+		// Record online/offline transitions
+		state.Connectivity.Check(config.Servers, agentMetrics, time.Now())
 
 		// Build compact delta updates
 		var deltaUpdates []CompactServerUpdate
@@ -405,10 +595,7 @@ func metricsBroadcastLoop(state *AppState) {
 		// Check remote servers
 		for _, server := range config.Servers {
 			metricsData := agentMetrics[server.ID]
-			online := false
-			if metricsData != nil {
-				online = time.Since(metricsData.LastUpdated).Seconds() < 30
-			}
+			online := isAgentOnline(&server, metricsData, time.Now())
 
 			currentMetrics := &CompactMetrics{}
 			if metricsData != nil {
@@ -468,16 +655,15 @@ func metricsBroadcastLoop(state *AppState) {
 				D:    deltaUpdates,
 			}
 
-			if data, err := json.Marshal(msg); err == nil {
-				state.BroadcastMetrics(string(data))
-			}
+			state.BroadcastDelta(msg, config.serverHidden)
 		}
 	}
 }
 
 // NOTE: aggregation15MinLoop and aggregationLoop removed
 // Aggregation is now performed on the agent side and sent to server
-// This reduces server CPU load and allows agents to maintain their own historical data
+// This reduces server CPU load and allows agents to maintain their own historical data.
+// rollupLoop (rollup.go) only covers servers that send raw metrics.
 
 // snapshotRefreshLoop periodically refreshes the dashboard snapshot
 func snapshotRefreshLoop(state *AppState) {
@@ -492,17 +678,47 @@ func snapshotRefreshLoop(state *AppState) {
 	}
 }
 
-func cleanupLoop(db *sql.DB) {
+func cleanupLoop(state *AppState) {
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		if err := CleanupOldData(db); err != nil {
+		state.ConfigMu.RLock()
+		settings := state.Config.Retention
+		servers := append([]RemoteServer(nil), state.Config.Servers...)
+		state.ConfigMu.RUnlock()
+
+		if err := CleanupOldData(state.DB, metricsStore, settings, servers); err != nil {
 			fmt.Printf("Failed to cleanup old data: %v\n", err)
 		}
 	}
 }
 
+// availabilityLoop fills metrics_daily.uptime_percent for the last days once per hour.
+// Recent days are recomputed because late agent data can still change their coverage.
+func availabilityLoop(state *AppState) {
+	time.Sleep(1 * time.Minute) // Let agents reconnect first
+
+	ticker := time.NewTicker(1 * time.Hour)
+	defer ticker.Stop()
+
+	for {
+		state.ConfigMu.RLock()
+		servers := append([]RemoteServer(nil), state.Config.Servers...)
+		state.ConfigMu.RUnlock()
+
+		today := time.Now().UTC()
+		for i := 1; i <= 3; i++ {
+			if err := FillDailyUptime(state.DB, metricsStore, servers, today.AddDate(0, 0, -i)); err != nil {
+				fmt.Printf("Failed to fill daily uptime: %v\n", err)
+				break
+			}
+		}
+
+		<-ticker.C
+	}
+}
+
 func boolPtr(b bool) *bool {
 	return &b
 }
@@ -3,12 +3,16 @@ package main
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware authenticates the bearer token, a session JWT or an API token, and requires the
+// user to have at least the given role. The user is loaded on every request, so role changes and
+// deleted accounts take effect immediately.
+func (s *AppState) AuthMiddleware(role Role) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -22,16 +26,174 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		var user *User
+		if strings.HasPrefix(tokenString, APITokenPrefix) {
+			user = s.authenticateAPIToken(c, tokenString)
+		} else {
+			user = s.authenticateSession(c, tokenString)
+		}
+		if user == nil {
+			return
+		}
+		if !user.Role.Allows(role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+
+		c.Set(contextUserKey, user)
+		c.Next()
+	}
+}
+
+// authenticateSession checks a session JWT and that its session was not revoked; it aborts the request and returns nil if it is invalid
+func (s *AppState) authenticateSession(c *gin.Context, tokenString string) *User {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(GetJWTSecret()), nil
+	})
+
+	if err != nil || !token.Valid {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return nil
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	sessionID, _ := claims["jti"].(string)
+	session, err := getSession(s.DB, sessionID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load session"})
+		return nil
+	}
+	sub, _ := token.Claims.GetSubject()
+	if session == nil || session.UserID != sub {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session expired or revoked"})
+		return nil
+	}
+
+	user := s.loadAuthenticatedUser(c, sub)
+	if user != nil {
+		touchSession(session, time.Now())
+		c.Set(contextSessionKey, session.ID)
+	}
+	return user
+}
+
+// authenticateAPIToken checks an API token and whether its scopes cover the route; it aborts
+// the request and returns nil if not
+func (s *AppState) authenticateAPIToken(c *gin.Context, secret string) *User {
+	token, err := getAPITokenBySecret(s.DB, secret)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load token"})
+		return nil
+	}
+	now := time.Now()
+	if token == nil || token.Expired(now) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return nil
+	}
+
+	scope, ok := apiTokenRoutes[c.Request.Method+" "+c.FullPath()]
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API tokens cannot access this endpoint"})
+		return nil
+	}
+	if !token.HasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token is missing scope " + string(scope)})
+		return nil
+	}
+
+	user := s.loadAuthenticatedUser(c, token.UserID)
+	if user != nil {
+		touchAPIToken(token, now)
+		c.Set(contextAPITokenKey, token.ID)
+	}
+	return user
+}
+
+// optionalUser returns the user a public route is called by, or nil for anonymous requests and
+// invalid tokens; unlike AuthMiddleware it never rejects the request. API tokens only count when
+// they have one of scopes. For <img> tags, which cannot set headers, API tokens may also be
+// passed as ?token=; session JWTs may not, as URLs end up in access logs (the dashboard
+// WebSocket uses tickets, see WSTickets).
+func (s *AppState) optionalUser(c *gin.Context, scopes ...Scope) *User {
+	user, _ := s.optionalCaller(c, scopes...)
+	return user
+}
+
+// optionalCaller is optionalUser that also returns the API token of the request, or nil when
+// the user is logged in with a session
+func (s *AppState) optionalCaller(c *gin.Context, scopes ...Scope) (*User, *APIToken) {
+	tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if query := c.Query("token"); tokenString == "" && strings.HasPrefix(query, APITokenPrefix) {
+		tokenString = query
+	}
+	if tokenString == "" {
+		return nil, nil
+	}
+
+	var userID string
+	var apiToken *APIToken
+	if strings.HasPrefix(tokenString, APITokenPrefix) {
+		token, err := getAPITokenBySecret(s.DB, tokenString)
+		if err != nil || token == nil || token.Expired(time.Now()) || !token.HasAnyScope(scopes...) {
+			return nil, nil
+		}
+		userID, apiToken = token.UserID, token
+	} else {
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			return []byte(GetJWTSecret()), nil
 		})
-
 		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-			return
+			return nil, nil
 		}
+		claims, _ := token.Claims.(jwt.MapClaims)
+		sessionID, _ := claims["jti"].(string)
+		userID, _ = token.Claims.GetSubject()
+		session, err := getSession(s.DB, sessionID)
+		if err != nil || session == nil || session.UserID != userID {
+			return nil, nil
+		}
+	}
 
-		c.Next()
+	user, err := getUserByID(s.DB, userID)
+	if err != nil || user == nil {
+		return nil, nil
 	}
+	return user, apiToken
 }
 
+func (s *AppState) loadAuthenticatedUser(c *gin.Context, id string) *User {
+	user, err := getUserByID(s.DB, id)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+		return nil
+	}
+	if user == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return nil
+	}
+	return user
+}
+
+const (
+	contextUserKey     = "user"
+	contextSessionKey  = "session_id"
+	contextAPITokenKey = "api_token_id"
+)
+
+// currentUser returns the user authenticated by AuthMiddleware
+func currentUser(c *gin.Context) *User {
+	if v, ok := c.Get(contextUserKey); ok {
+		return v.(*User)
+	}
+	return nil
+}
+
+// currentSessionID returns the login session of the request; it is empty for API tokens
+func currentSessionID(c *gin.Context) string {
+	return c.GetString(contextSessionKey)
+}
+
+// currentAPITokenID returns the API token of the request; it is empty for login sessions
+func currentAPITokenID(c *gin.Context) string {
+	return c.GetString(contextAPITokenKey)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Schema Migrations
+// ============================================================================
+//
+// The SQLite schema is built by the numbered files in migrations/ (NNNN_name.sql),
+// applied in order, each in its own transaction, and recorded in schema_migrations.
+// Migrations are never edited once released; schema changes go into a new file.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one embedded schema change
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// MigrationState is a migration and when it was applied, if it was
+type MigrationState struct {
+	Migration
+	AppliedAt string
+}
+
+// loadMigrations returns the embedded migrations ordered by version
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".sql")
+		prefix, label, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration file name %q", e.Name())
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %q and %q share version %d", other, e.Name(), version)
+		}
+		seen[version] = e.Name()
+
+		data, err := migrationFiles.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: label, SQL: string(data)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// LatestSchemaVersion is the schema version this binary migrates to
+func LatestSchemaVersion() int {
+	migrations, err := loadMigrations()
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+func tableExists(db *sql.DB, table string) bool {
+	var name string
+	err := db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&name)
+	return err == nil
+}
+
+func columnExists(db *sql.DB, table, column string) bool {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n)
+	return err == nil && n > 0
+}
+
+// appliedMigrations returns the applied versions and when they were applied
+func appliedMigrations(db *sql.DB) (map[int]string, error) {
+	applied := make(map[int]string)
+	if !tableExists(db, "schema_migrations") {
+		return applied, nil
+	}
+	rows, err := db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var appliedAt string
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatus lists every known migration plus applied versions this binary does not know
+func MigrationStatus(db *sql.DB) ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		states = append(states, MigrationState{Migration: m, AppliedAt: applied[m.Version]})
+		delete(applied, m.Version)
+	}
+	for version, appliedAt := range applied {
+		states = append(states, MigrationState{Migration: Migration{Version: version, Name: "(unknown)"}, AppliedAt: appliedAt})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// checkSchemaVersion refuses databases written by a newer server
+func checkSchemaVersion(applied map[int]string, latest int) error {
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("database schema version %d is newer than this server supports (%d); upgrade vstats-server", version, latest)
+		}
+	}
+	return nil
+}
+
+// Migrate applies all pending migrations and returns how many were applied
+func Migrate(db *sql.DB) (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+
+	// Databases created before versioned migrations get their columns fixed up first
+	if !tableExists(db, "schema_migrations") && tableExists(db, "metrics_raw") {
+		if err := upgradeLegacySchema(db); err != nil {
+			return 0, fmt.Errorf("legacy schema upgrade: %w", err)
+		}
+	}
+
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)`); err != nil {
+		return 0, err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) > 0 {
+		if err := checkSchemaVersion(applied, migrations[len(migrations)-1].Version); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return count, fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		fmt.Printf("🔧 Applied migration %04d_%s\n", m.Version, m.Name)
+		count++
+	}
+	return count, nil
+}
+
+func applyMigration(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		m.Version, m.Name, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// upgradeLegacySchema adds the columns that older servers added with unconditional ALTER TABLEs,
+// so the CREATE ... IF NOT EXISTS migrations apply cleanly on top of an existing database
+func upgradeLegacySchema(db *sql.DB) error {
+	columns := []struct{ table, column, def string }{
+		{"metrics_raw", "ping_ms", "REAL"},
+		{"metrics_hourly", "ping_avg", "REAL"},
+		{"metrics_daily", "ping_avg", "REAL"},
+		{"metrics_raw", "bucket_5min", "INTEGER"},
+		{"ping_raw", "bucket_5min", "INTEGER"},
+		{"metrics_raw", "bucket_5sec", "INTEGER"},
+		{"ping_raw", "bucket_5sec", "INTEGER"},
+		{"alert_rules", "channels", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, c := range columns {
+		if !tableExists(db, c.table) || columnExists(db, c.table, c.column) {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE " + c.table + " ADD COLUMN " + c.column + " " + c.def); err != nil {
+			return err
+		}
+	}
+
+	// Backfill buckets of rows written before the bucket columns existed
+	// (bucket_5min once held unix seconds, hence the upper bound)
+	backfills := []struct{ table, column, where, divisor string }{
+		{"metrics_raw", "bucket_5min", "bucket_5min IS NULL OR bucket_5min > 100000000", "120"},
+		{"ping_raw", "bucket_5min", "bucket_5min IS NULL OR bucket_5min > 100000000", "120"},
+		{"metrics_raw", "bucket_5sec", "bucket_5sec IS NULL", "5"},
+		{"ping_raw", "bucket_5sec", "bucket_5sec IS NULL", "5"},
+	}
+	for _, b := range backfills {
+		if !tableExists(db, b.table) {
+			continue
+		}
+		var needsBackfill int
+		db.QueryRow("SELECT 1 FROM " + b.table + " WHERE " + b.where + " LIMIT 1").Scan(&needsBackfill)
+		if needsBackfill != 1 {
+			continue
+		}
+		fmt.Printf("⏳ Backfilling %s for %s (one-time migration)...\n", b.column, b.table)
+		if _, err := db.Exec("UPDATE " + b.table + " SET " + b.column + " = CAST(strftime('%s', timestamp) AS INTEGER) / " + b.divisor + " WHERE " + b.where); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ============================================================================
+// Migrate Command
+// ============================================================================
+
+// runMigrateCommand implements `vstats-server migrate status|up`
+func runMigrateCommand(args []string) int {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		fmt.Fprintln(os.Stderr, "Usage: vstats-server migrate status|up")
+		return 2
+	}
+
+	dbPath := GetDBPath()
+	if args[0] == "status" && !fileExists(dbPath) {
+		fmt.Fprintf(os.Stderr, "❌ Database not found: %s\n", dbPath)
+		return 1
+	}
+	db, err := sql.Open("sqlite", dbPath+"?_busy_timeout=5000")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to open database: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	if args[0] == "up" {
+		count, err := Migrate(db)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		fmt.Printf("✅ Database %s is at schema version %d (%d migration(s) applied)\n", dbPath, LatestSchemaVersion(), count)
+		return 0
+	}
+
+	states, err := MigrationStatus(db)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("Database: %s\n", dbPath)
+	pending := 0
+	for _, s := range states {
+		status := "applied " + s.AppliedAt
+		if s.AppliedAt == "" {
+			status = "pending"
+			pending++
+		}
+		fmt.Printf("  %04d  %-24s %s\n", s.Version, s.Name, status)
+	}
+	if pending > 0 {
+		fmt.Printf("%d pending migration(s); run `vstats-server migrate up` or start the server to apply them\n", pending)
+	}
+	if applied, err := appliedMigrations(db); err == nil {
+		if err := checkSchemaVersion(applied, LatestSchemaVersion()); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+	}
+	return 0
+}
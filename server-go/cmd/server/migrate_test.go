@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrateFreshDatabase(t *testing.T) {
+	db := openTestDB(t)
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := Migrate(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", count, len(migrations))
+	}
+	if count, err := Migrate(db); err != nil || count != 0 {
+		t.Fatalf("second run applied %d migrations: %v", count, err)
+	}
+
+	states, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if s.AppliedAt == "" {
+			t.Errorf("migration %04d_%s is pending", s.Version, s.Name)
+		}
+	}
+	if last := states[len(states)-1].Version; last != LatestSchemaVersion() {
+		t.Errorf("latest applied version %d, want %d", last, LatestSchemaVersion())
+	}
+}
+
+func TestMigrateRefusesNewerDatabase(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'future', '2099-01-01T00:00:00Z')`,
+		LatestSchemaVersion()+1); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Migrate(db)
+	if err == nil || !strings.Contains(err.Error(), "newer than this server supports") {
+		t.Fatalf("migrate error: %v", err)
+	}
+	states, err := MigrationStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := states[len(states)-1]; last.Version != LatestSchemaVersion()+1 || last.Name != "(unknown)" {
+		t.Fatalf("unknown migration not listed: %+v", last)
+	}
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	db := openTestDB(t)
+	// metrics_raw as created by servers before ping and bucket columns existed
+	if _, err := db.Exec(`
+		CREATE TABLE metrics_raw (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			server_id TEXT NOT NULL,
+			timestamp TEXT NOT NULL,
+			cpu_usage REAL NOT NULL,
+			memory_usage REAL NOT NULL,
+			disk_usage REAL NOT NULL,
+			net_rx INTEGER NOT NULL,
+			net_tx INTEGER NOT NULL,
+			load_1 REAL NOT NULL,
+			load_5 REAL NOT NULL,
+			load_15 REAL NOT NULL,
+			created_at TEXT DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO metrics_raw (server_id, timestamp, cpu_usage, memory_usage, disk_usage, net_rx, net_tx, load_1, load_5, load_15)
+		VALUES ('a', '2024-01-01T00:02:05Z', 1, 1, 1, 0, 0, 0, 0, 0);`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range []string{"ping_ms", "bucket_5min", "bucket_5sec"} {
+		if !columnExists(db, "metrics_raw", column) {
+			t.Errorf("metrics_raw.%s was not added", column)
+		}
+	}
+	var bucket2min, bucket5sec int64
+	if err := db.QueryRow(`SELECT bucket_5min, bucket_5sec FROM metrics_raw`).Scan(&bucket2min, &bucket5sec); err != nil {
+		t.Fatal(err)
+	}
+	if ts := int64(1704067325); bucket2min != ts/120 || bucket5sec != ts/5 {
+		t.Fatalf("buckets were not backfilled: %d, %d", bucket2min, bucket5sec)
+	}
+}
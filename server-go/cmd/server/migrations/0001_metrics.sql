@@ -0,0 +1,157 @@
+-- Raw samples and the original pre-aggregated history tables
+
+-- Raw metrics (kept for the "raw" retention)
+CREATE TABLE IF NOT EXISTS metrics_raw (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	cpu_usage REAL NOT NULL,
+	memory_usage REAL NOT NULL,
+	disk_usage REAL NOT NULL,
+	net_rx INTEGER NOT NULL,
+	net_tx INTEGER NOT NULL,
+	load_1 REAL NOT NULL,
+	load_5 REAL NOT NULL,
+	load_15 REAL NOT NULL,
+	ping_ms REAL,
+	created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+	bucket_5min INTEGER, -- actually 2-minute buckets, for 720 points over 24h
+	bucket_5sec INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_time ON metrics_raw(server_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket ON metrics_raw(server_id, bucket_5min);
+CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket_5sec ON metrics_raw(server_id, bucket_5sec);
+
+-- Legacy 15-minute aggregated metrics
+CREATE TABLE IF NOT EXISTS metrics_15min (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	bucket_start TEXT NOT NULL,
+	cpu_avg REAL NOT NULL,
+	cpu_max REAL NOT NULL,
+	memory_avg REAL NOT NULL,
+	memory_max REAL NOT NULL,
+	disk_avg REAL NOT NULL,
+	net_rx_total INTEGER NOT NULL,
+	net_tx_total INTEGER NOT NULL,
+	ping_avg REAL,
+	sample_count INTEGER NOT NULL,
+	UNIQUE(server_id, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_metrics_15min_server_time ON metrics_15min(server_id, bucket_start);
+
+-- Legacy hourly aggregated metrics
+CREATE TABLE IF NOT EXISTS metrics_hourly (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	hour_start TEXT NOT NULL,
+	cpu_avg REAL NOT NULL,
+	cpu_max REAL NOT NULL,
+	memory_avg REAL NOT NULL,
+	memory_max REAL NOT NULL,
+	disk_avg REAL NOT NULL,
+	net_rx_total INTEGER NOT NULL,
+	net_tx_total INTEGER NOT NULL,
+	ping_avg REAL,
+	sample_count INTEGER NOT NULL,
+	UNIQUE(server_id, hour_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_metrics_hourly_server_time ON metrics_hourly(server_id, hour_start);
+
+-- Daily summaries with uptime (kept forever)
+CREATE TABLE IF NOT EXISTS metrics_daily (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	date TEXT NOT NULL,
+	cpu_avg REAL NOT NULL,
+	cpu_max REAL NOT NULL,
+	memory_avg REAL NOT NULL,
+	memory_max REAL NOT NULL,
+	disk_avg REAL NOT NULL,
+	net_rx_total INTEGER NOT NULL,
+	net_tx_total INTEGER NOT NULL,
+	uptime_percent REAL NOT NULL,
+	ping_avg REAL,
+	sample_count INTEGER NOT NULL,
+	UNIQUE(server_id, date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_metrics_daily_server_time ON metrics_daily(server_id, date);
+
+-- Raw ping results per target
+CREATE TABLE IF NOT EXISTS ping_raw (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_ms REAL,
+	packet_loss REAL NOT NULL DEFAULT 0,
+	status TEXT NOT NULL DEFAULT 'ok',
+	bucket_5min INTEGER,
+	bucket_5sec INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_ping_raw_server_time ON ping_raw(server_id, timestamp);
+CREATE INDEX IF NOT EXISTS idx_ping_raw_target ON ping_raw(server_id, target_name, timestamp);
+CREATE INDEX IF NOT EXISTS idx_ping_raw_server_bucket ON ping_raw(server_id, bucket_5min);
+CREATE INDEX IF NOT EXISTS idx_ping_raw_server_bucket_5sec ON ping_raw(server_id, bucket_5sec);
+
+-- Legacy 15-minute aggregated ping metrics
+CREATE TABLE IF NOT EXISTS ping_15min (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	bucket_start TEXT NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_avg REAL,
+	latency_max REAL,
+	packet_loss_avg REAL NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL,
+	UNIQUE(server_id, target_name, bucket_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ping_15min_server_time ON ping_15min(server_id, bucket_start);
+CREATE INDEX IF NOT EXISTS idx_ping_15min_target ON ping_15min(server_id, target_name, bucket_start);
+
+-- Legacy hourly aggregated ping metrics
+CREATE TABLE IF NOT EXISTS ping_hourly (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	hour_start TEXT NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_avg REAL,
+	latency_max REAL,
+	packet_loss_avg REAL NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL,
+	UNIQUE(server_id, target_name, hour_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ping_hourly_server_time ON ping_hourly(server_id, hour_start);
+CREATE INDEX IF NOT EXISTS idx_ping_hourly_target ON ping_hourly(server_id, target_name, hour_start);
+
+-- Daily ping summaries (kept forever)
+CREATE TABLE IF NOT EXISTS ping_daily (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	date TEXT NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_avg REAL,
+	latency_max REAL,
+	packet_loss_avg REAL NOT NULL DEFAULT 0,
+	uptime_percent REAL NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL,
+	UNIQUE(server_id, target_name, date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ping_daily_server_time ON ping_daily(server_id, date);
+CREATE INDEX IF NOT EXISTS idx_ping_daily_target ON ping_daily(server_id, target_name, date);
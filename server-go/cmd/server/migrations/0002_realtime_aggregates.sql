@@ -0,0 +1,63 @@
+-- Buckets updated as raw samples arrive
+
+-- 5-second aggregated metrics (for 1h queries, ~720 points per server)
+CREATE TABLE IF NOT EXISTS metrics_5sec (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	cpu_sum REAL NOT NULL DEFAULT 0,
+	cpu_max REAL NOT NULL DEFAULT 0,
+	memory_sum REAL NOT NULL DEFAULT 0,
+	memory_max REAL NOT NULL DEFAULT 0,
+	disk_sum REAL NOT NULL DEFAULT 0,
+	net_rx INTEGER NOT NULL DEFAULT 0,
+	net_tx INTEGER NOT NULL DEFAULT 0,
+	ping_sum REAL NOT NULL DEFAULT 0,
+	ping_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, bucket)
+) WITHOUT ROWID;
+
+-- 2-minute aggregated metrics (for 24h queries, ~720 points per server)
+CREATE TABLE IF NOT EXISTS metrics_2min (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	cpu_sum REAL NOT NULL DEFAULT 0,
+	cpu_max REAL NOT NULL DEFAULT 0,
+	memory_sum REAL NOT NULL DEFAULT 0,
+	memory_max REAL NOT NULL DEFAULT 0,
+	disk_sum REAL NOT NULL DEFAULT 0,
+	net_rx INTEGER NOT NULL DEFAULT 0,
+	net_tx INTEGER NOT NULL DEFAULT 0,
+	ping_sum REAL NOT NULL DEFAULT 0,
+	ping_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, bucket)
+) WITHOUT ROWID;
+
+-- 5-second aggregated ping metrics (for 1h queries)
+CREATE TABLE IF NOT EXISTS ping_5sec (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_sum REAL NOT NULL DEFAULT 0,
+	latency_max REAL NOT NULL DEFAULT 0,
+	latency_count INTEGER NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, target_name, bucket)
+) WITHOUT ROWID;
+
+-- 2-minute aggregated ping metrics (for 24h queries)
+CREATE TABLE IF NOT EXISTS ping_2min (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_sum REAL NOT NULL DEFAULT 0,
+	latency_max REAL NOT NULL DEFAULT 0,
+	latency_count INTEGER NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, target_name, bucket)
+) WITHOUT ROWID;
@@ -0,0 +1,94 @@
+-- Coarser buckets uploaded by agents or built by the server rollup
+
+-- 15-minute aggregated metrics (for 7d queries)
+CREATE TABLE IF NOT EXISTS metrics_15min_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	cpu_sum REAL NOT NULL DEFAULT 0,
+	cpu_max REAL NOT NULL DEFAULT 0,
+	memory_sum REAL NOT NULL DEFAULT 0,
+	memory_max REAL NOT NULL DEFAULT 0,
+	disk_sum REAL NOT NULL DEFAULT 0,
+	net_rx INTEGER NOT NULL DEFAULT 0,
+	net_tx INTEGER NOT NULL DEFAULT 0,
+	ping_sum REAL NOT NULL DEFAULT 0,
+	ping_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, bucket)
+) WITHOUT ROWID;
+
+-- Hourly aggregated metrics (for 30d queries)
+CREATE TABLE IF NOT EXISTS metrics_hourly_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	cpu_sum REAL NOT NULL DEFAULT 0,
+	cpu_max REAL NOT NULL DEFAULT 0,
+	memory_sum REAL NOT NULL DEFAULT 0,
+	memory_max REAL NOT NULL DEFAULT 0,
+	disk_sum REAL NOT NULL DEFAULT 0,
+	net_rx INTEGER NOT NULL DEFAULT 0,
+	net_tx INTEGER NOT NULL DEFAULT 0,
+	ping_sum REAL NOT NULL DEFAULT 0,
+	ping_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, bucket)
+) WITHOUT ROWID;
+
+-- Daily aggregated metrics (for 1y queries)
+CREATE TABLE IF NOT EXISTS metrics_daily_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	cpu_sum REAL NOT NULL DEFAULT 0,
+	cpu_max REAL NOT NULL DEFAULT 0,
+	memory_sum REAL NOT NULL DEFAULT 0,
+	memory_max REAL NOT NULL DEFAULT 0,
+	disk_sum REAL NOT NULL DEFAULT 0,
+	net_rx INTEGER NOT NULL DEFAULT 0,
+	net_tx INTEGER NOT NULL DEFAULT 0,
+	ping_sum REAL NOT NULL DEFAULT 0,
+	ping_count INTEGER NOT NULL DEFAULT 0,
+	sample_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, bucket)
+) WITHOUT ROWID;
+
+-- 15-minute aggregated ping metrics (for 7d queries)
+CREATE TABLE IF NOT EXISTS ping_15min_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_sum REAL NOT NULL DEFAULT 0,
+	latency_max REAL NOT NULL DEFAULT 0,
+	latency_count INTEGER NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, target_name, bucket)
+) WITHOUT ROWID;
+
+-- Hourly aggregated ping metrics (for 30d queries)
+CREATE TABLE IF NOT EXISTS ping_hourly_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_sum REAL NOT NULL DEFAULT 0,
+	latency_max REAL NOT NULL DEFAULT 0,
+	latency_count INTEGER NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, target_name, bucket)
+) WITHOUT ROWID;
+
+-- Daily aggregated ping metrics (for 1y queries)
+CREATE TABLE IF NOT EXISTS ping_daily_agg (
+	server_id TEXT NOT NULL,
+	bucket INTEGER NOT NULL,
+	target_name TEXT NOT NULL,
+	target_host TEXT NOT NULL,
+	latency_sum REAL NOT NULL DEFAULT 0,
+	latency_max REAL NOT NULL DEFAULT 0,
+	latency_count INTEGER NOT NULL DEFAULT 0,
+	ok_count INTEGER NOT NULL DEFAULT 0,
+	fail_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (server_id, target_name, bucket)
+) WITHOUT ROWID;
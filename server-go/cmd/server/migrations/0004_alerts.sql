@@ -0,0 +1,37 @@
+-- Alert rules and their firing/resolved history
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	metric TEXT NOT NULL,
+	operator TEXT NOT NULL,
+	threshold REAL NOT NULL,
+	duration_secs INTEGER NOT NULL DEFAULT 0,
+	cooldown_secs INTEGER NOT NULL DEFAULT 0,
+	server_ids TEXT NOT NULL DEFAULT '',
+	dimension_id TEXT NOT NULL DEFAULT '',
+	option_id TEXT NOT NULL DEFAULT '',
+	channels TEXT NOT NULL DEFAULT '',
+	enabled INTEGER NOT NULL DEFAULT 1,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS alert_history (
+	id TEXT PRIMARY KEY,
+	rule_id TEXT NOT NULL,
+	rule_name TEXT NOT NULL,
+	server_id TEXT NOT NULL,
+	server_name TEXT NOT NULL,
+	metric TEXT NOT NULL,
+	operator TEXT NOT NULL,
+	threshold REAL NOT NULL,
+	value REAL NOT NULL,
+	status TEXT NOT NULL,
+	fired_at TEXT NOT NULL,
+	resolved_at TEXT,
+	resolved_value REAL
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_history_server_time ON alert_history(server_id, fired_at);
+CREATE INDEX IF NOT EXISTS idx_alert_history_status ON alert_history(status);
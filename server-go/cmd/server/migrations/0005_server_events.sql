@@ -0,0 +1,11 @@
+-- Agent connectivity events (connect/disconnect/online/offline)
+
+CREATE TABLE IF NOT EXISTS server_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	server_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	timestamp TEXT NOT NULL,
+	detail TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_server_events_server_time ON server_events(server_id, timestamp);
@@ -0,0 +1,45 @@
+-- Server inventory and settings, previously kept in the config file
+
+CREATE TABLE IF NOT EXISTS servers (
+	id TEXT PRIMARY KEY,
+	position INTEGER NOT NULL DEFAULT 0, -- display order
+	name TEXT NOT NULL,
+	url TEXT NOT NULL DEFAULT '',
+	location TEXT NOT NULL DEFAULT '',
+	provider TEXT NOT NULL DEFAULT '',
+	tag TEXT NOT NULL DEFAULT '',
+	token TEXT NOT NULL,
+	version TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	group_id TEXT NOT NULL DEFAULT '',
+	group_values TEXT NOT NULL DEFAULT '{}', -- JSON object: dimension_id -> option_id
+	price_amount TEXT NOT NULL DEFAULT '',
+	price_period TEXT NOT NULL DEFAULT '',
+	purchase_date TEXT NOT NULL DEFAULT '',
+	tip_badge TEXT NOT NULL DEFAULT '',
+	offline_grace_secs INTEGER NOT NULL DEFAULT 0,
+	sla_target REAL NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS group_dimensions (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	key TEXT NOT NULL,
+	enabled INTEGER NOT NULL DEFAULT 1,
+	sort_order INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS group_options (
+	dimension_id TEXT NOT NULL,
+	id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	sort_order INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (dimension_id, id)
+);
+
+-- Settings sections (site, probe, notifications, ...) as JSON documents
+CREATE TABLE IF NOT EXISTS settings (
+	key TEXT PRIMARY KEY,
+	value TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
@@ -0,0 +1,20 @@
+-- User accounts with roles, and the OAuth identities linked to them
+
+CREATE TABLE IF NOT EXISTS users (
+	id TEXT PRIMARY KEY,
+	username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	password_hash TEXT NOT NULL DEFAULT '', -- empty: OAuth login only
+	role TEXT NOT NULL, -- admin, operator or viewer
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+	provider TEXT NOT NULL, -- github or google
+	subject TEXT NOT NULL COLLATE NOCASE, -- GitHub login or Google email
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
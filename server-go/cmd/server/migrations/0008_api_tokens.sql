@@ -0,0 +1,15 @@
+-- Long-lived API tokens for automation, acting as their user within their scopes
+
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE, -- SHA-256 of the token, hex
+	prefix TEXT NOT NULL, -- first characters of the token, to recognize it
+	scopes TEXT NOT NULL, -- comma separated
+	expires_at TEXT NOT NULL DEFAULT '', -- empty: never
+	last_used_at TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);
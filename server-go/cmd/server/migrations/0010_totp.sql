@@ -0,0 +1,11 @@
+-- TOTP two-factor authentication; a row without enabled is an enrollment waiting for its first code
+
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret TEXT NOT NULL, -- base32, as shown to the authenticator app
+	enabled INTEGER NOT NULL DEFAULT 0,
+	recovery_codes TEXT NOT NULL DEFAULT '', -- comma-separated sha256 hashes of the unused recovery codes
+	last_step INTEGER NOT NULL DEFAULT 0, -- time step of the last accepted code, so a code works only once
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
@@ -0,0 +1,27 @@
+-- Append-only log of administrative actions
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp TEXT NOT NULL,
+	actor_id TEXT NOT NULL DEFAULT '', -- user ID
+	actor TEXT NOT NULL DEFAULT '', -- username at the time of the action
+	api_token_id TEXT NOT NULL DEFAULT '', -- set when the action was made with an API token
+	client_ip TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL, -- e.g. server.delete, settings.update
+	target_type TEXT NOT NULL DEFAULT '',
+	target_id TEXT NOT NULL DEFAULT '',
+	changes TEXT NOT NULL DEFAULT '' -- JSON object of changed fields with their before/after values
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_timestamp ON audit_log(timestamp);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END;
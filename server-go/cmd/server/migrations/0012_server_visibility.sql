@@ -0,0 +1,3 @@
+-- Servers hidden from visitors who are not logged in
+
+ALTER TABLE servers ADD COLUMN hidden INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+-- Links that share the history and live updates of some servers without an account
+
+CREATE TABLE IF NOT EXISTS share_links (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL DEFAULT '',
+	server_ids TEXT NOT NULL DEFAULT '', -- comma separated, "local" for the dashboard server
+	dimension_id TEXT NOT NULL DEFAULT '', -- or the servers of a group dimension option
+	option_id TEXT NOT NULL DEFAULT '',
+	password_hash TEXT NOT NULL DEFAULT '', -- bcrypt, empty without password
+	expires_at TEXT NOT NULL DEFAULT '', -- empty: never
+	created_by TEXT NOT NULL DEFAULT '', -- username
+	created_at TEXT NOT NULL
+);
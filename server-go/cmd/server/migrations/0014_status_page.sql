@@ -0,0 +1,40 @@
+-- Status page incidents with their timeline, and scheduled maintenance windows
+
+CREATE TABLE IF NOT EXISTS status_incidents (
+	id TEXT PRIMARY KEY,
+	title TEXT NOT NULL,
+	impact TEXT NOT NULL, -- none, minor, major or critical
+	status TEXT NOT NULL, -- status of the latest update
+	component_ids TEXT NOT NULL DEFAULT '', -- comma separated status page component IDs
+	created_by TEXT NOT NULL DEFAULT '', -- username
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL,
+	resolved_at TEXT NOT NULL DEFAULT '' -- empty while the incident is open
+);
+
+CREATE INDEX IF NOT EXISTS idx_status_incidents_updated ON status_incidents(updated_at);
+
+CREATE TABLE IF NOT EXISTS status_incident_updates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	incident_id TEXT NOT NULL REFERENCES status_incidents(id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	message TEXT NOT NULL,
+	created_by TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_status_incident_updates_incident ON status_incident_updates(incident_id);
+
+CREATE TABLE IF NOT EXISTS maintenance_windows (
+	id TEXT PRIMARY KEY,
+	title TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	component_ids TEXT NOT NULL DEFAULT '', -- comma separated status page component IDs
+	starts_at TEXT NOT NULL,
+	ends_at TEXT NOT NULL,
+	created_by TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_windows_ends ON maintenance_windows(ends_at);
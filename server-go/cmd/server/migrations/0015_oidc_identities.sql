@@ -0,0 +1,13 @@
+-- OIDC identities are keyed by issuer and subject; identities created on first login keep being
+-- checked against the provider's allow-lists
+
+ALTER TABLE user_identities ADD COLUMN auto_provisioned INTEGER NOT NULL DEFAULT 0;
+
+-- Users created on first login have no password and got their identity along with the account
+UPDATE user_identities SET auto_provisioned = 1
+WHERE provider = 'oidc' AND EXISTS (
+	SELECT 1 FROM users
+	WHERE users.id = user_identities.user_id
+		AND users.password_hash = ''
+		AND users.created_at = user_identities.created_at
+);
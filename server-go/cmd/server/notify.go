@@ -0,0 +1,589 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ============================================================================
+// Notification Types
+// ============================================================================
+
+// Notification events
+const (
+	NotifyEventAlertFiring   = "alert_firing"
+	NotifyEventAlertResolved = "alert_resolved"
+	NotifyEventTest          = "test"
+)
+
+// Notification severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+	SeverityResolved = "resolved"
+)
+
+const (
+	defaultNotifyRetries   = 3
+	defaultNotifyRetryBase = 2 * time.Second
+	maxNotifyRetryDelay    = 5 * time.Minute
+	notifyTimeout          = 15 * time.Second
+)
+
+// Notification is the channel-independent message handed to every notifier
+type Notification struct {
+	Event      string            `json:"event"`    // alert_firing, alert_resolved, test
+	Severity   string            `json:"severity"` // info, warning, critical, resolved
+	Title      string            `json:"title"`
+	Message    string            `json:"message"`
+	ServerID   string            `json:"server_id,omitempty"`
+	ServerName string            `json:"server_name,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	Time       string            `json:"time"`
+}
+
+// Text renders the notification as plain text for chat and email channels
+func (n *Notification) Text() string {
+	if n.Message == "" {
+		return n.Title
+	}
+	return n.Title + "\n" + n.Message
+}
+
+// Notifier delivers a notification through one channel
+type Notifier interface {
+	Send(ctx context.Context, n *Notification) error
+}
+
+// permanentError marks a delivery failure that retrying won't fix (bad config, 4xx response)
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+var notifyHTTPClient = &http.Client{Timeout: notifyTimeout}
+
+// ============================================================================
+// Channel Construction & Validation
+// ============================================================================
+
+// newNotifier builds the notifier for a channel configuration
+func newNotifier(ch *NotificationChannel) (Notifier, error) {
+	if err := ch.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch ch.Type {
+	case ChannelTypeWebhook:
+		n := &webhookNotifier{cfg: ch.Webhook}
+		if ch.Webhook.BodyTemplate != "" {
+			tmpl, err := template.New(ch.ID).Funcs(notifyTemplateFuncs).Parse(ch.Webhook.BodyTemplate)
+			if err != nil {
+				return nil, fmt.Errorf("invalid body template: %w", err)
+			}
+			n.tmpl = tmpl
+		}
+		return n, nil
+	case ChannelTypeEmail:
+		return &emailNotifier{cfg: ch.Email}, nil
+	case ChannelTypeTelegram:
+		return &telegramNotifier{cfg: ch.Telegram}, nil
+	case ChannelTypeSlack, ChannelTypeDiscord:
+		return &chatWebhookNotifier{cfg: ch.Chat, discord: ch.Type == ChannelTypeDiscord}, nil
+	}
+	return nil, fmt.Errorf("unsupported channel type: %s", ch.Type)
+}
+
+// Validate checks that a channel has the settings its type requires
+func (ch *NotificationChannel) Validate() error {
+	if ch.Name == "" {
+		return fmt.Errorf("channel name is required")
+	}
+
+	switch ch.Type {
+	case ChannelTypeWebhook:
+		if ch.Webhook == nil || ch.Webhook.URL == "" {
+			return fmt.Errorf("webhook url is required")
+		}
+		if ch.Webhook.BodyTemplate != "" {
+			if _, err := template.New("body").Funcs(notifyTemplateFuncs).Parse(ch.Webhook.BodyTemplate); err != nil {
+				return fmt.Errorf("invalid body template: %w", err)
+			}
+		}
+	case ChannelTypeEmail:
+		if ch.Email == nil || ch.Email.Host == "" || ch.Email.From == "" || len(ch.Email.To) == 0 {
+			return fmt.Errorf("email host, from and to are required")
+		}
+		switch ch.Email.TLSMode {
+		case "", "starttls", "tls", "none":
+		default:
+			return fmt.Errorf("unsupported tls_mode: %s", ch.Email.TLSMode)
+		}
+	case ChannelTypeTelegram:
+		if ch.Telegram == nil || ch.Telegram.BotToken == "" || ch.Telegram.ChatID == "" {
+			return fmt.Errorf("telegram bot_token and chat_id are required")
+		}
+	case ChannelTypeSlack, ChannelTypeDiscord:
+		if ch.Chat == nil || ch.Chat.URL == "" {
+			return fmt.Errorf("webhook url is required")
+		}
+	default:
+		return fmt.Errorf("unsupported channel type: %s", ch.Type)
+	}
+	return nil
+}
+
+// ============================================================================
+// Webhook Channel
+// ============================================================================
+
+var notifyTemplateFuncs = template.FuncMap{
+	// json encodes a value so templates can safely embed strings in JSON bodies
+	"json": func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+type webhookNotifier struct {
+	cfg  *WebhookChannelConfig
+	tmpl *template.Template
+}
+
+func (w *webhookNotifier) Send(ctx context.Context, n *Notification) error {
+	var body []byte
+	if w.tmpl != nil {
+		var buf bytes.Buffer
+		if err := w.tmpl.Execute(&buf, n); err != nil {
+			return &permanentError{fmt.Errorf("render body template: %w", err)}
+		}
+		body = buf.Bytes()
+	} else {
+		body, _ = json.Marshal(n)
+	}
+
+	method := w.cfg.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	contentType := w.cfg.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	return postNotification(ctx, method, w.cfg.URL, contentType, w.cfg.Headers, body)
+}
+
+// ============================================================================
+// Email Channel
+// ============================================================================
+
+type emailNotifier struct {
+	cfg *EmailChannelConfig
+}
+
+func (e *emailNotifier) Send(ctx context.Context, n *Notification) error {
+	port := e.cfg.Port
+	if port == 0 {
+		switch e.cfg.TLSMode {
+		case "tls":
+			port = 465
+		case "none":
+			port = 25
+		default:
+			port = 587
+		}
+	}
+	addr := net.JoinHostPort(e.cfg.Host, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: e.cfg.Host}
+	dialer := &net.Dialer{Timeout: notifyTimeout}
+
+	var conn net.Conn
+	var err error
+	if e.cfg.TLSMode == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	if e.cfg.TLSMode == "" || e.cfg.TLSMode == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return &permanentError{fmt.Errorf("smtp server does not support STARTTLS")}
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if e.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)); err != nil {
+			return &permanentError{fmt.Errorf("smtp auth: %w", err)}
+		}
+	}
+
+	if err := client.Mail(e.cfg.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	for _, to := range e.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err := w.Write(e.buildMessage(n)); err != nil {
+		return fmt.Errorf("smtp write: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func (e *emailNotifier) buildMessage(n *Notification) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", "[vStats] "+n.Title))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+
+	body := n.Text()
+	keys := make([]string, 0, len(n.Fields))
+	for key := range n.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		body += fmt.Sprintf("\n%s: %s", key, n.Fields[key])
+	}
+	body += "\n\n" + n.Time + "\n"
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+// ============================================================================
+// Telegram Channel
+// ============================================================================
+
+type telegramNotifier struct {
+	cfg *TelegramChannelConfig
+}
+
+func (t *telegramNotifier) Send(ctx context.Context, n *Notification) error {
+	base := strings.TrimSuffix(t.cfg.APIBase, "/")
+	if base == "" {
+		base = "https://api.telegram.org"
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"chat_id":                  t.cfg.ChatID,
+		"text":                     n.Text(),
+		"disable_web_page_preview": true,
+	})
+	return postNotification(ctx, http.MethodPost, base+"/bot"+t.cfg.BotToken+"/sendMessage", "application/json", nil, body)
+}
+
+// ============================================================================
+// Slack / Discord Channel
+// ============================================================================
+
+type chatWebhookNotifier struct {
+	cfg     *ChatWebhookChannelConfig
+	discord bool
+}
+
+func (s *chatWebhookNotifier) Send(ctx context.Context, n *Notification) error {
+	payload := map[string]interface{}{}
+	text := n.Text()
+	if s.discord {
+		// Discord rejects messages longer than 2000 characters
+		if runes := []rune(text); len(runes) > 2000 {
+			text = string(runes[:1997]) + "..."
+		}
+		payload["content"] = text
+	} else {
+		payload["text"] = text
+	}
+	if s.cfg.Username != "" {
+		payload["username"] = s.cfg.Username
+	}
+
+	body, _ := json.Marshal(payload)
+	return postNotification(ctx, http.MethodPost, s.cfg.URL, "application/json", nil, body)
+}
+
+// postNotification sends an HTTP request and classifies the response for the retry loop
+func postNotification(ctx context.Context, method, url, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "vStats-Server/"+ServerVersion)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := notifyHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err}
+	}
+	return err
+}
+
+// ============================================================================
+// Dispatcher
+// ============================================================================
+
+type notificationJob struct {
+	channel      NotificationChannel
+	notification Notification
+	maxRetries   int
+	retryBase    time.Duration
+}
+
+// NotificationDispatcher fans notifications out to channels and retries failed deliveries
+type NotificationDispatcher struct {
+	settings func() NotificationSettings
+	queue    chan notificationJob
+}
+
+// NewNotificationDispatcher starts the delivery workers; settings is read on every dispatch
+func NewNotificationDispatcher(settings func() NotificationSettings, workers int) *NotificationDispatcher {
+	d := &NotificationDispatcher{
+		settings: settings,
+		queue:    make(chan notificationJob, 256),
+	}
+	for i := 0; i < workers; i++ {
+		go d.worker()
+	}
+	return d
+}
+
+// Dispatch queues a notification for the given channel IDs (empty = all enabled channels)
+func (d *NotificationDispatcher) Dispatch(n *Notification, channelIDs []string) {
+	if d == nil {
+		return
+	}
+	if n.Time == "" {
+		n.Time = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	settings := d.settings()
+	maxRetries := settings.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultNotifyRetries
+	}
+	retryBase := time.Duration(settings.RetryBaseSecs) * time.Second
+	if retryBase <= 0 {
+		retryBase = defaultNotifyRetryBase
+	}
+
+	wanted := make(map[string]bool, len(channelIDs))
+	for _, id := range channelIDs {
+		wanted[id] = true
+	}
+
+	for _, ch := range settings.Channels {
+		if !ch.Enabled || (len(wanted) > 0 && !wanted[ch.ID]) {
+			continue
+		}
+		job := notificationJob{channel: ch, notification: *n, maxRetries: maxRetries, retryBase: retryBase}
+		select {
+		case d.queue <- job:
+		default:
+			fmt.Printf("⚠️  Notification queue full, dropping %s for channel %s\n", n.Event, ch.Name)
+		}
+	}
+}
+
+func (d *NotificationDispatcher) worker() {
+	for job := range d.queue {
+		d.deliver(job)
+	}
+}
+
+// deliver sends one job with exponential backoff between attempts
+func (d *NotificationDispatcher) deliver(job notificationJob) {
+	notifier, err := newNotifier(&job.channel)
+	if err != nil {
+		fmt.Printf("⚠️  Notification channel %s misconfigured: %v\n", job.channel.Name, err)
+		return
+	}
+
+	delay := job.retryBase
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		err = notifier.Send(ctx, &job.notification)
+		cancel()
+		if err == nil {
+			return
+		}
+
+		if _, permanent := err.(*permanentError); permanent || attempt >= job.maxRetries {
+			fmt.Printf("❌ Notification to %s failed after %d attempt(s): %v\n", job.channel.Name, attempt+1, err)
+			return
+		}
+
+		fmt.Printf("⚠️  Notification to %s failed (attempt %d), retrying in %s: %v\n", job.channel.Name, attempt+1, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxNotifyRetryDelay {
+			delay = maxNotifyRetryDelay
+		}
+	}
+}
+
+// SendTestNotification delivers a test message synchronously with a single attempt
+func SendTestNotification(ch *NotificationChannel) error {
+	notifier, err := newNotifier(ch)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	return notifier.Send(ctx, &Notification{
+		Event:    NotifyEventTest,
+		Severity: SeverityInfo,
+		Title:    "Test notification",
+		Message:  fmt.Sprintf("This is a test message from vStats for channel \"%s\".", ch.Name),
+		Time:     time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// ============================================================================
+// Secret Masking
+// ============================================================================
+
+const maskedSecret = "********"
+
+// maskNotificationSettings returns a copy of the settings with credentials replaced by a placeholder
+func maskNotificationSettings(s NotificationSettings) NotificationSettings {
+	masked := s
+	masked.Channels = make([]NotificationChannel, len(s.Channels))
+	for i, ch := range s.Channels {
+		if ch.Webhook != nil {
+			w := *ch.Webhook
+			if len(w.Headers) > 0 {
+				w.Headers = make(map[string]string, len(ch.Webhook.Headers))
+				for key := range ch.Webhook.Headers {
+					w.Headers[key] = maskedSecret
+				}
+			}
+			ch.Webhook = &w
+		}
+		if ch.Email != nil {
+			e := *ch.Email
+			if e.Password != "" {
+				e.Password = maskedSecret
+			}
+			ch.Email = &e
+		}
+		if ch.Telegram != nil {
+			t := *ch.Telegram
+			if t.BotToken != "" {
+				t.BotToken = maskedSecret
+			}
+			ch.Telegram = &t
+		}
+		if ch.Chat != nil {
+			c := *ch.Chat
+			if c.URL != "" {
+				c.URL = maskedSecret
+			}
+			ch.Chat = &c
+		}
+		masked.Channels[i] = ch
+	}
+	return masked
+}
+
+// restoreChannelSecrets replaces masked placeholders with the stored credentials of the same
+// channel. Credentials are only restored while they still go to the stored host or URL, so a
+// changed destination cannot receive them.
+func restoreChannelSecrets(ch *NotificationChannel, existing []NotificationChannel) {
+	var prev *NotificationChannel
+	for i := range existing {
+		if existing[i].ID == ch.ID {
+			prev = &existing[i]
+			break
+		}
+	}
+	if prev == nil {
+		return
+	}
+
+	if ch.Webhook != nil && prev.Webhook != nil && ch.Webhook.URL == prev.Webhook.URL {
+		for key, value := range ch.Webhook.Headers {
+			if value == maskedSecret {
+				ch.Webhook.Headers[key] = prev.Webhook.Headers[key]
+			}
+		}
+	}
+	if ch.Email != nil && prev.Email != nil && ch.Email.Password == maskedSecret &&
+		ch.Email.Host == prev.Email.Host && ch.Email.Port == prev.Email.Port {
+		ch.Email.Password = prev.Email.Password
+	}
+	if ch.Telegram != nil && prev.Telegram != nil && ch.Telegram.BotToken == maskedSecret &&
+		ch.Telegram.APIBase == prev.Telegram.APIBase {
+		ch.Telegram.BotToken = prev.Telegram.BotToken
+	}
+	// The chat webhook URL is the secret and the destination at once
+	if ch.Chat != nil && prev.Chat != nil && ch.Chat.URL == maskedSecret {
+		ch.Chat.URL = prev.Chat.URL
+	}
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testNotification = Notification{
+	Event:      NotifyEventAlertFiring,
+	Severity:   SeverityCritical,
+	Title:      "CPU high on web-1",
+	Message:    "CPU usage is 97%",
+	ServerID:   "web-1",
+	ServerName: "web-1",
+	Fields:     map[string]string{"value": "97", "threshold": "90"},
+	Time:       "2026-01-02T03:04:05Z",
+}
+
+// capturedRequest is one request received by a channel endpoint
+type capturedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   []byte
+}
+
+// newChannelEndpoint answers with the given status codes in turn (the last one repeats) and
+// records every request
+func newChannelEndpoint(t *testing.T, statuses ...int) (*httptest.Server, func() []capturedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []capturedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, capturedRequest{r.Method, r.URL.Path, r.Header.Clone(), body})
+		status := statuses[min(len(requests), len(statuses))-1]
+		mu.Unlock()
+		w.WriteHeader(status)
+		w.Write([]byte("status " + strconv.Itoa(status)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []capturedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]capturedRequest(nil), requests...)
+	}
+}
+
+func sendTest(t *testing.T, ch *NotificationChannel) error {
+	t.Helper()
+	notifier, err := newNotifier(ch)
+	if err != nil {
+		t.Fatalf("newNotifier: %v", err)
+	}
+	n := testNotification
+	return notifier.Send(context.Background(), &n)
+}
+
+func decodeJSON(t *testing.T, body []byte) map[string]interface{} {
+	t.Helper()
+	var v map[string]interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		t.Fatalf("decode %q: %v", body, err)
+	}
+	return v
+}
+
+// ============================================================================
+// HTTP Channels
+// ============================================================================
+
+func TestWebhookDelivery(t *testing.T) {
+	srv, requests := newChannelEndpoint(t, http.StatusOK)
+
+	ch := &NotificationChannel{ID: "wh", Name: "hook", Type: ChannelTypeWebhook, Webhook: &WebhookChannelConfig{URL: srv.URL + "/hook"}}
+	if err := sendTest(t, ch); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	req := requests()[0]
+	if req.method != http.MethodPost || req.path != "/hook" || req.header.Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected request %s %s %s", req.method, req.path, req.header.Get("Content-Type"))
+	}
+	if !strings.HasPrefix(req.header.Get("User-Agent"), "vStats-Server/") {
+		t.Fatalf("unexpected user agent %q", req.header.Get("User-Agent"))
+	}
+	if body := decodeJSON(t, req.body); body["event"] != NotifyEventAlertFiring || body["title"] != testNotification.Title {
+		t.Fatalf("unexpected body %v", body)
+	}
+
+	// Method, headers, content type and body template are taken from the channel
+	ch.Webhook = &WebhookChannelConfig{
+		URL:          srv.URL + "/custom",
+		Method:       http.MethodPut,
+		Headers:      map[string]string{"Authorization": "Bearer abc"},
+		ContentType:  "text/plain",
+		BodyTemplate: `{{.Severity | upper}}: {{.Title}} {{json .Fields}}`,
+	}
+	if err := sendTest(t, ch); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	req = requests()[1]
+	if req.method != http.MethodPut || req.header.Get("Authorization") != "Bearer abc" || req.header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("unexpected request %s %v", req.method, req.header)
+	}
+	if want := `CRITICAL: CPU high on web-1 {"threshold":"90","value":"97"}`; string(req.body) != want {
+		t.Fatalf("body = %q, want %q", req.body, want)
+	}
+}
+
+func TestTelegramDelivery(t *testing.T) {
+	srv, requests := newChannelEndpoint(t, http.StatusOK)
+
+	ch := &NotificationChannel{ID: "tg", Name: "telegram", Type: ChannelTypeTelegram, Telegram: &TelegramChannelConfig{
+		BotToken: "123:abc",
+		ChatID:   "-10042",
+		APIBase:  srv.URL + "/",
+	}}
+	if err := sendTest(t, ch); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	req := requests()[0]
+	if req.path != "/bot123:abc/sendMessage" {
+		t.Fatalf("unexpected path %q", req.path)
+	}
+	body := decodeJSON(t, req.body)
+	if body["chat_id"] != "-10042" || body["text"] != testNotification.Text() || body["disable_web_page_preview"] != true {
+		t.Fatalf("unexpected body %v", body)
+	}
+}
+
+func TestChatWebhookDelivery(t *testing.T) {
+	srv, requests := newChannelEndpoint(t, http.StatusNoContent)
+
+	slack := &NotificationChannel{ID: "sl", Name: "slack", Type: ChannelTypeSlack, Chat: &ChatWebhookChannelConfig{URL: srv.URL + "/slack", Username: "vStats"}}
+	if err := sendTest(t, slack); err != nil {
+		t.Fatalf("slack: %v", err)
+	}
+	body := decodeJSON(t, requests()[0].body)
+	if body["text"] != testNotification.Text() || body["username"] != "vStats" || body["content"] != nil {
+		t.Fatalf("unexpected slack body %v", body)
+	}
+
+	// Discord uses content and caps it at 2000 characters
+	discord := &NotificationChannel{ID: "dc", Name: "discord", Type: ChannelTypeDiscord, Chat: &ChatWebhookChannelConfig{URL: srv.URL + "/discord"}}
+	notifier, err := newNotifier(discord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := testNotification
+	long.Message = strings.Repeat("é", 3000)
+	if err := notifier.Send(context.Background(), &long); err != nil {
+		t.Fatalf("discord: %v", err)
+	}
+	body = decodeJSON(t, requests()[1].body)
+	content, _ := body["content"].(string)
+	if n := len([]rune(content)); n != 2000 || !strings.HasSuffix(content, "...") || body["text"] != nil {
+		t.Fatalf("discord content has %d characters", n)
+	}
+}
+
+func TestPostNotificationClassification(t *testing.T) {
+	cases := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusUnauthorized, true},
+		{http.StatusNotFound, true},
+		{http.StatusRequestTimeout, false},
+		{http.StatusTooManyRequests, false},
+		{http.StatusInternalServerError, false},
+		{http.StatusBadGateway, false},
+		{http.StatusServiceUnavailable, false},
+	}
+	for _, tc := range cases {
+		srv, _ := newChannelEndpoint(t, tc.status)
+		err := postNotification(context.Background(), http.MethodPost, srv.URL, "application/json", nil, nil)
+		if err == nil {
+			t.Fatalf("HTTP %d: no error", tc.status)
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) != tc.permanent {
+			t.Errorf("HTTP %d: permanent = %v, want %v (%v)", tc.status, !tc.permanent, tc.permanent, err)
+		}
+		if !strings.Contains(err.Error(), "status "+strconv.Itoa(tc.status)) {
+			t.Errorf("HTTP %d: error %q lacks the response body", tc.status, err)
+		}
+	}
+
+	// Unreachable endpoints are retried
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	err := postNotification(context.Background(), http.MethodPost, srv.URL, "application/json", nil, nil)
+	var permanent *permanentError
+	if err == nil || errors.As(err, &permanent) {
+		t.Fatalf("unreachable endpoint: %v", err)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	cases := []struct {
+		name     string
+		statuses []int
+		attempts int
+	}{
+		{"success", []int{http.StatusOK}, 1},
+		{"recovers", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 3},
+		{"gives up", []int{http.StatusInternalServerError}, 3},
+		{"permanent", []int{http.StatusForbidden}, 1},
+		{"permanent after retry", []int{http.StatusBadGateway, http.StatusNotFound}, 2},
+	}
+	var d NotificationDispatcher
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, requests := newChannelEndpoint(t, tc.statuses...)
+			d.deliver(notificationJob{
+				channel:      NotificationChannel{ID: "wh", Name: "hook", Type: ChannelTypeWebhook, Webhook: &WebhookChannelConfig{URL: srv.URL}},
+				notification: testNotification,
+				maxRetries:   2,
+				retryBase:    time.Millisecond,
+			})
+			if got := len(requests()); got != tc.attempts {
+				t.Fatalf("%d attempts, want %d", got, tc.attempts)
+			}
+		})
+	}
+}
+
+// ============================================================================
+// Email Channel
+// ============================================================================
+
+// smtpStandIn is a plaintext SMTP server that accepts one login and records the mail it gets
+type smtpStandIn struct {
+	addr       *net.TCPAddr
+	startTLS   bool   // Advertise STARTTLS
+	rcptReply  string // Reply to RCPT TO, default 250
+	mu         sync.Mutex
+	auth       string // Decoded AUTH PLAIN response
+	from       string
+	recipients []string
+	data       string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &smtpStandIn{addr: ln.Addr().(*net.TCPAddr), rcptReply: "250 OK"}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) channel(username, password string) *NotificationChannel {
+	return &NotificationChannel{ID: "mail", Name: "mail", Type: ChannelTypeEmail, Email: &EmailChannelConfig{
+		Host:     "127.0.0.1",
+		Port:     s.addr.Port,
+		Username: username,
+		Password: password,
+		From:     "vstats@example.com",
+		To:       []string{"ops@example.com", "oncall@example.com"},
+		TLSMode:  "none",
+	}}
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		s.mu.Lock()
+		switch {
+		case verb == "EHLO":
+			if s.startTLS {
+				reply("250-localhost")
+				reply("250-STARTTLS")
+			} else {
+				reply("250-localhost")
+			}
+			reply("250 AUTH PLAIN")
+		case verb == "AUTH":
+			resp, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			s.auth = string(resp)
+			if s.auth == "\x00user\x00pass" {
+				reply("235 Authentication succeeded")
+			} else {
+				reply("535 Authentication failed")
+			}
+		case verb == "MAIL":
+			s.from = line
+			reply("250 OK")
+		case verb == "RCPT":
+			s.recipients = append(s.recipients, line)
+			reply(s.rcptReply)
+		case verb == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					s.mu.Unlock()
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.data = data.String()
+			reply("250 Queued")
+		case verb == "QUIT":
+			reply("221 Bye")
+			s.mu.Unlock()
+			return
+		default:
+			reply("250 OK")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestEmailDelivery(t *testing.T) {
+	s := newSMTPStandIn(t)
+	if err := sendTest(t, s.channel("user", "pass")); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.HasPrefix(s.from, "MAIL FROM:<vstats@example.com>") {
+		t.Fatalf("unexpected MAIL %q", s.from)
+	}
+	if len(s.recipients) != 2 || !strings.Contains(s.recipients[1], "<oncall@example.com>") {
+		t.Fatalf("unexpected recipients %q", s.recipients)
+	}
+	for _, want := range []string{
+		"From: vstats@example.com\r\n",
+		"To: ops@example.com, oncall@example.com\r\n",
+		"Subject: [vStats] CPU high on web-1\r\n",
+		"\r\n\r\nCPU high on web-1\r\nCPU usage is 97%\r\nthreshold: 90\r\nvalue: 97\r\n\r\n2026-01-02T03:04:05Z\r\n",
+	} {
+		if !strings.Contains(s.data, want) {
+			t.Errorf("message lacks %q:\n%s", want, s.data)
+		}
+	}
+}
+
+func TestEmailDeliveryErrors(t *testing.T) {
+	var permanent *permanentError
+
+	// A rejected login will not succeed on retry
+	s := newSMTPStandIn(t)
+	if err := sendTest(t, s.channel("user", "wrong")); err == nil || !errors.As(err, &permanent) {
+		t.Fatalf("bad credentials: %v", err)
+	}
+
+	// Neither will STARTTLS on a server that does not offer it
+	ch := s.channel("", "")
+	ch.Email.TLSMode = ""
+	if err := sendTest(t, ch); err == nil || !errors.As(err, &permanent) {
+		t.Fatalf("missing STARTTLS: %v", err)
+	}
+
+	// A temporarily rejected recipient is retried
+	s.mu.Lock()
+	s.rcptReply = "451 Try again later"
+	s.mu.Unlock()
+	if err := sendTest(t, s.channel("user", "pass")); err == nil || errors.As(err, &permanent) {
+		t.Fatalf("temporary RCPT failure: %v", err)
+	}
+
+	// So is a server that cannot be reached
+	ch = s.channel("", "")
+	ch.Email.Port = 1
+	if err := sendTest(t, ch); err == nil || errors.As(err, &permanent) {
+		t.Fatalf("unreachable server: %v", err)
+	}
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ============================================================================
+// OpenID Connect
+// ============================================================================
+//
+// Authorization code flow with PKCE (S256) against a discovered issuer. The ID token from
+// the token endpoint is verified against the issuer's JWKS (RSA or ECDSA), its issuer,
+// audience, expiry and the nonce sent with the authorization request.
+
+const (
+	oidcDiscoveryTTL = time.Hour
+	oidcJWKSTTL      = time.Hour
+)
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// OIDCDiscovery is the part of the issuer's openid-configuration document that is used
+type OIDCDiscovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+}
+
+type oidcJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type oidcKeySet struct {
+	keys      map[string]interface{} // kid -> *rsa.PublicKey or *ecdsa.PublicKey
+	fetchedAt time.Time
+}
+
+var (
+	oidcCacheMu     sync.Mutex
+	oidcDiscoveries = make(map[string]*OIDCDiscovery)
+	oidcDiscoveryAt = make(map[string]time.Time)
+	oidcKeySets     = make(map[string]*oidcKeySet)
+)
+
+// OIDCClaims are the ID token claims used to identify and authorize the account
+type OIDCClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     *bool    `json:"email_verified,omitempty"`
+	PreferredUsername string   `json:"preferred_username"`
+	Groups            []string `json:"-"`
+}
+
+// oidcProvider returns the OIDC provider if it is enabled and configured
+func (o *OAuthConfig) oidcProvider() *OIDCProvider {
+	if o == nil || o.OIDC == nil || !o.OIDC.Enabled || o.OIDC.Issuer == "" || o.OIDC.ClientID == "" {
+		return nil
+	}
+	return o.OIDC
+}
+
+func validateOIDCProvider(p *OIDCProvider) error {
+	if p.Issuer != "" {
+		u, err := url.Parse(p.Issuer)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("issuer must be an http(s) URL")
+		}
+	}
+	if p.Enabled && (p.Issuer == "" || p.ClientID == "") {
+		return fmt.Errorf("issuer and client_id are required")
+	}
+	if p.DefaultRole != "" && !p.DefaultRole.Valid() {
+		return fmt.Errorf("default_role must be admin, operator or viewer")
+	}
+	return nil
+}
+
+// discoverOIDC fetches the issuer's openid-configuration, cached for oidcDiscoveryTTL
+func discoverOIDC(issuer string) (*OIDCDiscovery, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	oidcCacheMu.Lock()
+	if d, ok := oidcDiscoveries[issuer]; ok && time.Since(oidcDiscoveryAt[issuer]) < oidcDiscoveryTTL {
+		oidcCacheMu.Unlock()
+		return d, nil
+	}
+	oidcCacheMu.Unlock()
+
+	var d OIDCDiscovery
+	if err := oidcGetJSON(issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, expected %q", d.Issuer, issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document is missing endpoints")
+	}
+
+	oidcCacheMu.Lock()
+	oidcDiscoveries[issuer] = &d
+	oidcDiscoveryAt[issuer] = time.Now()
+	oidcCacheMu.Unlock()
+	return &d, nil
+}
+
+// oidcKey returns the signing key with the given ID, refetching the JWKS when the key is
+// unknown so that key rotation at the issuer is picked up
+func oidcKey(jwksURI, kid string) (interface{}, error) {
+	oidcCacheMu.Lock()
+	set := oidcKeySets[jwksURI]
+	oidcCacheMu.Unlock()
+	if set != nil && time.Since(set.fetchedAt) < oidcJWKSTTL {
+		if key, ok := set.keys[kid]; ok {
+			return key, nil
+		}
+		// Refetching for unknown kids is limited, so forged tokens cannot hammer the issuer
+		if time.Since(set.fetchedAt) < 10*time.Second {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	var doc struct {
+		Keys []oidcJWK `json:"keys"`
+	}
+	if err := oidcGetJSON(jwksURI, &doc); err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	set = &oidcKeySet{keys: make(map[string]interface{}), fetchedAt: time.Now()}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			set.keys[k.Kid] = key
+		}
+	}
+	oidcCacheMu.Lock()
+	oidcKeySets[jwksURI] = set
+	oidcCacheMu.Unlock()
+
+	if key, ok := set.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (k oidcJWK) publicKey() (interface{}, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func oidcGetJSON(u string, v interface{}) error {
+	resp, err := oidcHTTPClient.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// oidcRandom returns a random URL-safe string for states, nonces and PKCE verifiers
+func oidcRandom() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// oidcAuthURL builds the authorization request
+func oidcAuthURL(d *OIDCDiscovery, p *OIDCProvider, redirectURI, state, nonce, verifier string) string {
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", pkceChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + params.Encode()
+}
+
+// exchangeOIDCCode redeems the authorization code and returns the raw ID token
+func exchangeOIDCCode(d *OIDCDiscovery, p *OIDCProvider, code, redirectURI, verifier string) (string, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURI)
+	data.Set("code_verifier", verifier)
+	data.Set("client_id", p.ClientID)
+
+	// client_secret_basic is the default; use client_secret_post when it is the only one offered
+	usePost := len(d.TokenAuthMethods) > 0
+	for _, m := range d.TokenAuthMethods {
+		if m == "client_secret_basic" {
+			usePost = false
+		}
+	}
+	if p.ClientSecret != "" && usePost {
+		data.Set("client_secret", p.ClientSecret)
+	}
+
+	req, _ := http.NewRequest("POST", d.TokenEndpoint, strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" && !usePost {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResp); err != nil {
+		return "", err
+	}
+	if tokenResp.Error != "" {
+		return "", fmt.Errorf("%s %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return "", fmt.Errorf("no id_token in response")
+	}
+	return tokenResp.IDToken, nil
+}
+
+// verifyOIDCToken checks the ID token signature and claims and returns its claims
+func verifyOIDCToken(d *OIDCDiscovery, p *OIDCProvider, rawToken, nonce string) (*OIDCClaims, error) {
+	var claims OIDCClaims
+	_, err := jwt.ParseWithClaims(rawToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return oidcKey(d.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("invalid ID token: nonce mismatch")
+	}
+
+	// Groups may be a list or a single string, under a configurable claim name
+	var raw jwt.MapClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(rawToken, &raw); err == nil {
+		groupsClaim := p.GroupsClaim
+		if groupsClaim == "" {
+			groupsClaim = "groups"
+		}
+		switch v := raw[groupsClaim].(type) {
+		case []interface{}:
+			for _, g := range v {
+				if s, ok := g.(string); ok {
+					claims.Groups = append(claims.Groups, s)
+				}
+			}
+		case string:
+			claims.Groups = []string{v}
+		}
+	}
+	return &claims, nil
+}
+
+// oidcAllowed reports whether the account passes one of the provider's allow-lists. Emails
+// only count when the issuer says they are verified.
+func oidcAllowed(p *OIDCProvider, claims *OIDCClaims) bool {
+	if claims.emailVerified() {
+		if isUserAllowed(p.AllowedUsers, claims.Email) {
+			return true
+		}
+		if at := strings.LastIndex(claims.Email, "@"); at >= 0 {
+			domain := claims.Email[at+1:]
+			for _, d := range p.AllowedDomains {
+				if strings.EqualFold(strings.TrimPrefix(d, "@"), domain) {
+					return true
+				}
+			}
+		}
+	}
+	for _, g := range claims.Groups {
+		for _, allowed := range p.AllowedGroups {
+			if g == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *OIDCClaims) emailVerified() bool {
+	return c.Email != "" && c.EmailVerified != nil && *c.EmailVerified
+}
+
+// oidcSubject is the identity subject of an account: its issuer and its stable subject, as
+// emails can change and be reused
+func (c *OIDCClaims) oidcSubject() string {
+	return c.Issuer + "#" + c.Subject
+}
+
+// oidcUser returns the user an OIDC account logs in as, or for accounts passing the allow-lists
+// a user created with the provider's default role. Identities are keyed by oidcSubject; an
+// identity an admin linked by email is matched by the verified email once and then moved to
+// the subject. Users created on first login lose access when they no longer pass the allow-lists.
+func (s *AppState) oidcUser(p *OIDCProvider, claims *OIDCClaims) (*User, error) {
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("ID token has no subject")
+	}
+	account := claims.Email
+	if account == "" {
+		account = claims.Subject
+	}
+
+	subject := claims.oidcSubject()
+	user, err := getUserByIdentity(s.DB, "oidc", subject)
+	if err == nil && user == nil && claims.emailVerified() {
+		if user, err = getUserByIdentity(s.DB, "oidc", claims.Email); err == nil && user != nil {
+			err = bindOIDCSubject(s.DB, user, claims.Email, subject)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load user")
+	}
+	if user != nil {
+		for _, identity := range user.Identities {
+			if identity.Provider == "oidc" && strings.EqualFold(identity.Subject, subject) &&
+				identity.AutoProvisioned && !oidcAllowed(p, claims) {
+				return nil, fmt.Errorf("User not authorized: %s", account)
+			}
+		}
+		return user, nil
+	}
+	if !oidcAllowed(p, claims) {
+		return nil, fmt.Errorf("User not authorized: %s", account)
+	}
+
+	role := p.DefaultRole
+	if !role.Valid() {
+		role = RoleViewer
+	}
+	for _, username := range []string{claims.PreferredUsername, claims.Email} {
+		if validateUsername(username) != nil {
+			continue
+		}
+		user = newUser(username, role)
+		user.Identities = []UserIdentity{{Provider: "oidc", Subject: subject, AutoProvisioned: true}}
+		err := SaveUser(s.DB, user)
+		if err == nil {
+			fmt.Printf("👤 Created %s user %q on first OIDC login\n", role, username)
+			return user, nil
+		}
+		if !errors.Is(err, errUsernameTaken) {
+			return nil, fmt.Errorf("Failed to create user")
+		}
+	}
+	return nil, fmt.Errorf("No free username for %s", account)
+}
+
+// bindOIDCSubject replaces an identity linked by email with the account's subject
+func bindOIDCSubject(db *sql.DB, user *User, email, subject string) error {
+	for i, identity := range user.Identities {
+		if identity.Provider == "oidc" && strings.EqualFold(identity.Subject, email) {
+			user.Identities[i].Subject = subject
+		}
+	}
+	user.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return SaveUser(db, user)
+}
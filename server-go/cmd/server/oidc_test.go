@@ -0,0 +1,440 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is a minimal OpenID Connect provider: discovery, JWKS and a token endpoint that
+// checks the PKCE verifier of the codes registered with authorize
+type mockIssuer struct {
+	t      *testing.T
+	srv    *httptest.Server
+	client string
+	secret string
+
+	mu       sync.Mutex
+	keys     map[string]*rsa.PrivateKey // Published signing keys by kid
+	kid      string                     // Key new tokens are signed with
+	codes    map[string]mockCode
+	jwksHits int
+}
+
+type mockCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	m := &mockIssuer{t: t, client: "vstats", secret: "s3cret", keys: make(map[string]*rsa.PrivateKey), codes: make(map[string]mockCode)}
+	m.rotate("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.srv.URL,
+			"authorization_endpoint": m.srv.URL + "/authorize",
+			"token_endpoint":         m.srv.URL + "/token",
+			"jwks_uri":               m.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.jwksHits++
+		keys := []oidcJWK{}
+		for kid, key := range m.keys {
+			keys = append(keys, oidcJWK{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		fail := func(code string) {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": code})
+		}
+		if id, secret, ok := r.BasicAuth(); !ok || id != m.client || secret != m.secret {
+			fail("invalid_client")
+			return
+		}
+		m.mu.Lock()
+		code, ok := m.codes[r.Form.Get("code")]
+		delete(m.codes, r.Form.Get("code"))
+		m.mu.Unlock()
+		if !ok || r.Form.Get("grant_type") != "authorization_code" {
+			fail("invalid_grant")
+			return
+		}
+		if pkceChallenge(r.Form.Get("code_verifier")) != code.challenge {
+			fail("invalid_grant")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(code.claims)})
+	})
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+func (m *mockIssuer) provider() *OIDCProvider {
+	return &OIDCProvider{Enabled: true, Issuer: m.srv.URL, ClientID: m.client, ClientSecret: m.secret}
+}
+
+// rotate publishes a new signing key and signs new tokens with it
+func (m *mockIssuer) rotate(kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.keys[kid] = key
+	m.kid = kid
+	m.mu.Unlock()
+}
+
+func (m *mockIssuer) sign(claims jwt.MapClaims) string {
+	m.mu.Lock()
+	key, kid := m.keys[m.kid], m.kid
+	m.mu.Unlock()
+	return signWith(m.t, key, kid, claims)
+}
+
+func signWith(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// claims returns valid ID token claims for nonce, with overrides applied
+func (m *mockIssuer) claims(nonce string, overrides jwt.MapClaims) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   m.srv.URL,
+		"aud":   m.client,
+		"sub":   "user-1",
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+		"email": "alice@example.com",
+	}
+	for k, v := range overrides {
+		claims[k] = v
+	}
+	return claims
+}
+
+func (m *mockIssuer) discover(t *testing.T) *OIDCDiscovery {
+	t.Helper()
+	d, err := discoverOIDC(m.srv.URL)
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+	return d
+}
+
+// expireJWKSCache makes the next unknown kid refetch the issuer's keys
+func expireJWKSCache(jwksURI string) {
+	oidcCacheMu.Lock()
+	defer oidcCacheMu.Unlock()
+	if set := oidcKeySets[jwksURI]; set != nil {
+		set.fetchedAt = time.Now().Add(-time.Minute)
+	}
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	m := newMockIssuer(t)
+	d := m.discover(t)
+	if d.TokenEndpoint != m.srv.URL+"/token" || d.JWKSURI != m.srv.URL+"/jwks" {
+		t.Fatalf("unexpected endpoints: %+v", d)
+	}
+
+	// A discovery document for another issuer is refused
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 "https://evil.example.com",
+			"authorization_endpoint": "https://evil.example.com/authorize",
+			"token_endpoint":         "https://evil.example.com/token",
+			"jwks_uri":               "https://evil.example.com/jwks",
+		})
+	}))
+	defer other.Close()
+	if _, err := discoverOIDC(other.URL); err == nil {
+		t.Fatal("discovery for a mismatched issuer succeeded")
+	}
+}
+
+func TestOIDCCodeExchangePKCE(t *testing.T) {
+	m := newMockIssuer(t)
+	d := m.discover(t)
+	p := m.provider()
+	redirect := "http://localhost/api/auth/oauth/oidc/callback"
+
+	verifier, nonce := oidcRandom(), oidcRandom()
+	authURL, err := url.Parse(oidcAuthURL(d, p, redirect, "state-1", nonce, verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := authURL.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") != pkceChallenge(verifier) {
+		t.Fatalf("authorization request lacks the S256 challenge: %s", authURL)
+	}
+	if q.Get("nonce") != nonce || q.Get("client_id") != p.ClientID || q.Get("redirect_uri") != redirect {
+		t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+
+	register := func(code string) {
+		m.mu.Lock()
+		m.codes[code] = mockCode{challenge: q.Get("code_challenge"), claims: m.claims(nonce, nil)}
+		m.mu.Unlock()
+	}
+
+	register("code-1")
+	if _, err := exchangeOIDCCode(d, p, "code-1", redirect, oidcRandom()); err == nil {
+		t.Fatal("exchange with the wrong verifier succeeded")
+	}
+
+	register("code-2")
+	idToken, err := exchangeOIDCCode(d, p, "code-2", redirect, verifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	claims, err := verifyOIDCToken(d, p, idToken, nonce)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "alice@example.com" {
+		t.Fatalf("unexpected claims: %+v", claims)
+	}
+
+	// Codes are single use
+	if _, err := exchangeOIDCCode(d, p, "code-2", redirect, verifier); err == nil {
+		t.Fatal("code was accepted twice")
+	}
+}
+
+func TestOIDCVerifyTokenClaims(t *testing.T) {
+	m := newMockIssuer(t)
+	d := m.discover(t)
+	p := m.provider()
+
+	if _, err := verifyOIDCToken(d, p, m.sign(m.claims("n", nil)), "n"); err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		overrides jwt.MapClaims
+		nonce     string
+	}{
+		{"wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com"}, "n"},
+		{"wrong audience", jwt.MapClaims{"aud": "someone-else"}, "n"},
+		{"wrong nonce", nil, "other"},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, "n"},
+		{"no expiry", jwt.MapClaims{"exp": nil}, "n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := m.claims("n", tc.overrides)
+			for k, v := range claims {
+				if v == nil {
+					delete(claims, k)
+				}
+			}
+			if _, err := verifyOIDCToken(d, p, m.sign(claims), tc.nonce); err == nil {
+				t.Fatal("token was accepted")
+			}
+		})
+	}
+}
+
+func TestOIDCKeyRotation(t *testing.T) {
+	m := newMockIssuer(t)
+	d := m.discover(t)
+	p := m.provider()
+
+	if _, err := verifyOIDCToken(d, p, m.sign(m.claims("n", nil)), "n"); err != nil {
+		t.Fatalf("verify with the first key: %v", err)
+	}
+
+	// Right after a fetch, unknown kids do not refetch the JWKS
+	m.rotate("key-2")
+	rotated := m.sign(m.claims("n", nil))
+	hits := m.jwksHits
+	if _, err := verifyOIDCToken(d, p, rotated, "n"); err == nil {
+		t.Fatal("token with an unknown kid accepted without a refetch")
+	}
+	if m.jwksHits != hits {
+		t.Fatal("JWKS was refetched right after a fetch")
+	}
+
+	// Later, the new key is picked up
+	expireJWKSCache(d.JWKSURI)
+	if _, err := verifyOIDCToken(d, p, rotated, "n"); err != nil {
+		t.Fatalf("verify after rotation: %v", err)
+	}
+
+	// A token signed by a key the issuer does not publish fails, even with a known kid
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyOIDCToken(d, p, signWith(t, forger, "key-2", m.claims("n", nil)), "n"); err == nil {
+		t.Fatal("token signed with an unpublished key accepted")
+	}
+
+	// HMAC tokens signed with the public modulus are refused
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, m.claims("n", nil))
+	hmac.Header["kid"] = "key-2"
+	signed, _ := hmac.SignedString([]byte("key"))
+	if _, err := verifyOIDCToken(d, p, signed, "n"); err == nil {
+		t.Fatal("HS256 token accepted")
+	}
+}
+
+func TestOIDCAllowed(t *testing.T) {
+	verified, unverified := true, false
+	p := &OIDCProvider{
+		AllowedUsers:   []string{"bob@partner.com"},
+		AllowedDomains: []string{"example.com"},
+		AllowedGroups:  []string{"ops"},
+	}
+	cases := []struct {
+		name   string
+		claims OIDCClaims
+		want   bool
+	}{
+		{"verified domain", OIDCClaims{Email: "alice@example.com", EmailVerified: &verified}, true},
+		{"domain is case-insensitive", OIDCClaims{Email: "alice@EXAMPLE.com", EmailVerified: &verified}, true},
+		{"unverified domain", OIDCClaims{Email: "alice@example.com", EmailVerified: &unverified}, false},
+		{"domain without email_verified", OIDCClaims{Email: "alice@example.com"}, false},
+		{"verified user", OIDCClaims{Email: "bob@partner.com", EmailVerified: &verified}, true},
+		{"user without email_verified", OIDCClaims{Email: "bob@partner.com"}, false},
+		{"subdomain", OIDCClaims{Email: "eve@evil.example.com", EmailVerified: &verified}, false},
+		{"group", OIDCClaims{Groups: []string{"dev", "ops"}}, true},
+		{"group is case-sensitive", OIDCClaims{Groups: []string{"OPS"}}, false},
+		{"nothing", OIDCClaims{Email: "eve@evil.com", EmailVerified: &verified, Groups: []string{"dev"}}, false},
+	}
+	for _, tc := range cases {
+		if got := oidcAllowed(p, &tc.claims); got != tc.want {
+			t.Errorf("%s: oidcAllowed = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestOIDCUserProvisioning(t *testing.T) {
+	s := newTestState(t)
+	verified := true
+	p := &OIDCProvider{AllowedGroups: []string{"ops"}, DefaultRole: RoleOperator}
+	claims := &OIDCClaims{PreferredUsername: "carol", Groups: []string{"ops"}}
+	claims.Issuer, claims.Subject = "https://sso.example.com", "sub-carol"
+
+	user, err := s.oidcUser(p, claims)
+	if err != nil {
+		t.Fatalf("first login: %v", err)
+	}
+	if user.Username != "carol" || user.Role != RoleOperator {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if len(user.Identities) != 1 || user.Identities[0].Subject != "https://sso.example.com#sub-carol" || !user.Identities[0].AutoProvisioned {
+		t.Fatalf("unexpected identities %+v", user.Identities)
+	}
+
+	again, err := s.oidcUser(p, claims)
+	if err != nil || again.ID != user.ID {
+		t.Fatalf("second login: %v, %+v", err, again)
+	}
+
+	// Leaving the allowed group ends access of provisioned users
+	claims.Groups = []string{"dev"}
+	if _, err := s.oidcUser(p, claims); err == nil {
+		t.Fatal("provisioned user logged in after leaving the allowed group")
+	}
+
+	// The same email under another subject is another account
+	other := &OIDCClaims{Email: "carol@example.com", EmailVerified: &verified, Groups: []string{"ops"}}
+	other.Issuer, other.Subject = "https://sso.example.com", "sub-other"
+	if u, err := s.oidcUser(p, other); err != nil || u.ID == user.ID {
+		t.Fatalf("other subject: %v, %+v", err, u)
+	}
+}
+
+func TestOIDCUserLinkedByEmail(t *testing.T) {
+	s := newTestState(t)
+	verified, unverified := true, false
+	p := &OIDCProvider{}
+
+	admin, err := getUserByUsername(s.DB, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.Identities = []UserIdentity{{Provider: "oidc", Subject: "dave@example.com"}}
+	if err := SaveUser(s.DB, admin); err != nil {
+		t.Fatal(err)
+	}
+
+	login := func(sub string, emailVerified *bool) (*User, error) {
+		claims := &OIDCClaims{Email: "dave@example.com", EmailVerified: emailVerified}
+		claims.Issuer, claims.Subject = "https://sso.example.com", sub
+		return s.oidcUser(p, claims)
+	}
+
+	if _, err := login("sub-dave", nil); err == nil {
+		t.Fatal("email without email_verified matched a linked user")
+	}
+	if _, err := login("sub-dave", &unverified); err == nil {
+		t.Fatal("unverified email matched a linked user")
+	}
+
+	user, err := login("sub-dave", &verified)
+	if err != nil || user.ID != admin.ID {
+		t.Fatalf("verified email: %v, %+v", err, user)
+	}
+	if user.Identities[0].Subject != "https://sso.example.com#sub-dave" {
+		t.Fatalf("identity was not bound to the subject: %+v", user.Identities)
+	}
+
+	// Once bound, the email no longer links other accounts
+	if _, err := login("sub-mallory", &verified); err == nil {
+		t.Fatal("another subject with the same email logged in as the linked user")
+	}
+
+	// Admin-linked identities do not depend on the allow-lists
+	if user, err := login("sub-dave", nil); err != nil || user.ID != admin.ID {
+		t.Fatalf("bound subject: %v, %+v", err, user)
+	}
+}
+
+func TestOIDCSubjectIsPerIssuer(t *testing.T) {
+	claims := &OIDCClaims{}
+	claims.Issuer, claims.Subject = "https://a.example.com", "1"
+	other := &OIDCClaims{}
+	other.Issuer, other.Subject = "https://b.example.com", "1"
+	if claims.oidcSubject() == other.oidcSubject() || !strings.HasSuffix(claims.oidcSubject(), "#1") {
+		t.Fatalf("subjects %q and %q", claims.oidcSubject(), other.oidcSubject())
+	}
+}
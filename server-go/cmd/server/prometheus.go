@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================
+// Prometheus Text Exposition
+// ============================================================================
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type promLabel struct {
+	Name  string
+	Value string
+}
+
+type promSample struct {
+	Labels []promLabel
+	Value  float64
+}
+
+type promFamily struct {
+	Name    string
+	Help    string
+	Type    string // gauge or counter
+	Samples []promSample
+}
+
+// promRegistry collects samples grouped by metric family, preserving registration order
+type promRegistry struct {
+	families map[string]*promFamily
+	order    []string
+}
+
+func newPromRegistry() *promRegistry {
+	return &promRegistry{families: make(map[string]*promFamily)}
+}
+
+func (r *promRegistry) add(name, typ, help string, labels []promLabel, value float64) {
+	f, ok := r.families[name]
+	if !ok {
+		f = &promFamily{Name: name, Help: help, Type: typ}
+		r.families[name] = f
+		r.order = append(r.order, name)
+	}
+	f.Samples = append(f.Samples, promSample{Labels: labels, Value: value})
+}
+
+func (r *promRegistry) gauge(name, help string, labels []promLabel, value float64) {
+	r.add(name, "gauge", help, labels, value)
+}
+
+func (r *promRegistry) counter(name, help string, labels []promLabel, value float64) {
+	r.add(name, "counter", help, labels, value)
+}
+
+// Write renders all families in the text exposition format
+func (r *promRegistry) Write(buf *bytes.Buffer) {
+	for _, name := range r.order {
+		f := r.families[name]
+		buf.WriteString("# HELP " + f.Name + " " + f.Help + "\n")
+		buf.WriteString("# TYPE " + f.Name + " " + f.Type + "\n")
+		for _, s := range f.Samples {
+			buf.WriteString(f.Name)
+			if len(s.Labels) > 0 {
+				buf.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						buf.WriteByte(',')
+					}
+					buf.WriteString(l.Name)
+					buf.WriteString(`="`)
+					buf.WriteString(escapePromLabelValue(l.Value))
+					buf.WriteByte('"')
+				}
+				buf.WriteByte('}')
+			}
+			buf.WriteByte(' ')
+			buf.WriteString(strconv.FormatFloat(s.Value, 'g', -1, 64))
+			buf.WriteByte('\n')
+		}
+	}
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePromLabelValue(v string) string {
+	return promLabelEscaper.Replace(v)
+}
+
+// sanitizePromLabelName turns an arbitrary key into a valid label name ([a-zA-Z_][a-zA-Z0-9_]*)
+func sanitizePromLabelName(name string) string {
+	var b strings.Builder
+	for i, ch := range name {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch == '_':
+			b.WriteRune(ch)
+		case ch >= '0' && ch <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(ch)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// withLabels returns a copy of base with extra labels appended
+func withLabels(base []promLabel, extra ...promLabel) []promLabel {
+	labels := make([]promLabel, 0, len(base)+len(extra))
+	labels = append(labels, base...)
+	return append(labels, extra...)
+}
+
+// ============================================================================
+// Exporter
+// ============================================================================
+
+// serverPromLabels builds the identifying labels of a server
+func serverPromLabels(server *RemoteServer, dimensions []GroupDimension) []promLabel {
+	labels := []promLabel{
+		{"server_id", server.ID},
+		{"name", server.Name},
+		{"location", server.Location},
+		{"provider", server.Provider},
+	}
+
+	// One label per group dimension, valued with the selected option ID
+	keys := make([]string, 0, len(dimensions))
+	byKey := make(map[string]string, len(dimensions))
+	for _, dim := range dimensions {
+		key := "group_" + sanitizePromLabelName(dim.Key)
+		if _, dup := byKey[key]; dup {
+			continue
+		}
+		keys = append(keys, key)
+		byKey[key] = server.GroupValues[dim.ID]
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		labels = append(labels, promLabel{key, byKey[key]})
+	}
+	return labels
+}
+
+// writeServerMetrics adds all samples of one server to the registry
+func writeServerMetrics(r *promRegistry, labels []promLabel, online bool, data *AgentMetricsData) {
+	up := 0.0
+	if online {
+		up = 1
+	}
+	r.gauge("vstats_up", "Whether the agent reported metrics within its offline grace period.", labels, up)
+
+	if data == nil {
+		return
+	}
+	m := &data.Metrics
+
+	r.gauge("vstats_last_seen_timestamp_seconds", "Unix time of the last metrics report.", labels, float64(data.LastUpdated.Unix()))
+	r.gauge("vstats_uptime_seconds", "Host uptime in seconds.", labels, float64(m.Uptime))
+
+	r.gauge("vstats_cpu_usage_percent", "CPU usage in percent.", labels, float64(m.CPU.Usage))
+	r.gauge("vstats_cpu_cores", "Number of CPU cores.", labels, float64(m.CPU.Cores))
+
+	r.gauge("vstats_load1", "1-minute load average.", labels, m.LoadAverage.One)
+	r.gauge("vstats_load5", "5-minute load average.", labels, m.LoadAverage.Five)
+	r.gauge("vstats_load15", "15-minute load average.", labels, m.LoadAverage.Fifteen)
+
+	r.gauge("vstats_memory_total_bytes", "Total memory in bytes.", labels, float64(m.Memory.Total))
+	r.gauge("vstats_memory_used_bytes", "Used memory in bytes.", labels, float64(m.Memory.Used))
+	r.gauge("vstats_memory_available_bytes", "Available memory in bytes.", labels, float64(m.Memory.Available))
+	r.gauge("vstats_memory_usage_percent", "Memory usage in percent.", labels, float64(m.Memory.UsagePercent))
+	r.gauge("vstats_swap_total_bytes", "Total swap in bytes.", labels, float64(m.Memory.SwapTotal))
+	r.gauge("vstats_swap_used_bytes", "Used swap in bytes.", labels, float64(m.Memory.SwapUsed))
+
+	for _, d := range m.Disks {
+		mount := ""
+		if len(d.MountPoints) > 0 {
+			mount = d.MountPoints[0]
+		}
+		dl := withLabels(labels, promLabel{"disk", d.Name}, promLabel{"mountpoint", mount})
+		r.gauge("vstats_disk_total_bytes", "Disk size in bytes.", dl, float64(d.Total))
+		r.gauge("vstats_disk_used_bytes", "Used disk space in bytes.", dl, float64(d.Used))
+		r.gauge("vstats_disk_usage_percent", "Disk usage in percent.", dl, float64(d.UsagePercent))
+		r.gauge("vstats_disk_read_bytes_per_second", "Disk read throughput in bytes per second.", dl, float64(d.ReadSpeed))
+		r.gauge("vstats_disk_write_bytes_per_second", "Disk write throughput in bytes per second.", dl, float64(d.WriteSpeed))
+	}
+
+	r.gauge("vstats_network_receive_bytes_per_second", "Total receive throughput in bytes per second.", labels, float64(m.Network.RxSpeed))
+	r.gauge("vstats_network_transmit_bytes_per_second", "Total transmit throughput in bytes per second.", labels, float64(m.Network.TxSpeed))
+	for _, iface := range m.Network.Interfaces {
+		il := withLabels(labels, promLabel{"interface", iface.Name})
+		r.counter("vstats_network_receive_bytes_total", "Bytes received per interface.", il, float64(iface.RxBytes))
+		r.counter("vstats_network_transmit_bytes_total", "Bytes transmitted per interface.", il, float64(iface.TxBytes))
+		r.counter("vstats_network_receive_packets_total", "Packets received per interface.", il, float64(iface.RxPackets))
+		r.counter("vstats_network_transmit_packets_total", "Packets transmitted per interface.", il, float64(iface.TxPackets))
+	}
+
+	if m.Ping != nil {
+		for _, t := range m.Ping.Targets {
+			pl := withLabels(labels, promLabel{"target", t.Name}, promLabel{"host", t.Host})
+			if t.LatencyMs != nil {
+				r.gauge("vstats_ping_latency_milliseconds", "Latency to the ping target in milliseconds.", pl, *t.LatencyMs)
+			}
+			r.gauge("vstats_ping_packet_loss_percent", "Packet loss to the ping target in percent.", pl, t.PacketLoss)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Series Selectors
+// ============================================================================
+
+type promMatchType int
+
+const (
+	promMatchEqual promMatchType = iota
+	promMatchNotEqual
+	promMatchRegexp
+	promMatchNotRegexp
+)
+
+// promMatcher is one label matcher of a series selector such as cpu{name=~"web-.*"}
+type promMatcher struct {
+	Name  string
+	Type  promMatchType
+	Value string
+	re    *regexp.Regexp
+}
+
+func (m *promMatcher) Matches(value string) bool {
+	switch m.Type {
+	case promMatchEqual:
+		return value == m.Value
+	case promMatchNotEqual:
+		return value != m.Value
+	case promMatchRegexp:
+		return m.re.MatchString(value)
+	case promMatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+// matchesLabels reports whether a label set satisfies every matcher; missing labels match as ""
+func matchesLabels(matchers []*promMatcher, labels []promLabel) bool {
+	for _, m := range matchers {
+		value := ""
+		for _, l := range labels {
+			if l.Name == m.Name {
+				value = l.Value
+				break
+			}
+		}
+		if !m.Matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// parsePromSelector parses an instant vector selector: metric_name{label="v",label!~"re",...}.
+// Functions, operators and range vectors are not supported.
+func parsePromSelector(input string) ([]*promMatcher, error) {
+	s := strings.TrimSpace(input)
+	var matchers []*promMatcher
+
+	name := scanPromIdent(s, true)
+	if name != "" {
+		matchers = append(matchers, &promMatcher{Name: "__name__", Type: promMatchEqual, Value: name})
+		s = strings.TrimSpace(s[len(name):])
+	}
+
+	if strings.HasPrefix(s, "{") {
+		s = strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(s, "}") {
+			label := scanPromIdent(s, false)
+			if label == "" {
+				return nil, fmt.Errorf("expected label name in selector %q", input)
+			}
+			s = strings.TrimSpace(s[len(label):])
+
+			var typ promMatchType
+			switch {
+			case strings.HasPrefix(s, "=~"):
+				typ, s = promMatchRegexp, s[2:]
+			case strings.HasPrefix(s, "!~"):
+				typ, s = promMatchNotRegexp, s[2:]
+			case strings.HasPrefix(s, "!="):
+				typ, s = promMatchNotEqual, s[2:]
+			case strings.HasPrefix(s, "="):
+				typ, s = promMatchEqual, s[1:]
+			default:
+				return nil, fmt.Errorf("expected match operator after label %q", label)
+			}
+
+			value, rest, err := scanPromString(strings.TrimSpace(s))
+			if err != nil {
+				return nil, err
+			}
+			m := &promMatcher{Name: label, Type: typ, Value: value}
+			if typ == promMatchRegexp || typ == promMatchNotRegexp {
+				if m.re, err = regexp.Compile("^(?:" + value + ")$"); err != nil {
+					return nil, fmt.Errorf("invalid regular expression %q: %v", value, err)
+				}
+			}
+			matchers = append(matchers, m)
+
+			s = strings.TrimSpace(rest)
+			if strings.HasPrefix(s, ",") {
+				s = strings.TrimSpace(s[1:])
+			} else if !strings.HasPrefix(s, "}") {
+				return nil, fmt.Errorf("expected ',' or '}' in selector %q", input)
+			}
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+
+	if s != "" {
+		return nil, fmt.Errorf("unsupported expression %q: only series selectors are supported", input)
+	}
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+	return matchers, nil
+}
+
+// scanPromIdent returns the metric or label name at the start of s
+func scanPromIdent(s string, metric bool) string {
+	for i, ch := range s {
+		ok := ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') ||
+			(i > 0 && ch >= '0' && ch <= '9') || (metric && ch == ':')
+		if !ok {
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// scanPromString reads a quoted label value and returns it with the remaining input
+func scanPromString(s string) (string, string, error) {
+	if s == "" {
+		return "", "", fmt.Errorf("expected quoted label value")
+	}
+	quote := s[0]
+	if quote != '"' && quote != '\'' && quote != '`' {
+		return "", "", fmt.Errorf("expected quoted label value")
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] == '\\' && quote != '`' {
+			i++
+			continue
+		}
+		if s[i] != quote {
+			continue
+		}
+		raw := s[:i+1]
+		if quote == '\'' {
+			raw = `"` + strings.ReplaceAll(raw[1:i], `"`, `\"`) + `"`
+		}
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid label value %s", s[:i+1])
+		}
+		return value, s[i+1:], nil
+	}
+	return "", "", fmt.Errorf("unterminated label value")
+}
+
+// evalPromScalar evaluates a number or a single binary operation between two numbers (e.g. "1+1")
+func evalPromScalar(input string) (float64, bool) {
+	s := strings.TrimSpace(input)
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return v, true
+	}
+	for i := 1; i < len(s); i++ {
+		op := s[i]
+		if op != '+' && op != '-' && op != '*' && op != '/' {
+			continue
+		}
+		a, errA := strconv.ParseFloat(strings.TrimSpace(s[:i]), 64)
+		b, errB := strconv.ParseFloat(strings.TrimSpace(s[i+1:]), 64)
+		if errA != nil || errB != nil {
+			continue
+		}
+		switch op {
+		case '+':
+			return a + b, true
+		case '-':
+			return a - b, true
+		case '*':
+			return a * b, true
+		default:
+			return a / b, true
+		}
+	}
+	return 0, false
+}
+
+// ============================================================================
+// History Series
+// ============================================================================
+
+// promHistoryMetric maps a stored history column to a metric name (shared with the exporter where possible)
+type promHistoryMetric struct {
+	Name  string
+	Ping  bool // Per ping target, with target/host labels
+	value func(p *HistoryPoint) float64
+}
+
+var promHistoryMetrics = []promHistoryMetric{
+	{Name: "vstats_cpu_usage_percent", value: func(p *HistoryPoint) float64 { return float64(p.CPU) }},
+	{Name: "vstats_memory_usage_percent", value: func(p *HistoryPoint) float64 { return float64(p.Memory) }},
+	{Name: "vstats_disk_usage_percent", value: func(p *HistoryPoint) float64 { return float64(p.Disk) }},
+	{Name: "vstats_network_receive_bytes_total", value: func(p *HistoryPoint) float64 { return float64(p.NetRx) }},
+	{Name: "vstats_network_transmit_bytes_total", value: func(p *HistoryPoint) float64 { return float64(p.NetTx) }},
+	{Name: "vstats_ping_latency_milliseconds", Ping: true},
+}
+
+type promPoint struct {
+	T int64 // Unix seconds of the bucket start
+	V float64
+}
+
+type promSeries struct {
+	Labels []promLabel
+	Points []promPoint
+}
+
+// LabelMap renders the labels as the metric object of the HTTP API; empty labels are left out
+func (s *promSeries) LabelMap() map[string]string {
+	m := make(map[string]string, len(s.Labels))
+	for _, l := range s.Labels {
+		if l.Value != "" {
+			m[l.Name] = l.Value
+		}
+	}
+	return m
+}
+
+// selectPromSeries resolves matchers against the configured servers and their stored history in [from, to].
+// Series without any sample in the window are omitted.
+func selectPromSeries(st Storage, servers []RemoteServer, dimensions []GroupDimension, matchers []*promMatcher, gran HistoryGranularity, from, to time.Time) ([]promSeries, error) {
+	var result []promSeries
+	for i := range servers {
+		server := &servers[i]
+		base := serverPromLabels(server, dimensions)
+
+		var history []HistoryPoint
+		var pingTargets []PingHistoryTarget
+		historyLoaded, pingLoaded := false, false
+
+		for _, metric := range promHistoryMetrics {
+			labels := withLabels([]promLabel{{"__name__", metric.Name}}, base...)
+
+			if !metric.Ping {
+				if !matchesLabels(matchers, labels) {
+					continue
+				}
+				if !historyLoaded {
+					var err error
+					if history, err = GetHistoryRange(st, server.ID, gran, from, to); err != nil {
+						return nil, err
+					}
+					historyLoaded = true
+				}
+				series := promSeries{Labels: labels}
+				for j := range history {
+					ts, err := time.Parse(time.RFC3339, history[j].Timestamp)
+					if err != nil {
+						continue
+					}
+					series.Points = append(series.Points, promPoint{T: ts.Unix(), V: metric.value(&history[j])})
+				}
+				if len(series.Points) > 0 {
+					result = append(result, series)
+				}
+				continue
+			}
+
+			// Skip the ping query when the server-level labels already rule the metric out
+			if !matchesServerLabels(matchers, labels) {
+				continue
+			}
+			if !pingLoaded {
+				var err error
+				if pingTargets, err = GetPingHistoryRange(st, server.ID, gran, from, to); err != nil {
+					return nil, err
+				}
+				pingLoaded = true
+			}
+			for _, target := range pingTargets {
+				tl := withLabels(labels, promLabel{"target", target.Name}, promLabel{"host", target.Host})
+				if !matchesLabels(matchers, tl) {
+					continue
+				}
+				series := promSeries{Labels: tl}
+				for _, p := range target.Data {
+					ts, err := time.Parse(time.RFC3339, p.Timestamp)
+					if p.LatencyMs == nil || err != nil {
+						continue
+					}
+					series.Points = append(series.Points, promPoint{T: ts.Unix(), V: *p.LatencyMs})
+				}
+				if len(series.Points) > 0 {
+					result = append(result, series)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// matchesServerLabels checks only the matchers whose label is present in labels
+func matchesServerLabels(matchers []*promMatcher, labels []promLabel) bool {
+	for _, m := range matchers {
+		for _, l := range labels {
+			if l.Name == m.Name && !m.Matches(l.Value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// stepPromPoints samples a series at start, start+step, ... end, taking the latest point
+// no older than lookback at each step (the instant-vector semantics of Prometheus)
+func stepPromPoints(points []promPoint, start, end time.Time, step, lookback time.Duration) [][]interface{} {
+	values := [][]interface{}{}
+	j := -1
+	for t := start; !t.After(end); t = t.Add(step) {
+		ts := t.Unix()
+		for j+1 < len(points) && points[j+1].T <= ts {
+			j++
+		}
+		if j < 0 || ts-points[j].T > int64(lookback/time.Second) {
+			continue
+		}
+		values = append(values, promValue(t, points[j].V))
+	}
+	return values
+}
+
+func promValue(t time.Time, v float64) []interface{} {
+	return []interface{}{float64(t.UnixMilli()) / 1000, strconv.FormatFloat(v, 'f', -1, 64)}
+}
+
+// promLookback is how far back a step may reach for a sample of the given granularity
+func promLookback(gran HistoryGranularity) time.Duration {
+	lookback := 2 * time.Duration(gran.BucketSecs) * time.Second
+	if lookback < 5*time.Minute {
+		lookback = 5 * time.Minute
+	}
+	return lookback
+}
+
+// promLabelNames lists every label name the query API can return
+func promLabelNames(dimensions []GroupDimension) []string {
+	names := []string{"__name__", "server_id", "name", "location", "provider", "target", "host"}
+	for _, dim := range dimensions {
+		names = append(names, "group_"+sanitizePromLabelName(dim.Key))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================================
+// Retention Policies
+// ============================================================================
+
+// DefaultRetentionPolicy is what the cleanup used before retention became configurable
+var DefaultRetentionPolicy = RetentionPolicy{
+	RawHours:   24,
+	Sec5Hours:  2,
+	Min2Hours:  26,
+	Min15Days:  8,
+	HourlyDays: 32,
+	DailyDays:  400,
+}
+
+// minRetentionPolicy keeps the fixed dashboard ranges (1h, 24h, 7d, 30d, 1y) backed by their tables
+var minRetentionPolicy = RetentionPolicy{
+	RawHours:   1,
+	Sec5Hours:  1,
+	Min2Hours:  24,
+	Min15Days:  7,
+	HourlyDays: 30,
+	DailyDays:  365,
+}
+
+const maxRetentionDays = 10 * 366
+
+// Duration returns the retention of a granularity ("raw", "5sec", "2min", "15min", "hourly", "daily")
+func (p RetentionPolicy) Duration(granularity string) time.Duration {
+	switch granularity {
+	case "raw":
+		return time.Duration(p.RawHours) * time.Hour
+	case "5sec":
+		return time.Duration(p.Sec5Hours) * time.Hour
+	case "2min":
+		return time.Duration(p.Min2Hours) * time.Hour
+	case "15min":
+		return time.Duration(p.Min15Days) * 24 * time.Hour
+	case "hourly":
+		return time.Duration(p.HourlyDays) * 24 * time.Hour
+	case "daily":
+		return time.Duration(p.DailyDays) * 24 * time.Hour
+	}
+	return 0
+}
+
+// Override returns p with every non-zero field of o applied
+func (p RetentionPolicy) Override(o RetentionPolicy) RetentionPolicy {
+	if o.RawHours > 0 {
+		p.RawHours = o.RawHours
+	}
+	if o.Sec5Hours > 0 {
+		p.Sec5Hours = o.Sec5Hours
+	}
+	if o.Min2Hours > 0 {
+		p.Min2Hours = o.Min2Hours
+	}
+	if o.Min15Days > 0 {
+		p.Min15Days = o.Min15Days
+	}
+	if o.HourlyDays > 0 {
+		p.HourlyDays = o.HourlyDays
+	}
+	if o.DailyDays > 0 {
+		p.DailyDays = o.DailyDays
+	}
+	return p
+}
+
+// extend returns p with every field raised to at least the value in o
+func (p RetentionPolicy) extend(o RetentionPolicy) RetentionPolicy {
+	p.RawHours = max(p.RawHours, o.RawHours)
+	p.Sec5Hours = max(p.Sec5Hours, o.Sec5Hours)
+	p.Min2Hours = max(p.Min2Hours, o.Min2Hours)
+	p.Min15Days = max(p.Min15Days, o.Min15Days)
+	p.HourlyDays = max(p.HourlyDays, o.HourlyDays)
+	p.DailyDays = max(p.DailyDays, o.DailyDays)
+	return p
+}
+
+// validate checks a fully resolved policy
+func (p RetentionPolicy) validate() error {
+	fields := []struct {
+		name     string
+		value    int
+		min, max int
+	}{
+		{"raw_hours", p.RawHours, minRetentionPolicy.RawHours, maxRetentionDays * 24},
+		{"5sec_hours", p.Sec5Hours, minRetentionPolicy.Sec5Hours, maxRetentionDays * 24},
+		{"2min_hours", p.Min2Hours, minRetentionPolicy.Min2Hours, maxRetentionDays * 24},
+		{"15min_days", p.Min15Days, minRetentionPolicy.Min15Days, maxRetentionDays},
+		{"hourly_days", p.HourlyDays, minRetentionPolicy.HourlyDays, maxRetentionDays},
+		{"daily_days", p.DailyDays, minRetentionPolicy.DailyDays, maxRetentionDays},
+	}
+	for _, f := range fields {
+		if f.value < f.min || f.value > f.max {
+			return fmt.Errorf("%s must be between %d and %d", f.name, f.min, f.max)
+		}
+	}
+
+	// Coarser tables back the longer ranges, so they must not expire before finer ones
+	order := []string{"5sec", "2min", "15min", "hourly", "daily"}
+	for i := 1; i < len(order); i++ {
+		if p.Duration(order[i]) < p.Duration(order[i-1]) {
+			return fmt.Errorf("%s retention must not be shorter than %s retention", order[i], order[i-1])
+		}
+	}
+	return nil
+}
+
+// Validate checks the default policy and every override as it would be applied
+func (s *RetentionSettings) Validate() error {
+	base := DefaultRetentionPolicy.Override(s.Default)
+	if err := base.validate(); err != nil {
+		return fmt.Errorf("default: %v", err)
+	}
+	for id, p := range s.Groups {
+		if err := base.Override(p).validate(); err != nil {
+			return fmt.Errorf("group %s: %v", id, err)
+		}
+	}
+	for id, p := range s.Servers {
+		if err := base.Override(p).validate(); err != nil {
+			return fmt.Errorf("server %s: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// Base returns the default policy with built-in values filled in
+func (s *RetentionSettings) Base() RetentionPolicy {
+	return DefaultRetentionPolicy.Override(s.Default)
+}
+
+// Resolve returns the policy of a server: the default, extended by its groups (longest retention
+// wins when several groups match) and finally overridden by a server-specific policy
+func (s *RetentionSettings) Resolve(server *RemoteServer) RetentionPolicy {
+	policy := s.Base()
+
+	var fromGroups RetentionPolicy
+	matched := false
+	groupIDs := []string{server.GroupID}
+	for _, optionID := range server.GroupValues {
+		groupIDs = append(groupIDs, optionID)
+	}
+	for _, id := range groupIDs {
+		if p, ok := s.Groups[id]; ok && id != "" {
+			fromGroups = fromGroups.extend(policy.Override(p))
+			matched = true
+		}
+	}
+	if matched {
+		policy = fromGroups
+	}
+
+	if p, ok := s.Servers[server.ID]; ok {
+		policy = policy.Override(p)
+	}
+	return policy
+}
+
+var (
+	activeRetentionMu sync.RWMutex
+	activeRetention   = DefaultRetentionPolicy
+)
+
+// SetActiveRetention publishes the default policy used to pick history tables
+func SetActiveRetention(settings RetentionSettings) {
+	activeRetentionMu.Lock()
+	activeRetention = settings.Base()
+	activeRetentionMu.Unlock()
+}
+
+// ActiveRetention returns the default policy currently in effect
+func ActiveRetention() RetentionPolicy {
+	activeRetentionMu.RLock()
+	defer activeRetentionMu.RUnlock()
+	return activeRetention
+}
+
+// ============================================================================
+// Retention Cleanup
+// ============================================================================
+
+// retentionTable is a table cleaned by one granularity of a policy
+type retentionTable struct {
+	Table       string
+	Granularity string
+	Column      string
+	BucketSecs  int64 // 0 when Column holds RFC3339 text
+}
+
+// metricsRetentionTables are kept by the metrics storage backend
+var metricsRetentionTables = []retentionTable{
+	{"metrics_raw", "raw", "timestamp", 0},
+	{"ping_raw", "raw", "timestamp", 0},
+	{"metrics_5sec", "5sec", "bucket", 5},
+	{"ping_5sec", "5sec", "bucket", 5},
+	{"metrics_2min", "2min", "bucket", 120},
+	{"ping_2min", "2min", "bucket", 120},
+	{"metrics_15min_agg", "15min", "bucket", 900},
+	{"ping_15min_agg", "15min", "bucket", 900},
+	{"metrics_hourly_agg", "hourly", "bucket", 3600},
+	{"ping_hourly_agg", "hourly", "bucket", 3600},
+	{"metrics_daily_agg", "daily", "bucket", 86400},
+	{"ping_daily_agg", "daily", "bucket", 86400},
+}
+
+// legacyRetentionTables are pre-aggregated tables that only exist in older SQLite databases
+var legacyRetentionTables = []retentionTable{
+	{"metrics_15min", "15min", "bucket_start", 0},
+	{"ping_15min", "15min", "bucket_start", 0},
+	{"metrics_hourly", "hourly", "hour_start", 0},
+	{"ping_hourly", "hourly", "hour_start", 0},
+}
+
+// eventRetentionTables always live in the local SQLite database.
+// Server events are kept as long as daily aggregates so downtime stays explainable.
+var eventRetentionTables = []retentionTable{
+	{"server_events", "daily", "timestamp", 0},
+}
+
+// RetentionScopeReport is what one distinct policy removes (or would remove) per table
+type RetentionScopeReport struct {
+	Default bool             `json:"default"`           // Applies to all servers without an override
+	Servers []string         `json:"servers,omitempty"` // Server IDs of an override scope
+	Policy  RetentionPolicy  `json:"policy"`
+	Rows    map[string]int64 `json:"rows"`
+	Total   int64            `json:"total"`
+}
+
+// retentionScopes groups servers by effective policy; servers on the default policy are not listed
+func retentionScopes(settings RetentionSettings, servers []RemoteServer) []*RetentionScopeReport {
+	base := settings.Base()
+	scopes := []*RetentionScopeReport{{Default: true, Policy: base}}
+	byPolicy := make(map[RetentionPolicy]*RetentionScopeReport)
+	for i := range servers {
+		policy := settings.Resolve(&servers[i])
+		if policy == base {
+			continue
+		}
+		scope, ok := byPolicy[policy]
+		if !ok {
+			scope = &RetentionScopeReport{Policy: policy}
+			byPolicy[policy] = scope
+			scopes = append(scopes, scope)
+		}
+		scope.Servers = append(scope.Servers, servers[i].ID)
+	}
+	for _, scope := range scopes {
+		sort.Strings(scope.Servers)
+	}
+	return scopes
+}
+
+// retentionRunner deletes (or counts) the rows of t older than cutoff. With exclude set the rows
+// of serverIDs are skipped, otherwise only the rows of serverIDs are affected; an empty exclude
+// list affects every server.
+type retentionRunner func(t retentionTable, cutoff time.Time, serverIDs []string, exclude bool) (int64, error)
+
+// applyRetention runs the policy of every scope over tables
+func applyRetention(tables []retentionTable, settings RetentionSettings, servers []RemoteServer, now time.Time, run retentionRunner) ([]*RetentionScopeReport, error) {
+	scopes := retentionScopes(settings, servers)
+
+	// The default scope covers every server without an override, including removed servers
+	var overridden []string
+	for _, scope := range scopes[1:] {
+		overridden = append(overridden, scope.Servers...)
+	}
+
+	for _, scope := range scopes {
+		scope.Rows = make(map[string]int64, len(tables))
+		serverIDs, exclude := scope.Servers, false
+		if scope.Default {
+			serverIDs, exclude = overridden, true
+		}
+		for _, t := range tables {
+			n, err := run(t, now.Add(-scope.Policy.Duration(t.Granularity)), serverIDs, exclude)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", t.Table, err)
+			}
+			scope.Rows[t.Table] = n
+			scope.Total += n
+		}
+	}
+	return scopes, nil
+}
+
+// sqliteRetentionRunner runs retention statements against a SQLite database
+func sqliteRetentionRunner(db *sql.DB, dryRun bool) retentionRunner {
+	return func(t retentionTable, cutoffTime time.Time, serverIDs []string, exclude bool) (int64, error) {
+		var cutoff interface{} = cutoffTime.Format(time.RFC3339)
+		if t.BucketSecs > 0 {
+			cutoff = cutoffTime.Unix() / t.BucketSecs
+		}
+		where := t.Column + " < ?"
+		args := []interface{}{cutoff}
+		if len(serverIDs) > 0 {
+			op := "IN"
+			if exclude {
+				op = "NOT IN"
+			}
+			where += fmt.Sprintf(" AND server_id %s (%s)", op, sqlPlaceholders(len(serverIDs)))
+			for _, id := range serverIDs {
+				args = append(args, id)
+			}
+		}
+
+		var n int64
+		if dryRun {
+			err := db.QueryRow("SELECT COUNT(*) FROM "+t.Table+" WHERE "+where, args...).Scan(&n)
+			return n, err
+		}
+		res, err := db.Exec("DELETE FROM "+t.Table+" WHERE "+where, args...)
+		if err != nil {
+			return 0, err
+		}
+		n, _ = res.RowsAffected()
+		return n, nil
+	}
+}
+
+// ApplyRetention deletes expired rows according to the settings, or only counts them when dryRun
+// is set. Metrics tables are handled by the storage backend, server events by the local database.
+func ApplyRetention(db *sql.DB, st Storage, settings RetentionSettings, servers []RemoteServer, now time.Time, dryRun bool) ([]*RetentionScopeReport, error) {
+	scopes, err := st.ApplyRetention(settings, servers, now, dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*RetentionScopeReport
+	run := func(db *sql.DB) error {
+		var err error
+		events, err = applyRetention(eventRetentionTables, settings, servers, now, sqliteRetentionRunner(db, dryRun))
+		return err
+	}
+	if dryRun || dbWriter == nil {
+		err = run(db)
+	} else {
+		err = dbWriter.WriteSync(run)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Both runs derive their scopes from the same settings, so they line up one to one
+	for i, scope := range events {
+		for table, n := range scope.Rows {
+			scopes[i].Rows[table] = n
+		}
+		scopes[i].Total += scope.Total
+	}
+	return scopes, nil
+}
+
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetentionResolve(t *testing.T) {
+	settings := RetentionSettings{
+		Default: RetentionPolicy{RawHours: 48},
+		Groups: map[string]RetentionPolicy{
+			"eu":   {DailyDays: 730},
+			"prod": {DailyDays: 500, HourlyDays: 60},
+		},
+		Servers: map[string]RetentionPolicy{
+			"pinned": {DailyDays: 400},
+		},
+	}
+	base := DefaultRetentionPolicy
+	base.RawHours = 48
+
+	cases := []struct {
+		name   string
+		server RemoteServer
+		want   RetentionPolicy
+	}{
+		{"default", RemoteServer{ID: "a"}, base},
+		{"legacy group", RemoteServer{ID: "a", GroupID: "eu"}, withRetention(base, func(p *RetentionPolicy) { p.DailyDays = 730 })},
+		{"longest group wins", RemoteServer{ID: "a", GroupValues: map[string]string{"region": "eu", "env": "prod"}},
+			withRetention(base, func(p *RetentionPolicy) { p.DailyDays, p.HourlyDays = 730, 60 })},
+		{"server override", RemoteServer{ID: "pinned", GroupValues: map[string]string{"region": "eu"}},
+			withRetention(base, func(p *RetentionPolicy) { p.DailyDays = 400 })},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := settings.Resolve(&tc.server); got != tc.want {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func withRetention(p RetentionPolicy, edit func(*RetentionPolicy)) RetentionPolicy {
+	edit(&p)
+	return p
+}
+
+func TestRetentionValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		settings RetentionSettings
+		err      string
+	}{
+		{"built-in defaults", RetentionSettings{}, ""},
+		{"below dashboard range", RetentionSettings{Default: RetentionPolicy{HourlyDays: 7}}, "default: hourly_days must be between 30"},
+		{"coarser expires first", RetentionSettings{Default: RetentionPolicy{Min15Days: 60}}, "default: hourly retention must not be shorter than 15min"},
+		{"group override", RetentionSettings{Groups: map[string]RetentionPolicy{"eu": {DailyDays: 100000}}}, "group eu: daily_days"},
+		{"server override", RetentionSettings{Servers: map[string]RetentionPolicy{"a": {RawHours: 72}}}, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.settings.Validate()
+			if tc.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Fatalf("error %v, want %q", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestApplyRetentionScopes(t *testing.T) {
+	settings := RetentionSettings{
+		Groups:  map[string]RetentionPolicy{"eu": {DailyDays: 730}},
+		Servers: map[string]RetentionPolicy{"c": {DailyDays: 730}},
+	}
+	servers := []RemoteServer{
+		{ID: "a"},
+		{ID: "b", GroupValues: map[string]string{"region": "eu"}},
+		{ID: "c"},
+	}
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tables := []retentionTable{{"metrics_daily_agg", "daily", "bucket", 86400}}
+
+	type call struct {
+		cutoff    time.Time
+		serverIDs []string
+		exclude   bool
+	}
+	var calls []call
+	scopes, err := applyRetention(tables, settings, servers, now, func(_ retentionTable, cutoff time.Time, serverIDs []string, exclude bool) (int64, error) {
+		calls = append(calls, call{cutoff, serverIDs, exclude})
+		return 3, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Servers sharing a policy are cleaned together; the default scope covers everything else
+	if len(scopes) != 2 || !scopes[0].Default || !slices.Equal(scopes[1].Servers, []string{"b", "c"}) {
+		t.Fatalf("unexpected scopes: %+v", scopes)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+	if !calls[0].exclude || !slices.Equal(calls[0].serverIDs, []string{"b", "c"}) || !calls[0].cutoff.Equal(now.AddDate(0, 0, -400)) {
+		t.Errorf("default scope: %+v", calls[0])
+	}
+	if calls[1].exclude || !slices.Equal(calls[1].serverIDs, []string{"b", "c"}) || !calls[1].cutoff.Equal(now.AddDate(0, 0, -730)) {
+		t.Errorf("override scope: %+v", calls[1])
+	}
+	if scopes[1].Rows["metrics_daily_agg"] != 3 || scopes[1].Total != 3 {
+		t.Errorf("override rows: %+v", scopes[1])
+	}
+}
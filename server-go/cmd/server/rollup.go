@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"vstats/internal/common"
+)
+
+// ============================================================================
+// Server-Side Rollups
+// ============================================================================
+//
+// Current agents upload their own 15min/hourly/daily buckets ("aggregated_metrics").
+// Servers that only push raw samples (older agents, third-party pushers and the
+// local node) get the same buckets built here: 15min and hourly from
+// metrics_raw/ping_raw, daily from the hourly buckets because raw rows expire first.
+
+const (
+	rollupInterval = 5 * time.Minute
+	// rollupLookback is recomputed on every run so late samples still land in their buckets
+	rollupLookback = 2 * time.Hour
+	// aggregatingAgentTTL is how long an aggregated upload marks a server as self-aggregating
+	// (agents sync every minute)
+	aggregatingAgentTTL = 5 * time.Minute
+)
+
+// RollupTracker remembers which servers upload their own aggregated buckets
+type RollupTracker struct {
+	mu             sync.Mutex
+	lastAggregated map[string]time.Time
+}
+
+func NewRollupTracker() *RollupTracker {
+	return &RollupTracker{lastAggregated: make(map[string]time.Time)}
+}
+
+// MarkAggregated records an aggregated_metrics upload from a server
+func (t *RollupTracker) MarkAggregated(serverID string, at time.Time) {
+	t.mu.Lock()
+	t.lastAggregated[serverID] = at
+	t.mu.Unlock()
+}
+
+// AgentAggregates reports whether a server uploaded aggregated buckets recently
+func (t *RollupTracker) AgentAggregates(serverID string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last, ok := t.lastAggregated[serverID]
+	return ok && now.Sub(last) < aggregatingAgentTTL
+}
+
+// rollupLoop builds missing aggregates for servers that do not aggregate themselves
+func rollupLoop(state *AppState) {
+	time.Sleep(2 * time.Minute) // Let aggregating agents announce themselves first
+
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	// The first run catches up on everything raw data still covers
+	catchUp := true
+	for {
+		state.ConfigMu.RLock()
+		serverIDs := []string{"local"}
+		for _, server := range state.Config.Servers {
+			serverIDs = append(serverIDs, server.ID)
+		}
+		state.ConfigMu.RUnlock()
+
+		now := time.Now().UTC()
+		for _, serverID := range serverIDs {
+			if state.Rollups.AgentAggregates(serverID, now) {
+				continue
+			}
+			if err := RollupServer(metricsStore, serverID, now, catchUp); err != nil {
+				fmt.Printf("Failed to roll up metrics for %s: %v\n", serverID, err)
+			}
+		}
+		catchUp = false
+
+		<-ticker.C
+	}
+}
+
+// RollupServer recomputes the 15min, hourly and daily buckets of a server from its raw samples.
+// Only whole buckets are read, so a recomputed bucket is always complete for the data available.
+func RollupServer(st Storage, serverID string, now time.Time, catchUp bool) error {
+	retention := ActiveRetention()
+	rawSince, hourlySince := now.Add(-rollupLookback), now.AddDate(0, 0, -1)
+	if catchUp {
+		rawSince = now.Add(-retention.Duration("raw"))
+		hourlySince = now.Add(-retention.Duration("hourly"))
+	}
+	rawFrom := rawSince.Unix() / 3600 * 3600
+	dayFrom := hourlySince.Unix() / 86400 * 86400
+	until := now.Unix()
+
+	var granularities []common.GranularityData
+	for _, g := range []struct {
+		name     string
+		interval int64
+	}{{"15min", 900}, {"hourly", 3600}} {
+		data, err := st.RollupRaw(serverID, g.name, g.interval, rawFrom, until)
+		if err != nil {
+			return err
+		}
+		granularities = append(granularities, data)
+	}
+	if err := st.StoreRollup(serverID, granularities); err != nil {
+		return err
+	}
+
+	// Daily buckets are built from the hourly buckets just written
+	daily, err := rollupDailyFromHourly(st, serverID, dayFrom, until)
+	if err != nil {
+		return err
+	}
+	return st.StoreRollup(serverID, []common.GranularityData{daily})
+}
+
+// rollupDailyFromHourly merges the hourly buckets in [from, to) (unix seconds) into daily buckets
+func rollupDailyFromHourly(st Storage, serverID string, from, to int64) (common.GranularityData, error) {
+	data := common.GranularityData{Granularity: "daily", Interval: 86400}
+	fromHour, toHour := from/3600, (to+3599)/3600-1
+
+	err := st.ScanMetricBuckets(serverID, "hourly", fromHour, toHour, func(b *common.BucketData) error {
+		day := b.Bucket / 24
+		if n := len(data.Metrics); n == 0 || data.Metrics[n-1].Bucket != day {
+			data.Metrics = append(data.Metrics, common.BucketData{Bucket: day})
+		}
+		mergeBucket(&data.Metrics[len(data.Metrics)-1], b)
+		return nil
+	})
+	if err != nil {
+		return data, err
+	}
+
+	// Ping buckets arrive ordered by target and then bucket
+	err = st.ScanPingBuckets(serverID, "hourly", fromHour, toHour, func(p *common.PingBucketData) error {
+		day := p.Bucket / 24
+		if n := len(data.Ping); n == 0 || data.Ping[n-1].Bucket != day || data.Ping[n-1].TargetName != p.TargetName {
+			data.Ping = append(data.Ping, common.PingBucketData{Bucket: day, TargetName: p.TargetName})
+		}
+		mergePingBucket(&data.Ping[len(data.Ping)-1], p)
+		return nil
+	})
+	return data, err
+}
+
+// storeRollupBucketsInternal writes server-built buckets to SQLite. Unlike agent uploads it never
+// replaces a bucket that already holds more samples, so agent-provided buckets always win.
+func storeRollupBucketsInternal(db *sql.DB, serverID string, granularities []common.GranularityData) error {
+	for _, g := range granularities {
+		metricsTable, pingTable := getMetricsTable(g.Granularity), getPingTable(g.Granularity)
+
+		for _, m := range g.Metrics {
+			if _, err := db.Exec(`
+				INSERT INTO `+metricsTable+` (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT(server_id, bucket) DO UPDATE SET
+					cpu_sum = excluded.cpu_sum,
+					cpu_max = excluded.cpu_max,
+					memory_sum = excluded.memory_sum,
+					memory_max = excluded.memory_max,
+					disk_sum = excluded.disk_sum,
+					net_rx = excluded.net_rx,
+					net_tx = excluded.net_tx,
+					ping_sum = excluded.ping_sum,
+					ping_count = excluded.ping_count,
+					sample_count = excluded.sample_count
+				WHERE excluded.sample_count >= `+metricsTable+`.sample_count`,
+				serverID, m.Bucket,
+				m.CPUSum, m.CPUMax,
+				m.MemorySum, m.MemoryMax,
+				m.DiskSum,
+				m.NetRx, m.NetTx,
+				m.PingSum, m.PingCount,
+				m.SampleCount,
+			); err != nil {
+				return err
+			}
+		}
+
+		for _, p := range g.Ping {
+			if _, err := db.Exec(`
+				INSERT INTO `+pingTable+` (server_id, bucket, target_name, target_host, latency_sum, latency_max, latency_count, ok_count, fail_count)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT(server_id, target_name, bucket) DO UPDATE SET
+					target_host = excluded.target_host,
+					latency_sum = excluded.latency_sum,
+					latency_max = excluded.latency_max,
+					latency_count = excluded.latency_count,
+					ok_count = excluded.ok_count,
+					fail_count = excluded.fail_count
+				WHERE excluded.ok_count + excluded.fail_count >= `+pingTable+`.ok_count + `+pingTable+`.fail_count`,
+				serverID, p.Bucket, p.TargetName, p.TargetHost,
+				p.LatencySum, p.LatencyMax, p.LatencyCount, p.OkCount, p.FailCount,
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// Login Sessions
+// ============================================================================
+//
+// Every session JWT carries the ID of a row in the sessions table (jti claim), and a token
+// is only accepted while that row exists. Revoking a session deletes the row; sessions are
+// revoked when their user changes password and when the JWT secret changes.
+
+// SessionLifetime is how long a login stays valid
+const SessionLifetime = 7 * 24 * time.Hour
+
+type Session struct {
+	ID         string `json:"id"`
+	UserID     string `json:"user_id"`
+	Provider   string `json:"provider,omitempty"`
+	ClientIP   string `json:"client_ip"`
+	UserAgent  string `json:"user_agent"`
+	IssuedAt   string `json:"issued_at"`
+	ExpiresAt  string `json:"expires_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	Current    bool   `json:"current"`
+}
+
+// jwtSecretID fingerprints the JWT secret, so sessions signed with an older secret can be told apart
+func jwtSecretID(secret string) string {
+	sum := sha256.Sum256([]byte("vstats-session:" + secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// issueSession records a session for user and returns its JWT; provider is empty for password logins
+func (s *AppState) issueSession(c *gin.Context, user *User, provider string) (string, time.Time, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(SessionLifetime)
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+	secret := GetJWTSecret()
+	session := Session{
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		Provider:   provider,
+		ClientIP:   c.ClientIP(),
+		UserAgent:  userAgent,
+		IssuedAt:   now.Format(time.RFC3339),
+		ExpiresAt:  expiresAt.Format(time.RFC3339),
+		LastSeenAt: now.Format(time.RFC3339),
+	}
+
+	if err := writeInventory(s.DB, func(tx *sql.Tx) error {
+		// Expired sessions are dropped whenever a new one starts
+		if _, err := tx.Exec(`DELETE FROM sessions WHERE expires_at < ?`, session.IssuedAt); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+			INSERT INTO sessions (id, user_id, provider, client_ip, user_agent, secret_id, issued_at, expires_at, last_seen_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			session.ID, session.UserID, session.Provider, session.ClientIP, session.UserAgent, jwtSecretID(secret),
+			session.IssuedAt, session.ExpiresAt, session.LastSeenAt)
+		return err
+	}); err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims := jwt.MapClaims{
+		"sub":      user.ID,
+		"jti":      session.ID,
+		"username": user.Username,
+		"role":     user.Role,
+		"iat":      now.Unix(),
+		"exp":      expiresAt.Unix(),
+	}
+	if provider != "" {
+		claims["provider"] = provider
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+const sessionColumns = `id, user_id, provider, client_ip, user_agent, issued_at, expires_at, last_seen_at`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*Session, error) {
+	var ss Session
+	err := row.Scan(&ss.ID, &ss.UserID, &ss.Provider, &ss.ClientIP, &ss.UserAgent, &ss.IssuedAt, &ss.ExpiresAt, &ss.LastSeenAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ss, nil
+}
+
+// getSession returns an unexpired session; it returns nil when there is none
+func getSession(db *sql.DB, id string) (*Session, error) {
+	ss, err := scanSession(db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ? AND expires_at > ?`,
+		id, time.Now().UTC().Format(time.RFC3339)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ss, err
+}
+
+func listSessions(db *sql.DB, userID string) ([]*Session, error) {
+	rows, err := db.Query(`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? AND expires_at > ? ORDER BY last_seen_at DESC`,
+		userID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		ss, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, ss)
+	}
+	return sessions, rows.Err()
+}
+
+// deleteSession ends one session of a user and reports whether it existed
+func deleteSession(db *sql.DB, userID, id string) (bool, error) {
+	var found bool
+	err := writeInventory(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM sessions WHERE id = ? AND user_id = ?`, id, userID)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		found = n > 0
+		return nil
+	})
+	return found, err
+}
+
+// RevokeUserSessions ends all sessions of a user and returns how many there were
+func RevokeUserSessions(db *sql.DB, userID string) (int64, error) {
+	var n int64
+	err := writeInventory(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, userID)
+		if err != nil {
+			return err
+		}
+		n, _ = res.RowsAffected()
+		return nil
+	})
+	return n, err
+}
+
+// PruneSessions removes expired sessions and those signed with another JWT secret,
+// which can no longer be verified after the secret was rotated
+func PruneSessions(db *sql.DB, secret string) error {
+	return writeInventory(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM sessions WHERE secret_id != ?`, jwtSecretID(secret))
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			fmt.Printf("🔒 JWT secret changed, revoked %d session(s)\n", n)
+		}
+		_, err = tx.Exec(`DELETE FROM sessions WHERE expires_at < ?`, time.Now().UTC().Format(time.RFC3339))
+		return err
+	})
+}
+
+// touchSession records that a session was used, at most once a minute
+func touchSession(ss *Session, now time.Time) {
+	if last, err := time.Parse(time.RFC3339, ss.LastSeenAt); err == nil && now.Sub(last) < time.Minute {
+		return
+	}
+	lastSeen := now.UTC().Format(time.RFC3339)
+	dbWriter.WriteAsync(func(db *sql.DB) error {
+		_, err := db.Exec(`UPDATE sessions SET last_seen_at = ? WHERE id = ?`, lastSeen, ss.ID)
+		return err
+	})
+}
+
+// ============================================================================
+// WebSocket Tickets
+// ============================================================================
+//
+// Browsers cannot set headers on WebSocket connections, and URLs end up in access logs, so the
+// dashboard does not put its session JWT into the /ws URL. It exchanges the JWT for a ticket
+// that is valid once and only for a few seconds instead.
+
+const wsTicketLifetime = 30 * time.Second
+
+type wsTicket struct {
+	userID    string
+	sessionID string
+	expiresAt time.Time
+}
+
+// WSTickets hands out and redeems WebSocket tickets; they live in memory only
+type WSTickets struct {
+	mu      sync.Mutex
+	tickets map[string]wsTicket
+}
+
+func NewWSTickets() *WSTickets {
+	return &WSTickets{tickets: make(map[string]wsTicket)}
+}
+
+// Issue returns a new ticket for a user's login session
+func (t *WSTickets) Issue(userID, sessionID string, now time.Time) string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, tk := range t.tickets {
+		if !now.Before(tk.expiresAt) {
+			delete(t.tickets, key)
+		}
+	}
+	t.tickets[ticket] = wsTicket{userID: userID, sessionID: sessionID, expiresAt: now.Add(wsTicketLifetime)}
+	return ticket
+}
+
+// Redeem consumes a ticket and returns its user and session, or false if it is unknown,
+// expired or already used
+func (t *WSTickets) Redeem(ticket string, now time.Time) (string, string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tk, ok := t.tickets[ticket]
+	if !ok {
+		return "", "", false
+	}
+	delete(t.tickets, ticket)
+	if !now.Before(tk.expiresAt) {
+		return "", "", false
+	}
+	return tk.userID, tk.sessionID, true
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// sessionID returns the session a JWT belongs to
+func sessionID(t *testing.T, token string) string {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := claims["jti"].(string)
+	return id
+}
+
+func TestSessionRevoke(t *testing.T) {
+	s := newTestState(t)
+	admin, _ := getUserByUsername(s.DB, "admin")
+	laptop, phone := newTestSession(t, s, admin), newTestSession(t, s, admin)
+	other := newTestSession(t, s, newTestUser(t, s, "viewer", RoleViewer))
+
+	route := func(r *gin.Engine) {
+		protected := r.Group("/", s.AuthMiddleware(RoleViewer))
+		protected.GET("/api/auth/verify", s.VerifyToken)
+		protected.DELETE("/api/sessions", s.RevokeAllSessions)
+		protected.DELETE("/api/sessions/:id", s.RevokeSession)
+	}
+	check := func(name, session string, want int) {
+		t.Helper()
+		if w := serveTest(route, http.MethodGet, "/api/auth/verify", session); w.Code != want {
+			t.Fatalf("%s: %d, want %d", name, w.Code, want)
+		}
+	}
+
+	if w := serveTest(route, http.MethodDelete, "/api/sessions/"+sessionID(t, laptop), phone); w.Code != http.StatusOK {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body)
+	}
+	check("revoked session", laptop, http.StatusUnauthorized)
+	check("session revoking it", phone, http.StatusOK)
+
+	// Sessions of other users are not found
+	if w := serveTest(route, http.MethodDelete, "/api/sessions/"+sessionID(t, other), phone); w.Code != http.StatusNotFound {
+		t.Fatalf("revoking another user's session: %d", w.Code)
+	}
+	check("other user's session", other, http.StatusOK)
+
+	if w := serveTest(route, http.MethodDelete, "/api/sessions", phone); w.Code != http.StatusOK {
+		t.Fatalf("revoke all: %d %s", w.Code, w.Body)
+	}
+	check("session after revoking all", phone, http.StatusUnauthorized)
+	check("other user's session after revoking all", other, http.StatusOK)
+}
+
+func TestPruneSessions(t *testing.T) {
+	s := newTestState(t)
+	admin, _ := getUserByUsername(s.DB, "admin")
+	current := sessionID(t, newTestSession(t, s, admin))
+	expired := sessionID(t, newTestSession(t, s, admin))
+	if err := dbWriter.WriteSync(func(db *sql.DB) error {
+		_, err := db.Exec(`UPDATE sessions SET expires_at = ? WHERE id = ?`, time.Now().Add(-time.Hour).UTC().Format(time.RFC3339), expired)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func() int {
+		var n int
+		if err := s.DB.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if err := PruneSessions(s.DB, GetJWTSecret()); err != nil {
+		t.Fatal(err)
+	}
+	if ss, _ := getSession(s.DB, current); ss == nil || count() != 1 {
+		t.Fatalf("expected only %s to remain, %d sessions left", current, count())
+	}
+
+	// A new JWT secret invalidates every session signed with the old one
+	if err := PruneSessions(s.DB, "rotated-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 0 {
+		t.Fatalf("%d sessions of the old secret left", n)
+	}
+}
+
+func TestWSTickets(t *testing.T) {
+	tickets := NewWSTickets()
+	now := time.Now()
+
+	ticket := tickets.Issue("user", "session", now)
+	if userID, sessionID, ok := tickets.Redeem(ticket, now.Add(time.Second)); !ok || userID != "user" || sessionID != "session" {
+		t.Fatalf("redeem: %q %q %v", userID, sessionID, ok)
+	}
+	if _, _, ok := tickets.Redeem(ticket, now.Add(time.Second)); ok {
+		t.Fatal("ticket redeemed twice")
+	}
+
+	ticket = tickets.Issue("user", "session", now)
+	if _, _, ok := tickets.Redeem(ticket, now.Add(wsTicketLifetime)); ok {
+		t.Fatal("expired ticket redeemed")
+	}
+}
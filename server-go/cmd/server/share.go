@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ============================================================================
+// Share Links
+// ============================================================================
+//
+// A share link gives whoever has it read-only access to the history and live updates of a few
+// servers, listed by ID or as the servers of a group dimension option, without an account.
+// The link token is the link ID signed with the JWT secret, so admins can look it up again, and
+// it stops working when the link is deleted or expires, or the secret changes. Links with a
+// password are unlocked first, which hands out an access token valid for shareAccessLifetime.
+
+const shareAccessLifetime = 12 * time.Hour
+
+type ShareLink struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	ServerIDs   []string `json:"server_ids,omitempty"`
+	DimensionID string   `json:"dimension_id,omitempty"`
+	OptionID    string   `json:"option_id,omitempty"`
+	HasPassword bool     `json:"has_password"`
+	ExpiresAt   string   `json:"expires_at,omitempty"`
+	CreatedBy   string   `json:"created_by"`
+	CreatedAt   string   `json:"created_at"`
+	Token       string   `json:"token"`
+
+	passwordHash string
+}
+
+func (l *ShareLink) Expired(now time.Time) bool {
+	if l.ExpiresAt == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, l.ExpiresAt)
+	return err != nil || !now.Before(expiresAt)
+}
+
+func (l *ShareLink) SetPassword(password string) error {
+	if password == "" {
+		l.passwordHash, l.HasPassword = "", false
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	l.passwordHash, l.HasPassword = string(hash), true
+	return nil
+}
+
+func (l *ShareLink) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(l.passwordHash), []byte(password)) == nil
+}
+
+// scope returns the IDs of the servers the link shares, "local" for the dashboard server.
+// Servers of a group option are resolved against the current configuration.
+func (l *ShareLink) scope(config *AppConfig) map[string]bool {
+	scope := make(map[string]bool)
+	if l.DimensionID == "" {
+		for _, id := range l.ServerIDs {
+			scope[id] = true
+		}
+		return scope
+	}
+	if config.LocalNode.GroupValues[l.DimensionID] == l.OptionID {
+		scope["local"] = true
+	}
+	for _, server := range config.Servers {
+		if server.GroupValues[l.DimensionID] == l.OptionID {
+			scope[server.ID] = true
+		}
+	}
+	return scope
+}
+
+// shareToken signs a link ID; the token is "<id>.<signature>"
+func shareToken(id string) string {
+	return id + "." + shareSignature(id)
+}
+
+func shareSignature(id string) string {
+	mac := hmac.New(sha256.New, []byte(GetJWTSecret()))
+	mac.Write([]byte("share:" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseShareToken returns the link ID of a correctly signed token
+func parseShareToken(token string) (string, bool) {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(shareSignature(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+// newShareAccessToken issues the access token of an unlocked link; it expires with the link
+func newShareAccessToken(l *ShareLink, now time.Time) (string, time.Time, error) {
+	expiresAt := now.Add(shareAccessLifetime)
+	if t, err := time.Parse(time.RFC3339, l.ExpiresAt); err == nil && t.Before(expiresAt) {
+		expiresAt = t
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"share": l.ID,
+		"iat":   now.Unix(),
+		"exp":   expiresAt.Unix(),
+	}).SignedString([]byte(GetJWTSecret()))
+	return token, expiresAt, err
+}
+
+// shareAccessExpiry checks an access token issued by newShareAccessToken for link id and
+// returns when it expires
+func shareAccessExpiry(id, tokenString string) (time.Time, bool) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(GetJWTSecret()), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return time.Time{}, false
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	share, _ := claims["share"].(string)
+	exp, err := claims.GetExpirationTime()
+	if share != id || err != nil {
+		return time.Time{}, false
+	}
+	return exp.Time, true
+}
+
+// ============================================================================
+// Share Link Persistence
+// ============================================================================
+
+const shareLinkColumns = `id, name, server_ids, dimension_id, option_id, password_hash, expires_at, created_by, created_at`
+
+func scanShareLink(row interface{ Scan(...interface{}) error }) (*ShareLink, error) {
+	var l ShareLink
+	var serverIDs string
+	if err := row.Scan(&l.ID, &l.Name, &serverIDs, &l.DimensionID, &l.OptionID, &l.passwordHash,
+		&l.ExpiresAt, &l.CreatedBy, &l.CreatedAt); err != nil {
+		return nil, err
+	}
+	if serverIDs != "" {
+		l.ServerIDs = strings.Split(serverIDs, ",")
+	}
+	l.HasPassword = l.passwordHash != ""
+	l.Token = shareToken(l.ID)
+	return &l, nil
+}
+
+func listShareLinks(db *sql.DB) ([]*ShareLink, error) {
+	rows, err := db.Query(`SELECT ` + shareLinkColumns + ` FROM share_links ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*ShareLink{}
+	for rows.Next() {
+		l, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// getShareLink returns nil when there is no such link
+func getShareLink(db *sql.DB, id string) (*ShareLink, error) {
+	l, err := scanShareLink(db.QueryRow(`SELECT `+shareLinkColumns+` FROM share_links WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return l, err
+}
+
+func saveShareLink(db *sql.DB, l *ShareLink) error {
+	_, err := db.Exec(`INSERT INTO share_links (`+shareLinkColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		l.ID, l.Name, strings.Join(l.ServerIDs, ","), l.DimensionID, l.OptionID, l.passwordHash,
+		l.ExpiresAt, l.CreatedBy, l.CreatedAt)
+	return err
+}
+
+func deleteShareLink(db *sql.DB, id string) (bool, error) {
+	res, err := db.Exec(`DELETE FROM share_links WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
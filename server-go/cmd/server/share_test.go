@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useJWTSecret sets the JWT secret for the rest of the test
+func useJWTSecret(t *testing.T, secret string) {
+	t.Helper()
+	previous := GetJWTSecret()
+	InitJWTSecret(secret)
+	t.Cleanup(func() { InitJWTSecret(previous) })
+}
+
+func TestShareToken(t *testing.T) {
+	useJWTSecret(t, "share-secret")
+	token := shareToken("link-1")
+
+	if id, ok := parseShareToken(token); !ok || id != "link-1" {
+		t.Fatalf("parse: %q %v", id, ok)
+	}
+	for name, bad := range map[string]string{
+		"other id":        "link-2" + strings.TrimPrefix(token, "link-1"),
+		"bad signature":   token[:len(token)-2] + "xx",
+		"no signature":    "link-1",
+		"empty signature": "link-1.",
+	} {
+		if _, ok := parseShareToken(bad); ok {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+
+	// Rotating the JWT secret invalidates every link token
+	InitJWTSecret("rotated-secret")
+	if _, ok := parseShareToken(token); ok {
+		t.Fatal("token accepted after the secret changed")
+	}
+}
+
+func TestShareAccessToken(t *testing.T) {
+	useJWTSecret(t, "share-secret")
+	now := time.Now().UTC()
+
+	link := &ShareLink{ID: "link-1"}
+	token, expiresAt, err := newShareAccessToken(link, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.Equal(now.Add(shareAccessLifetime)) {
+		t.Fatalf("expires at %v", expiresAt)
+	}
+	if _, ok := shareAccessExpiry("link-1", token); !ok {
+		t.Fatal("access token refused")
+	}
+	if _, ok := shareAccessExpiry("link-2", token); ok {
+		t.Fatal("access token accepted for another link")
+	}
+
+	// Access ends with the link
+	link.ExpiresAt = now.Add(time.Hour).Format(time.RFC3339)
+	if _, expiresAt, _ := newShareAccessToken(link, now); !expiresAt.Equal(now.Add(time.Hour).Truncate(time.Second)) {
+		t.Fatalf("access outlives the link: %v", expiresAt)
+	}
+
+	// Expired access tokens are refused
+	expired, _, _ := newShareAccessToken(&ShareLink{ID: "link-1"}, now.Add(-shareAccessLifetime-time.Minute))
+	if _, ok := shareAccessExpiry("link-1", expired); ok {
+		t.Fatal("expired access token accepted")
+	}
+}
+
+func TestShareLinkAccess(t *testing.T) {
+	s := newTestState(t)
+	s.LoginGuard = NewLoginGuard()
+	s.Config.Servers = []RemoteServer{
+		{ID: "a", Name: "web-1", GroupValues: map[string]string{"region": "eu"}},
+		{ID: "b", Name: "db-1", GroupValues: map[string]string{"region": "us"}},
+	}
+	now := time.Now().UTC()
+	links := map[string]*ShareLink{
+		"servers": {ID: "l1", ServerIDs: []string{"b"}},
+		"group":   {ID: "l2", DimensionID: "region", OptionID: "eu"},
+		"expired": {ID: "l3", ServerIDs: []string{"a"}, ExpiresAt: now.Add(-time.Minute).Format(time.RFC3339)},
+		"locked":  {ID: "l4", ServerIDs: []string{"a"}},
+	}
+	if err := links["locked"].SetPassword("secret"); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range links {
+		link.CreatedAt = now.Format(time.RFC3339)
+		if err := saveShareLink(s.DB, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := gin.New()
+	r.GET("/api/share/:token", s.GetShare)
+	r.POST("/api/share/:token/unlock", s.UnlockShare)
+	get := func(link *ShareLink, access string) (int, []string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/share/"+shareToken(link.ID), nil)
+		if access != "" {
+			req.Header.Set("Authorization", "Bearer "+access)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp ShareResponse
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var ids []string
+		for _, u := range resp.Servers {
+			ids = append(ids, u.ServerID)
+		}
+		return w.Code, ids
+	}
+	unlock := func(link *ShareLink, password string) (int, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/share/"+shareToken(link.ID)+"/unlock",
+			strings.NewReader(`{"password":"`+password+`"}`)))
+		var resp struct {
+			AccessToken string `json:"access_token"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp.AccessToken
+	}
+
+	if code, ids := get(links["servers"], ""); code != http.StatusOK || len(ids) != 1 || ids[0] != "b" {
+		t.Fatalf("server link: %d %v", code, ids)
+	}
+	if code, ids := get(links["group"], ""); code != http.StatusOK || len(ids) != 1 || ids[0] != "a" {
+		t.Fatalf("group link: %d %v", code, ids)
+	}
+	if code, _ := get(links["expired"], ""); code != http.StatusNotFound {
+		t.Fatalf("expired link: %d", code)
+	}
+	if code, _ := get(&ShareLink{ID: "unknown"}, ""); code != http.StatusNotFound {
+		t.Fatalf("unknown link: %d", code)
+	}
+
+	if code, _ := get(links["locked"], ""); code != http.StatusUnauthorized {
+		t.Fatalf("locked link without access token: %d", code)
+	}
+	if code, _ := unlock(links["locked"], "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: %d", code)
+	}
+	code, access := unlock(links["locked"], "secret")
+	if code != http.StatusOK || access == "" {
+		t.Fatalf("unlock: %d", code)
+	}
+	if code, ids := get(links["locked"], access); code != http.StatusOK || len(ids) != 1 {
+		t.Fatalf("locked link with access token: %d %v", code, ids)
+	}
+	// An access token only opens the link it was issued for
+	if _, other := unlock(links["servers"], ""); other == "" {
+		t.Fatal("no access token for a link without password")
+	} else if code, _ := get(links["locked"], other); code != http.StatusUnauthorized {
+		t.Fatalf("access token of another link: %d", code)
+	}
+}
@@ -4,7 +4,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"os/signal"
@@ -13,7 +12,7 @@ import (
 )
 
 // SetupSignalHandler sets up signal handlers for graceful operations
-// SIGHUP: Reload password from config file
+// SIGHUP: Reload the JWT secret from the config file
 func SetupSignalHandler(state *AppState) {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGHUP)
@@ -29,38 +28,29 @@ func SetupSignalHandler(state *AppState) {
 	}()
 }
 
-// reloadConfig reloads the configuration from disk
+// reloadConfig reloads the JWT secret from the config file. Passwords are read from the
+// database on every login, so a reset takes effect without a reload.
 func reloadConfig(state *AppState) {
-	path := GetConfigPath()
-	data, err := os.ReadFile(path)
+	fileConfig, err := readConfigFile()
 	if err != nil {
 		fmt.Printf("❌ Failed to read config: %v\n", err)
 		return
 	}
 
-	var newConfig AppConfig
-	if err := json.Unmarshal(data, &newConfig); err != nil {
-		fmt.Printf("❌ Failed to parse config: %v\n", err)
-		return
-	}
-
-	// Validate the new password hash
-	if len(newConfig.AdminPasswordHash) < 4 ||
-		(newConfig.AdminPasswordHash[:3] != "$2a" && newConfig.AdminPasswordHash[:3] != "$2b") {
-		fmt.Println("❌ Invalid password hash format in config")
-		return
-	}
-
 	// Update the config in memory
 	state.ConfigMu.Lock()
-	state.Config.AdminPasswordHash = newConfig.AdminPasswordHash
-	if newConfig.JWTSecret != "" {
-		state.Config.JWTSecret = newConfig.JWTSecret
-		InitJWTSecret(newConfig.JWTSecret)
+	if fileConfig != nil && fileConfig.JWTSecret != "" {
+		state.Config.JWTSecret = fileConfig.JWTSecret
+		InitJWTSecret(fileConfig.JWTSecret)
 	}
 	state.ConfigMu.Unlock()
 
-	fmt.Println("✅ Config reloaded successfully - new password is now active")
+	// Sessions signed with a rotated secret are dropped
+	if err := PruneSessions(state.DB, GetJWTSecret()); err != nil {
+		fmt.Printf("❌ Failed to prune sessions: %v\n", err)
+	}
+
+	fmt.Println("✅ Config reloaded successfully")
 }
 
 // SignalError represents different types of signal errors
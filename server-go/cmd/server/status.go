@@ -0,0 +1,624 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"vstats/internal/common"
+)
+
+// ============================================================================
+// Status Page
+// ============================================================================
+//
+// The status page lists components chosen by an admin, each backed by a server or by one ping
+// target of a server. Their status follows connectivity: an offline server is a major outage
+// and a ping target losing packets is degraded or down; a ping component without current
+// results follows its server. Open incidents raise the status of the components they affect to
+// their impact. Maintenance windows show their components as under maintenance, keep alerts of
+// the servers behind them from firing and mark downtime within them as planned, which does not
+// count against availability.
+
+// Component statuses, from best to worst
+const (
+	ComponentOperational = "operational"
+	ComponentMaintenance = "under_maintenance"
+	ComponentDegraded    = "degraded_performance"
+	ComponentPartial     = "partial_outage"
+	ComponentMajor       = "major_outage"
+)
+
+var componentStatusRank = map[string]int{
+	ComponentOperational: 0,
+	ComponentMaintenance: 1,
+	ComponentDegraded:    2,
+	ComponentPartial:     3,
+	ComponentMajor:       4,
+}
+
+// Incident impacts
+const (
+	IncidentImpactNone     = "none"
+	IncidentImpactMinor    = "minor"
+	IncidentImpactMajor    = "major"
+	IncidentImpactCritical = "critical"
+)
+
+// incidentImpactStatus is the status an open incident gives the components it affects
+var incidentImpactStatus = map[string]string{
+	IncidentImpactNone:     ComponentOperational,
+	IncidentImpactMinor:    ComponentDegraded,
+	IncidentImpactMajor:    ComponentPartial,
+	IncidentImpactCritical: ComponentMajor,
+}
+
+// Incident statuses; every update of the timeline sets one
+const (
+	IncidentInvestigating = "investigating"
+	IncidentIdentified    = "identified"
+	IncidentMonitoring    = "monitoring"
+	IncidentResolved      = "resolved"
+)
+
+var incidentStatuses = map[string]bool{
+	IncidentInvestigating: true,
+	IncidentIdentified:    true,
+	IncidentMonitoring:    true,
+	IncidentResolved:      true,
+}
+
+// Maintenance window states, derived from the schedule
+const (
+	MaintenanceScheduled  = "scheduled"
+	MaintenanceInProgress = "in_progress"
+	MaintenanceCompleted  = "completed"
+)
+
+const (
+	statusPingPartialLoss = 50                  // packet loss (%) from which a ping component is a partial outage; any loss degrades it
+	statusIncidentHistory = 14 * 24 * time.Hour // resolved incidents stay on the page this long
+	statusMaxDays         = 90                  // longest uptime history shown per component
+)
+
+// Incident is a manually reported problem with a timeline of updates
+type Incident struct {
+	ID           string           `json:"id"`
+	Title        string           `json:"title"`
+	Impact       string           `json:"impact"` // none, minor, major, critical
+	Status       string           `json:"status"` // Status of the latest update
+	ComponentIDs []string         `json:"component_ids"`
+	CreatedBy    string           `json:"created_by,omitempty"`
+	CreatedAt    string           `json:"created_at"`
+	UpdatedAt    string           `json:"updated_at"`
+	ResolvedAt   string           `json:"resolved_at,omitempty"`
+	Updates      []IncidentUpdate `json:"updates"` // Newest first
+}
+
+type IncidentUpdate struct {
+	ID        int64  `json:"id"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	CreatedBy string `json:"created_by,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+func (inc *Incident) Open() bool {
+	return inc.ResolvedAt == ""
+}
+
+// MaintenanceWindow is planned work on some components
+type MaintenanceWindow struct {
+	ID           string   `json:"id"`
+	Title        string   `json:"title"`
+	Description  string   `json:"description,omitempty"`
+	ComponentIDs []string `json:"component_ids"`
+	StartsAt     string   `json:"starts_at"`
+	EndsAt       string   `json:"ends_at"`
+	Status       string   `json:"status"` // scheduled, in_progress or completed when loaded
+	CreatedBy    string   `json:"created_by,omitempty"`
+	CreatedAt    string   `json:"created_at"`
+	UpdatedAt    string   `json:"updated_at"`
+}
+
+func (w *MaintenanceWindow) span() (time.Time, time.Time, bool) {
+	start, err1 := time.Parse(time.RFC3339, w.StartsAt)
+	end, err2 := time.Parse(time.RFC3339, w.EndsAt)
+	return start, end, err1 == nil && err2 == nil
+}
+
+func (w *MaintenanceWindow) State(now time.Time) string {
+	start, end, _ := w.span()
+	switch {
+	case now.Before(start):
+		return MaintenanceScheduled
+	case now.Before(end):
+		return MaintenanceInProgress
+	}
+	return MaintenanceCompleted
+}
+
+// validate fills in missing component IDs and checks the components against the configured servers
+func (p *StatusPageSettings) validate(config *AppConfig) error {
+	if p.PageURL != "" {
+		if u, err := url.Parse(p.PageURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("page_url must be an http(s) URL")
+		}
+	}
+
+	known := map[string]bool{"local": true}
+	for _, server := range config.Servers {
+		known[server.ID] = true
+	}
+	seen := make(map[string]bool)
+	for i := range p.Components {
+		comp := &p.Components[i]
+		if comp.ID == "" {
+			comp.ID = uuid.New().String()
+		}
+		if seen[comp.ID] {
+			return fmt.Errorf("duplicate component id: %s", comp.ID)
+		}
+		seen[comp.ID] = true
+		if strings.TrimSpace(comp.Name) == "" {
+			return fmt.Errorf("component name is required")
+		}
+		if !known[comp.ServerID] {
+			return fmt.Errorf("server not found: %s", comp.ServerID)
+		}
+	}
+	if p.Components == nil {
+		p.Components = []StatusComponent{}
+	}
+	return nil
+}
+
+// ============================================================================
+// Component Status
+// ============================================================================
+
+// worseStatus returns the worse of two component statuses
+func worseStatus(a, b string) string {
+	if componentStatusRank[b] > componentStatusRank[a] {
+		return b
+	}
+	return a
+}
+
+// connectivityStatus derives the status of a component from its server being online and the
+// latest metrics of the server
+func (comp *StatusComponent) connectivityStatus(online bool, metrics *SystemMetrics) string {
+	if !online {
+		return ComponentMajor
+	}
+	if comp.PingTarget == "" || metrics == nil || metrics.Ping == nil {
+		return ComponentOperational
+	}
+	for _, t := range metrics.Ping.Targets {
+		if t.Name != comp.PingTarget {
+			continue
+		}
+		switch {
+		case t.Status != "ok" || t.PacketLoss >= 100:
+			return ComponentMajor
+		case t.PacketLoss >= statusPingPartialLoss:
+			return ComponentPartial
+		case t.PacketLoss > 0:
+			return ComponentDegraded
+		}
+		return ComponentOperational
+	}
+	return ComponentOperational
+}
+
+// status applies maintenance windows in progress and open incidents to the connectivity status
+func (comp *StatusComponent) status(connectivity string, windows []MaintenanceWindow, incidents []Incident, now time.Time) string {
+	status := connectivity
+	for i := range windows {
+		if windows[i].State(now) == MaintenanceInProgress && slices.Contains(windows[i].ComponentIDs, comp.ID) {
+			status = ComponentMaintenance
+		}
+	}
+	for i := range incidents {
+		if incidents[i].Open() && slices.Contains(incidents[i].ComponentIDs, comp.ID) {
+			status = worseStatus(status, incidentImpactStatus[incidents[i].Impact])
+		}
+	}
+	return status
+}
+
+// ============================================================================
+// Maintenance Schedule
+// ============================================================================
+
+// maintenanceSpan is the time a maintenance window covers a server
+type maintenanceSpan struct {
+	serverID   string
+	pingOnly   bool // Only ping components of the server are in the window
+	start, end time.Time
+}
+
+var (
+	activeMaintenanceMu sync.RWMutex
+	activeMaintenance   []maintenanceSpan
+)
+
+// SetActiveMaintenance publishes the maintenance windows that alerts and downtime are checked against
+func SetActiveMaintenance(components []StatusComponent, windows []MaintenanceWindow) {
+	byID := make(map[string]StatusComponent, len(components))
+	for _, comp := range components {
+		byID[comp.ID] = comp
+	}
+
+	var spans []maintenanceSpan
+	for i := range windows {
+		start, end, ok := windows[i].span()
+		if !ok {
+			continue
+		}
+		for _, id := range windows[i].ComponentIDs {
+			if comp, ok := byID[id]; ok {
+				spans = append(spans, maintenanceSpan{serverID: comp.ServerID, pingOnly: comp.PingTarget != "", start: start, end: end})
+			}
+		}
+	}
+
+	activeMaintenanceMu.Lock()
+	activeMaintenance = spans
+	activeMaintenanceMu.Unlock()
+}
+
+// maintenanceAt reports whether a server, or only ping targets of it, are under maintenance at t
+func maintenanceAt(serverID string, t time.Time) (server, ping bool) {
+	activeMaintenanceMu.RLock()
+	defer activeMaintenanceMu.RUnlock()
+	for _, sp := range activeMaintenance {
+		if sp.serverID != serverID || t.Before(sp.start) || !t.Before(sp.end) {
+			continue
+		}
+		if sp.pingOnly {
+			ping = true
+		} else {
+			server = true
+		}
+	}
+	return server, ping
+}
+
+// plannedDowntime returns how much of [start, end) falls within maintenance windows of a server
+func plannedDowntime(serverID string, start, end time.Time) time.Duration {
+	var overlaps []maintenanceSpan
+	activeMaintenanceMu.RLock()
+	for _, sp := range activeMaintenance {
+		if sp.serverID != serverID || sp.pingOnly || !sp.start.Before(end) || !start.Before(sp.end) {
+			continue
+		}
+		if sp.start.Before(start) {
+			sp.start = start
+		}
+		if sp.end.After(end) {
+			sp.end = end
+		}
+		overlaps = append(overlaps, sp)
+	}
+	activeMaintenanceMu.RUnlock()
+
+	// Overlapping windows count once
+	sort.Slice(overlaps, func(i, j int) bool { return overlaps[i].start.Before(overlaps[j].start) })
+	var total time.Duration
+	var covered time.Time
+	for _, sp := range overlaps {
+		if sp.start.Before(covered) {
+			sp.start = covered
+		}
+		if sp.end.After(sp.start) {
+			total += sp.end.Sub(sp.start)
+			covered = sp.end
+		}
+	}
+	return total
+}
+
+// reloadMaintenance publishes the stored maintenance windows with the current components
+func (s *AppState) reloadMaintenance() error {
+	windows, err := listMaintenanceWindows(s.DB, time.Time{})
+	if err != nil {
+		return err
+	}
+	s.ConfigMu.RLock()
+	components := s.Config.StatusPage.Components
+	s.ConfigMu.RUnlock()
+	SetActiveMaintenance(components, windows)
+	return nil
+}
+
+// ============================================================================
+// Component Uptime
+// ============================================================================
+
+// dailyUptime returns the uptime per UTC day since from, as filled in by FillDailyUptime
+func dailyUptime(db *sql.DB, serverID string, from time.Time) (map[string]float64, error) {
+	rows, err := db.Query(`SELECT date, uptime_percent FROM metrics_daily WHERE server_id = ? AND date >= ?`,
+		serverID, from.UTC().Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := make(map[string]float64)
+	for rows.Next() {
+		var date string
+		var uptime float64
+		if err := rows.Scan(&date, &uptime); err != nil {
+			return nil, err
+		}
+		days[date] = uptime
+	}
+	return days, rows.Err()
+}
+
+// pingDailyAvailability returns the success ratio of a ping target of a server in [from, to),
+// overall and per UTC day
+func pingDailyAvailability(st Storage, serverID, target string, from, to time.Time) (*float64, map[string]float64, error) {
+	gran := pickAvailabilityGranularity(from, time.Now())
+	type counts struct{ ok, fail int64 }
+	var total counts
+	perDay := make(map[string]*counts)
+	err := st.ScanPingBuckets(serverID, gran.Name, from.Unix()/gran.BucketSecs, (to.Unix()+gran.BucketSecs-1)/gran.BucketSecs-1, func(p *common.PingBucketData) error {
+		if p.TargetName != target {
+			return nil
+		}
+		day := time.Unix(p.Bucket*gran.BucketSecs, 0).UTC().Format("2006-01-02")
+		if perDay[day] == nil {
+			perDay[day] = &counts{}
+		}
+		perDay[day].ok += int64(p.OkCount)
+		perDay[day].fail += int64(p.FailCount)
+		total.ok += int64(p.OkCount)
+		total.fail += int64(p.FailCount)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	days := make(map[string]float64, len(perDay))
+	for day, c := range perDay {
+		if p := percentOf(c.ok, c.ok+c.fail); p != nil {
+			days[day] = *p
+		}
+	}
+	return percentOf(total.ok, total.ok+total.fail), days, nil
+}
+
+// ============================================================================
+// Status Page Persistence
+// ============================================================================
+
+const incidentColumns = `id, title, impact, status, component_ids, created_by, created_at, updated_at, resolved_at`
+
+func splitIDs(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+func scanIncident(row interface{ Scan(...interface{}) error }) (*Incident, error) {
+	var inc Incident
+	var componentIDs string
+	if err := row.Scan(&inc.ID, &inc.Title, &inc.Impact, &inc.Status, &componentIDs, &inc.CreatedBy,
+		&inc.CreatedAt, &inc.UpdatedAt, &inc.ResolvedAt); err != nil {
+		return nil, err
+	}
+	inc.ComponentIDs = splitIDs(componentIDs)
+	inc.Updates = []IncidentUpdate{}
+	return &inc, nil
+}
+
+// IncidentFilter narrows down incident queries
+type IncidentFilter struct {
+	Since  time.Time // Only open incidents and those updated since
+	Limit  int
+	Offset int
+}
+
+// queryIncidents returns incidents with their updates, newest first
+func queryIncidents(db *sql.DB, f IncidentFilter) ([]Incident, error) {
+	query := `SELECT ` + incidentColumns + ` FROM status_incidents`
+	args := []interface{}{}
+	if !f.Since.IsZero() {
+		query += ` WHERE resolved_at = '' OR updated_at >= ?`
+		args = append(args, f.Since.UTC().Format(time.RFC3339))
+	}
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	query += ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	args = append(args, f.Limit, f.Offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	incidents := []Incident{}
+	for rows.Next() {
+		inc, err := scanIncident(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		incidents = append(incidents, *inc)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return incidents, loadIncidentUpdates(db, incidents)
+}
+
+// getIncident returns nil when there is no such incident
+func getIncident(db *sql.DB, id string) (*Incident, error) {
+	inc, err := scanIncident(db.QueryRow(`SELECT `+incidentColumns+` FROM status_incidents WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	incidents := []Incident{*inc}
+	if err := loadIncidentUpdates(db, incidents); err != nil {
+		return nil, err
+	}
+	return &incidents[0], nil
+}
+
+func loadIncidentUpdates(db *sql.DB, incidents []Incident) error {
+	if len(incidents) == 0 {
+		return nil
+	}
+	index := make(map[string]*Incident, len(incidents))
+	args := make([]interface{}, 0, len(incidents))
+	for i := range incidents {
+		index[incidents[i].ID] = &incidents[i]
+		args = append(args, incidents[i].ID)
+	}
+
+	rows, err := db.Query(`
+		SELECT incident_id, id, status, message, created_by, created_at FROM status_incident_updates
+		WHERE incident_id IN (?`+strings.Repeat(", ?", len(args)-1)+`)
+		ORDER BY id DESC`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var incidentID string
+		var u IncidentUpdate
+		if err := rows.Scan(&incidentID, &u.ID, &u.Status, &u.Message, &u.CreatedBy, &u.CreatedAt); err != nil {
+			return err
+		}
+		if inc := index[incidentID]; inc != nil {
+			inc.Updates = append(inc.Updates, u)
+		}
+	}
+	return rows.Err()
+}
+
+func saveIncident(tx *sql.Tx, inc *Incident) error {
+	_, err := tx.Exec(`
+		INSERT INTO status_incidents (`+incidentColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			title = excluded.title,
+			impact = excluded.impact,
+			status = excluded.status,
+			component_ids = excluded.component_ids,
+			updated_at = excluded.updated_at,
+			resolved_at = excluded.resolved_at`,
+		inc.ID, inc.Title, inc.Impact, inc.Status, strings.Join(inc.ComponentIDs, ","), inc.CreatedBy,
+		inc.CreatedAt, inc.UpdatedAt, inc.ResolvedAt)
+	return err
+}
+
+func insertIncidentUpdate(tx *sql.Tx, incidentID string, u *IncidentUpdate) error {
+	res, err := tx.Exec(`
+		INSERT INTO status_incident_updates (incident_id, status, message, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		incidentID, u.Status, u.Message, u.CreatedBy, u.CreatedAt)
+	if err != nil {
+		return err
+	}
+	u.ID, err = res.LastInsertId()
+	return err
+}
+
+func deleteIncident(tx *sql.Tx, id string) (bool, error) {
+	if _, err := tx.Exec(`DELETE FROM status_incident_updates WHERE incident_id = ?`, id); err != nil {
+		return false, err
+	}
+	res, err := tx.Exec(`DELETE FROM status_incidents WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+const maintenanceColumns = `id, title, description, component_ids, starts_at, ends_at, created_by, created_at, updated_at`
+
+func scanMaintenanceWindow(row interface{ Scan(...interface{}) error }) (*MaintenanceWindow, error) {
+	var w MaintenanceWindow
+	var componentIDs string
+	if err := row.Scan(&w.ID, &w.Title, &w.Description, &componentIDs, &w.StartsAt, &w.EndsAt,
+		&w.CreatedBy, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		return nil, err
+	}
+	w.ComponentIDs = splitIDs(componentIDs)
+	w.Status = w.State(time.Now())
+	return &w, nil
+}
+
+// listMaintenanceWindows returns the windows ending after endsAfter (all for a zero time), by start
+func listMaintenanceWindows(db *sql.DB, endsAfter time.Time) ([]MaintenanceWindow, error) {
+	query := `SELECT ` + maintenanceColumns + ` FROM maintenance_windows`
+	args := []interface{}{}
+	if !endsAfter.IsZero() {
+		query += ` WHERE ends_at > ?`
+		args = append(args, endsAfter.UTC().Format(time.RFC3339))
+	}
+	rows, err := db.Query(query+` ORDER BY starts_at`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	windows := []MaintenanceWindow{}
+	for rows.Next() {
+		w, err := scanMaintenanceWindow(rows)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, *w)
+	}
+	return windows, rows.Err()
+}
+
+// getMaintenanceWindow returns nil when there is no such window
+func getMaintenanceWindow(db *sql.DB, id string) (*MaintenanceWindow, error) {
+	w, err := scanMaintenanceWindow(db.QueryRow(`SELECT `+maintenanceColumns+` FROM maintenance_windows WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return w, err
+}
+
+func saveMaintenanceWindow(db *sql.DB, w *MaintenanceWindow) error {
+	_, err := db.Exec(`
+		INSERT INTO maintenance_windows (`+maintenanceColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			title = excluded.title,
+			description = excluded.description,
+			component_ids = excluded.component_ids,
+			starts_at = excluded.starts_at,
+			ends_at = excluded.ends_at,
+			updated_at = excluded.updated_at`,
+		w.ID, w.Title, w.Description, strings.Join(w.ComponentIDs, ","), w.StartsAt, w.EndsAt,
+		w.CreatedBy, w.CreatedAt, w.UpdatedAt)
+	return err
+}
+
+func deleteMaintenanceWindow(db *sql.DB, id string) (bool, error) {
+	res, err := db.Exec(`DELETE FROM maintenance_windows WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// Status Feeds
+// ============================================================================
+//
+// Subscribers follow the status page as JSON Feed (https://jsonfeed.org/version/1.1), RSS 2.0
+// or Atom. Every incident and maintenance window is one item that keeps its ID and changes its
+// modification time with every update, so feed readers show it again.
+
+const statusFeedItems = 50
+
+// statusFeedItem is an incident or maintenance window in the shape shared by all formats
+type statusFeedItem struct {
+	ID        string
+	URL       string
+	Title     string
+	Content   string // Plain text
+	Published time.Time
+	Updated   time.Time
+	Tags      []string
+}
+
+// statusLabel turns a status such as under_maintenance into "Under maintenance"
+func statusLabel(status string) string {
+	label := strings.ReplaceAll(status, "_", " ")
+	if label == "" {
+		return label
+	}
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+func formatFeedTime(ts string) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return ts
+	}
+	return t.UTC().Format("2006-01-02 15:04 UTC")
+}
+
+func parseFeedTime(ts string) time.Time {
+	t, _ := time.Parse(time.RFC3339, ts)
+	return t.UTC()
+}
+
+func incidentFeedItem(inc *Incident, pageURL string) statusFeedItem {
+	var content strings.Builder
+	for i, u := range inc.Updates {
+		if i > 0 {
+			content.WriteString("\n\n")
+		}
+		fmt.Fprintf(&content, "%s - %s\n%s", statusLabel(u.Status), formatFeedTime(u.CreatedAt), u.Message)
+	}
+	return statusFeedItem{
+		ID:        pageURL + "#incident-" + inc.ID,
+		URL:       pageURL + "#incident-" + inc.ID,
+		Title:     fmt.Sprintf("%s (%s)", inc.Title, statusLabel(inc.Status)),
+		Content:   content.String(),
+		Published: parseFeedTime(inc.CreatedAt),
+		Updated:   parseFeedTime(inc.UpdatedAt),
+		Tags:      []string{"incident", inc.Impact, inc.Status},
+	}
+}
+
+func maintenanceFeedItem(w *MaintenanceWindow, pageURL string) statusFeedItem {
+	content := fmt.Sprintf("%s: %s to %s", statusLabel(w.Status), formatFeedTime(w.StartsAt), formatFeedTime(w.EndsAt))
+	if w.Description != "" {
+		content += "\n\n" + w.Description
+	}
+	return statusFeedItem{
+		ID:        pageURL + "#maintenance-" + w.ID,
+		URL:       pageURL + "#maintenance-" + w.ID,
+		Title:     fmt.Sprintf("Maintenance: %s (%s)", w.Title, statusLabel(w.Status)),
+		Content:   content,
+		Published: parseFeedTime(w.CreatedAt),
+		Updated:   parseFeedTime(w.UpdatedAt),
+		Tags:      []string{"maintenance", w.Status},
+	}
+}
+
+// statusFeedEntries merges incidents and maintenance windows, most recently updated first
+func statusFeedEntries(incidents []Incident, windows []MaintenanceWindow, pageURL string) []statusFeedItem {
+	items := make([]statusFeedItem, 0, len(incidents)+len(windows))
+	for i := range incidents {
+		items = append(items, incidentFeedItem(&incidents[i], pageURL))
+	}
+	for i := range windows {
+		items = append(items, maintenanceFeedItem(&windows[i], pageURL))
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Updated.After(items[j].Updated) })
+	if len(items) > statusFeedItems {
+		items = items[:statusFeedItems]
+	}
+	return items
+}
+
+// ============================================================================
+// Feed Formats
+// ============================================================================
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	ContentText   string   `json:"content_text"`
+	DatePublished string   `json:"date_published"`
+	DateModified  string   `json:"date_modified"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+func buildJSONFeed(title, description, pageURL, feedURL string, items []statusFeedItem) *jsonFeed {
+	feed := &jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       title,
+		HomePageURL: pageURL,
+		FeedURL:     feedURL,
+		Description: description,
+		Items:       make([]jsonFeedItem, 0, len(items)),
+	}
+	for _, item := range items {
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            item.ID,
+			URL:           item.URL,
+			Title:         item.Title,
+			ContentText:   item.Content,
+			DatePublished: item.Published.Format(time.RFC3339),
+			DateModified:  item.Updated.Format(time.RFC3339),
+			Tags:          item.Tags,
+		})
+	}
+	return feed
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func buildRSSFeed(title, description, pageURL string, items []statusFeedItem, now time.Time) *rssFeed {
+	if description == "" {
+		description = title
+	}
+	feed := &rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          pageURL,
+			Description:   description,
+			LastBuildDate: now.Format(time.RFC1123Z),
+		},
+	}
+	for _, item := range items {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			GUID:        rssGUID{Value: item.ID},
+			PubDate:     item.Updated.Format(time.RFC1123Z),
+			Description: item.Content,
+			Categories:  item.Tags,
+		})
+	}
+	return feed
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Author   atomAuthor  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Link       atomLink       `xml:"link"`
+	Content    atomContent    `xml:"content"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+func buildAtomFeed(title, description, pageURL, feedURL string, items []statusFeedItem, now time.Time) *atomFeed {
+	updated := now
+	if len(items) > 0 {
+		updated = items[0].Updated
+	}
+	feed := &atomFeed{
+		ID:       feedURL,
+		Title:    title,
+		Subtitle: description,
+		Updated:  updated.Format(time.RFC3339),
+		Author:   atomAuthor{Name: title},
+		Links:    []atomLink{{Href: pageURL}, {Href: feedURL, Rel: "self"}},
+	}
+	for _, item := range items {
+		entry := atomEntry{
+			ID:        item.ID,
+			Title:     item.Title,
+			Published: item.Published.Format(time.RFC3339),
+			Updated:   item.Updated.Format(time.RFC3339),
+			Link:      atomLink{Href: item.URL},
+			Content:   atomContent{Type: "text", Value: item.Content},
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
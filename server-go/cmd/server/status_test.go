@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestComponentStatus(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	server := StatusComponent{ID: "web", ServerID: "a"}
+	ping := StatusComponent{ID: "gw", ServerID: "a", PingTarget: "gateway"}
+	metrics := func(status string, loss float64) *SystemMetrics {
+		return &SystemMetrics{Ping: &PingMetrics{Targets: []PingTarget{{Name: "gateway", Status: status, PacketLoss: loss}}}}
+	}
+
+	connectivity := []struct {
+		name    string
+		comp    StatusComponent
+		online  bool
+		metrics *SystemMetrics
+		want    string
+	}{
+		{"server online", server, true, nil, ComponentOperational},
+		{"server offline", server, false, nil, ComponentMajor},
+		{"ping ok", ping, true, metrics("ok", 0), ComponentOperational},
+		{"ping loss", ping, true, metrics("ok", 10), ComponentDegraded},
+		{"ping heavy loss", ping, true, metrics("ok", statusPingPartialLoss), ComponentPartial},
+		{"ping down", ping, true, metrics("timeout", 0), ComponentMajor},
+		{"ping without results", ping, true, &SystemMetrics{}, ComponentOperational},
+		{"ping of offline server", ping, false, metrics("ok", 0), ComponentMajor},
+	}
+	for _, tc := range connectivity {
+		if got := tc.comp.connectivityStatus(tc.online, tc.metrics); got != tc.want {
+			t.Errorf("%s: %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	window := MaintenanceWindow{ComponentIDs: []string{"web"},
+		StartsAt: now.Add(-time.Hour).Format(time.RFC3339), EndsAt: now.Add(time.Hour).Format(time.RFC3339)}
+	minor := Incident{Impact: IncidentImpactMinor, ComponentIDs: []string{"web"}}
+	critical := Incident{Impact: IncidentImpactCritical, ComponentIDs: []string{"web"}}
+	resolved := Incident{Impact: IncidentImpactCritical, ComponentIDs: []string{"web"}, ResolvedAt: now.Format(time.RFC3339)}
+
+	applied := []struct {
+		name         string
+		connectivity string
+		windows      []MaintenanceWindow
+		incidents    []Incident
+		want         string
+	}{
+		{"maintenance hides outage", ComponentMajor, []MaintenanceWindow{window}, nil, ComponentMaintenance},
+		{"incident raises status", ComponentOperational, nil, []Incident{minor}, ComponentDegraded},
+		{"incident does not lower status", ComponentMajor, nil, []Incident{minor}, ComponentMajor},
+		{"worst incident wins", ComponentOperational, nil, []Incident{minor, critical}, ComponentMajor},
+		{"resolved incident", ComponentOperational, nil, []Incident{resolved}, ComponentOperational},
+		{"incident during maintenance", ComponentOperational, []MaintenanceWindow{window}, []Incident{minor}, ComponentDegraded},
+	}
+	for _, tc := range applied {
+		if got := server.status(tc.connectivity, tc.windows, tc.incidents, now); got != tc.want {
+			t.Errorf("%s: %s, want %s", tc.name, got, tc.want)
+		}
+	}
+	if got := ping.status(ComponentOperational, []MaintenanceWindow{window}, []Incident{critical}, now); got != ComponentOperational {
+		t.Errorf("other component affected: %s", got)
+	}
+}
+
+func TestMaintenanceSchedule(t *testing.T) {
+	t.Cleanup(func() { SetActiveMaintenance(nil, nil) })
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h int) string { return start.Add(time.Duration(h) * time.Hour).Format(time.RFC3339) }
+	components := []StatusComponent{
+		{ID: "web", ServerID: "a"},
+		{ID: "gw", ServerID: "b", PingTarget: "gateway"},
+	}
+	SetActiveMaintenance(components, []MaintenanceWindow{
+		{ComponentIDs: []string{"web"}, StartsAt: at(1), EndsAt: at(3)},
+		{ComponentIDs: []string{"web"}, StartsAt: at(2), EndsAt: at(4)}, // Overlaps the first
+		{ComponentIDs: []string{"gw"}, StartsAt: at(1), EndsAt: at(3)},
+		{ComponentIDs: []string{"unknown"}, StartsAt: at(1), EndsAt: at(3)},
+	})
+
+	if server, ping := maintenanceAt("a", start.Add(90*time.Minute)); !server || ping {
+		t.Errorf("server a: %v %v", server, ping)
+	}
+	if server, _ := maintenanceAt("a", start.Add(4*time.Hour)); server {
+		t.Error("window end is inclusive")
+	}
+	if server, ping := maintenanceAt("b", start.Add(90*time.Minute)); server || !ping {
+		t.Errorf("server b: %v %v", server, ping)
+	}
+
+	if d := plannedDowntime("a", start, start.Add(24*time.Hour)); d != 3*time.Hour {
+		t.Errorf("overlapping windows counted as %v", d)
+	}
+	if d := plannedDowntime("a", start.Add(150*time.Minute), start.Add(24*time.Hour)); d != 90*time.Minute {
+		t.Errorf("clipped windows counted as %v", d)
+	}
+	// Ping components do not make server downtime planned
+	if d := plannedDowntime("b", start, start.Add(24*time.Hour)); d != 0 {
+		t.Errorf("ping window counted as %v", d)
+	}
+}
+
+func TestStatusPageSettingsValidate(t *testing.T) {
+	config := &AppConfig{Servers: []RemoteServer{{ID: "a"}}}
+	cases := []struct {
+		name     string
+		settings StatusPageSettings
+		err      string
+	}{
+		{"valid", StatusPageSettings{Components: []StatusComponent{{Name: "Web", ServerID: "a"}, {Name: "Dashboard", ServerID: "local"}}}, ""},
+		{"unknown server", StatusPageSettings{Components: []StatusComponent{{Name: "Web", ServerID: "gone"}}}, "server not found"},
+		{"missing name", StatusPageSettings{Components: []StatusComponent{{ServerID: "a"}}}, "name is required"},
+		{"duplicate id", StatusPageSettings{Components: []StatusComponent{{ID: "x", Name: "A", ServerID: "a"}, {ID: "x", Name: "B", ServerID: "a"}}}, "duplicate"},
+		{"bad page url", StatusPageSettings{PageURL: "javascript:alert(1)"}, "page_url"},
+	}
+	for _, tc := range cases {
+		err := tc.settings.validate(config)
+		if tc.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+			} else if tc.settings.Components[0].ID == "" {
+				t.Errorf("%s: component ID not filled in", tc.name)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"vstats/internal/common"
+)
+
+// ============================================================================
+// Metrics Storage
+// ============================================================================
+//
+// Storage persists the metrics pipeline: raw samples, aggregated buckets, history
+// reads and retention cleanup. SQLite is the default backend; PostgreSQL can be
+// selected for large installations. Everything else (events, alerts, uptime and
+// settings tables) always stays in the local SQLite database.
+
+// Storage is implemented by sqliteStorage and postgresStorage
+type Storage interface {
+	// Driver returns StorageDriverSQLite or StorageDriverPostgres
+	Driver() string
+	Close() error
+
+	// StoreSamples writes raw samples and adds them to the 5sec/2min buckets; the write may be queued
+	StoreSamples(items []MetricsBufferItem) error
+	// StoreSample writes one sample unless its 5-second bucket is already stored; the write may be queued
+	StoreSample(serverID string, metrics *SystemMetrics) error
+	// StoreAggregates upserts agent-provided buckets, replacing sums and counts; the write may be queued
+	StoreAggregates(metrics map[AggBufferKey]*common.BucketData, ping map[PingBufferKey]*common.PingBucketData) error
+	// StoreRollup upserts server-built buckets without replacing buckets that hold more samples
+	StoreRollup(serverID string, granularities []common.GranularityData) error
+
+	// RollupRaw aggregates the raw samples in [from, to) (unix seconds) into buckets of interval seconds
+	RollupRaw(serverID, granularity string, interval, from, to int64) (common.GranularityData, error)
+	// ScanMetricBuckets calls fn for every bucket in [fromBucket, toBucket], oldest first
+	ScanMetricBuckets(serverID, granularity string, fromBucket, toBucket int64, fn func(*common.BucketData) error) error
+	// ScanPingBuckets calls fn for every ping bucket in [fromBucket, toBucket], ordered by target and bucket
+	ScanPingBuckets(serverID, granularity string, fromBucket, toBucket int64, fn func(*common.PingBucketData) error) error
+	// History and PingHistory serve the fixed dashboard ranges (1h, 24h, 7d, 30d, 1y)
+	History(serverID, rangeStr string, sinceBucket int64) ([]HistoryPoint, error)
+	PingHistory(serverID, rangeStr string, sinceBucket int64) ([]PingHistoryTarget, error)
+	// LastMetricsTime returns the time of the newest stored sample, or nil
+	LastMetricsTime(serverID string) *time.Time
+	// LastBuckets returns the newest bucket of every granularity, for resumable agent sync
+	LastBuckets(serverID string) map[string]int64
+	// PingTargets lists every ping target with recent or aggregated data
+	PingTargets() ([]PingTargetLabel, error)
+
+	// ApplyRetention deletes expired metrics rows, or only counts them when dryRun is set
+	ApplyRetention(settings RetentionSettings, servers []RemoteServer, now time.Time, dryRun bool) ([]*RetentionScopeReport, error)
+}
+
+// PingTargetLabel identifies a ping target across servers
+type PingTargetLabel struct {
+	Name string
+	Host string
+}
+
+const (
+	StorageDriverSQLite   = "sqlite"
+	StorageDriverPostgres = "postgres"
+)
+
+// Global metrics storage, set up after the config is loaded
+var metricsStore Storage
+
+// Resolve applies the VSTATS_DB_DRIVER and VSTATS_DATABASE_URL environment overrides.
+// A database URL without a driver selects PostgreSQL.
+func (s StorageSettings) Resolve() StorageSettings {
+	if driver := os.Getenv("VSTATS_DB_DRIVER"); driver != "" {
+		s.Driver = driver
+	}
+	if url := os.Getenv("VSTATS_DATABASE_URL"); url != "" {
+		s.DatabaseURL = url
+	}
+	s.Driver = strings.ToLower(strings.TrimSpace(s.Driver))
+	if s.Driver == "" {
+		s.Driver = StorageDriverSQLite
+		if s.DatabaseURL != "" {
+			s.Driver = StorageDriverPostgres
+		}
+	}
+	if s.Driver == "postgresql" || s.Driver == "pgx" {
+		s.Driver = StorageDriverPostgres
+	}
+	return s
+}
+
+// OpenStorage returns the configured backend. The SQLite backend shares db (and dbWriter, when set).
+func OpenStorage(settings StorageSettings, db *sql.DB) (Storage, error) {
+	settings = settings.Resolve()
+	switch settings.Driver {
+	case StorageDriverSQLite:
+		return &sqliteStorage{db: db}, nil
+	case StorageDriverPostgres:
+		if settings.DatabaseURL == "" {
+			return nil, fmt.Errorf("postgres storage requires a database URL (storage.database_url or VSTATS_DATABASE_URL)")
+		}
+		return openPostgresStorage(settings.DatabaseURL)
+	}
+	return nil, fmt.Errorf("unknown storage driver %q", settings.Driver)
+}
+
+// ============================================================================
+// SQLite Storage
+// ============================================================================
+
+// sqliteStorage keeps metrics in the local database; writes go through dbWriter when it is running
+type sqliteStorage struct {
+	db *sql.DB
+}
+
+func (s *sqliteStorage) Driver() string { return StorageDriverSQLite }
+
+// Close is a no-op: the database is shared with the rest of the server and closed by main
+func (s *sqliteStorage) Close() error { return nil }
+
+// write runs fn through dbWriter, or directly when no writer is running (e.g. the export command)
+func (s *sqliteStorage) write(async bool, fn func(*sql.DB) error) error {
+	if dbWriter == nil {
+		return fn(s.db)
+	}
+	if async {
+		dbWriter.WriteAsync(fn)
+		return nil
+	}
+	return dbWriter.WriteSync(fn)
+}
+
+func (s *sqliteStorage) StoreSamples(items []MetricsBufferItem) error {
+	return s.write(true, func(db *sql.DB) error {
+		return batchStoreMetrics(db, items)
+	})
+}
+
+func (s *sqliteStorage) StoreSample(serverID string, metrics *SystemMetrics) error {
+	m := *metrics
+	return s.write(true, func(db *sql.DB) error {
+		return storeMetricsWithDedupInternal(db, serverID, &m)
+	})
+}
+
+func (s *sqliteStorage) StoreAggregates(metrics map[AggBufferKey]*common.BucketData, ping map[PingBufferKey]*common.PingBucketData) error {
+	return s.write(true, func(db *sql.DB) error {
+		err := flushAggBufferToDB(db, metrics, ping)
+		if err != nil {
+			fmt.Printf("⚠️ Aggregation buffer flush error: %v\n", err)
+		}
+		return err
+	})
+}
+
+func (s *sqliteStorage) StoreRollup(serverID string, granularities []common.GranularityData) error {
+	return s.write(false, func(db *sql.DB) error {
+		return storeRollupBucketsInternal(db, serverID, granularities)
+	})
+}
+
+func (s *sqliteStorage) RollupRaw(serverID, granularity string, interval, from, to int64) (common.GranularityData, error) {
+	data := common.GranularityData{Granularity: granularity, Interval: int(interval)}
+	from5, to5 := from/5, (to+4)/5
+
+	rows, err := s.db.Query(`
+		SELECT bucket_5sec * 5 / ? AS b,
+			SUM(cpu_usage), MAX(cpu_usage), SUM(memory_usage), MAX(memory_usage), SUM(disk_usage),
+			MAX(net_rx), MAX(net_tx), COALESCE(SUM(ping_ms), 0), COUNT(ping_ms), COUNT(*)
+		FROM metrics_raw
+		WHERE server_id = ? AND bucket_5sec >= ? AND bucket_5sec < ?
+		GROUP BY b
+		ORDER BY b`, interval, serverID, from5, to5)
+	if err != nil {
+		return data, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bd common.BucketData
+		if err := rows.Scan(&bd.Bucket, &bd.CPUSum, &bd.CPUMax, &bd.MemorySum, &bd.MemoryMax, &bd.DiskSum,
+			&bd.NetRx, &bd.NetTx, &bd.PingSum, &bd.PingCount, &bd.SampleCount); err != nil {
+			return data, err
+		}
+		data.Metrics = append(data.Metrics, bd)
+	}
+	if err := rows.Err(); err != nil {
+		return data, err
+	}
+
+	pingRows, err := s.db.Query(`
+		SELECT bucket_5sec * 5 / ? AS b, target_name, MAX(target_host),
+			COALESCE(SUM(latency_ms), 0), COALESCE(MAX(latency_ms), 0), COUNT(latency_ms),
+			SUM(CASE WHEN status = 'ok' THEN 1 ELSE 0 END), SUM(CASE WHEN status = 'ok' THEN 0 ELSE 1 END)
+		FROM ping_raw
+		WHERE server_id = ? AND bucket_5sec >= ? AND bucket_5sec < ?
+		GROUP BY b, target_name
+		ORDER BY b`, interval, serverID, from5, to5)
+	if err != nil {
+		return data, err
+	}
+	defer pingRows.Close()
+	for pingRows.Next() {
+		var pd common.PingBucketData
+		if err := pingRows.Scan(&pd.Bucket, &pd.TargetName, &pd.TargetHost,
+			&pd.LatencySum, &pd.LatencyMax, &pd.LatencyCount, &pd.OkCount, &pd.FailCount); err != nil {
+			return data, err
+		}
+		data.Ping = append(data.Ping, pd)
+	}
+	return data, pingRows.Err()
+}
+
+func (s *sqliteStorage) ScanMetricBuckets(serverID, granularity string, fromBucket, toBucket int64, fn func(*common.BucketData) error) error {
+	table := getMetricsTable(granularity)
+	if table == "" {
+		return fmt.Errorf("unknown granularity %q", granularity)
+	}
+	rows, err := s.db.Query(`
+		SELECT bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count
+		FROM `+table+`
+		WHERE server_id = ? AND bucket >= ? AND bucket <= ?
+		ORDER BY bucket ASC`, serverID, fromBucket, toBucket)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bd common.BucketData
+		if err := rows.Scan(&bd.Bucket, &bd.CPUSum, &bd.CPUMax, &bd.MemorySum, &bd.MemoryMax, &bd.DiskSum,
+			&bd.NetRx, &bd.NetTx, &bd.PingSum, &bd.PingCount, &bd.SampleCount); err != nil {
+			return err
+		}
+		if err := fn(&bd); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqliteStorage) ScanPingBuckets(serverID, granularity string, fromBucket, toBucket int64, fn func(*common.PingBucketData) error) error {
+	table := getPingTable(granularity)
+	if table == "" {
+		return fmt.Errorf("unknown granularity %q", granularity)
+	}
+	rows, err := s.db.Query(`
+		SELECT bucket, target_name, target_host, latency_sum, latency_max, latency_count, ok_count, fail_count
+		FROM `+table+`
+		WHERE server_id = ? AND bucket >= ? AND bucket <= ?
+		ORDER BY target_name, bucket ASC`, serverID, fromBucket, toBucket)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pd common.PingBucketData
+		if err := rows.Scan(&pd.Bucket, &pd.TargetName, &pd.TargetHost,
+			&pd.LatencySum, &pd.LatencyMax, &pd.LatencyCount, &pd.OkCount, &pd.FailCount); err != nil {
+			return err
+		}
+		if err := fn(&pd); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// History also falls back to the legacy pre-aggregated and raw tables of older databases
+func (s *sqliteStorage) History(serverID, rangeStr string, sinceBucket int64) ([]HistoryPoint, error) {
+	return GetHistorySince(s.db, serverID, rangeStr, sinceBucket)
+}
+
+func (s *sqliteStorage) PingHistory(serverID, rangeStr string, sinceBucket int64) ([]PingHistoryTarget, error) {
+	return GetPingHistorySince(s.db, serverID, rangeStr, sinceBucket)
+}
+
+func (s *sqliteStorage) LastMetricsTime(serverID string) *time.Time {
+	return lastMetricsTimeSQLite(s.db, serverID)
+}
+
+func (s *sqliteStorage) LastBuckets(serverID string) map[string]int64 {
+	return lastAggregationBucketsSQLite(s.db, serverID)
+}
+
+func (s *sqliteStorage) PingTargets() ([]PingTargetLabel, error) {
+	rows, err := s.db.Query(`
+		SELECT target_name, target_host FROM ping_2min
+		UNION SELECT target_name, target_host FROM ping_hourly_agg
+		UNION SELECT target_name, target_host FROM ping_daily_agg`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []PingTargetLabel
+	for rows.Next() {
+		var t PingTargetLabel
+		if err := rows.Scan(&t.Name, &t.Host); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+func (s *sqliteStorage) ApplyRetention(settings RetentionSettings, servers []RemoteServer, now time.Time, dryRun bool) ([]*RetentionScopeReport, error) {
+	tables := append(append([]retentionTable(nil), metricsRetentionTables...), legacyRetentionTables...)
+	if dryRun {
+		return applyRetention(tables, settings, servers, now, sqliteRetentionRunner(s.db, true))
+	}
+	var scopes []*RetentionScopeReport
+	err := s.write(false, func(db *sql.DB) error {
+		var err error
+		scopes, err = applyRetention(tables, settings, servers, now, sqliteRetentionRunner(db, false))
+		return err
+	})
+	return scopes, err
+}
+
+// ============================================================================
+// Backend-Independent History
+// ============================================================================
+
+// historyRangeSpec maps the fixed dashboard ranges to a granularity, window and point limit
+func historyRangeSpec(rangeStr string) (granularity string, window time.Duration, limit int, incremental bool) {
+	switch rangeStr {
+	case "1h":
+		return "5sec", time.Hour, 720, true
+	case "7d":
+		return "15min", 7 * 24 * time.Hour, 720, false
+	case "30d":
+		return "hourly", 30 * 24 * time.Hour, 720, false
+	case "1y":
+		return "daily", 365 * 24 * time.Hour, 365, false
+	}
+	return "2min", 24 * time.Hour, 720, true
+}
+
+// historyFromBuckets serves a fixed dashboard range from the aggregate tables only
+func historyFromBuckets(st Storage, serverID, rangeStr string, sinceBucket int64) ([]HistoryPoint, error) {
+	granularity, window, limit, incremental := historyRangeSpec(rangeStr)
+	secs := historyBucketSecs[granularity]
+	cutoff := time.Now().UTC().Add(-window).Unix() / secs
+	if incremental && sinceBucket > cutoff {
+		cutoff = sinceBucket
+	}
+
+	var data []HistoryPoint
+	err := st.ScanMetricBuckets(serverID, granularity, cutoff, time.Now().UTC().Unix()/secs, func(b *common.BucketData) error {
+		if len(data) < limit {
+			data = append(data, historyPointFromBucket(b, secs))
+		}
+		return nil
+	})
+	return data, err
+}
+
+// pingHistoryFromBuckets serves a fixed dashboard range of ping data from the aggregate tables only
+func pingHistoryFromBuckets(st Storage, serverID, rangeStr string, sinceBucket int64) ([]PingHistoryTarget, error) {
+	granularity, window, _, incremental := historyRangeSpec(rangeStr)
+	secs := historyBucketSecs[granularity]
+	cutoff := time.Now().UTC().Add(-window).Unix() / secs
+	if incremental && sinceBucket > cutoff {
+		cutoff = sinceBucket
+	}
+	return scanPingHistory(st, serverID, granularity, cutoff, time.Now().UTC().Unix()/secs)
+}
+
+// scanPingHistory groups the ping buckets in [fromBucket, toBucket] by target
+func scanPingHistory(st Storage, serverID, granularity string, fromBucket, toBucket int64) ([]PingHistoryTarget, error) {
+	secs := historyBucketSecs[granularity]
+	targets := []PingHistoryTarget{}
+	// Buckets arrive ordered by target, so consecutive buckets share a target
+	err := st.ScanPingBuckets(serverID, granularity, fromBucket, toBucket, func(p *common.PingBucketData) error {
+		if len(targets) == 0 || targets[len(targets)-1].Name != p.TargetName {
+			targets = append(targets, PingHistoryTarget{Name: p.TargetName, Host: p.TargetHost, Data: []PingHistoryPoint{}})
+		}
+		t := &targets[len(targets)-1]
+		t.Data = append(t.Data, pingHistoryPointFromBucket(p, secs))
+		return nil
+	})
+	return targets, err
+}
+
+func historyPointFromBucket(b *common.BucketData, bucketSecs int64) HistoryPoint {
+	p := HistoryPoint{
+		Timestamp: time.Unix(b.Bucket*bucketSecs, 0).UTC().Format(time.RFC3339),
+		NetRx:     int64(b.NetRx),
+		NetTx:     int64(b.NetTx),
+	}
+	if b.SampleCount > 0 {
+		p.CPU = float32(b.CPUSum / float64(b.SampleCount))
+		p.Memory = float32(b.MemorySum / float64(b.SampleCount))
+		p.Disk = float32(b.DiskSum / float64(b.SampleCount))
+	}
+	if b.PingCount > 0 {
+		ping := b.PingSum / float64(b.PingCount)
+		p.PingMs = &ping
+	}
+	return p
+}
+
+func pingHistoryPointFromBucket(b *common.PingBucketData, bucketSecs int64) PingHistoryPoint {
+	p := PingHistoryPoint{
+		Timestamp: time.Unix(b.Bucket*bucketSecs, 0).UTC().Format(time.RFC3339),
+		Status:    "ok",
+	}
+	if b.LatencyCount > 0 {
+		latency := b.LatencySum / float64(b.LatencyCount)
+		p.LatencyMs = &latency
+	}
+	if b.FailCount > 0 {
+		p.Status = "error"
+	}
+	return p
+}
+
+// mergeBucket folds src into dst the way coarser buckets are built from finer ones
+func mergeBucket(dst, src *common.BucketData) {
+	dst.CPUSum += src.CPUSum
+	dst.CPUMax = max(dst.CPUMax, src.CPUMax)
+	dst.MemorySum += src.MemorySum
+	dst.MemoryMax = max(dst.MemoryMax, src.MemoryMax)
+	dst.DiskSum += src.DiskSum
+	dst.NetRx = max(dst.NetRx, src.NetRx)
+	dst.NetTx = max(dst.NetTx, src.NetTx)
+	dst.PingSum += src.PingSum
+	dst.PingCount += src.PingCount
+	dst.SampleCount += src.SampleCount
+}
+
+func mergePingBucket(dst, src *common.PingBucketData) {
+	dst.TargetHost = src.TargetHost
+	dst.LatencySum += src.LatencySum
+	dst.LatencyMax = max(dst.LatencyMax, src.LatencyMax)
+	dst.LatencyCount += src.LatencyCount
+	dst.OkCount += src.OkCount
+	dst.FailCount += src.FailCount
+}
@@ -0,0 +1,631 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"vstats/internal/common"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ============================================================================
+// PostgreSQL Storage
+// ============================================================================
+//
+// postgresStorage keeps the metrics tables in PostgreSQL. The tables have the same
+// names and bucket layout as in SQLite; legacy pre-aggregated tables are not created.
+
+const pgQueryTimeout = 30 * time.Second
+
+type postgresStorage struct {
+	pool *pgxpool.Pool
+}
+
+func openPostgresStorage(databaseURL string) (*postgresStorage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	poolConfig, err := pgxpool.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database URL: %w", err)
+	}
+
+	// Connection pool settings
+	poolConfig.MaxConns = 25
+	poolConfig.MinConns = 5
+	poolConfig.MaxConnLifetime = time.Hour
+	poolConfig.MaxConnIdleTime = 30 * time.Minute
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	s := &postgresStorage{pool: pool}
+	if err := s.initSchema(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to create metrics tables: %w", err)
+	}
+	return s, nil
+}
+
+func (s *postgresStorage) initSchema(ctx context.Context) error {
+	statements := []string{`
+		CREATE TABLE IF NOT EXISTS metrics_raw (
+			id BIGSERIAL PRIMARY KEY,
+			server_id TEXT NOT NULL,
+			timestamp TIMESTAMPTZ NOT NULL,
+			cpu_usage DOUBLE PRECISION NOT NULL,
+			memory_usage DOUBLE PRECISION NOT NULL,
+			disk_usage DOUBLE PRECISION NOT NULL,
+			net_rx BIGINT NOT NULL,
+			net_tx BIGINT NOT NULL,
+			load_1 DOUBLE PRECISION NOT NULL,
+			load_5 DOUBLE PRECISION NOT NULL,
+			load_15 DOUBLE PRECISION NOT NULL,
+			ping_ms DOUBLE PRECISION,
+			bucket_5min BIGINT NOT NULL,
+			bucket_5sec BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_time ON metrics_raw(server_id, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_metrics_raw_server_bucket_5sec ON metrics_raw(server_id, bucket_5sec)`,
+		`
+		CREATE TABLE IF NOT EXISTS ping_raw (
+			id BIGSERIAL PRIMARY KEY,
+			server_id TEXT NOT NULL,
+			timestamp TIMESTAMPTZ NOT NULL,
+			target_name TEXT NOT NULL,
+			target_host TEXT NOT NULL,
+			latency_ms DOUBLE PRECISION,
+			packet_loss DOUBLE PRECISION NOT NULL DEFAULT 0,
+			status TEXT NOT NULL DEFAULT 'ok',
+			bucket_5min BIGINT NOT NULL,
+			bucket_5sec BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_ping_raw_server_time ON ping_raw(server_id, timestamp)`,
+		`CREATE INDEX IF NOT EXISTS idx_ping_raw_server_bucket_5sec ON ping_raw(server_id, bucket_5sec)`,
+	}
+
+	for _, granularity := range []string{"5sec", "2min", "15min", "hourly", "daily"} {
+		metricsTable, pingTable := getMetricsTable(granularity), getPingTable(granularity)
+		statements = append(statements, `
+		CREATE TABLE IF NOT EXISTS `+metricsTable+` (
+			server_id TEXT NOT NULL,
+			bucket BIGINT NOT NULL,
+			cpu_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+			cpu_max DOUBLE PRECISION NOT NULL DEFAULT 0,
+			memory_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+			memory_max DOUBLE PRECISION NOT NULL DEFAULT 0,
+			disk_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+			net_rx BIGINT NOT NULL DEFAULT 0,
+			net_tx BIGINT NOT NULL DEFAULT 0,
+			ping_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+			ping_count BIGINT NOT NULL DEFAULT 0,
+			sample_count BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (server_id, bucket)
+		)`, `
+		CREATE TABLE IF NOT EXISTS `+pingTable+` (
+			server_id TEXT NOT NULL,
+			bucket BIGINT NOT NULL,
+			target_name TEXT NOT NULL,
+			target_host TEXT NOT NULL,
+			latency_sum DOUBLE PRECISION NOT NULL DEFAULT 0,
+			latency_max DOUBLE PRECISION NOT NULL DEFAULT 0,
+			latency_count BIGINT NOT NULL DEFAULT 0,
+			ok_count BIGINT NOT NULL DEFAULT 0,
+			fail_count BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (server_id, target_name, bucket)
+		)`,
+			// Retention deletes by bucket across all servers
+			`CREATE INDEX IF NOT EXISTS idx_`+metricsTable+`_bucket ON `+metricsTable+`(bucket)`,
+			`CREATE INDEX IF NOT EXISTS idx_`+pingTable+`_bucket ON `+pingTable+`(bucket)`,
+		)
+	}
+
+	for _, stmt := range statements {
+		if _, err := s.pool.Exec(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *postgresStorage) Driver() string { return StorageDriverPostgres }
+
+func (s *postgresStorage) Close() error {
+	s.pool.Close()
+	return nil
+}
+
+// Upsert modes for the aggregate tables
+const (
+	pgUpsertAdd     = iota // raw samples add to the bucket
+	pgUpsertReplace        // agent uploads replace sums and counts, maxes only grow
+	pgUpsertRollup         // server-built buckets never replace buckets with more samples
+)
+
+func pgMetricsUpsertSQL(table string, mode int) string {
+	set := map[int]string{
+		pgUpsertAdd: `
+			cpu_sum = t.cpu_sum + excluded.cpu_sum,
+			cpu_max = GREATEST(t.cpu_max, excluded.cpu_max),
+			memory_sum = t.memory_sum + excluded.memory_sum,
+			memory_max = GREATEST(t.memory_max, excluded.memory_max),
+			disk_sum = t.disk_sum + excluded.disk_sum,
+			net_rx = GREATEST(t.net_rx, excluded.net_rx),
+			net_tx = GREATEST(t.net_tx, excluded.net_tx),
+			ping_sum = t.ping_sum + excluded.ping_sum,
+			ping_count = t.ping_count + excluded.ping_count,
+			sample_count = t.sample_count + excluded.sample_count`,
+		pgUpsertReplace: `
+			cpu_sum = excluded.cpu_sum,
+			cpu_max = GREATEST(t.cpu_max, excluded.cpu_max),
+			memory_sum = excluded.memory_sum,
+			memory_max = GREATEST(t.memory_max, excluded.memory_max),
+			disk_sum = excluded.disk_sum,
+			net_rx = GREATEST(t.net_rx, excluded.net_rx),
+			net_tx = GREATEST(t.net_tx, excluded.net_tx),
+			ping_sum = excluded.ping_sum,
+			ping_count = excluded.ping_count,
+			sample_count = excluded.sample_count`,
+		pgUpsertRollup: `
+			cpu_sum = excluded.cpu_sum,
+			cpu_max = excluded.cpu_max,
+			memory_sum = excluded.memory_sum,
+			memory_max = excluded.memory_max,
+			disk_sum = excluded.disk_sum,
+			net_rx = excluded.net_rx,
+			net_tx = excluded.net_tx,
+			ping_sum = excluded.ping_sum,
+			ping_count = excluded.ping_count,
+			sample_count = excluded.sample_count
+			WHERE excluded.sample_count >= t.sample_count`,
+	}[mode]
+	return `
+		INSERT INTO ` + table + ` AS t (server_id, bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (server_id, bucket) DO UPDATE SET` + set
+}
+
+func pgPingUpsertSQL(table string, mode int) string {
+	set := map[int]string{
+		pgUpsertAdd: `
+			target_host = excluded.target_host,
+			latency_sum = t.latency_sum + excluded.latency_sum,
+			latency_max = GREATEST(t.latency_max, excluded.latency_max),
+			latency_count = t.latency_count + excluded.latency_count,
+			ok_count = t.ok_count + excluded.ok_count,
+			fail_count = t.fail_count + excluded.fail_count`,
+		pgUpsertReplace: `
+			target_host = excluded.target_host,
+			latency_sum = excluded.latency_sum,
+			latency_max = GREATEST(t.latency_max, excluded.latency_max),
+			latency_count = excluded.latency_count,
+			ok_count = excluded.ok_count,
+			fail_count = excluded.fail_count`,
+		pgUpsertRollup: `
+			target_host = excluded.target_host,
+			latency_sum = excluded.latency_sum,
+			latency_max = excluded.latency_max,
+			latency_count = excluded.latency_count,
+			ok_count = excluded.ok_count,
+			fail_count = excluded.fail_count
+			WHERE excluded.ok_count + excluded.fail_count >= t.ok_count + t.fail_count`,
+	}[mode]
+	return `
+		INSERT INTO ` + table + ` AS t (server_id, bucket, target_name, target_host, latency_sum, latency_max, latency_count, ok_count, fail_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (server_id, target_name, bucket) DO UPDATE SET` + set
+}
+
+func queueMetricsUpsert(batch *pgx.Batch, table string, mode int, serverID string, b *common.BucketData) {
+	batch.Queue(pgMetricsUpsertSQL(table, mode),
+		serverID, b.Bucket,
+		b.CPUSum, b.CPUMax,
+		b.MemorySum, b.MemoryMax,
+		b.DiskSum,
+		int64(b.NetRx), int64(b.NetTx),
+		b.PingSum, b.PingCount,
+		b.SampleCount,
+	)
+}
+
+func queuePingUpsert(batch *pgx.Batch, table string, mode int, serverID string, p *common.PingBucketData) {
+	batch.Queue(pgPingUpsertSQL(table, mode),
+		serverID, p.Bucket, p.TargetName, p.TargetHost,
+		p.LatencySum, p.LatencyMax, p.LatencyCount, p.OkCount, p.FailCount,
+	)
+}
+
+// sendBatch runs a batch in one transaction
+func (s *postgresStorage) sendBatch(batch *pgx.Batch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pgQueryTimeout)
+	defer cancel()
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *postgresStorage) StoreSamples(items []MetricsBufferItem) error {
+	batch := &pgx.Batch{}
+	for _, item := range items {
+		queueSample(batch, item.ServerID, item.Metrics)
+	}
+	return s.sendBatch(batch)
+}
+
+// queueSample queues the raw rows of a sample and adds it to the 5sec/2min buckets, like batchStoreMetrics
+func queueSample(batch *pgx.Batch, serverID string, metrics *SystemMetrics) {
+	var diskUsage float32 = 0
+	if len(metrics.Disks) > 0 {
+		diskUsage = metrics.Disks[0].UsagePercent
+	}
+	bucket5min := metrics.Timestamp.Unix() / 120
+	bucket5sec := metrics.Timestamp.Unix() / 5
+
+	var pingMs *float64
+	var pingVal float64
+	var pingCnt int
+	if metrics.Ping != nil && len(metrics.Ping.Targets) > 0 {
+		var sum float64
+		var count int
+		for _, t := range metrics.Ping.Targets {
+			if t.LatencyMs != nil {
+				sum += *t.LatencyMs
+				count++
+			}
+		}
+		if count > 0 {
+			avg := sum / float64(count)
+			pingMs = &avg
+			pingVal = avg
+			pingCnt = 1
+		}
+	}
+
+	batch.Queue(`
+		INSERT INTO metrics_raw (server_id, timestamp, cpu_usage, memory_usage, disk_usage, net_rx, net_tx, load_1, load_5, load_15, ping_ms, bucket_5min, bucket_5sec)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+		serverID, metrics.Timestamp.UTC(),
+		float64(metrics.CPU.Usage), float64(metrics.Memory.UsagePercent), float64(diskUsage),
+		int64(metrics.Network.TotalRx), int64(metrics.Network.TotalTx),
+		metrics.LoadAverage.One, metrics.LoadAverage.Five, metrics.LoadAverage.Fifteen,
+		pingMs, bucket5min, bucket5sec,
+	)
+
+	sample := common.BucketData{
+		CPUSum:      float64(metrics.CPU.Usage),
+		CPUMax:      float64(metrics.CPU.Usage),
+		MemorySum:   float64(metrics.Memory.UsagePercent),
+		MemoryMax:   float64(metrics.Memory.UsagePercent),
+		DiskSum:     float64(diskUsage),
+		NetRx:       metrics.Network.TotalRx,
+		NetTx:       metrics.Network.TotalTx,
+		PingSum:     pingVal,
+		PingCount:   pingCnt,
+		SampleCount: 1,
+	}
+	sample.Bucket = bucket5sec
+	queueMetricsUpsert(batch, "metrics_5sec", pgUpsertAdd, serverID, &sample)
+	sample.Bucket = bucket5min
+	queueMetricsUpsert(batch, "metrics_2min", pgUpsertAdd, serverID, &sample)
+
+	if metrics.Ping == nil {
+		return
+	}
+	for _, target := range metrics.Ping.Targets {
+		batch.Queue(`
+			INSERT INTO ping_raw (server_id, timestamp, target_name, target_host, latency_ms, packet_loss, status, bucket_5min, bucket_5sec)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			serverID, metrics.Timestamp.UTC(), target.Name, target.Host,
+			target.LatencyMs, target.PacketLoss, target.Status,
+			bucket5min, bucket5sec,
+		)
+
+		p := common.PingBucketData{TargetName: target.Name, TargetHost: target.Host, FailCount: 1}
+		if target.LatencyMs != nil {
+			p.LatencySum, p.LatencyMax, p.LatencyCount = *target.LatencyMs, *target.LatencyMs, 1
+		}
+		if target.Status == "ok" {
+			p.OkCount, p.FailCount = 1, 0
+		}
+		p.Bucket = bucket5sec
+		queuePingUpsert(batch, "ping_5sec", pgUpsertAdd, serverID, &p)
+		p.Bucket = bucket5min
+		queuePingUpsert(batch, "ping_2min", pgUpsertAdd, serverID, &p)
+	}
+}
+
+func (s *postgresStorage) StoreSample(serverID string, metrics *SystemMetrics) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pgQueryTimeout)
+	defer cancel()
+
+	// Skip samples whose 5-second bucket is already stored
+	var exists bool
+	err := s.pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM metrics_raw WHERE server_id = $1 AND bucket_5sec = $2)`,
+		serverID, metrics.Timestamp.Unix()/5).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	return s.StoreSamples([]MetricsBufferItem{{ServerID: serverID, Metrics: metrics}})
+}
+
+func (s *postgresStorage) StoreAggregates(metrics map[AggBufferKey]*common.BucketData, ping map[PingBufferKey]*common.PingBucketData) error {
+	batch := &pgx.Batch{}
+	for key, data := range metrics {
+		if table := getMetricsTable(key.Granularity); table != "" {
+			queueMetricsUpsert(batch, table, pgUpsertReplace, key.ServerID, data)
+		}
+	}
+	for key, data := range ping {
+		if table := getPingTable(key.Granularity); table != "" {
+			queuePingUpsert(batch, table, pgUpsertReplace, key.ServerID, data)
+		}
+	}
+	return s.sendBatch(batch)
+}
+
+func (s *postgresStorage) StoreRollup(serverID string, granularities []common.GranularityData) error {
+	batch := &pgx.Batch{}
+	for _, g := range granularities {
+		metricsTable, pingTable := getMetricsTable(g.Granularity), getPingTable(g.Granularity)
+		for i := range g.Metrics {
+			queueMetricsUpsert(batch, metricsTable, pgUpsertRollup, serverID, &g.Metrics[i])
+		}
+		for i := range g.Ping {
+			queuePingUpsert(batch, pingTable, pgUpsertRollup, serverID, &g.Ping[i])
+		}
+	}
+	return s.sendBatch(batch)
+}
+
+func (s *postgresStorage) RollupRaw(serverID, granularity string, interval, from, to int64) (common.GranularityData, error) {
+	data := common.GranularityData{Granularity: granularity, Interval: int(interval)}
+	from5, to5 := from/5, (to+4)/5
+
+	ctx, cancel := context.WithTimeout(context.Background(), pgQueryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT bucket_5sec * 5 / $1 AS b,
+			SUM(cpu_usage), MAX(cpu_usage), SUM(memory_usage), MAX(memory_usage), SUM(disk_usage),
+			MAX(net_rx), MAX(net_tx), COALESCE(SUM(ping_ms), 0), COUNT(ping_ms), COUNT(*)
+		FROM metrics_raw
+		WHERE server_id = $2 AND bucket_5sec >= $3 AND bucket_5sec < $4
+		GROUP BY b
+		ORDER BY b`, interval, serverID, from5, to5)
+	if err != nil {
+		return data, err
+	}
+	for rows.Next() {
+		var bd common.BucketData
+		var netRx, netTx int64
+		if err := rows.Scan(&bd.Bucket, &bd.CPUSum, &bd.CPUMax, &bd.MemorySum, &bd.MemoryMax, &bd.DiskSum,
+			&netRx, &netTx, &bd.PingSum, &bd.PingCount, &bd.SampleCount); err != nil {
+			rows.Close()
+			return data, err
+		}
+		bd.NetRx, bd.NetTx = uint64(netRx), uint64(netTx)
+		data.Metrics = append(data.Metrics, bd)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return data, err
+	}
+
+	pingRows, err := s.pool.Query(ctx, `
+		SELECT bucket_5sec * 5 / $1 AS b, target_name, MAX(target_host),
+			COALESCE(SUM(latency_ms), 0), COALESCE(MAX(latency_ms), 0), COUNT(latency_ms),
+			COUNT(*) FILTER (WHERE status = 'ok'), COUNT(*) FILTER (WHERE status <> 'ok')
+		FROM ping_raw
+		WHERE server_id = $2 AND bucket_5sec >= $3 AND bucket_5sec < $4
+		GROUP BY b, target_name
+		ORDER BY b`, interval, serverID, from5, to5)
+	if err != nil {
+		return data, err
+	}
+	defer pingRows.Close()
+	for pingRows.Next() {
+		var pd common.PingBucketData
+		if err := pingRows.Scan(&pd.Bucket, &pd.TargetName, &pd.TargetHost,
+			&pd.LatencySum, &pd.LatencyMax, &pd.LatencyCount, &pd.OkCount, &pd.FailCount); err != nil {
+			return data, err
+		}
+		data.Ping = append(data.Ping, pd)
+	}
+	return data, pingRows.Err()
+}
+
+func (s *postgresStorage) ScanMetricBuckets(serverID, granularity string, fromBucket, toBucket int64, fn func(*common.BucketData) error) error {
+	table := getMetricsTable(granularity)
+	if table == "" {
+		return fmt.Errorf("unknown granularity %q", granularity)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pgQueryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT bucket, cpu_sum, cpu_max, memory_sum, memory_max, disk_sum, net_rx, net_tx, ping_sum, ping_count, sample_count
+		FROM `+table+`
+		WHERE server_id = $1 AND bucket >= $2 AND bucket <= $3
+		ORDER BY bucket ASC`, serverID, fromBucket, toBucket)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bd common.BucketData
+		var netRx, netTx int64
+		if err := rows.Scan(&bd.Bucket, &bd.CPUSum, &bd.CPUMax, &bd.MemorySum, &bd.MemoryMax, &bd.DiskSum,
+			&netRx, &netTx, &bd.PingSum, &bd.PingCount, &bd.SampleCount); err != nil {
+			return err
+		}
+		bd.NetRx, bd.NetTx = uint64(netRx), uint64(netTx)
+		if err := fn(&bd); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *postgresStorage) ScanPingBuckets(serverID, granularity string, fromBucket, toBucket int64, fn func(*common.PingBucketData) error) error {
+	table := getPingTable(granularity)
+	if table == "" {
+		return fmt.Errorf("unknown granularity %q", granularity)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pgQueryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT bucket, target_name, target_host, latency_sum, latency_max, latency_count, ok_count, fail_count
+		FROM `+table+`
+		WHERE server_id = $1 AND bucket >= $2 AND bucket <= $3
+		ORDER BY target_name, bucket ASC`, serverID, fromBucket, toBucket)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var pd common.PingBucketData
+		if err := rows.Scan(&pd.Bucket, &pd.TargetName, &pd.TargetHost,
+			&pd.LatencySum, &pd.LatencyMax, &pd.LatencyCount, &pd.OkCount, &pd.FailCount); err != nil {
+			return err
+		}
+		if err := fn(&pd); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *postgresStorage) History(serverID, rangeStr string, sinceBucket int64) ([]HistoryPoint, error) {
+	return historyFromBuckets(s, serverID, rangeStr, sinceBucket)
+}
+
+func (s *postgresStorage) PingHistory(serverID, rangeStr string, sinceBucket int64) ([]PingHistoryTarget, error) {
+	return pingHistoryFromBuckets(s, serverID, rangeStr, sinceBucket)
+}
+
+func (s *postgresStorage) LastMetricsTime(serverID string) *time.Time {
+	ctx, cancel := context.WithTimeout(context.Background(), pgQueryTimeout)
+	defer cancel()
+
+	var lastTime *time.Time
+	var raw *time.Time
+	if err := s.pool.QueryRow(ctx, `SELECT MAX(timestamp) FROM metrics_raw WHERE server_id = $1`, serverID).Scan(&raw); err == nil && raw != nil {
+		t := raw.UTC()
+		lastTime = &t
+	}
+
+	for _, g := range []string{"5sec", "2min"} {
+		var bucket *int64
+		s.pool.QueryRow(ctx, `SELECT MAX(bucket) FROM `+getMetricsTable(g)+` WHERE server_id = $1`, serverID).Scan(&bucket)
+		if bucket == nil || *bucket <= 0 {
+			continue
+		}
+		t := time.Unix(*bucket*historyBucketSecs[g], 0).UTC()
+		if lastTime == nil || t.After(*lastTime) {
+			lastTime = &t
+		}
+	}
+	return lastTime
+}
+
+func (s *postgresStorage) LastBuckets(serverID string) map[string]int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), pgQueryTimeout)
+	defer cancel()
+
+	buckets := make(map[string]int64)
+	for _, g := range []string{"5sec", "2min", "15min", "hourly", "daily"} {
+		var bucket *int64
+		err := s.pool.QueryRow(ctx, `SELECT MAX(bucket) FROM `+getMetricsTable(g)+` WHERE server_id = $1`, serverID).Scan(&bucket)
+		if err == nil && bucket != nil && *bucket > 0 {
+			buckets[g] = *bucket
+		}
+	}
+	return buckets
+}
+
+func (s *postgresStorage) PingTargets() ([]PingTargetLabel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pgQueryTimeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT target_name, target_host FROM ping_2min
+		UNION SELECT target_name, target_host FROM ping_hourly_agg
+		UNION SELECT target_name, target_host FROM ping_daily_agg`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []PingTargetLabel
+	for rows.Next() {
+		var t PingTargetLabel
+		if err := rows.Scan(&t.Name, &t.Host); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+func (s *postgresStorage) ApplyRetention(settings RetentionSettings, servers []RemoteServer, now time.Time, dryRun bool) ([]*RetentionScopeReport, error) {
+	return applyRetention(metricsRetentionTables, settings, servers, now, s.retentionRunner(dryRun))
+}
+
+func (s *postgresStorage) retentionRunner(dryRun bool) retentionRunner {
+	return func(t retentionTable, cutoffTime time.Time, serverIDs []string, exclude bool) (int64, error) {
+		// Raw tables store real timestamps, aggregate tables bucket numbers
+		var cutoff interface{} = cutoffTime.UTC()
+		if t.BucketSecs > 0 {
+			cutoff = cutoffTime.Unix() / t.BucketSecs
+		}
+		where := t.Column + " < $1"
+		args := []interface{}{cutoff}
+		if len(serverIDs) > 0 {
+			filter := "server_id = ANY($2)"
+			if exclude {
+				filter = "NOT (" + filter + ")"
+			}
+			where += " AND " + filter
+			args = append(args, serverIDs)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		if dryRun {
+			var n int64
+			err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM "+t.Table+" WHERE "+where, args...).Scan(&n)
+			return n, err
+		}
+		tag, err := s.pool.Exec(ctx, "DELETE FROM "+t.Table+" WHERE "+where, args...)
+		if err != nil {
+			return 0, err
+		}
+		return tag.RowsAffected(), nil
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ============================================================================
+// API Tokens
+// ============================================================================
+//
+// API tokens are long-lived bearer tokens for scripts. A token acts as the user who
+// created it, but only on the endpoints its scopes cover (see apiTokenRoutes); everything
+// else, including managing users and tokens, needs a login session.
+
+// APITokenPrefix marks API tokens, so they are told apart from session JWTs
+const APITokenPrefix = "vst_"
+
+type Scope string
+
+const (
+	ScopeServersRead  Scope = "servers:read"
+	ScopeServersWrite Scope = "servers:write"
+	ScopeMetricsRead  Scope = "metrics:read"
+	ScopeAgentsUpdate Scope = "agents:update"
+	ScopeAlertsRead   Scope = "alerts:read"
+	ScopeAlertsWrite  Scope = "alerts:write"
+	ScopeBackupsRead  Scope = "backups:read"
+)
+
+var allScopes = []Scope{
+	ScopeServersRead, ScopeServersWrite, ScopeMetricsRead, ScopeAgentsUpdate,
+	ScopeAlertsRead, ScopeAlertsWrite, ScopeBackupsRead,
+}
+
+// adminEquivalentScopes give access to data that amounts to full admin rights (backups hold the
+// users, their password hashes and TOTP secrets); tokens only get them when requested explicitly
+var adminEquivalentScopes = map[Scope]bool{
+	ScopeBackupsRead: true,
+}
+
+// apiTokenRoutes maps the protected routes API tokens may call to the scope they need
+var apiTokenRoutes = map[string]Scope{
+	"GET /api/settings/local-node": ScopeServersRead,
+	"GET /api/settings/probe":      ScopeServersRead,
+	"GET /api/install-command":     ScopeServersRead,
+
+	"POST /api/servers":                             ScopeServersWrite,
+	"PUT /api/servers/:id":                          ScopeServersWrite,
+	"DELETE /api/servers/:id":                       ScopeServersWrite,
+	"POST /api/agent/register":                      ScopeServersWrite,
+	"PUT /api/settings/local-node":                  ScopeServersWrite,
+	"PUT /api/settings/probe":                       ScopeServersWrite,
+	"POST /api/groups":                              ScopeServersWrite,
+	"PUT /api/groups/:id":                           ScopeServersWrite,
+	"DELETE /api/groups/:id":                        ScopeServersWrite,
+	"POST /api/dimensions":                          ScopeServersWrite,
+	"PUT /api/dimensions/:id":                       ScopeServersWrite,
+	"DELETE /api/dimensions/:id":                    ScopeServersWrite,
+	"POST /api/dimensions/:id/options":              ScopeServersWrite,
+	"PUT /api/dimensions/:id/options/:option_id":    ScopeServersWrite,
+	"DELETE /api/dimensions/:id/options/:option_id": ScopeServersWrite,
+	"GET /api/history/:server_id/export":            ScopeMetricsRead,
+	"POST /api/servers/:id/update":                  ScopeAgentsUpdate,
+	"GET /api/alerts/rules":                         ScopeAlertsRead,
+	"GET /api/alerts/rules/:id":                     ScopeAlertsRead,
+	"GET /api/alerts/active":                        ScopeAlertsRead,
+	"GET /api/alerts/history":                       ScopeAlertsRead,
+	"POST /api/alerts/rules":                        ScopeAlertsWrite,
+	"PUT /api/alerts/rules/:id":                     ScopeAlertsWrite,
+	"DELETE /api/alerts/rules/:id":                  ScopeAlertsWrite,
+	"POST /api/notifications/test":                  ScopeAlertsWrite,
+	"GET /api/admin/backup":                         ScopeBackupsRead,
+}
+
+func (s Scope) Valid() bool {
+	for _, known := range allScopes {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+type APIToken struct {
+	ID         string  `json:"id"`
+	UserID     string  `json:"user_id"`
+	Name       string  `json:"name"`
+	Prefix     string  `json:"prefix"`
+	Scopes     []Scope `json:"scopes"`
+	ExpiresAt  string  `json:"expires_at,omitempty"`
+	LastUsedAt string  `json:"last_used_at,omitempty"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+func (t *APIToken) HasScope(scope Scope) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *APIToken) HasAnyScope(scopes ...Scope) bool {
+	for _, scope := range scopes {
+		if t.HasScope(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *APIToken) Expired(now time.Time) bool {
+	if t.ExpiresAt == "" {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, t.ExpiresAt)
+	return err != nil || !now.Before(expiresAt)
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIToken creates a token for user and returns it together with its secret, which is only
+// shown once; the database keeps its hash
+func newAPIToken(userID, name string, scopes []Scope, expiresAt string) (*APIToken, string) {
+	secret := APITokenPrefix + GenerateRandomString(40)
+	return &APIToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:len(APITokenPrefix)+6],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}, secret
+}
+
+// ============================================================================
+// API Token Persistence
+// ============================================================================
+
+const apiTokenColumns = `id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at`
+
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*APIToken, error) {
+	var t APIToken
+	var scopes string
+	if err := row.Scan(&t.ID, &t.UserID, &t.Name, &t.Prefix, &scopes, &t.ExpiresAt, &t.LastUsedAt, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	t.Scopes = []Scope{}
+	for _, s := range strings.Split(scopes, ",") {
+		if s != "" {
+			t.Scopes = append(t.Scopes, Scope(s))
+		}
+	}
+	return &t, nil
+}
+
+func listAPITokens(db *sql.DB, userID string) ([]*APIToken, error) {
+	rows, err := db.Query(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*APIToken{}
+	for rows.Next() {
+		t, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// getAPITokenBySecret looks a token up by its secret; it returns nil when there is no such token
+func getAPITokenBySecret(db *sql.DB, secret string) (*APIToken, error) {
+	t, err := scanAPIToken(db.QueryRow(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE token_hash = ?`, hashAPIToken(secret)))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+func saveAPIToken(db *sql.DB, t *APIToken, secret string) error {
+	scopes := make([]string, len(t.Scopes))
+	for i, s := range t.Scopes {
+		scopes[i] = string(s)
+	}
+	_, err := db.Exec(`INSERT INTO api_tokens (`+apiTokenColumns+`, token_hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.UserID, t.Name, t.Prefix, strings.Join(scopes, ","), t.ExpiresAt, t.LastUsedAt, t.CreatedAt, hashAPIToken(secret))
+	return err
+}
+
+func deleteAPIToken(db *sql.DB, userID, id string) (bool, error) {
+	res, err := db.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// touchAPIToken records that a token was used. Requests can come in bursts, so the write is
+// queued and skipped when the recorded time is less than a minute old.
+func touchAPIToken(t *APIToken, now time.Time) {
+	if last, err := time.Parse(time.RFC3339, t.LastUsedAt); err == nil && now.Sub(last) < time.Minute {
+		return
+	}
+	lastUsed := now.UTC().Format(time.RFC3339)
+	dbWriter.WriteAsync(func(db *sql.DB) error {
+		_, err := db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, lastUsed, t.ID)
+		return err
+	})
+}
+
+// validateScopes checks requested scopes and removes duplicates
+func validateScopes(scopes []Scope) ([]Scope, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	seen := make(map[Scope]bool)
+	result := []Scope{}
+	for _, s := range scopes {
+		if !s.Valid() {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAPITokenRouteScopes(t *testing.T) {
+	s := newTestState(t)
+	admin, _ := getUserByUsername(s.DB, "admin")
+	viewer := newTestUser(t, s, "viewer", RoleViewer)
+
+	expired, expiredSecret := newAPIToken(admin.ID, "expired", []Scope{ScopeServersRead}, time.Now().Add(-time.Minute).UTC().Format(time.RFC3339))
+	if err := saveAPIToken(s.DB, expired, expiredSecret); err != nil {
+		t.Fatal(err)
+	}
+
+	route := func(r *gin.Engine) {
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		r.GET("/api/settings/probe", s.AuthMiddleware(RoleViewer), ok)
+		r.GET("/api/tokens", s.AuthMiddleware(RoleViewer), ok)
+		r.POST("/api/servers", s.AuthMiddleware(RoleOperator), ok)
+		r.GET("/api/admin/backup", s.AuthMiddleware(RoleAdmin), ok)
+	}
+	cases := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		want   int
+	}{
+		{"scope covers route", http.MethodGet, "/api/settings/probe", newTestToken(t, s, admin, ScopeServersRead), http.StatusOK},
+		{"write scope does not read", http.MethodGet, "/api/settings/probe", newTestToken(t, s, admin, ScopeServersWrite), http.StatusForbidden},
+		{"other scope", http.MethodGet, "/api/settings/probe", newTestToken(t, s, admin, ScopeMetricsRead), http.StatusForbidden},
+		{"session only route", http.MethodGet, "/api/tokens", newTestToken(t, s, admin, allScopes...), http.StatusForbidden},
+		{"write scope", http.MethodPost, "/api/servers", newTestToken(t, s, admin, ScopeServersWrite), http.StatusOK},
+		{"scope beyond role", http.MethodPost, "/api/servers", newTestToken(t, s, viewer, ScopeServersWrite), http.StatusForbidden},
+		{"backups scope", http.MethodGet, "/api/admin/backup", newTestToken(t, s, admin, ScopeBackupsRead), http.StatusOK},
+		{"expired", http.MethodGet, "/api/settings/probe", expiredSecret, http.StatusUnauthorized},
+		{"unknown", http.MethodGet, "/api/settings/probe", APITokenPrefix + "unknown", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := serveTest(route, tc.method, tc.target, tc.token); w.Code != tc.want {
+				t.Fatalf("%d %s, want %d", w.Code, w.Body, tc.want)
+			}
+		})
+	}
+}
+
+func TestCreateAPITokenAdminEquivalent(t *testing.T) {
+	s := newTestState(t)
+	admin, _ := getUserByUsername(s.DB, "admin")
+	session := newTestSession(t, s, admin)
+	r := gin.New()
+	r.POST("/api/tokens", s.AuthMiddleware(RoleViewer), s.CreateAPIToken)
+	create := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := create(`{"name":"backup","scopes":["backups:read"]}`); code != http.StatusBadRequest {
+		t.Fatalf("backups:read without opt-in: %d", code)
+	}
+	if code := create(`{"name":"backup","scopes":["backups:read"],"admin_equivalent":true}`); code != http.StatusOK {
+		t.Fatalf("backups:read with opt-in: %d", code)
+	}
+	if code := create(`{"name":"metrics","scopes":["metrics:read"]}`); code != http.StatusOK {
+		t.Fatalf("metrics:read: %d", code)
+	}
+	if code := create(`{"name":"bogus","scopes":["everything"]}`); code != http.StatusBadRequest {
+		t.Fatalf("unknown scope: %d", code)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// TOTP Two-Factor Authentication
+// ============================================================================
+//
+// RFC 6238 codes (SHA1, 6 digits, 30 second steps), as used by common authenticator apps.
+// A user enrolls by scanning the otpauth:// URI and confirming one code; password logins
+// then also need a current code or one of the single-use recovery codes.
+
+const (
+	totpIssuer        = "vStats"
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1 // steps accepted before and after the current one, for clock drift
+	recoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type UserTOTP struct {
+	UserID        string
+	Secret        string
+	Enabled       bool
+	RecoveryCodes []string // hashes of the unused codes
+	LastStep      int64
+	CreatedAt     string
+	UpdatedAt     string
+}
+
+// newUserTOTP starts an enrollment with a fresh 160-bit secret
+func newUserTOTP(userID string) (*UserTOTP, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	return &UserTOTP{
+		UserID:        userID,
+		Secret:        totpEncoding.EncodeToString(secret),
+		RecoveryCodes: []string{},
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// URI returns the otpauth:// URI authenticator apps import, usually from a QR code
+func (t *UserTOTP) URI(username string) string {
+	params := url.Values{}
+	params.Set("secret", t.Secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(totpIssuer+":"+username) + "?" + params.Encode()
+}
+
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchStep returns the time step code is valid for around now, or 0 if it matches none
+func (t *UserTOTP) matchStep(code string, now time.Time) int64 {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0
+	}
+	key, err := totpEncoding.DecodeString(t.Secret)
+	if err != nil {
+		return 0
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step
+		}
+	}
+	return 0
+}
+
+// newRecoveryCodes returns fresh recovery codes, to be shown once, and the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		s := hex.EncodeToString(b)
+		codes[i] = s[:5] + "-" + s[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code, ignoring case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// ============================================================================
+// TOTP Persistence
+// ============================================================================
+
+// userTOTPEnabled is the column the user queries select to fill User.TOTPEnabled
+const userTOTPEnabled = `EXISTS (SELECT 1 FROM user_totp WHERE user_totp.user_id = users.id AND user_totp.enabled = 1)`
+
+// getUserTOTP returns the TOTP settings of a user; it returns nil when the user never enrolled
+func getUserTOTP(db *sql.DB, userID string) (*UserTOTP, error) {
+	var t UserTOTP
+	var recoveryCodes string
+	err := db.QueryRow(`
+		SELECT user_id, secret, enabled, recovery_codes, last_step, created_at, updated_at
+		FROM user_totp WHERE user_id = ?`, userID).
+		Scan(&t.UserID, &t.Secret, &t.Enabled, &recoveryCodes, &t.LastStep, &t.CreatedAt, &t.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.RecoveryCodes = []string{}
+	for _, h := range strings.Split(recoveryCodes, ",") {
+		if h != "" {
+			t.RecoveryCodes = append(t.RecoveryCodes, h)
+		}
+	}
+	return &t, nil
+}
+
+func saveUserTOTP(db *sql.DB, t *UserTOTP) error {
+	return writeInventory(db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO user_totp (user_id, secret, enabled, recovery_codes, last_step, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET
+				secret = excluded.secret,
+				enabled = excluded.enabled,
+				recovery_codes = excluded.recovery_codes,
+				last_step = excluded.last_step,
+				updated_at = excluded.updated_at`,
+			t.UserID, t.Secret, t.Enabled, strings.Join(t.RecoveryCodes, ","), t.LastStep, t.CreatedAt, t.UpdatedAt)
+		return err
+	})
+}
+
+// DisableUserTOTP turns off two-factor authentication for a user and reports whether it was on
+func DisableUserTOTP(db *sql.DB, userID string) (bool, error) {
+	var found bool
+	err := writeInventory(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		found = n > 0
+		return nil
+	})
+	return found, err
+}
+
+// useTOTPCode checks a code of an enabled TOTP and marks its time step used, so the same
+// code cannot be replayed
+func useTOTPCode(db *sql.DB, t *UserTOTP, code string) (bool, error) {
+	step := t.matchStep(code, time.Now())
+	if step == 0 {
+		return false, nil
+	}
+	var ok bool
+	err := writeInventory(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`UPDATE user_totp SET last_step = ? WHERE user_id = ? AND enabled = 1 AND last_step < ?`,
+			step, t.UserID, step)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		ok = n > 0
+		return nil
+	})
+	return ok, err
+}
+
+// useRecoveryCode checks a recovery code and removes it, since each one works only once
+func useRecoveryCode(db *sql.DB, userID, code string) (bool, error) {
+	hash := hashRecoveryCode(code)
+	var ok bool
+	err := writeInventory(db, func(tx *sql.Tx) error {
+		var stored string
+		err := tx.QueryRow(`SELECT recovery_codes FROM user_totp WHERE user_id = ? AND enabled = 1`, userID).Scan(&stored)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		remaining := []string{}
+		for _, h := range strings.Split(stored, ",") {
+			if h == "" {
+				continue
+			}
+			if !ok && subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 {
+				ok = true
+				continue
+			}
+			remaining = append(remaining, h)
+		}
+		if !ok {
+			return nil
+		}
+		_, err = tx.Exec(`UPDATE user_totp SET recovery_codes = ?, updated_at = ? WHERE user_id = ?`,
+			strings.Join(remaining, ","), time.Now().UTC().Format(time.RFC3339), userID)
+		return err
+	})
+	return ok, err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B (SHA1), truncated to six digits
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		if got := totpCode(key, unix/totpPeriod); got != want {
+			t.Errorf("code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestTOTPMatchStep(t *testing.T) {
+	totp := &UserTOTP{Secret: totpEncoding.EncodeToString([]byte("12345678901234567890"))}
+	key := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+
+	cases := []struct {
+		name string
+		code string
+		want int64
+	}{
+		{"current", totpCode(key, step), step},
+		{"previous", totpCode(key, step-1), step - 1},
+		{"next", totpCode(key, step+1), step + 1},
+		{"too old", totpCode(key, step-2), 0},
+		{"spaces", " " + totpCode(key, step)[:3] + " " + totpCode(key, step)[3:], step},
+		{"too short", totpCode(key, step)[:5], 0},
+		{"not a code", "abcdef", 0},
+	}
+	for _, tc := range cases {
+		if got := totp.matchStep(tc.code, now); got != tc.want {
+			t.Errorf("%s: step %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+// enableTestTOTP turns on two-factor authentication for user and returns its key and recovery codes
+func enableTestTOTP(t *testing.T, s *AppState, user *User) ([]byte, []string) {
+	t.Helper()
+	totp, err := newUserTOTP(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	totp.Enabled, totp.RecoveryCodes = true, hashes
+	if err := saveUserTOTP(s.DB, totp); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := totpEncoding.DecodeString(totp.Secret)
+	return key, codes
+}
+
+func TestTOTPReplay(t *testing.T) {
+	s := newTestState(t)
+	admin, _ := getUserByUsername(s.DB, "admin")
+	key, recovery := enableTestTOTP(t, s, admin)
+	totp, err := getUserTOTP(s.DB, admin.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := totpCode(key, time.Now().Unix()/totpPeriod)
+	if ok, err := useTOTPCode(s.DB, totp, code); err != nil || !ok {
+		t.Fatalf("first use: %v %v", ok, err)
+	}
+	if ok, _ := useTOTPCode(s.DB, totp, code); ok {
+		t.Fatal("code accepted twice")
+	}
+	// A code of an earlier step is refused once a later one was used
+	if ok, _ := useTOTPCode(s.DB, totp, totpCode(key, time.Now().Unix()/totpPeriod-1)); ok {
+		t.Fatal("older code accepted after a newer one")
+	}
+
+	// Recovery codes work once, ignoring case and dashes
+	if ok, err := useRecoveryCode(s.DB, admin.ID, strings.ToUpper(strings.ReplaceAll(recovery[0], "-", ""))); err != nil || !ok {
+		t.Fatalf("recovery code: %v %v", ok, err)
+	}
+	if ok, _ := useRecoveryCode(s.DB, admin.ID, recovery[0]); ok {
+		t.Fatal("recovery code accepted twice")
+	}
+	if totp, _ := getUserTOTP(s.DB, admin.ID); len(totp.RecoveryCodes) != recoveryCodeCount-1 {
+		t.Fatalf("%d recovery codes left", len(totp.RecoveryCodes))
+	}
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	s := newTestState(t)
+	s.LoginGuard = NewLoginGuard()
+	admin, _ := getUserByUsername(s.DB, "admin")
+	key, _ := enableTestTOTP(t, s, admin)
+
+	r := gin.New()
+	r.POST("/api/auth/login", s.Login)
+	login := func(body map[string]string) (int, map[string]interface{}) {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(string(data))))
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w.Code, resp
+	}
+
+	code, resp := login(map[string]string{"username": "admin", "password": "password"})
+	if code != http.StatusUnauthorized || resp["totp_required"] != true {
+		t.Fatalf("password only: %d %v", code, resp)
+	}
+	current := totpCode(key, time.Now().Unix()/totpPeriod)
+	if code, resp := login(map[string]string{"username": "admin", "password": "password", "totp_code": current}); code != http.StatusOK || resp["token"] == nil {
+		t.Fatalf("with code: %d %v", code, resp)
+	}
+	if code, _ := login(map[string]string{"username": "admin", "password": "password", "totp_code": current}); code != http.StatusUnauthorized {
+		t.Fatalf("replayed code: %d", code)
+	}
+	if code, _ := login(map[string]string{"username": "admin", "password": "wrong", "totp_code": current}); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: %d", code)
+	}
+}
@@ -32,12 +32,16 @@ type Claims struct {
 }
 
 type LoginRequest struct {
-	Password string `json:"password"`
+	Username     string `json:"username,omitempty"` // Defaults to the admin account
+	Password     string `json:"password"`
+	TOTPCode     string `json:"totp_code,omitempty"`     // Required with two-factor authentication enabled
+	RecoveryCode string `json:"recovery_code,omitempty"` // Accepted instead of totp_code, once per code
 }
 
 type LoginResponse struct {
 	Token     string    `json:"token"`
 	ExpiresAt time.Time `json:"expires_at"`
+	User      *User     `json:"user"`
 }
 
 type ChangePasswordRequest struct {
@@ -50,9 +54,11 @@ type ChangePasswordRequest struct {
 // ============================================================================
 
 type OAuthStateData struct {
-	Provider  string `json:"provider"`
-	State     string `json:"state"`
-	CreatedAt int64  `json:"created_at"`
+	Provider     string `json:"provider"`
+	State        string `json:"state"`
+	CreatedAt    int64  `json:"created_at"`
+	CodeVerifier string `json:"-"` // PKCE verifier (OIDC)
+	Nonce        string `json:"-"` // Expected ID token nonce (OIDC)
 }
 
 type GitHubUser struct {
@@ -98,30 +104,36 @@ type OAuthLoginResponse struct {
 // ============================================================================
 
 type AddServerRequest struct {
-	Name         string            `json:"name"`
-	URL          string            `json:"url"`
-	Location     string            `json:"location"`
-	Provider     string            `json:"provider"`
-	Tag          string            `json:"tag"`
-	GroupID      string            `json:"group_id,omitempty"`     // Deprecated
-	GroupValues  map[string]string `json:"group_values,omitempty"` // dimension_id -> option_id
-	PriceAmount  string            `json:"price_amount,omitempty"`
-	PricePeriod  string            `json:"price_period,omitempty"`
-	PurchaseDate string            `json:"purchase_date,omitempty"`
-	TipBadge     string            `json:"tip_badge,omitempty"`
+	Name             string            `json:"name"`
+	URL              string            `json:"url"`
+	Location         string            `json:"location"`
+	Provider         string            `json:"provider"`
+	Tag              string            `json:"tag"`
+	GroupID          string            `json:"group_id,omitempty"`     // Deprecated
+	GroupValues      map[string]string `json:"group_values,omitempty"` // dimension_id -> option_id
+	PriceAmount      string            `json:"price_amount,omitempty"`
+	PricePeriod      string            `json:"price_period,omitempty"`
+	PurchaseDate     string            `json:"purchase_date,omitempty"`
+	TipBadge         string            `json:"tip_badge,omitempty"`
+	OfflineGraceSecs int               `json:"offline_grace_secs,omitempty"`
+	SLATarget        float64           `json:"sla_target,omitempty"`
+	Hidden           bool              `json:"hidden,omitempty"`
 }
 
 type UpdateServerRequest struct {
-	Name         *string            `json:"name,omitempty"`
-	Location     *string            `json:"location,omitempty"`
-	Provider     *string            `json:"provider,omitempty"`
-	Tag          *string            `json:"tag,omitempty"`
-	GroupID      *string            `json:"group_id,omitempty"`     // Deprecated
-	GroupValues  *map[string]string `json:"group_values,omitempty"` // dimension_id -> option_id
-	PriceAmount  *string            `json:"price_amount,omitempty"`
-	PricePeriod  *string            `json:"price_period,omitempty"`
-	PurchaseDate *string            `json:"purchase_date,omitempty"`
-	TipBadge     *string            `json:"tip_badge,omitempty"`
+	Name             *string            `json:"name,omitempty"`
+	Location         *string            `json:"location,omitempty"`
+	Provider         *string            `json:"provider,omitempty"`
+	Tag              *string            `json:"tag,omitempty"`
+	GroupID          *string            `json:"group_id,omitempty"`     // Deprecated
+	GroupValues      *map[string]string `json:"group_values,omitempty"` // dimension_id -> option_id
+	PriceAmount      *string            `json:"price_amount,omitempty"`
+	PricePeriod      *string            `json:"price_period,omitempty"`
+	PurchaseDate     *string            `json:"purchase_date,omitempty"`
+	TipBadge         *string            `json:"tip_badge,omitempty"`
+	OfflineGraceSecs *int               `json:"offline_grace_secs,omitempty"`
+	SLATarget        *float64           `json:"sla_target,omitempty"`
+	Hidden           *bool              `json:"hidden,omitempty"`
 }
 
 // ============================================================================
@@ -186,6 +198,9 @@ type HistoryPoint struct {
 type HistoryResponse struct {
 	ServerID    string              `json:"server_id"`
 	Range       string              `json:"range"`
+	From        string              `json:"from,omitempty"`        // Custom window start (range "custom")
+	To          string              `json:"to,omitempty"`          // Custom window end (range "custom")
+	Granularity string              `json:"granularity,omitempty"` // Table used for a custom window
 	Data        []HistoryPoint      `json:"data"`
 	PingTargets []PingHistoryTarget `json:"ping_targets,omitempty"`
 	LastBucket  int64               `json:"last_bucket,omitempty"`  // For incremental updates
@@ -385,7 +400,18 @@ type AgentConnection struct {
 type DashboardClient struct {
 	Conn    *websocket.Conn
 	IP      string
-	WriteMu sync.Mutex // Protects concurrent writes to the connection
+	Public  bool            // Not logged in: hidden servers are left out and fields redacted
+	Scope   map[string]bool // Set for share links: the only servers the client sees
+	ShareID string          // Share link the client was opened with
+	WriteMu sync.Mutex      // Protects concurrent writes to the connection
+}
+
+// sees reports whether the client is sent the server, "local" for the dashboard server
+func (c *DashboardClient) sees(serverID string, hidden bool) bool {
+	if c.Scope != nil {
+		return c.Scope[serverID]
+	}
+	return !c.Public || !hidden
 }
 
 type AppState struct {
@@ -402,8 +428,21 @@ type AppState struct {
 	DashboardMu      sync.RWMutex
 	DB               *sql.DB
 	// Pre-built snapshot for fast dashboard delivery
-	Snapshot         *DashboardSnapshot
-	SnapshotMu       sync.RWMutex
+	Snapshot       *DashboardSnapshot
+	PublicSnapshot *DashboardSnapshot // Snapshot for visitors who are not logged in
+	SnapshotMu     sync.RWMutex
+	// Threshold alert evaluation
+	Alerts *AlertEngine
+	// Notification delivery
+	Notifier *NotificationDispatcher
+	// Online/offline transition tracking
+	Connectivity *ConnectivityTracker
+	// Servers uploading their own aggregated buckets
+	Rollups *RollupTracker
+	// Failed login tracking and backoff
+	LoginGuard *LoginGuard
+	// One-time tickets authenticating dashboard WebSockets
+	WSTickets *WSTickets
 }
 
 // GetOnlineUsersCount returns the number of unique IPs connected to the dashboard
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ============================================================================
+// Users & Roles
+// ============================================================================
+
+// Role decides what a user may do; each role includes the ones below it
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // read-only access to the dashboard and history
+	RoleOperator Role = "operator" // manages servers, groups and alert rules
+	RoleAdmin    Role = "admin"    // manages users and server-wide settings
+)
+
+// DefaultAdminUsername is the account the admin password of older versions is imported into
+const DefaultAdminUsername = "admin"
+
+func (r Role) rank() int {
+	switch r {
+	case RoleViewer:
+		return 1
+	case RoleOperator:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+func (r Role) Valid() bool {
+	return r.rank() > 0
+}
+
+// Allows reports whether the role grants at least min
+func (r Role) Allows(min Role) bool {
+	return r.Valid() && r.rank() >= min.rank()
+}
+
+// UserIdentity links an OAuth account to a user
+type UserIdentity struct {
+	Provider string `json:"provider"` // github, google or oidc
+	Subject  string `json:"subject"`  // GitHub login, Google email, or OIDC <issuer>#<sub> (see oidcUser)
+	// Created on first OIDC login; such links only last while the account passes the allow-lists
+	AutoProvisioned bool `json:"auto_provisioned,omitempty"`
+}
+
+type User struct {
+	ID           string         `json:"id"`
+	Username     string         `json:"username"`
+	Role         Role           `json:"role"`
+	HasPassword  bool           `json:"has_password"`
+	TOTPEnabled  bool           `json:"totp_enabled"`
+	Identities   []UserIdentity `json:"identities"`
+	CreatedAt    string         `json:"created_at"`
+	UpdatedAt    string         `json:"updated_at"`
+	PasswordHash string         `json:"-"`
+}
+
+func (u *User) CheckPassword(password string) bool {
+	return u.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// dummyPasswordHash is checked when there is no password to compare against, so a login
+// takes as long whether or not the username exists
+var dummyPasswordHash = []byte("$2a$10$i.1ROdep2rPy90VWIccsqu5amISrZzFV1UwFHgcJ/ect6t/HuVaS.")
+
+// checkLoginPassword checks the password of a user that may not exist or have a password
+func checkLoginPassword(u *User, password string) bool {
+	if u == nil || u.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+	return u.CheckPassword(password)
+}
+
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	u.HasPassword = true
+	return nil
+}
+
+func validateUsername(username string) error {
+	if username == "" || len(username) > 64 {
+		return fmt.Errorf("username must be 1-64 characters")
+	}
+	if strings.TrimSpace(username) != username || strings.ContainsAny(username, " \t\r\n") {
+		return fmt.Errorf("username must not contain whitespace")
+	}
+	return nil
+}
+
+func validateIdentity(identity UserIdentity) error {
+	if identity.Provider != "github" && identity.Provider != "google" && identity.Provider != "oidc" {
+		return fmt.Errorf("provider must be github, google or oidc")
+	}
+	if identity.Subject == "" {
+		return fmt.Errorf("subject is required")
+	}
+	return nil
+}
+
+// ============================================================================
+// User Persistence
+// ============================================================================
+
+const userColumns = `id, username, password_hash, role, created_at, updated_at`
+
+func scanUser(row interface{ Scan(...interface{}) error }) (*User, error) {
+	var u User
+	if err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.CreatedAt, &u.UpdatedAt, &u.TOTPEnabled); err != nil {
+		return nil, err
+	}
+	u.HasPassword = u.PasswordHash != ""
+	u.Identities = []UserIdentity{}
+	return &u, nil
+}
+
+func listUsers(db *sql.DB) ([]*User, error) {
+	rows, err := db.Query(`SELECT ` + userColumns + `, ` + userTOTPEnabled + ` FROM users ORDER BY created_at, username`)
+	if err != nil {
+		return nil, err
+	}
+	users := []*User{}
+	byID := make(map[string]*User)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		users = append(users, u)
+		byID[u.ID] = u
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	idRows, err := db.Query(`SELECT user_id, provider, subject, auto_provisioned FROM user_identities ORDER BY provider, subject`)
+	if err != nil {
+		return nil, err
+	}
+	defer idRows.Close()
+	for idRows.Next() {
+		var userID string
+		var identity UserIdentity
+		if err := idRows.Scan(&userID, &identity.Provider, &identity.Subject, &identity.AutoProvisioned); err != nil {
+			return nil, err
+		}
+		if u, ok := byID[userID]; ok {
+			u.Identities = append(u.Identities, identity)
+		}
+	}
+	return users, idRows.Err()
+}
+
+// getUser loads a user with its identities; it returns nil when there is no such user
+func getUser(db *sql.DB, where string, arg interface{}) (*User, error) {
+	u, err := scanUser(db.QueryRow(`SELECT `+userColumns+`, `+userTOTPEnabled+` FROM users WHERE `+where, arg))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT provider, subject, auto_provisioned FROM user_identities WHERE user_id = ? ORDER BY provider, subject`, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var identity UserIdentity
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.AutoProvisioned); err != nil {
+			return nil, err
+		}
+		u.Identities = append(u.Identities, identity)
+	}
+	return u, rows.Err()
+}
+
+func getUserByID(db *sql.DB, id string) (*User, error) {
+	return getUser(db, `id = ?`, id)
+}
+
+func getUserByUsername(db *sql.DB, username string) (*User, error) {
+	return getUser(db, `username = ?`, username)
+}
+
+// getUserByIdentity finds the user an OAuth account is linked to
+func getUserByIdentity(db *sql.DB, provider, subject string) (*User, error) {
+	var userID string
+	err := db.QueryRow(`SELECT user_id FROM user_identities WHERE provider = ? AND subject = ?`, provider, subject).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return getUserByID(db, userID)
+}
+
+// firstAdmin returns the oldest admin account
+func firstAdmin(db *sql.DB) (*User, error) {
+	return getUser(db, `role = ? ORDER BY created_at, username LIMIT 1`, RoleAdmin)
+}
+
+func countAdmins(tx *sql.Tx) (int, error) {
+	var n int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE role = ?`, RoleAdmin).Scan(&n)
+	return n, err
+}
+
+// SaveUser inserts or updates a user and replaces its identities. Demoting the last admin is refused.
+func SaveUser(db *sql.DB, u *User) error {
+	return writeInventory(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`
+			INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT(id) DO UPDATE SET
+				username = excluded.username,
+				password_hash = excluded.password_hash,
+				role = excluded.role,
+				updated_at = excluded.updated_at`,
+			u.ID, u.Username, u.PasswordHash, u.Role, u.CreatedAt, u.UpdatedAt); err != nil {
+			if strings.Contains(err.Error(), "UNIQUE") {
+				return errUsernameTaken
+			}
+			return err
+		}
+		if n, err := countAdmins(tx); err != nil {
+			return err
+		} else if n == 0 {
+			return errLastAdmin
+		}
+
+		if _, err := tx.Exec(`DELETE FROM user_identities WHERE user_id = ?`, u.ID); err != nil {
+			return err
+		}
+		for _, identity := range u.Identities {
+			if _, err := tx.Exec(`INSERT INTO user_identities (provider, subject, user_id, auto_provisioned, created_at) VALUES (?, ?, ?, ?, ?)`,
+				identity.Provider, identity.Subject, u.ID, identity.AutoProvisioned, u.UpdatedAt); err != nil {
+				if strings.Contains(err.Error(), "UNIQUE") {
+					return fmt.Errorf("%w: %s %s", errIdentityLinked, identity.Provider, identity.Subject)
+				}
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteUser removes a user with its identities, two-factor settings, API tokens and sessions. Deleting the last admin is refused.
+func DeleteUser(db *sql.DB, id string) (bool, error) {
+	var found bool
+	err := writeInventory(db, func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		n, _ := res.RowsAffected()
+		found = n > 0
+		if n, err := countAdmins(tx); err != nil {
+			return err
+		} else if n == 0 {
+			return errLastAdmin
+		}
+		if _, err := tx.Exec(`DELETE FROM user_identities WHERE user_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM user_totp WHERE user_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM api_tokens WHERE user_id = ?`, id); err != nil {
+			return err
+		}
+		_, err = tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, id)
+		return err
+	})
+	return found, err
+}
+
+var (
+	errUsernameTaken  = fmt.Errorf("username already exists")
+	errLastAdmin      = fmt.Errorf("at least one admin account is required")
+	errIdentityLinked = fmt.Errorf("OAuth account is already linked to another user")
+)
+
+func newUser(username string, role Role) *User {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return &User{
+		ID:         uuid.New().String(),
+		Username:   username,
+		Role:       role,
+		Identities: []UserIdentity{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+func countUsers(db *sql.DB) (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&n)
+	return n, err
+}
+
+// EnsureAdminUser creates the admin account on first start, from the admin password of the
+// single-user versions. The OAuth allow-lists keep logging in as this account (see oauthUser).
+func EnsureAdminUser(db *sql.DB, config *AppConfig) error {
+	n, err := countUsers(db)
+	if err != nil || n > 0 {
+		return err
+	}
+
+	admin := newUser(DefaultAdminUsername, RoleAdmin)
+	admin.PasswordHash = config.AdminPasswordHash
+	admin.HasPassword = admin.PasswordHash != ""
+	if err := SaveUser(db, admin); err != nil {
+		return err
+	}
+	fmt.Printf("👤 Created admin user %q with the admin password\n", admin.Username)
+	return nil
+}
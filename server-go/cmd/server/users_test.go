@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoleAllows(t *testing.T) {
+	cases := []struct {
+		role, min Role
+		want      bool
+	}{
+		{RoleAdmin, RoleAdmin, true},
+		{RoleAdmin, RoleViewer, true},
+		{RoleOperator, RoleOperator, true},
+		{RoleOperator, RoleAdmin, false},
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleOperator, false},
+		{"", RoleViewer, false},
+		{"root", RoleViewer, false},
+	}
+	for _, tc := range cases {
+		if got := tc.role.Allows(tc.min); got != tc.want {
+			t.Errorf("%q.Allows(%q) = %v, want %v", tc.role, tc.min, got, tc.want)
+		}
+	}
+}
+
+func TestAuthMiddlewareRoles(t *testing.T) {
+	s := newTestState(t)
+	admin, _ := getUserByUsername(s.DB, "admin")
+	sessions := map[Role]string{
+		RoleAdmin:    newTestSession(t, s, admin),
+		RoleOperator: newTestSession(t, s, newTestUser(t, s, "operator", RoleOperator)),
+		RoleViewer:   newTestSession(t, s, newTestUser(t, s, "viewer", RoleViewer)),
+	}
+	route := func(r *gin.Engine) {
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		r.GET("/viewer", s.AuthMiddleware(RoleViewer), ok)
+		r.GET("/operator", s.AuthMiddleware(RoleOperator), ok)
+		r.GET("/admin", s.AuthMiddleware(RoleAdmin), ok)
+	}
+
+	for role, session := range sessions {
+		for _, min := range []Role{RoleViewer, RoleOperator, RoleAdmin} {
+			want := http.StatusForbidden
+			if role.Allows(min) {
+				want = http.StatusOK
+			}
+			if w := serveTest(route, http.MethodGet, "/"+string(min), session); w.Code != want {
+				t.Errorf("%s on %s route: %d, want %d", role, min, w.Code, want)
+			}
+		}
+	}
+	if w := serveTest(route, http.MethodGet, "/viewer", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without session: %d", w.Code)
+	}
+}
+
+func TestLastAdminGuard(t *testing.T) {
+	s := newTestState(t)
+	admin, _ := getUserByUsername(s.DB, "admin")
+
+	demoted := *admin
+	demoted.Role = RoleOperator
+	if err := SaveUser(s.DB, &demoted); !errors.Is(err, errLastAdmin) {
+		t.Fatalf("demoting the last admin: %v", err)
+	}
+	if _, err := DeleteUser(s.DB, admin.ID); !errors.Is(err, errLastAdmin) {
+		t.Fatalf("deleting the last admin: %v", err)
+	}
+	if user, _ := getUserByID(s.DB, admin.ID); user == nil || user.Role != RoleAdmin {
+		t.Fatalf("last admin was changed: %+v", user)
+	}
+
+	// The handler refuses it too, and allows it once there is another admin
+	other := newTestUser(t, s, "other", RoleAdmin)
+	session := newTestSession(t, s, other)
+	r := gin.New()
+	r.Use(s.AuthMiddleware(RoleAdmin))
+	r.PUT("/api/users/:id", s.UpdateUser)
+	update := func(id string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/users/"+id, strings.NewReader(`{"role":"viewer"}`))
+		req.Header.Set("Authorization", "Bearer "+session)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := update(admin.ID); code != http.StatusOK {
+		t.Fatalf("demoting one of two admins: %d", code)
+	}
+	if code := update(other.ID); code != http.StatusBadRequest {
+		t.Fatalf("demoting the last admin through the API: %d", code)
+	}
+}
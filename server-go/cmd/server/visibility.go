@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================================================
+// Public Visibility
+// ============================================================================
+//
+// The dashboard endpoints (metrics, servers, history, the /ws stream) are public. Visitors who
+// are not logged in do not see hidden servers, and the fields VisibilitySettings turns off are
+// redacted for them. Requests with a valid session or API token see everything.
+
+// publicView returns the visibility settings and true when the request comes from a visitor
+// who is not logged in
+func (s *AppState) publicView(c *gin.Context) (VisibilitySettings, bool) {
+	if s.optionalUser(c, ScopeMetricsRead) != nil {
+		return VisibilitySettings{}, false
+	}
+	s.ConfigMu.RLock()
+	defer s.ConfigMu.RUnlock()
+	return s.Config.Visibility, true
+}
+
+// serverHidden reports whether a server, or "local" for the dashboard server, is hidden
+func (c *AppConfig) serverHidden(id string) bool {
+	if id == "local" {
+		return c.LocalNode.Hidden
+	}
+	for _, server := range c.Servers {
+		if server.ID == id {
+			return server.Hidden
+		}
+	}
+	return false
+}
+
+// publicServerCount is the number of dashboard entries, including the local node, visitors see
+func (c *AppConfig) publicServerCount() int {
+	n := 0
+	if !c.LocalNode.Hidden {
+		n++
+	}
+	for _, server := range c.Servers {
+		if !server.Hidden {
+			n++
+		}
+	}
+	return n
+}
+
+// hiddenFromRequest reports whether the server must not be shown to the request, answering it
+// with 404 (as for unknown servers) if so
+func (s *AppState) hiddenFromRequest(c *gin.Context, serverID string) bool {
+	s.ConfigMu.RLock()
+	hidden := s.Config.serverHidden(serverID)
+	s.ConfigMu.RUnlock()
+	if hidden && s.optionalUser(c, ScopeMetricsRead) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Server not found"})
+		return true
+	}
+	return false
+}
+
+// dropPublicSnapshot makes new visitors get a freshly built dashboard state until the next
+// snapshot refresh, so changes to what they may see apply at once
+func (s *AppState) dropPublicSnapshot() {
+	s.SnapshotMu.Lock()
+	s.PublicSnapshot = nil
+	s.SnapshotMu.Unlock()
+}
+
+// redactUpdate removes the fields turned off for visitors from a dashboard entry. Metrics are
+// copied before they are changed, as they are shared with the agent state.
+func (v VisibilitySettings) redactUpdate(u *ServerMetricsUpdate) {
+	if v.MaskIP {
+		u.IP = maskIP(u.IP)
+	}
+	if v.HidePrices {
+		u.PriceAmount, u.PricePeriod, u.PurchaseDate = "", "", ""
+	}
+	if u.Metrics != nil {
+		u.Metrics = v.redactMetrics(u.Metrics)
+	}
+}
+
+func (v VisibilitySettings) redactServer(server *RemoteServer) {
+	if v.MaskIP {
+		server.IP = maskIP(server.IP)
+		server.URL = ""
+	}
+	if v.HidePrices {
+		server.PriceAmount, server.PricePeriod, server.PurchaseDate = "", "", ""
+	}
+}
+
+func (v VisibilitySettings) redactMetrics(m *SystemMetrics) *SystemMetrics {
+	redacted := *m
+	if v.MaskIP && len(m.IPAddresses) > 0 {
+		redacted.IPAddresses = make([]string, len(m.IPAddresses))
+		for i, addr := range m.IPAddresses {
+			redacted.IPAddresses[i] = maskIP(addr)
+		}
+	}
+	if v.HideHostname {
+		redacted.Hostname = ""
+	}
+	if v.HideSystemDetails {
+		redacted.OS.Kernel = ""
+		redacted.Disks = append([]DiskMetrics(nil), m.Disks...)
+		for i := range redacted.Disks {
+			redacted.Disks[i].Model, redacted.Disks[i].Serial = "", ""
+		}
+		redacted.Network.Interfaces = append([]NetworkInterface(nil), m.Network.Interfaces...)
+		for i := range redacted.Network.Interfaces {
+			redacted.Network.Interfaces[i].MAC = ""
+		}
+	}
+	return &redacted
+}
+
+// maskIP keeps the network part of an address: 203.0.113.7 becomes 203.0.*.* and
+// 2001:db8::1 becomes 2001:db8:*. Anything that is not an IP address is masked entirely.
+func maskIP(addr string) string {
+	if addr == "" {
+		return ""
+	}
+	host, _, _ := strings.Cut(addr, "/")
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "*"
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.*.*", v4[0], v4[1])
+	}
+	return fmt.Sprintf("%x:%x:*", uint16(ip[0])<<8|uint16(ip[1]), uint16(ip[2])<<8|uint16(ip[3]))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMaskIP(t *testing.T) {
+	cases := map[string]string{
+		"203.0.113.7":        "203.0.*.*",
+		"203.0.113.7/24":     "203.0.*.*",
+		"2001:db8::1":        "2001:db8:*",
+		"::ffff:192.0.2.1":   "192.0.*.*",
+		"server.example.com": "*",
+		"":                   "",
+	}
+	for addr, want := range cases {
+		if got := maskIP(addr); got != want {
+			t.Errorf("maskIP(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
+
+func TestRedactMetrics(t *testing.T) {
+	m := &SystemMetrics{Hostname: "web-1", IPAddresses: []string{"203.0.113.7"}}
+	m.OS.Kernel = "6.1.0"
+	m.Disks = []DiskMetrics{{Model: "SSD", Serial: "S123"}}
+	m.Network.Interfaces = []NetworkInterface{{MAC: "00:11:22:33:44:55"}}
+
+	v := VisibilitySettings{MaskIP: true, HideHostname: true, HideSystemDetails: true}
+	redacted := v.redactMetrics(m)
+	if redacted.Hostname != "" || redacted.IPAddresses[0] != "203.0.*.*" || redacted.OS.Kernel != "" ||
+		redacted.Disks[0].Serial != "" || redacted.Disks[0].Model != "" || redacted.Network.Interfaces[0].MAC != "" {
+		t.Fatalf("not redacted: %+v", redacted)
+	}
+	// The agent state the metrics came from is left alone
+	if m.Hostname != "web-1" || m.IPAddresses[0] != "203.0.113.7" || m.Disks[0].Serial != "S123" || m.Network.Interfaces[0].MAC == "" {
+		t.Fatalf("original metrics were changed: %+v", m)
+	}
+
+	server := RemoteServer{IP: "203.0.113.7", URL: "https://203.0.113.7", PriceAmount: "5", PurchaseDate: "2024-01-01"}
+	VisibilitySettings{MaskIP: true, HidePrices: true}.redactServer(&server)
+	if server.IP != "203.0.*.*" || server.URL != "" || server.PriceAmount != "" || server.PurchaseDate != "" {
+		t.Fatalf("server not redacted: %+v", server)
+	}
+}
+
+func TestHiddenFromRequest(t *testing.T) {
+	s := newTestState(t)
+	s.Config.Servers = []RemoteServer{{ID: "visible"}, {ID: "hidden", Hidden: true}}
+	s.Config.LocalNode.Hidden = true
+	admin, _ := getUserByUsername(s.DB, "admin")
+
+	route := func(r *gin.Engine) {
+		r.GET("/api/history/:id", func(c *gin.Context) {
+			if !s.hiddenFromRequest(c, c.Param("id")) {
+				c.Status(http.StatusOK)
+			}
+		})
+	}
+	cases := []struct {
+		name   string
+		target string
+		bearer string
+		want   int
+	}{
+		{"visible server", "/api/history/visible", "", http.StatusOK},
+		{"hidden server", "/api/history/hidden", "", http.StatusNotFound},
+		{"hidden local node", "/api/history/local", "", http.StatusNotFound},
+		{"session", "/api/history/hidden", newTestSession(t, s, admin), http.StatusOK},
+		{"metrics:read token", "/api/history/hidden", newTestToken(t, s, admin, ScopeMetricsRead), http.StatusOK},
+		{"metrics:read token in URL", "/api/history/hidden?token=" + newTestToken(t, s, admin, ScopeMetricsRead), "", http.StatusOK},
+		{"token without metrics:read", "/api/history/hidden", newTestToken(t, s, admin, ScopeAlertsRead), http.StatusNotFound},
+		{"invalid session", "/api/history/hidden", "not-a-jwt", http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := serveTest(route, http.MethodGet, tc.target, tc.bearer); w.Code != tc.want {
+				t.Fatalf("%d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+
+	if n := s.Config.publicServerCount(); n != 1 {
+		t.Fatalf("public server count %d, want 1", n)
+	}
+}
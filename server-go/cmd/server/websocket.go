@@ -21,21 +21,49 @@ var upgrader = websocket.Upgrader{
 // ============================================================================
 
 func (s *AppState) HandleDashboardWS(c *gin.Context) {
+	// Logged-in dashboards pass a ticket from CreateWSTicket as ?ticket= to see hidden servers
+	// and redacted fields
+	public := s.optionalUser(c, ScopeMetricsRead) == nil
+	if ticket := c.Query("ticket"); public && ticket != "" {
+		public = s.redeemWSTicket(ticket) == nil
+	}
+	s.serveDashboardWS(c, &DashboardClient{Public: public}, time.Time{})
+}
+
+// redeemWSTicket returns the user of a WebSocket ticket, or nil if the ticket or its session
+// is no longer valid
+func (s *AppState) redeemWSTicket(ticket string) *User {
+	userID, sessionID, ok := s.WSTickets.Redeem(ticket, time.Now())
+	if !ok {
+		return nil
+	}
+	session, err := getSession(s.DB, sessionID)
+	if err != nil || session == nil || session.UserID != userID {
+		return nil
+	}
+	user, err := getUserByID(s.DB, userID)
+	if err != nil {
+		return nil
+	}
+	return user
+}
+
+// serveDashboardWS streams the dashboard to client, which is closed at until if it is set
+func (s *AppState) serveDashboardWS(c *gin.Context, client *DashboardClient, until time.Time) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
 	defer conn.Close()
-
-	// Get client IP
-	clientIP := c.ClientIP()
+	if !until.IsZero() {
+		timer := time.AfterFunc(time.Until(until), func() { conn.Close() })
+		defer timer.Stop()
+	}
 
 	// Register client with IP
-	client := &DashboardClient{
-		Conn: conn,
-		IP:   clientIP,
-	}
+	client.Conn = conn
+	client.IP = c.ClientIP()
 	s.DashboardMu.Lock()
 	s.DashboardClients[conn] = client
 	s.DashboardMu.Unlock()
@@ -90,9 +118,18 @@ func (s *AppState) sendInitialState(client *DashboardClient) {
 		return client.Conn.WriteMessage(websocket.TextMessage, data)
 	}
 
+	// Share links see only some servers and always get fresh data
+	if client.Scope != nil {
+		s.sendInitialStateFresh(client)
+		return
+	}
+
 	// Try to use cached snapshot first
 	s.SnapshotMu.RLock()
 	snapshot := s.Snapshot
+	if client.Public {
+		snapshot = s.PublicSnapshot
+	}
 	s.SnapshotMu.RUnlock()
 
 	if snapshot != nil && time.Since(snapshot.LastUpdated) < 10*time.Second {
@@ -126,7 +163,15 @@ func (s *AppState) sendInitialStateFresh(client *DashboardClient) {
 	}
 	s.AgentMetricsMu.RUnlock()
 
-	totalServers := 1 + len(config.Servers) // local + remote
+	totalServers := 0 // local + remote the client sees
+	if client.sees("local", config.LocalNode.Hidden) {
+		totalServers++
+	}
+	for _, server := range config.Servers {
+		if client.sees(server.ID, server.Hidden) {
+			totalServers++
+		}
+	}
 
 	// Helper function to write with lock
 	writeMessage := func(data []byte) error {
@@ -185,19 +230,24 @@ func (s *AppState) sendInitialStateFresh(client *DashboardClient) {
 			TipBadge:     localNode.TipBadge,
 		},
 	}
-	localData, _ := json.Marshal(localServer)
-	if err := writeMessage(localData); err != nil {
-		return
+	if client.sees("local", localNode.Hidden) {
+		if client.Public {
+			config.Visibility.redactUpdate(&localServer.Server)
+		}
+		localData, _ := json.Marshal(localServer)
+		if err := writeMessage(localData); err != nil {
+			return
+		}
+		index++
 	}
-	index++
 
 	// Remote servers
 	for _, server := range config.Servers {
-		metricsData := agentMetrics[server.ID]
-		online := false
-		if metricsData != nil {
-			online = time.Since(metricsData.LastUpdated).Seconds() < 30
+		if !client.sees(server.ID, server.Hidden) {
+			continue
 		}
+		metricsData := agentMetrics[server.ID]
+		online := isAgentOnline(&server, metricsData, time.Now())
 
 		version := server.Version
 		if metricsData != nil && metricsData.Metrics.Version != "" {
@@ -231,6 +281,9 @@ func (s *AppState) sendInitialStateFresh(client *DashboardClient) {
 				TipBadge:     server.TipBadge,
 			},
 		}
+		if client.Public {
+			config.Visibility.redactUpdate(&serverMsg.Server)
+		}
 		serverData, _ := json.Marshal(serverMsg)
 		if err := writeMessage(serverData); err != nil {
 			return
@@ -262,6 +315,12 @@ func (s *AppState) RefreshSnapshot() {
 		ServerMessages: make([][]byte, 0, totalServers),
 		LastUpdated:    time.Now(),
 	}
+	// Visitors who are not logged in get their own snapshot without hidden servers
+	publicTotal := config.publicServerCount()
+	publicSnapshot := &DashboardSnapshot{
+		ServerMessages: make([][]byte, 0, publicTotal),
+		LastUpdated:    snapshot.LastUpdated,
+	}
 
 	// Build init message
 	initMsg := StreamInitMessage{
@@ -272,6 +331,8 @@ func (s *AppState) RefreshSnapshot() {
 		SiteSettings:    &config.SiteSettings,
 	}
 	snapshot.InitMessage, _ = json.Marshal(initMsg)
+	initMsg.TotalServers = publicTotal
+	publicSnapshot.InitMessage, _ = json.Marshal(initMsg)
 
 	// Build local server message
 	localMetrics := CollectMetrics()
@@ -309,15 +370,18 @@ func (s *AppState) RefreshSnapshot() {
 	}
 	localData, _ := json.Marshal(localServer)
 	snapshot.ServerMessages = append(snapshot.ServerMessages, localData)
+	if !localNode.Hidden {
+		localServer.Total = publicTotal
+		config.Visibility.redactUpdate(&localServer.Server)
+		localData, _ = json.Marshal(localServer)
+		publicSnapshot.ServerMessages = append(publicSnapshot.ServerMessages, localData)
+	}
 
 	// Build remote server messages
 	index := 1
 	for _, server := range config.Servers {
 		metricsData := agentMetrics[server.ID]
-		online := false
-		if metricsData != nil {
-			online = time.Since(metricsData.LastUpdated).Seconds() < 30
-		}
+		online := isAgentOnline(&server, metricsData, time.Now())
 
 		version := server.Version
 		if metricsData != nil && metricsData.Metrics.Version != "" {
@@ -354,19 +418,31 @@ func (s *AppState) RefreshSnapshot() {
 		serverData, _ := json.Marshal(serverMsg)
 		snapshot.ServerMessages = append(snapshot.ServerMessages, serverData)
 		index++
+
+		if !server.Hidden {
+			serverMsg.Index = len(publicSnapshot.ServerMessages)
+			serverMsg.Total = publicTotal
+			config.Visibility.redactUpdate(&serverMsg.Server)
+			serverData, _ = json.Marshal(serverMsg)
+			publicSnapshot.ServerMessages = append(publicSnapshot.ServerMessages, serverData)
+		}
 	}
 
 	// Build end message
 	endMsg := StreamEndMessage{Type: "stream_end"}
 	snapshot.EndMessage, _ = json.Marshal(endMsg)
+	publicSnapshot.EndMessage = snapshot.EndMessage
 
 	// Atomically replace snapshot
 	s.SnapshotMu.Lock()
 	s.Snapshot = snapshot
+	s.PublicSnapshot = publicSnapshot
 	s.SnapshotMu.Unlock()
 }
 
-func (s *AppState) BroadcastMetrics(msg string) {
+// BroadcastDelta sends delta updates to the dashboards, each getting only the servers it sees;
+// hidden reports the servers left out for visitors who are not logged in
+func (s *AppState) BroadcastDelta(msg DeltaMessage, hidden func(serverID string) bool) {
 	s.DashboardMu.RLock()
 	clients := make([]*DashboardClient, 0, len(s.DashboardClients))
 	for _, client := range s.DashboardClients {
@@ -376,10 +452,29 @@ func (s *AppState) BroadcastMetrics(msg string) {
 	}
 	s.DashboardMu.RUnlock()
 
-	msgBytes := []byte(msg)
+	var full, public []byte
 	for _, client := range clients {
+		var data []byte
+		switch {
+		case !client.Public:
+			if full == nil {
+				full = filterDelta(msg, func(string) bool { return true })
+			}
+			data = full
+		case client.Scope == nil:
+			if public == nil {
+				public = filterDelta(msg, func(id string) bool { return !hidden(id) })
+			}
+			data = public
+		default:
+			data = filterDelta(msg, func(id string) bool { return client.Scope[id] })
+		}
+		if len(data) == 0 {
+			continue
+		}
+
 		client.WriteMu.Lock()
-		err := client.Conn.WriteMessage(websocket.TextMessage, msgBytes)
+		err := client.Conn.WriteMessage(websocket.TextMessage, data)
 		client.WriteMu.Unlock()
 
 		if err != nil {
@@ -391,6 +486,22 @@ func (s *AppState) BroadcastMetrics(msg string) {
 	}
 }
 
+// filterDelta serializes the updates of msg for the servers keep accepts; the result is empty,
+// but not nil, when there are none
+func filterDelta(msg DeltaMessage, keep func(serverID string) bool) []byte {
+	filtered := DeltaMessage{Type: msg.Type, Ts: msg.Ts}
+	for _, update := range msg.D {
+		if keep(update.ID) {
+			filtered.D = append(filtered.D, update)
+		}
+	}
+	if len(filtered.D) == 0 {
+		return []byte{}
+	}
+	data, _ := json.Marshal(filtered)
+	return data
+}
+
 // ============================================================================
 // Agent WebSocket Handler
 // ============================================================================
@@ -451,7 +562,7 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 							// Update version
 							if agentMsg.Version != "" && server.Version != agentMsg.Version {
 								server.Version = agentMsg.Version
-								SaveConfig(s.Config)
+								UpdateServerAgentInfo(s.DB, server.ID, server.Version, server.IP)
 							}
 
 							// Register connection
@@ -461,6 +572,7 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 								SendChan: sendChan,
 							}
 							s.AgentConnsMu.Unlock()
+							s.Connectivity.AgentConnected(agentMsg.ServerID, clientIP)
 
 							// Send auth success with probe config and last data time
 							response := map[string]interface{}{
@@ -521,7 +633,7 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 							changed = true
 						}
 						if changed {
-							SaveConfig(s.Config)
+							UpdateServerAgentInfo(s.DB, authenticatedServerID, s.Config.Servers[i].Version, s.Config.Servers[i].IP)
 						}
 						break
 					}
@@ -571,6 +683,8 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 			if len(agentMsg.Granularities) > 0 {
 				StoreMultiGranularityMetrics(authenticatedServerID, agentMsg.Granularities)
 			}
+			// The agent aggregates itself, so the server-side rollup skips it
+			s.Rollups.MarkAggregated(authenticatedServerID, time.Now())
 
 			// Update in-memory state with last metrics if provided
 			if agentMsg.LastMetrics != nil {
@@ -592,6 +706,7 @@ func (s *AppState) HandleAgentWS(c *gin.Context) {
 		s.AgentConnsMu.Lock()
 		delete(s.AgentConns, authenticatedServerID)
 		s.AgentConnsMu.Unlock()
+		s.Connectivity.AgentDisconnected(authenticatedServerID)
 	}
 }
 
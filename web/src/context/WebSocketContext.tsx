@@ -214,10 +214,31 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
 
   // Global WebSocket connection - persists across page navigations
   useEffect(() => {
-    const connect = () => {
+    let disposed = false;
+    const connect = async () => {
       try {
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${protocol}//${window.location.host}/ws`;
+        // Logged-in users exchange their token for a one-time ticket to also see hidden servers
+        // and redacted fields; the token itself must not end up in URLs
+        let ticket = '';
+        const authToken = localStorage.getItem('vstats_token');
+        if (authToken) {
+          try {
+            const res = await fetch('/api/auth/ws-ticket', {
+              method: 'POST',
+              headers: { 'Authorization': `Bearer ${authToken}` }
+            });
+            if (res.ok) {
+              ticket = (await res.json()).ticket ?? '';
+            }
+          } catch {
+            // Fall back to the public view
+          }
+        }
+        if (disposed) {
+          return;
+        }
+        const wsUrl = `${protocol}//${window.location.host}/ws${ticket ? `?ticket=${encodeURIComponent(ticket)}` : ''}`;
 
         const ws = new WebSocket(wsUrl);
         wsRef.current = ws;
@@ -499,6 +520,7 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
 
     // Cleanup only when the entire app unmounts (not on page navigation)
     return () => {
+      disposed = true;
       if (reconnectTimeoutRef.current) {
         clearTimeout(reconnectTimeoutRef.current);
       }
@@ -176,7 +176,10 @@ function HistoryChart({ serverId }: { serverId: string }) {
     setError(null);
     
     try {
-      const res = await fetch(`/api/history/${serverId}?range=${range}&type=${dataType}`);
+      const authToken = localStorage.getItem('vstats_token');
+      const res = await fetch(`/api/history/${serverId}?range=${range}&type=${dataType}`, {
+        headers: authToken ? { 'Authorization': `Bearer ${authToken}` } : undefined
+      });
       if (!res.ok) throw new Error('Failed to fetch history');
       const json: HistoryResponse = await res.json();
       
@@ -728,7 +728,9 @@ export default function Settings() {
   
   const fetchAgentStatus = async () => {
     try {
-      const res = await fetch('/api/metrics/all');
+      const res = await fetch('/api/metrics/all', {
+        headers: { 'Authorization': `Bearer ${token}` }
+      });
       if (res.ok) {
         const data = await res.json();
         const status: Record<string, boolean> = {};
@@ -1512,7 +1514,9 @@ export default function Settings() {
 
   const fetchServers = async () => {
     try {
-      const res = await fetch('/api/servers');
+      const res = await fetch('/api/servers', {
+        headers: { 'Authorization': `Bearer ${token}` }
+      });
       if (res.ok) {
         const data = await res.json();
         setServers(data);